@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/earlysvahn/sidekick/internal/agent"
@@ -99,6 +100,9 @@ func runAgentsShowCommand(args []string) error {
 		"model":             a.Model,
 		"system_prompt":     a.SystemPrompt,
 		"default_verbosity": a.DefaultVerbosity,
+		"verbosity_bias":    a.VerbosityBias,
+		"min_verbosity":     a.MinVerbosity,
+		"max_verbosity":     a.MaxVerbosity,
 		"enabled":           a.Enabled,
 		"revision":          a.Revision,
 		"updated_at":        a.UpdatedAt.Format(time.RFC3339),
@@ -144,6 +148,9 @@ func runAgentsCreateCommand(args []string) error {
 		Model            string  `json:"model"`
 		SystemPrompt     string  `json:"system_prompt"`
 		DefaultVerbosity int     `json:"default_verbosity"`
+		VerbosityBias    int     `json:"verbosity_bias"`
+		MinVerbosity     int     `json:"min_verbosity"`
+		MaxVerbosity     *int    `json:"max_verbosity"`
 		Enabled          bool    `json:"enabled"`
 	}
 
@@ -174,6 +181,9 @@ func runAgentsCreateCommand(args []string) error {
 		Model:            input.Model,
 		SystemPrompt:     input.SystemPrompt,
 		DefaultVerbosity: input.DefaultVerbosity,
+		VerbosityBias:    input.VerbosityBias,
+		MinVerbosity:     input.MinVerbosity,
+		MaxVerbosity:     input.MaxVerbosity,
 		Enabled:          input.Enabled,
 	}
 
@@ -200,20 +210,29 @@ func runAgentsUpdateCommand(args []string) error {
 
 	fs := flag.NewFlagSet("agents update", flag.ExitOnError)
 	var filePath string
+	var bias, minVerbosity int
+	var maxVerbosity string
 	fs.StringVar(&filePath, "file", "", "path to JSON file")
+	fs.IntVar(&bias, "bias", 0, "added to the requested verbosity (-4 to 4)")
+	fs.IntVar(&minVerbosity, "min-verbosity", 0, "lowest verbosity the agent answers at")
+	fs.StringVar(&maxVerbosity, "max-verbosity", "", "highest verbosity the agent answers at, or 'none'")
 	if err := fs.Parse(args[1:]); err != nil {
 		return err
 	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
 	var data []byte
 	var err error
 
+	// JSON is read from stdin unless only verbosity flags are given
+	onlyFlags := filePath == "" && (set["bias"] || set["min-verbosity"] || set["max-verbosity"])
 	if filePath != "" {
 		data, err = os.ReadFile(filePath)
 		if err != nil {
 			return fmt.Errorf("read file: %w", err)
 		}
-	} else {
+	} else if !onlyFlags {
 		data, err = io.ReadAll(os.Stdin)
 		if err != nil {
 			return fmt.Errorf("read stdin: %w", err)
@@ -221,8 +240,10 @@ func runAgentsUpdateCommand(args []string) error {
 	}
 
 	var input map[string]interface{}
-	if err := json.Unmarshal(data, &input); err != nil {
-		return fmt.Errorf("parse json: %w", err)
+	if !onlyFlags {
+		if err := json.Unmarshal(data, &input); err != nil {
+			return fmt.Errorf("parse json: %w", err)
+		}
 	}
 
 	database, err := db.OpenSQLite()
@@ -263,6 +284,37 @@ func runAgentsUpdateCommand(args []string) error {
 			existing.BaseAgent = &ba
 		}
 	}
+	if bias, ok := input["verbosity_bias"].(float64); ok {
+		existing.VerbosityBias = int(bias)
+	}
+	if v, ok := input["min_verbosity"].(float64); ok {
+		existing.MinVerbosity = int(v)
+	}
+	if v, ok := input["max_verbosity"]; ok {
+		if v == nil {
+			existing.MaxVerbosity = nil
+		} else if n, ok := v.(float64); ok {
+			m := int(n)
+			existing.MaxVerbosity = &m
+		}
+	}
+	if set["bias"] {
+		existing.VerbosityBias = bias
+	}
+	if set["min-verbosity"] {
+		existing.MinVerbosity = minVerbosity
+	}
+	if set["max-verbosity"] {
+		if maxVerbosity == "none" {
+			existing.MaxVerbosity = nil
+		} else {
+			m, err := strconv.Atoi(maxVerbosity)
+			if err != nil {
+				return fmt.Errorf("--max-verbosity must be a number or 'none'")
+			}
+			existing.MaxVerbosity = &m
+		}
+	}
 
 	if err := repo.Update(existing); err != nil {
 		return fmt.Errorf("update agent: %w", err)
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/audit"
+	"github.com/earlysvahn/sidekick/internal/db"
+)
+
+// auditPollInterval is how often 'audit tail --follow' checks for new events.
+const auditPollInterval = 2 * time.Second
+
+// RunAuditCommand handles the 'audit' subcommand. Like 'users', it reads
+// Postgres directly (SIDEKICK_POSTGRES_DSN).
+func RunAuditCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("audit command requires a subcommand: tail")
+	}
+
+	switch args[0] {
+	case "tail":
+		return runAuditTailCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown audit subcommand: %s", args[0])
+	}
+}
+
+// runAuditTailCommand prints the latest events oldest-first and, with
+// --follow, keeps polling for new ones until interrupted.
+func runAuditTailCommand(args []string) error {
+	fs := flag.NewFlagSet("audit tail", flag.ExitOnError)
+	var limit int
+	var follow, asJSON bool
+	var action, actor string
+	fs.IntVar(&limit, "n", 20, "number of events to show")
+	fs.BoolVar(&follow, "follow", false, "keep printing new events")
+	fs.BoolVar(&follow, "f", false, "shorthand for --follow")
+	fs.StringVar(&action, "action", "", "filter by action (prefix when ending in * or .)")
+	fs.StringVar(&actor, "actor", "", "filter by actor id or email")
+	fs.BoolVar(&asJSON, "json", false, "print events as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database, err := db.OpenPostgres()
+	if err != nil {
+		return fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	defer database.Close()
+
+	if err := audit.InitSchema(database); err != nil {
+		return fmt.Errorf("init audit schema: %w", err)
+	}
+
+	filter := audit.Filter{Action: action, Actor: actor, Limit: limit}
+	events, err := audit.Query(database, filter)
+	if err != nil {
+		return err
+	}
+
+	var lastID int64
+	for i := len(events) - 1; i >= 0; i-- {
+		printAuditEvent(events[i], asJSON)
+		lastID = events[i].ID
+	}
+	if !follow {
+		return nil
+	}
+
+	return followAudit(database, filter, lastID, asJSON)
+}
+
+func followAudit(database *sql.DB, filter audit.Filter, lastID int64, asJSON bool) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(auditPollInterval)
+	defer ticker.Stop()
+
+	filter.Limit = 0
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+
+		filter.AfterID = lastID
+		events, err := audit.Query(database, filter)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			printAuditEvent(ev, asJSON)
+			lastID = ev.ID
+		}
+	}
+}
+
+func printAuditEvent(ev audit.Event, asJSON bool) {
+	if asJSON {
+		data, _ := json.Marshal(ev)
+		fmt.Println(string(data))
+		return
+	}
+
+	actor := ev.ActorEmail
+	if actor == "" {
+		actor = ev.ActorID
+	}
+	if actor == "" {
+		actor = "-"
+	}
+	target := "-"
+	if ev.TargetType != "" {
+		target = ev.TargetType + ":" + ev.TargetID
+	}
+	line := fmt.Sprintf("%s  %-24s %-30s %-40s %s",
+		ev.OccurredAt.Local().Format("2006-01-02 15:04:05"), ev.Action, actor, target, ev.IP)
+	if len(ev.Diff) > 0 {
+		data, _ := json.Marshal(ev.Diff)
+		line += "  " + string(data)
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,439 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/cli"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+// batchItem is one line of a batch input file. Only prompt is required; id
+// defaults to the line number and is what a resumed run matches results on.
+type batchItem struct {
+	ID        string   `json:"id,omitempty"`
+	Prompt    string   `json:"prompt"`
+	Agent     string   `json:"agent,omitempty"`
+	Verbosity *int     `json:"verbosity,omitempty"`
+	Context   string   `json:"context,omitempty"`
+	Files     []string `json:"files,omitempty"`
+
+	line int
+}
+
+// batchResult is one line of a batch output file. Results are written in
+// the order they finish.
+type batchResult struct {
+	ID                 string         `json:"id"`
+	Line               int            `json:"line"`
+	Reply              string         `json:"reply,omitempty"`
+	Source             string         `json:"source,omitempty"`
+	Agent              string         `json:"agent"`
+	Model              string         `json:"model,omitempty"`
+	Context            string         `json:"context,omitempty"`
+	EffectiveVerbosity int            `json:"effective_verbosity"`
+	MatchedKeywords    []string       `json:"matched_keywords,omitempty"`
+	Warnings           []string       `json:"warnings,omitempty"`
+	Usage              executor.Usage `json:"usage"`
+	LatencyMS          int64          `json:"latency_ms"`
+	Error              string         `json:"error,omitempty"`
+}
+
+// batchRunner holds what every prompt of a batch shares.
+type batchRunner struct {
+	fallback      executor.FallbackConfig
+	historyLimit  int
+	defaultAgent  string // for prompts without an agent; "" is the default profile
+	tokenLimit    int
+	historyStore  store.HistoryStore // nil when no prompt names a context
+	keywordStore  store.VerbosityKeywordLister
+	keywordUserID string
+
+	// historyMu serializes history reads and writes; the file backend
+	// rewrites whole contexts.
+	historyMu sync.Mutex
+}
+
+// RunBatchCommand handles 'sidekick batch in.jsonl --out out.jsonl': runs
+// every prompt of a JSONL file and writes one JSON result per line. Prompts
+// that already have a successful result in the output file are skipped, so
+// an interrupted run can be resumed with the same command.
+func RunBatchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	outPath := fs.String("out", "", "output JSONL file (appended to when resuming)")
+	concurrency := fs.Int("concurrency", 1, "number of prompts to run at once")
+	modelOverride := fs.String("model", "", "force a specific Ollama model")
+	localOnly := fs.Bool("local", false, "force local Ollama execution")
+	remoteOnly := fs.Bool("remote", false, "force remote execution")
+	storageBackend := fs.String("storage", cliConfig.Storage, "storage backend for prompts with a context (file|sqlite|postgres)")
+	historyLimit := fs.Int("history", cliConfig.History, "number of prior messages to include for prompts with a context")
+	tokenLimit := fs.Int("token-limit", executor.DefaultTokenLimit, "largest request in estimated tokens, prompt plus reply budget")
+	quiet := fs.Bool("quiet", false, "suppress progress lines")
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *outPath == "" {
+		return fmt.Errorf("usage: sidekick batch in.jsonl --out out.jsonl [--concurrency N]")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+
+	items, err := readBatchItems(positional[0])
+	if err != nil {
+		return err
+	}
+	done, err := resumeBatchOutput(*outPath)
+	if err != nil {
+		return err
+	}
+	var pending []batchItem
+	for _, item := range items {
+		if !done[item.ID] {
+			pending = append(pending, item)
+		}
+	}
+	skipped := len(items) - len(pending)
+
+	remoteURL := cliConfig.RemoteURL
+	runner := &batchRunner{
+		fallback: executor.FallbackConfig{
+			ModelOverride: *modelOverride,
+			RemoteURL:     remoteURL,
+			LocalOnly:     *localOnly,
+			RemoteOnly:    *remoteOnly,
+			RemoteTimeout: cliConfig.RemoteTimeout,
+		},
+		historyLimit: *historyLimit,
+		defaultAgent: cliConfig.Agent,
+		tokenLimit:   *tokenLimit,
+	}
+	for _, item := range pending {
+		if item.Context != "" {
+			if runner.historyStore, err = CreateHistoryStore(*storageBackend); err != nil {
+				return fmt.Errorf("storage error: %w", err)
+			}
+			break
+		}
+	}
+	var closeKeywords func() error
+	runner.keywordStore, runner.keywordUserID, closeKeywords = resolveKeywordLister(runner.historyStore)
+	defer closeKeywords()
+
+	out, err := os.OpenFile(*outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open output: %w", err)
+	}
+	defer out.Close()
+
+	if skipped > 0 && !*quiet {
+		fmt.Fprintf(os.Stderr, "[batch] resuming: %d of %d prompts already done\n", skipped, len(items))
+	}
+
+	var (
+		mu       sync.Mutex
+		results  []batchResult
+		writeErr error
+		wg       sync.WaitGroup
+	)
+	encoder := json.NewEncoder(out)
+	groups := groupBatchItems(pending)
+	queue := make(chan []batchItem)
+	for i := 0; i < min(*concurrency, max(len(groups), 1)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				for _, item := range group {
+					result := runner.run(item)
+
+					mu.Lock()
+					if err := encoder.Encode(result); err != nil && writeErr == nil {
+						writeErr = fmt.Errorf("write output: %w", err)
+					}
+					results = append(results, result)
+					if !*quiet {
+						status := "ok"
+						if result.Error != "" {
+							status = "failed: " + result.Error
+						}
+						fmt.Fprintf(os.Stderr, "[batch] %d/%d %s %s (%dms)\n", len(results), len(pending), result.ID, status, result.LatencyMS)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	wg.Wait()
+
+	if writeErr != nil {
+		return writeErr
+	}
+	failed := printBatchSummary(os.Stdout, results, len(items), skipped, *outPath)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d prompts failed; run the same command again to retry them", failed, len(results))
+	}
+	return nil
+}
+
+// groupBatchItems splits items into units of work for the workers. Items
+// sharing a context form one group in input order, so each sees the history
+// the previous one left; other items run on their own.
+func groupBatchItems(items []batchItem) [][]batchItem {
+	var groups [][]batchItem
+	byContext := make(map[string]int)
+	for _, item := range items {
+		if item.Context == "" {
+			groups = append(groups, []batchItem{item})
+			continue
+		}
+		if i, ok := byContext[item.Context]; ok {
+			groups[i] = append(groups[i], item)
+			continue
+		}
+		byContext[item.Context] = len(groups)
+		groups = append(groups, []batchItem{item})
+	}
+	return groups
+}
+
+// run executes one prompt. Failures are reported in the result rather than
+// stopping the batch.
+func (r *batchRunner) run(item batchItem) batchResult {
+	result := batchResult{ID: item.ID, Line: item.line, Agent: item.Agent, Context: item.Context}
+	if result.Agent == "" {
+		result.Agent = r.defaultAgent
+	}
+	if result.Agent == "" {
+		result.Agent = "default"
+	}
+	if err := r.execute(item, &result); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (r *batchRunner) execute(item batchItem, result *batchResult) error {
+	profile := agent.GetProfile(result.Agent)
+	if profile == nil {
+		return fmt.Errorf("unknown agent profile: %s", result.Agent)
+	}
+
+	attachments, err := cli.ReadAttachments(item.Files, nil, r.tokenLimit*executor.CharsPerToken)
+	if err != nil {
+		return err
+	}
+	prompt := cli.BuildPrompt(item.Prompt, attachments)
+
+	var system string
+	var history []store.Message
+	if item.Context != "" {
+		r.historyMu.Lock()
+		ctxHist, err := r.historyStore.LoadContext(item.Context)
+		r.historyMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("history error: %w", err)
+		}
+		system = ctxHist.System
+		history = ctxHist.Messages
+	}
+	if profile.SystemPrompt != "" {
+		system = profile.SystemPrompt
+	}
+
+	// Verbosity rules see only the item's prompt, not its files
+	escalation, err := executor.ResolveVerbosity(context.Background(), item.Verbosity, executor.DefaultVerbosity(), result.Agent, profile, item.Prompt, r.keywordUserID, r.keywordStore)
+	if err != nil {
+		return fmt.Errorf("verbosity escalation error: %w", err)
+	}
+	result.EffectiveVerbosity = escalation.EffectiveVerbosity
+	result.MatchedKeywords = escalation.MatchedKeywords
+	if escalation.Warning != "" {
+		result.Warnings = append(result.Warnings, escalation.Warning)
+	}
+	if constraint := executor.SystemConstraint(escalation.EffectiveVerbosity); constraint != "" {
+		if system != "" {
+			system += "\n\n" + constraint
+		} else {
+			system = constraint
+		}
+	}
+
+	messages := chat.BuildMessages(system, history, r.historyLimit, prompt)
+	if budget := executor.EstimateTokenBudget(messages, escalation.EffectiveVerbosity); budget.EstimatedPromptTokens+max(budget.MaxCompletionTokens, 0) > r.tokenLimit {
+		return fmt.Errorf("request too large: about %d prompt tokens plus a %d-token reply exceed the %d-token limit",
+			budget.EstimatedPromptTokens, max(budget.MaxCompletionTokens, 0), r.tokenLimit)
+	}
+
+	cfg := r.fallback
+	cfg.Profile = profile
+	cfg.Verbosity = escalation.EffectiveVerbosity
+	execResult, err := executor.ExecuteWithFallback(cfg, messages)
+	result.LatencyMS = execResult.Latency.Milliseconds()
+	if err != nil {
+		return err
+	}
+	result.Reply = execResult.Reply
+	result.Source = execResult.Source
+	result.Model = execResult.Model
+	result.Usage = execResult.Usage
+
+	if item.Context != "" {
+		now := time.Now().UTC()
+		verbosity := escalation.EffectiveVerbosity
+		r.historyMu.Lock()
+		defer r.historyMu.Unlock()
+		_ = r.historyStore.Append(item.Context, store.Message{Role: "user", Content: prompt, Time: now, Files: cli.AttachmentNames(attachments)})
+		_ = r.historyStore.Append(item.Context, store.Message{
+			Role:             "assistant",
+			Content:          execResult.Reply,
+			Agent:            &result.Agent,
+			Verbosity:        &verbosity,
+			Time:             now,
+			Model:            execResult.Model,
+			Source:           execResult.Source,
+			Keywords:         escalation.MatchedKeywords,
+			PromptTokens:     execResult.Usage.PromptTokens,
+			CompletionTokens: execResult.Usage.CompletionTokens,
+			LatencyMS:        execResult.Latency.Milliseconds(),
+		})
+	}
+	return nil
+}
+
+// readBatchItems parses a batch input file, skipping blank lines.
+func readBatchItems(path string) ([]batchItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []batchItem
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var item batchItem
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if strings.TrimSpace(item.Prompt) == "" {
+			return nil, fmt.Errorf("%s:%d: prompt required", path, line)
+		}
+		item.line = line
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		if first, ok := seen[item.ID]; ok {
+			return nil, fmt.Errorf("%s:%d: id %q already used on line %d", path, line, item.ID, first)
+		}
+		seen[item.ID] = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return items, nil
+}
+
+// resumeBatchOutput returns the ids that already have a successful result
+// in an existing output file. A last line cut short by an interrupted run is
+// removed so appended results start on a fresh line.
+func resumeBatchOutput(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete < len(data) {
+		if err := os.Truncate(path, int64(complete)); err != nil {
+			return nil, fmt.Errorf("truncate partial line: %w", err)
+		}
+		data = data[:complete]
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var result batchResult
+		if err := decoder.Decode(&result); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s is not a batch output file: %w", path, err)
+		}
+		// A retried prompt has a failed line followed by a later one
+		done[result.ID] = done[result.ID] || result.Error == ""
+	}
+	return done, nil
+}
+
+// printBatchSummary writes counts, latency and token totals for a run and
+// lists its failures. Returns the number of failures.
+func printBatchSummary(w io.Writer, results []batchResult, total, skipped int, outPath string) int {
+	var failures []batchResult
+	var latencies []time.Duration
+	var usage executor.Usage
+	for _, r := range results {
+		if r.Error != "" {
+			failures = append(failures, r)
+			continue
+		}
+		latencies = append(latencies, time.Duration(r.LatencyMS)*time.Millisecond)
+		usage.PromptTokens += r.Usage.PromptTokens
+		usage.CompletionTokens += r.Usage.CompletionTokens
+	}
+
+	fmt.Fprintf(w, "Batch complete: %d prompts, %d run, %d succeeded, %d failed", total, len(results), len(results)-len(failures), len(failures))
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d already in %s", skipped, outPath)
+	}
+	fmt.Fprintln(w)
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var sum time.Duration
+		for _, l := range latencies {
+			sum += l
+		}
+		percentile := func(p float64) time.Duration {
+			return latencies[int(p*float64(len(latencies)-1))]
+		}
+		fmt.Fprintf(w, "Latency: avg %s, p50 %s, p95 %s, max %s\n",
+			(sum / time.Duration(len(latencies))).Round(time.Millisecond), percentile(0.5), percentile(0.95), latencies[len(latencies)-1])
+		fmt.Fprintf(w, "Tokens: %d prompt + %d completion = %d\n", usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens())
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Line < failures[j].Line })
+		fmt.Fprintln(w, "Failures:")
+		for _, r := range failures {
+			fmt.Fprintf(w, "  line %d (id %s): %s\n", r.Line, r.ID, r.Error)
+		}
+	}
+	return len(failures)
+}
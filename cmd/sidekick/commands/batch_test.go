@@ -0,0 +1,310 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/executor"
+)
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBatchItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		ids     []string
+		wantErr string
+	}{
+		{
+			name:  "ids default to the line number",
+			input: `{"prompt":"a"}` + "\n\n" + `{"id":"x","prompt":"b"}` + "\n" + `{"prompt":"c"}`,
+			ids:   []string{"1", "x", "4"},
+		},
+		{
+			name:    "duplicate id",
+			input:   `{"id":"x","prompt":"a"}` + "\n" + `{"id":"x","prompt":"b"}` + "\n",
+			wantErr: `:2: id "x" already used on line 1`,
+		},
+		{
+			name:    "explicit id clashing with a line number",
+			input:   `{"id":"2","prompt":"a"}` + "\n" + `{"prompt":"b"}` + "\n",
+			wantErr: `:2: id "2" already used on line 1`,
+		},
+		{
+			name:    "missing prompt",
+			input:   `{"prompt":"a"}` + "\n" + `{"id":"b","prompt":"  "}` + "\n",
+			wantErr: ":2: prompt required",
+		},
+		{
+			name:    "invalid JSON",
+			input:   `{"prompt":"a"` + "\n",
+			wantErr: ":1:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := readBatchItems(writeTemp(t, "in.jsonl", tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+func TestResumeBatchOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		done     map[string]bool
+		leftover string // file content after resuming
+		wantErr  string
+	}{
+		{
+			name:     "empty file",
+			output:   "",
+			done:     map[string]bool{},
+			leftover: "",
+		},
+		{
+			name:     "failed then succeeded",
+			output:   `{"id":"a","error":"boom"}` + "\n" + `{"id":"a","reply":"ok"}` + "\n",
+			done:     map[string]bool{"a": true},
+			leftover: `{"id":"a","error":"boom"}` + "\n" + `{"id":"a","reply":"ok"}` + "\n",
+		},
+		{
+			name:     "succeeded then failed",
+			output:   `{"id":"a","reply":"ok"}` + "\n" + `{"id":"a","error":"boom"}` + "\n",
+			done:     map[string]bool{"a": true},
+			leftover: `{"id":"a","reply":"ok"}` + "\n" + `{"id":"a","error":"boom"}` + "\n",
+		},
+		{
+			name:     "only failed",
+			output:   `{"id":"a","error":"boom"}` + "\n" + `{"id":"b","reply":"ok"}` + "\n",
+			done:     map[string]bool{"a": false, "b": true},
+			leftover: `{"id":"a","error":"boom"}` + "\n" + `{"id":"b","reply":"ok"}` + "\n",
+		},
+		{
+			name:     "truncated last line",
+			output:   `{"id":"a","reply":"ok"}` + "\n" + `{"id":"b","rep`,
+			done:     map[string]bool{"a": true},
+			leftover: `{"id":"a","reply":"ok"}` + "\n",
+		},
+		{
+			name:    "not a batch output",
+			output:  "hello\n",
+			wantErr: "is not a batch output file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTemp(t, "out.jsonl", tt.output)
+			done, err := resumeBatchOutput(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(done, tt.done) {
+				t.Errorf("done = %v, want %v", done, tt.done)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.leftover {
+				t.Errorf("file = %q, want %q", b, tt.leftover)
+			}
+		})
+	}
+
+	done, err := resumeBatchOutput(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || len(done) != 0 {
+		t.Errorf("missing file: done = %v, err = %v, want nothing done", done, err)
+	}
+}
+
+func TestPrintBatchSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []batchResult
+		total   int
+		skipped int
+		failed  int
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "all succeeded",
+			results: []batchResult{
+				{ID: "a", Line: 1, LatencyMS: 100, Usage: executor.Usage{PromptTokens: 10, CompletionTokens: 5}},
+				{ID: "b", Line: 2, LatencyMS: 300, Usage: executor.Usage{PromptTokens: 20, CompletionTokens: 15}},
+			},
+			total: 2,
+			want: []string{
+				"Batch complete: 2 prompts, 2 run, 2 succeeded, 0 failed\n",
+				"Latency: avg 200ms, p50 100ms, p95 100ms, max 300ms\n",
+				"Tokens: 30 prompt + 20 completion = 50\n",
+			},
+			notWant: []string{"Failures:", "already in"},
+		},
+		{
+			name: "failures sorted by line and left out of totals",
+			results: []batchResult{
+				{ID: "c", Line: 3, Error: "timeout", LatencyMS: 900, Usage: executor.Usage{PromptTokens: 99}},
+				{ID: "a", Line: 1, LatencyMS: 50, Usage: executor.Usage{PromptTokens: 1, CompletionTokens: 2}},
+				{ID: "b", Line: 2, Error: "unknown agent profile: x"},
+			},
+			total:   4,
+			skipped: 1,
+			failed:  2,
+			want: []string{
+				"Batch complete: 4 prompts, 3 run, 1 succeeded, 2 failed, 1 already in out.jsonl\n",
+				"max 50ms",
+				"Tokens: 1 prompt + 2 completion = 3\n",
+				"Failures:\n  line 2 (id b): unknown agent profile: x\n  line 3 (id c): timeout\n",
+			},
+		},
+		{
+			name:    "nothing succeeded",
+			results: []batchResult{{ID: "a", Line: 1, Error: "boom"}},
+			total:   1,
+			failed:  1,
+			want:    []string{"0 succeeded, 1 failed", "Failures:"},
+			notWant: []string{"Latency:", "Tokens:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if failed := printBatchSummary(&buf, tt.results, tt.total, tt.skipped, "out.jsonl"); failed != tt.failed {
+				t.Errorf("failed = %d, want %d", failed, tt.failed)
+			}
+			out := buf.String()
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("summary missing %q:\n%s", w, out)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(out, w) {
+					t.Errorf("summary has %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupBatchItems(t *testing.T) {
+	items := []batchItem{
+		{ID: "1", Context: "a"},
+		{ID: "2"},
+		{ID: "3", Context: "b"},
+		{ID: "4", Context: "a"},
+		{ID: "5"},
+		{ID: "6", Context: "a"},
+	}
+	var got [][]string
+	for _, group := range groupBatchItems(items) {
+		var ids []string
+		for _, item := range group {
+			ids = append(ids, item.ID)
+		}
+		got = append(got, ids)
+	}
+	want := [][]string{{"1", "4", "6"}, {"2"}, {"3"}, {"5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestBatchVerbosityRulesIgnoreFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fakeOllama(t, "ok")
+	putRules(t, verbosityRulesIgnoringAttachments...)
+
+	line, err := json.Marshal(map[string]any{"prompt": "explain this", "verbosity": 1, "files": []string{writeAttachment(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := writeTemp(t, "in.jsonl", string(line)+"\n")
+	outPath := filepath.Join(t.TempDir(), "out.jsonl")
+	if _, err := captureStdout(t, func() error {
+		return RunBatchCommand([]string{in, "--out", outPath, "--local", "--quiet"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result batchResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatalf("output %q: %v", b, err)
+	}
+	if result.EffectiveVerbosity != 3 || !reflect.DeepEqual(result.MatchedKeywords, []string{"this"}) {
+		t.Errorf("verbosity = %d from %v, want 3 from the code-block-free rule only", result.EffectiveVerbosity, result.MatchedKeywords)
+	}
+}
+
+func TestBatchDefaultsToConfiguredAgent(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fakeOllama(t, "ok")
+	saved := cliConfig
+	t.Cleanup(func() { cliConfig = saved })
+	cliConfig.Agent = "golang-dev"
+
+	in := writeTemp(t, "in.jsonl", `{"id":"a","prompt":"hi"}`+"\n"+`{"id":"b","prompt":"hi","agent":"code"}`+"\n")
+	outPath := filepath.Join(t.TempDir(), "out.jsonl")
+	if _, err := captureStdout(t, func() error {
+		return RunBatchCommand([]string{in, "--out", outPath, "--local", "--quiet"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var result batchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("output %q: %v", line, err)
+		}
+		agents[result.ID] = result.Agent
+	}
+	if want := map[string]string{"a": "golang-dev", "b": "code"}; !reflect.DeepEqual(agents, want) {
+		t.Errorf("agents = %v, want %v", agents, want)
+	}
+}
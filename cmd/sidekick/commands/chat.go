@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,8 +14,8 @@ import (
 	"github.com/earlysvahn/sidekick/internal/agent"
 	"github.com/earlysvahn/sidekick/internal/chat"
 	"github.com/earlysvahn/sidekick/internal/cli"
-	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/render"
 	"github.com/earlysvahn/sidekick/internal/store"
 )
 
@@ -34,21 +35,21 @@ func RunChatCommand(args []string) error {
 	var verbosity int
 
 	fs.StringVar(&modelOverride, "model", "", "force a specific Ollama model")
-	fs.StringVar(&contextName, "context", "misc", "context|ctx: context name")
-	fs.StringVar(&contextName, "ctx", "misc", "")
-	fs.IntVar(&historyLimit, "history", 4, "history|h: number of prior messages to include")
-	fs.IntVar(&historyLimit, "h", 4, "")
+	fs.StringVar(&contextName, "context", cliConfig.Context, "context|ctx: context name")
+	fs.StringVar(&contextName, "ctx", cliConfig.Context, "")
+	fs.IntVar(&historyLimit, "history", cliConfig.History, "history|h: number of prior messages to include")
+	fs.IntVar(&historyLimit, "h", cliConfig.History, "")
 	fs.StringVar(&systemPrompt, "system", "", "system|sp: system prompt for this context")
 	fs.StringVar(&systemPrompt, "sp", "", "")
-	fs.StringVar(&agentProfile, "agent", "", "agent|a: agent profile (code, golang-dev, etc)")
-	fs.StringVar(&agentProfile, "a", "", "")
+	fs.StringVar(&agentProfile, "agent", cliConfig.Agent, "agent|a: agent profile (code, golang-dev, etc)")
+	fs.StringVar(&agentProfile, "a", cliConfig.Agent, "")
 	fs.BoolVar(&localOnly, "local", false, "force local Ollama execution")
 	fs.BoolVar(&remoteOnly, "remote", false, "force remote execution")
 	fs.BoolVar(&quiet, "quiet", false, "suppress non-error logs")
-	fs.StringVar(&storageBackend, "storage", "file", "storage|s: storage backend (file|sqlite)")
-	fs.StringVar(&storageBackend, "s", "file", "")
-	fs.IntVar(&verbosity, "verbosity", -1, "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
-	fs.IntVar(&verbosity, "v", -1, "")
+	fs.StringVar(&storageBackend, "storage", cliConfig.Storage, "storage|s: storage backend (file|sqlite|postgres)")
+	fs.StringVar(&storageBackend, "s", cliConfig.Storage, "")
+	fs.IntVar(&verbosity, "verbosity", defaultVerbosity(), "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
+	fs.IntVar(&verbosity, "v", defaultVerbosity(), "")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -87,11 +88,7 @@ func RunChatCommand(args []string) error {
 		return fmt.Errorf("storage error: %w", err)
 	}
 
-	// Load remote URL
-	remoteURL, err := config.LoadRemote()
-	if err != nil {
-		return fmt.Errorf("config error: %w", err)
-	}
+	remoteURL := cliConfig.RemoteURL
 
 	// Load context
 	ctxHist, err := historyStore.LoadContext(contextName)
@@ -102,7 +99,7 @@ func RunChatCommand(args []string) error {
 	// Apply system prompt override if provided
 	if systemPrompt != "" {
 		ctxHist.System = systemPrompt
-		if err := historyStore.SaveContext(contextName, ctxHist); err != nil {
+		if err := historyStore.SaveSystem(contextName, ctxHist.System); err != nil {
 			return fmt.Errorf("save system prompt: %w", err)
 		}
 	}
@@ -159,14 +156,15 @@ func runChatMode(
 		requestedVerbosityValue = verbosity
 		requestedVerbosity = &requestedVerbosityValue
 	}
-	keywordStore := resolveKeywordLister(historyStore)
+	keywordStore, keywordUserID, closeKeywords := resolveKeywordLister(historyStore)
+	defer closeKeywords()
 
 	// Print welcome message
 	fmt.Fprintf(os.Stderr, "Chat mode (context: %s | agent: %s)\n", contextName, currentAgent)
 	if system != "" {
 		fmt.Fprintf(os.Stderr, "System: %s\n", system)
 	}
-	fmt.Fprintln(os.Stderr, "Press Ctrl+C or Ctrl+D to exit.\n")
+	fmt.Fprint(os.Stderr, "Press Ctrl+C or Ctrl+D to exit.\n\n")
 
 	// Setup readline
 	rl, err := readline.New(fmt.Sprintf("[%s] > ", currentAgent))
@@ -241,7 +239,49 @@ func runChatMode(
 			continue
 		}
 
-		escalationResult, err := executor.ResolveVerbosity(ctx, requestedVerbosity, defaultVerbosity, currentAgent, input, "", keywordStore)
+		// /retry answers the last question again and /edit N replaces an
+		// earlier one; both start a new branch and keep the old turns.
+		prior := history
+		var userParent *int64 // nil continues the active branch
+		var retryOf *store.Message
+		if input == "/retry" {
+			i, ok := chat.RetryPoint(history)
+			if !ok {
+				fmt.Fprint(os.Stderr, "Nothing to retry\n\n")
+				continue
+			}
+			retryOf = &history[i]
+			input = retryOf.Content
+			prior = history[:i]
+		} else if input == "/edit" || strings.HasPrefix(input, "/edit ") {
+			numStr, text, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(input, "/edit")), " ")
+			n, err := strconv.Atoi(numStr)
+			if err != nil {
+				fmt.Fprint(os.Stderr, "Usage: /edit N [new message] (N as listed by 'sidekick history --verbose')\n\n")
+				continue
+			}
+			i, err := chat.EditPoint(history, n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n\n", err)
+				continue
+			}
+			text = strings.TrimSpace(text)
+			if text == "" {
+				line, err := rl.ReadlineWithDefault(history[i].Content)
+				if err != nil {
+					continue
+				}
+				text = strings.TrimSpace(line)
+			}
+			if text == "" {
+				continue
+			}
+			input = text
+			prior = history[:i]
+			userParent = store.ParentRef(history[i].Parent())
+		}
+
+		escalationResult, err := executor.ResolveVerbosity(ctx, requestedVerbosity, defaultVerbosity, currentAgent, profile, input, keywordUserID, keywordStore)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[error] %v\n\n", err)
 			continue
@@ -262,7 +302,7 @@ func runChatMode(
 		}
 
 		// Build messages
-		messages := chat.BuildMessages(systemWithConstraint, history, historyLimit, input)
+		messages := chat.BuildMessages(systemWithConstraint, prior, historyLimit, input)
 
 		// Execute with spinner
 		result, err := cli.ExecuteWithSpinner("", func() (executor.ExecutionResult, error) {
@@ -271,6 +311,7 @@ func runChatMode(
 				RemoteURL:     remoteURL,
 				LocalOnly:     localOnly,
 				RemoteOnly:    remoteOnly,
+				RemoteTimeout: cliConfig.RemoteTimeout,
 				Profile:       profile,
 				Verbosity:     effectiveVerbosity,
 				Log:           logf,
@@ -283,31 +324,45 @@ func runChatMode(
 
 		// Apply post-processing and render
 		fmt.Printf("\n[%s]\n", currentAgent)
-		fmt.Print(result.Reply)
+		fmt.Print(render.Reply(result.Reply, cliConfig.Render))
 		fmt.Printf("(source: %s)\n", result.Source)
 		fmt.Println()
 
 		// Persist messages
 		now := time.Now().UTC()
-		userMsg := store.Message{Role: "user", Content: input, Time: now}
+		userMsg := store.Message{Role: "user", Content: input, Time: now, ParentID: userParent}
 		assistantAgent := currentAgent
 		assistantVerbosity := effectiveVerbosity
 		assistantMsg := store.Message{
-			Role:      "assistant",
-			Content:   result.Reply,
-			Agent:     &assistantAgent,
-			Verbosity: &assistantVerbosity,
-			Time:      now,
+			Role:             "assistant",
+			Content:          result.Reply,
+			Agent:            &assistantAgent,
+			Verbosity:        &assistantVerbosity,
+			Time:             now,
+			Model:            result.Model,
+			Source:           result.Source,
+			Keywords:         escalationResult.MatchedKeywords,
+			PromptTokens:     result.Usage.PromptTokens,
+			CompletionTokens: result.Usage.CompletionTokens,
+			LatencyMS:        result.Latency.Milliseconds(),
 		}
 
-		if err := historyStore.Append(contextName, userMsg); err != nil {
+		if retryOf != nil {
+			// Only the new reply is stored, next to the old one
+			userMsg = *retryOf
+			assistantMsg.ParentID = store.ParentRef(retryOf.ID)
+		} else if err := historyStore.Append(contextName, userMsg); err != nil {
 			fmt.Fprintf(os.Stderr, "[warning] failed to save user message: %v\n", err)
 		}
 		if err := historyStore.Append(contextName, assistantMsg); err != nil {
 			fmt.Fprintf(os.Stderr, "[warning] failed to save assistant message: %v\n", err)
 		}
 
-		// Update in-memory history
-		history = append(history, userMsg, assistantMsg)
+		// Reload the active branch so the new messages carry their IDs
+		if h, err := historyStore.LoadContext(contextName); err == nil {
+			history = h.Messages
+		} else {
+			history = append(prior[:len(prior):len(prior)], userMsg, assistantMsg)
+		}
 	}
 }
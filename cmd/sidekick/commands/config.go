@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+)
+
+// cliConfig holds the layered CLI config once LoadConfig has run; commands
+// take their flag defaults from it.
+var cliConfig = config.DefaultCLIConfig()
+
+// LoadConfig loads and validates the CLI config and applies the settings
+// that are not flags, such as the Ollama endpoint.
+func LoadConfig() error {
+	cfg, err := config.LoadCLI()
+	if err != nil {
+		return err
+	}
+	if cfg.Agent != "" && agent.GetProfile(cfg.Agent) == nil {
+		return fmt.Errorf("config agent: unknown agent profile %q (available: %s)", cfg.Agent, strings.Join(agent.ListProfiles(), ", "))
+	}
+	cliConfig = cfg
+	hosts := cfg.OllamaHosts()
+	ollama.BaseURL = hosts[0]
+	ollama.Timeout = cfg.OllamaTimeout
+	if len(hosts) > 1 {
+		pool := make([]ollama.Host, len(hosts))
+		for i, url := range hosts {
+			pool[i] = ollama.Host{URL: url}
+		}
+		ollama.SetDefaultPool(ollama.NewPool(pool, 0))
+	}
+	return nil
+}
+
+// defaultVerbosity is the --verbosity default: the configured level, or -1
+// for the default agent's.
+func defaultVerbosity() int {
+	if cliConfig.Verbosity != nil {
+		return *cliConfig.Verbosity
+	}
+	return -1
+}
+
+// RunConfigCommand handles 'sidekick config get|set|unset|list'. It works
+// on config.json even when the current config does not validate, so a bad
+// value can always be fixed.
+func RunConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("config requires a subcommand: get, set, unset, list")
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: sidekick config get KEY")
+		}
+		cfg, err := config.LoadCLI()
+		if err != nil {
+			return err
+		}
+		value, err := cfg.Get(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: sidekick config set KEY VALUE")
+		}
+		if args[1] == "agent" && args[2] != "" && agent.GetProfile(args[2]) == nil {
+			return fmt.Errorf("unknown agent profile: %s\nAvailable profiles: %s", args[2], strings.Join(agent.ListProfiles(), ", "))
+		}
+		if err := config.SetCLI(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in %s\n", args[1], config.File())
+		return nil
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: sidekick config unset KEY")
+		}
+		if err := config.UnsetCLI(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Unset %s in %s\n", args[1], config.File())
+		return nil
+	case "list":
+		cfg, err := config.LoadCLI()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-16s %-28s %-8s %s\n", "KEY", "VALUE", "SOURCE", "DESCRIPTION")
+		for _, key := range config.CLIKeys() {
+			value, _ := cfg.Get(key)
+			fmt.Printf("%-16s %-28s %-8s %s\n", key, value, cfg.Source(key), config.CLIKeyDescription(key))
+		}
+		fmt.Printf("\nConfig file: %s\n", config.File())
+		fmt.Printf("Environment: SIDEKICK_<KEY> overrides a key, e.g. %s\n", config.CLIKeyEnv("storage"))
+		return nil
+	default:
+		return fmt.Errorf("unknown config subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+func TestConfigCommandFixesUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "sidekick"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.File(), []byte(`{"histroy": 3, "storage": "sqlite"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadCLI(); err == nil {
+		t.Fatal("expected the misspelled key to be rejected")
+	}
+
+	if err := RunConfigCommand([]string{"set", "history", "3"}); err != nil {
+		t.Fatalf("set with an unknown key in the file: %v", err)
+	}
+	if err := RunConfigCommand([]string{"unset", "histroy"}); err != nil {
+		t.Fatalf("unset of the unknown key: %v", err)
+	}
+	if err := RunConfigCommand([]string{"unset", "bogus"}); err == nil {
+		t.Error("expected unset of a key that is neither known nor present to fail")
+	}
+
+	cfg, err := config.LoadCLI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.History != 3 || cfg.Storage != "sqlite" {
+		t.Errorf("history = %d, storage = %s, want 3 and sqlite", cfg.History, cfg.Storage)
+	}
+}
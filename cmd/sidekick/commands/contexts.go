@@ -12,9 +12,13 @@ import (
 
 // RunContextsCommand handles the 'contexts' subcommand
 func RunContextsCommand(args []string) error {
+	if len(args) > 0 && args[0] == "fork" {
+		return runContextsForkCommand(args[1:])
+	}
+
 	fs := flag.NewFlagSet("contexts", flag.ExitOnError)
 	var storageBackend string
-	fs.StringVar(&storageBackend, "storage", "file", "storage backend (file|sqlite)")
+	fs.StringVar(&storageBackend, "storage", cliConfig.Storage, "storage backend (file|sqlite|postgres)")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -47,6 +51,72 @@ func RunContextsCommand(args []string) error {
 	return nil
 }
 
+// runContextsForkCommand copies the first N messages of a context's active
+// branch into a new context, to continue the conversation from there.
+func runContextsForkCommand(args []string) error {
+	const usage = "usage: sidekick contexts fork <name> --at N <newname>"
+
+	fs := flag.NewFlagSet("contexts fork", flag.ExitOnError)
+	at := fs.Int("at", 0, "number of messages to keep, as listed by 'history --verbose' (default: all)")
+	storageBackend := fs.String("storage", cliConfig.Storage, "storage backend (file|sqlite|postgres)")
+
+	// Flags may come before, between or after the names
+	names, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 2 {
+		return fmt.Errorf(usage)
+	}
+	sourceName, targetName := names[0], names[1]
+
+	historyStore, err := CreateHistoryStore(*storageBackend)
+	if err != nil {
+		return fmt.Errorf("storage error: %w", err)
+	}
+
+	source, err := historyStore.LoadContext(sourceName)
+	if err != nil {
+		return fmt.Errorf("load context: %w", err)
+	}
+	if source.System == "" && len(source.Messages) == 0 {
+		return fmt.Errorf("context '%s' does not exist", sourceName)
+	}
+	target, err := historyStore.LoadContext(targetName)
+	if err != nil {
+		return fmt.Errorf("load context: %w", err)
+	}
+	if target.System != "" || len(target.Messages) > 0 {
+		return fmt.Errorf("context '%s' already exists", targetName)
+	}
+
+	n := *at
+	if n == 0 {
+		n = len(source.Messages)
+	}
+	if n < 1 || n > len(source.Messages) {
+		return fmt.Errorf("--at must be between 1 and %d", len(source.Messages))
+	}
+
+	// IDs are per context; the copies form a fresh linear branch
+	for _, msg := range source.Messages[:n] {
+		msg.ID, msg.ParentID = 0, nil
+		if err := historyStore.Append(targetName, msg); err != nil {
+			return fmt.Errorf("append message: %w", err)
+		}
+	}
+	// System prompt after messages, so stores that create contexts on
+	// first write have one to update
+	if source.System != "" {
+		if err := historyStore.SaveSystem(targetName, source.System); err != nil {
+			return fmt.Errorf("save system prompt: %w", err)
+		}
+	}
+
+	fmt.Printf("Forked %s at message %d into %s\n", sourceName, n, targetName)
+	return nil
+}
+
 // CreateHistoryStore instantiates the appropriate storage backend
 func CreateHistoryStore(backend string) (store.HistoryStore, error) {
 	switch backend {
@@ -3,6 +3,9 @@ package commands
 import (
 	"flag"
 	"fmt"
+	"strings"
+
+	"github.com/earlysvahn/sidekick/internal/store"
 )
 
 // RunHistoryCommand handles the 'history' subcommand
@@ -10,9 +13,12 @@ func RunHistoryCommand(args []string) error {
 	fs := flag.NewFlagSet("history", flag.ExitOnError)
 	var contextName string
 	var storageBackend string
+	var verbose bool
 	fs.StringVar(&contextName, "context", "", "context name (required)")
 	fs.StringVar(&contextName, "ctx", "", "context name (alias for -context)")
-	fs.StringVar(&storageBackend, "storage", "file", "storage backend (file|sqlite)")
+	fs.StringVar(&storageBackend, "storage", cliConfig.Storage, "storage backend (file|sqlite|postgres)")
+	fs.BoolVar(&verbose, "verbose", false, "show response metadata (model, source, tokens, latency)")
+	fs.BoolVar(&verbose, "v", false, "")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -45,14 +51,57 @@ func RunHistoryCommand(args []string) error {
 		fmt.Printf("[system] %s\n", ctxHist.System)
 	}
 
-	// Print all messages in chronological order
-	for _, msg := range ctxHist.Messages {
+	// Print the active branch in chronological order; verbose output numbers
+	// messages for 'contexts fork --at N' and /edit N
+	for i, msg := range ctxHist.Messages {
 		role := msg.Role
 		if msg.Role == "assistant" && msg.Agent != nil && *msg.Agent != "" {
 			role = *msg.Agent
 		}
+		if verbose {
+			fmt.Printf("%d ", i+1)
+		}
 		fmt.Printf("[%s] %s\n", role, msg.Content)
+		if verbose && msg.Role == "assistant" {
+			if meta := formatMessageMeta(msg); meta != "" {
+				fmt.Printf("  (%s)\n", meta)
+			}
+		}
+		if verbose && msg.Role == "user" && len(msg.Files) > 0 {
+			fmt.Printf("  (files: %s)\n", strings.Join(msg.Files, ", "))
+		}
 	}
 
 	return nil
 }
+
+// formatMessageMeta renders the response metadata recorded on an assistant
+// message, skipping fields that were not recorded.
+func formatMessageMeta(msg store.Message) string {
+	var parts []string
+	if !msg.Time.IsZero() {
+		parts = append(parts, msg.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	if msg.Model != "" {
+		parts = append(parts, "model: "+msg.Model)
+	}
+	if msg.Source != "" {
+		parts = append(parts, "source: "+msg.Source)
+	}
+	if msg.Verbosity != nil {
+		parts = append(parts, fmt.Sprintf("verbosity: %d", *msg.Verbosity))
+	}
+	if len(msg.Keywords) > 0 {
+		parts = append(parts, "keywords: "+strings.Join(msg.Keywords, ", "))
+	}
+	if msg.PromptTokens > 0 || msg.CompletionTokens > 0 {
+		parts = append(parts, fmt.Sprintf("tokens: %d+%d", msg.PromptTokens, msg.CompletionTokens))
+	}
+	if msg.LatencyMS > 0 {
+		parts = append(parts, fmt.Sprintf("latency: %dms", msg.LatencyMS))
+	}
+	if msg.Incomplete {
+		parts = append(parts, "incomplete")
+	}
+	return strings.Join(parts, ", ")
+}
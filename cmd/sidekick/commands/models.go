@@ -0,0 +1,320 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/cli"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"golang.org/x/term"
+)
+
+// RunModelsCommand handles the 'models' subcommand. Every subcommand takes
+// --host URL to target one Ollama host; list, ps and check otherwise cover
+// every configured host, and pull, rm and show use the first.
+func RunModelsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("models command requires a subcommand: list, pull, rm, show, ps, check")
+	}
+
+	subcommand := args[0]
+	fs := flag.NewFlagSet("models "+subcommand, flag.ContinueOnError)
+	host := fs.String("host", "", "Ollama host URL (default: every configured host, or the first for pull|rm|show)")
+	yes := false
+	if subcommand == "check" {
+		fs.BoolVar(&yes, "yes", false, "pull missing models without asking")
+	}
+	positional, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "list", "ps", "check":
+		if len(positional) != 0 {
+			return fmt.Errorf("usage: sidekick models %s [--host URL]", subcommand)
+		}
+	case "pull", "rm", "show":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: sidekick models %s MODEL [--host URL]", subcommand)
+		}
+	}
+
+	hosts := modelHosts(*host)
+	switch subcommand {
+	case "list":
+		return runModelsListCommand(hosts)
+	case "ps":
+		return runModelsPSCommand(hosts)
+	case "pull":
+		return pullModel(hosts[0], positional[0])
+	case "rm":
+		if err := ollama.DeleteModelAt(context.Background(), hosts[0], positional[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from %s\n", positional[0], hosts[0])
+		return nil
+	case "show":
+		return runModelsShowCommand(hosts[0], positional[0])
+	case "check":
+		return runModelsCheckCommand(hosts, yes)
+	default:
+		return fmt.Errorf("unknown models subcommand: %s", subcommand)
+	}
+}
+
+// modelHosts returns host, or the hosts of the configured Ollama pool.
+func modelHosts(host string) []string {
+	if host = strings.TrimRight(strings.TrimSpace(host), "/"); host != "" {
+		return []string{host}
+	}
+	var hosts []string
+	for _, h := range ollama.DefaultPool().Status() {
+		hosts = append(hosts, h.URL)
+	}
+	return hosts
+}
+
+func runModelsListCommand(hosts []string) error {
+	multi := len(hosts) > 1
+	header := fmt.Sprintf("%-32s %-9s %-8s %-8s %-16s", "NAME", "SIZE", "PARAMS", "QUANT", "MODIFIED")
+	if multi {
+		header += " HOST"
+	}
+	fmt.Println(header)
+
+	failed := 0
+	for _, host := range hosts {
+		models, err := ollama.ListModelInfoAt(context.Background(), host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[warning] %s: %v\n", host, err)
+			failed++
+			continue
+		}
+		sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+		for _, m := range models {
+			modified := "-"
+			if !m.ModifiedAt.IsZero() {
+				modified = m.ModifiedAt.Local().Format("2006-01-02 15:04")
+			}
+			line := fmt.Sprintf("%-32s %-9s %-8s %-8s %-16s", m.Name, formatBytes(m.Size), m.Details.ParameterSize, m.Details.QuantizationLevel, modified)
+			if multi {
+				line += " " + host
+			}
+			fmt.Println(line)
+		}
+	}
+	if failed == len(hosts) {
+		return fmt.Errorf("no Ollama host reachable")
+	}
+	return nil
+}
+
+func runModelsPSCommand(hosts []string) error {
+	multi := len(hosts) > 1
+	header := fmt.Sprintf("%-32s %-9s %-9s %-20s", "NAME", "SIZE", "GPU", "UNLOADS")
+	if multi {
+		header += " HOST"
+	}
+	fmt.Println(header)
+
+	failed := 0
+	for _, host := range hosts {
+		models, err := ollama.RunningModelsAt(context.Background(), host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[warning] %s: %v\n", host, err)
+			failed++
+			continue
+		}
+		for _, m := range models {
+			gpu := "-"
+			if m.Size > 0 {
+				gpu = fmt.Sprintf("%d%%", m.SizeVRAM*100/m.Size)
+			}
+			unloads := "-"
+			if !m.ExpiresAt.IsZero() {
+				unloads = m.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+			}
+			line := fmt.Sprintf("%-32s %-9s %-9s %-20s", m.Name, formatBytes(m.Size), gpu, unloads)
+			if multi {
+				line += " " + host
+			}
+			fmt.Println(line)
+		}
+	}
+	if failed == len(hosts) {
+		return fmt.Errorf("no Ollama host reachable")
+	}
+	return nil
+}
+
+func runModelsShowCommand(host, model string) error {
+	show, err := ollama.ShowModelAt(context.Background(), host, model)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Model:        %s\n", model)
+	fmt.Printf("Family:       %s\n", show.Details.Family)
+	fmt.Printf("Parameters:   %s\n", show.Details.ParameterSize)
+	fmt.Printf("Quantization: %s\n", show.Details.QuantizationLevel)
+	if n := show.ContextLength(); n > 0 {
+		fmt.Printf("Context:      %d tokens\n", n)
+	}
+	if len(show.Capabilities) > 0 {
+		fmt.Printf("Capabilities: %s\n", strings.Join(show.Capabilities, ", "))
+	}
+	if !show.ModifiedAt.IsZero() {
+		fmt.Printf("Modified:     %s\n", show.ModifiedAt.Local().Format(time.RFC3339))
+	}
+	if params := strings.TrimSpace(show.Parameters); params != "" {
+		fmt.Println("\nModel parameters:")
+		for _, line := range strings.Split(params, "\n") {
+			fmt.Printf("  %s\n", strings.Join(strings.Fields(line), " "))
+		}
+	}
+	return nil
+}
+
+// pullModel pulls model onto host with a progress spinner.
+func pullModel(host, model string) error {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := cli.ExecuteWithProgress(fmt.Sprintf("pulling %s", model), cancel, func(update func(string)) error {
+		return ollama.PullModelAt(ctx, host, model, func(p ollama.PullProgress) {
+			update(formatPullProgress(model, p))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pulled %s onto %s in %s\n", model, host, time.Since(start).Round(time.Second))
+	return nil
+}
+
+func formatPullProgress(model string, p ollama.PullProgress) string {
+	status := p.Status
+	if p.Digest != "" {
+		// "pulling 6a0746a1ec1a..." is long and repeats the digest; shorten it
+		status = strings.TrimSuffix(strings.Fields(status + " ")[0], ":")
+		status += " " + shortDigest(p.Digest)
+	}
+	if pct := p.Percent(); pct >= 0 {
+		return fmt.Sprintf("pulling %s: %s %d%% (%s/%s)", model, status, pct, formatBytes(p.Completed), formatBytes(p.Total))
+	}
+	return fmt.Sprintf("pulling %s: %s", model, status)
+}
+
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// runModelsCheckCommand compares the models of enabled agents with the
+// models installed on hosts and offers to pull the missing ones onto the
+// first reachable host.
+func runModelsCheckCommand(hosts []string, yes bool) error {
+	database, err := db.OpenSQLite()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer database.Close()
+
+	agents, err := agent.NewRepository(database).ListEnabled()
+	if err != nil {
+		return fmt.Errorf("list agents: %w", err)
+	}
+	usedBy := make(map[string][]string)
+	for _, a := range agents {
+		model := ollama.SelectedModel(a.Model)
+		usedBy[model] = append(usedBy[model], a.ID)
+	}
+	models := make([]string, 0, len(usedBy))
+	for model := range usedBy {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	installed := make(map[string][]string) // host -> model names
+	var reachable []string
+	for _, host := range hosts {
+		names, err := ollama.ListModelsAt(context.Background(), host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[warning] %s: %v\n", host, err)
+			continue
+		}
+		installed[host] = names
+		reachable = append(reachable, host)
+	}
+	if len(reachable) == 0 {
+		return fmt.Errorf("no Ollama host reachable")
+	}
+
+	var missing []string
+	fmt.Printf("%-28s %-8s %s\n", "MODEL", "STATUS", "AGENTS")
+	for _, model := range models {
+		status := "present"
+		var on []string
+		for _, host := range reachable {
+			if ollama.ContainsModel(installed[host], model) {
+				on = append(on, host)
+			}
+		}
+		if len(on) == 0 {
+			status = "missing"
+			missing = append(missing, model)
+		}
+		line := fmt.Sprintf("%-28s %-8s %s", model, status, strings.Join(usedBy[model], ", "))
+		if len(hosts) > 1 && len(on) > 0 {
+			line += fmt.Sprintf(" (on %s)", strings.Join(on, ", "))
+		}
+		fmt.Println(line)
+	}
+
+	if len(missing) == 0 {
+		fmt.Println("\nAll agent models are installed.")
+		return nil
+	}
+	if !yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("%d agent model(s) missing; pull them with 'sidekick models check --yes'", len(missing))
+		}
+		fmt.Printf("\nPull %d missing model(s) onto %s? [y/N] ", len(missing), reachable[0])
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("%d agent model(s) missing", len(missing))
+		}
+	}
+	for _, model := range missing {
+		if err := pullModel(reachable[0], model); err != nil {
+			return fmt.Errorf("pull %s: %w", model, err)
+		}
+	}
+	return nil
+}
+
+// formatBytes formats a byte count with a decimal unit, as the Ollama CLI
+// does.
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/render"
+)
+
+// Output formats for one-shot mode.
+const (
+	outputText   = "text"   // the reply followed by a (source: ...) footer
+	outputJSON   = "json"   // a single result object
+	outputNDJSON = "ndjson" // {"delta":...} lines, then the result object with "done": true
+)
+
+// ErrReported is returned by commands that already reported their error in
+// the requested output format; the caller should exit without printing it.
+var ErrReported = errors.New("error already reported")
+
+// oneShotResult is the JSON form of a one-shot reply.
+type oneShotResult struct {
+	Done               bool     `json:"done,omitempty"`
+	Reply              string   `json:"reply"`
+	Source             string   `json:"source"`
+	Agent              string   `json:"agent"`
+	Model              string   `json:"model,omitempty"`
+	Context            string   `json:"context"`
+	EffectiveVerbosity int      `json:"effective_verbosity"`
+	Escalated          bool     `json:"escalated"`
+	MatchedKeywords    []string `json:"matched_keywords"`
+	Warnings           []string `json:"warnings"`
+	Files              []string `json:"files,omitempty"`
+	Usage              struct {
+		executor.Usage
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	LatencyMS int64 `json:"latency_ms"`
+}
+
+// outputWriter prints one-shot results and logs in the format chosen with
+// --output. Structured formats log to stderr as JSON lines.
+type outputWriter struct {
+	format string
+	quiet  bool
+	out    io.Writer
+	logger *slog.Logger
+}
+
+func newOutputWriter(format string, quiet bool) (*outputWriter, error) {
+	w := &outputWriter{format: format, quiet: quiet, out: os.Stdout}
+	switch format {
+	case outputText:
+	case outputJSON, outputNDJSON:
+		w.logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		return nil, fmt.Errorf("--output must be %s, %s or %s", outputText, outputJSON, outputNDJSON)
+	}
+	return w, nil
+}
+
+func (w *outputWriter) structured() bool {
+	return w.format != outputText
+}
+
+// Logf logs progress, unless --quiet is set.
+func (w *outputWriter) Logf(msg string) {
+	if w.quiet {
+		return
+	}
+	if w.structured() {
+		w.logger.Info(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[sidekick] %s\n", msg)
+}
+
+// Warn logs a warning, even with --quiet.
+func (w *outputWriter) Warn(msg string) {
+	if w.structured() {
+		w.logger.Warn(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[warning] %s\n", msg)
+}
+
+// Fail reports err as a JSON log line in the structured formats and returns
+// ErrReported; in text mode it returns err for the caller to print.
+func (w *outputWriter) Fail(err error) error {
+	if err == nil || !w.structured() {
+		return err
+	}
+	w.logger.Error(err.Error())
+	return ErrReported
+}
+
+// OnDelta returns the streaming callback for ndjson output, or nil for the
+// formats that print the reply once it is complete.
+func (w *outputWriter) OnDelta() func(string) error {
+	if w.format != outputNDJSON {
+		return nil
+	}
+	encoder := json.NewEncoder(w.out)
+	return func(delta string) error {
+		return encoder.Encode(map[string]string{"delta": delta})
+	}
+}
+
+// Result prints the finished reply.
+func (w *outputWriter) Result(result oneShotResult) error {
+	switch w.format {
+	case outputJSON:
+		return json.NewEncoder(w.out).Encode(result)
+	case outputNDJSON:
+		result.Done = true
+		return json.NewEncoder(w.out).Encode(result)
+	default:
+		fmt.Fprint(w.out, render.Reply(result.Reply, cliConfig.Render))
+		fmt.Fprintf(w.out, "(source: %s)\n", result.Source)
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newTestOutputWriter returns a writer for format whose results and logs go
+// to the returned buffers.
+func newTestOutputWriter(t *testing.T, format string) (*outputWriter, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	w, err := newOutputWriter(format, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, logs bytes.Buffer
+	w.out = &out
+	if w.logger != nil {
+		w.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	}
+	return w, &out, &logs
+}
+
+func testResult() oneShotResult {
+	result := oneShotResult{
+		Reply:              "hello world",
+		Source:             "local",
+		Agent:              "default",
+		Model:              "qwen2.5:7b",
+		Context:            "misc",
+		EffectiveVerbosity: 2,
+		MatchedKeywords:    []string{},
+		Warnings:           []string{},
+		LatencyMS:          850,
+	}
+	result.Usage.PromptTokens = 42
+	result.Usage.CompletionTokens = 7
+	result.Usage.TotalTokens = 49
+	return result
+}
+
+func TestOutputWriterJSON(t *testing.T) {
+	w, out, _ := newTestOutputWriter(t, outputJSON)
+	if w.OnDelta() != nil {
+		t.Fatal("json output streams deltas")
+	}
+	if err := w.Result(testResult()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("output = %q, want one JSON object", out)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["done"]; ok {
+		t.Errorf("json result has done: %s", lines[0])
+	}
+	if got["reply"] != "hello world" || got["context"] != "misc" || got["effective_verbosity"] != 2.0 {
+		t.Errorf("result = %s", lines[0])
+	}
+	usage, _ := got["usage"].(map[string]any)
+	if usage["prompt_tokens"] != 42.0 || usage["completion_tokens"] != 7.0 || usage["total_tokens"] != 49.0 {
+		t.Errorf("usage = %v, want flattened token counts", usage)
+	}
+}
+
+func TestOutputWriterNDJSON(t *testing.T) {
+	w, out, _ := newTestOutputWriter(t, outputNDJSON)
+	onDelta := w.OnDelta()
+	if onDelta == nil {
+		t.Fatal("ndjson output does not stream deltas")
+	}
+	for _, delta := range []string{"hello", " world"} {
+		if err := onDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Result(testResult()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("output = %q, want two deltas and the result", out)
+	}
+	if lines[0] != `{"delta":"hello"}` || lines[1] != `{"delta":" world"}` {
+		t.Errorf("deltas = %q, %q", lines[0], lines[1])
+	}
+	var done oneShotResult
+	if err := json.Unmarshal([]byte(lines[2]), &done); err != nil {
+		t.Fatal(err)
+	}
+	if !done.Done || done.Reply != "hello world" || done.Usage.TotalTokens != 49 {
+		t.Errorf("last line = %s, want the result with done", lines[2])
+	}
+}
+
+func TestOutputWriterFail(t *testing.T) {
+	cause := errors.New("model not found")
+	for _, format := range []string{outputJSON, outputNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			w, out, logs := newTestOutputWriter(t, format)
+			if err := w.Fail(cause); !errors.Is(err, ErrReported) {
+				t.Fatalf("Fail = %v, want ErrReported", err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("stdout = %q, want nothing", out)
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log = %q: %v", logs, err)
+			}
+			if entry["level"] != "ERROR" || entry["msg"] != "model not found" {
+				t.Errorf("log = %v, want an error entry", entry)
+			}
+			if err := w.Fail(nil); err != nil {
+				t.Errorf("Fail(nil) = %v", err)
+			}
+		})
+	}
+
+	w, _, _ := newTestOutputWriter(t, outputText)
+	if err := w.Fail(cause); err != cause {
+		t.Errorf("text Fail = %v, want the error itself", err)
+	}
+}
+
+func TestNewOutputWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := newOutputWriter("yaml", false); err == nil {
+		t.Fatal("expected an error")
+	}
+}
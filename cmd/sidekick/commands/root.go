@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -11,13 +12,12 @@ import (
 	"github.com/earlysvahn/sidekick/internal/agent"
 	"github.com/earlysvahn/sidekick/internal/chat"
 	"github.com/earlysvahn/sidekick/internal/cli"
-	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/executor"
 	"github.com/earlysvahn/sidekick/internal/store"
 )
 
 // RunOneShot handles one-shot query execution (default mode)
-func RunOneShot(args []string) error {
+func RunOneShot(args []string) (err error) {
 	fs := flag.NewFlagSet("sidekick", flag.ExitOnError)
 
 	var modelOverride string
@@ -30,41 +30,70 @@ func RunOneShot(args []string) error {
 	var storageBackend string
 	var agentProfile string
 	var verbosity int
+	var files, globs stringList
+	var tokenLimit int
+	var outputFormat string
 
 	fs.StringVar(&modelOverride, "model", "", "force a specific Ollama model")
-	fs.StringVar(&contextName, "context", "misc", "context|ctx: context name")
-	fs.StringVar(&contextName, "ctx", "misc", "")
-	fs.IntVar(&historyLimit, "history", 4, "history|h: number of prior messages to include")
-	fs.IntVar(&historyLimit, "h", 4, "")
+	fs.StringVar(&contextName, "context", cliConfig.Context, "context|ctx: context name")
+	fs.StringVar(&contextName, "ctx", cliConfig.Context, "")
+	fs.IntVar(&historyLimit, "history", cliConfig.History, "history|h: number of prior messages to include")
+	fs.IntVar(&historyLimit, "h", cliConfig.History, "")
 	fs.StringVar(&systemPrompt, "system", "", "system|sp: system prompt for this context")
 	fs.StringVar(&systemPrompt, "sp", "", "")
-	fs.StringVar(&agentProfile, "agent", "", "agent|a: agent profile (code, golang-dev, etc)")
-	fs.StringVar(&agentProfile, "a", "", "")
-	fs.IntVar(&verbosity, "verbosity", -1, "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
-	fs.IntVar(&verbosity, "v", -1, "")
+	fs.StringVar(&agentProfile, "agent", cliConfig.Agent, "agent|a: agent profile (code, golang-dev, etc)")
+	fs.StringVar(&agentProfile, "a", cliConfig.Agent, "")
+	fs.IntVar(&verbosity, "verbosity", defaultVerbosity(), "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
+	fs.IntVar(&verbosity, "v", defaultVerbosity(), "")
 	fs.BoolVar(&localOnly, "local", false, "force local Ollama execution")
 	fs.BoolVar(&remoteOnly, "remote", false, "force remote execution")
 	fs.BoolVar(&quiet, "quiet", false, "suppress non-error logs")
-	fs.StringVar(&storageBackend, "storage", "file", "storage|s: storage backend (file|sqlite)")
-	fs.StringVar(&storageBackend, "s", "file", "")
+	fs.StringVar(&storageBackend, "storage", cliConfig.Storage, "storage|s: storage backend (file|sqlite|postgres)")
+	fs.StringVar(&storageBackend, "s", cliConfig.Storage, "")
+	fs.Var(&files, "file", "attach a file to the prompt (repeatable)")
+	fs.Var(&globs, "glob", "attach the files matching a pattern (repeatable)")
+	fs.IntVar(&tokenLimit, "token-limit", executor.DefaultTokenLimit, "largest request in estimated tokens, prompt plus reply budget")
+	fs.StringVar(&outputFormat, "output", outputText, "output|o: output format (text|json|ndjson)")
+	fs.StringVar(&outputFormat, "o", outputText, "")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-
-	if fs.NArg() == 0 {
-		return fmt.Errorf("no prompt provided")
+	output, err := newOutputWriter(outputFormat, quiet)
+	if err != nil {
+		return err
 	}
+	defer func() { err = output.Fail(err) }()
 
-	rawPrompt := strings.Join(fs.Args(), " ")
-
-	logf := func(msg string) {
-		if quiet {
-			return
+	// Piped stdin and attached files are embedded as fenced blocks after
+	// the prompt. The byte limit only stops huge inputs from being read;
+	// the request as a whole is checked against tokenLimit below.
+	maxInputBytes := tokenLimit * executor.CharsPerToken
+	var attachments []cli.Attachment
+	if cli.StdinPiped() {
+		stdinInput, err := cli.ReadStdin(os.Stdin, maxInputBytes)
+		if err != nil {
+			return inputError(err)
 		}
-		fmt.Fprintf(os.Stderr, "[sidekick] %s\n", msg)
+		if stdinInput != nil {
+			attachments = append(attachments, *stdinInput)
+		}
+	}
+	fileInputs, err := cli.ReadAttachments(files, globs, maxInputBytes)
+	if err != nil {
+		return inputError(err)
+	}
+	attachments = append(attachments, fileInputs...)
+
+	if fs.NArg() == 0 && len(attachments) == 0 {
+		return fmt.Errorf("no prompt provided")
 	}
 
+	// Verbosity rules see only what the user typed; the attachments would
+	// match keywords and always contain code blocks
+	typedPrompt := strings.Join(fs.Args(), " ")
+	rawPrompt := cli.BuildPrompt(typedPrompt, attachments)
+
 	// Apply agent profile if specified
 	var profile *agent.AgentProfile
 	if agentProfile != "" {
@@ -97,7 +126,7 @@ func RunOneShot(args []string) error {
 	}
 	if systemPrompt != "" {
 		ctxHist.System = systemPrompt
-		if err := historyStore.SaveContext(contextName, ctxHist); err != nil {
+		if err := historyStore.SaveSystem(contextName, ctxHist.System); err != nil {
 			return fmt.Errorf("history error: %w", err)
 		}
 	}
@@ -105,28 +134,28 @@ func RunOneShot(args []string) error {
 	system := ctxHist.System
 	history := ctxHist.Messages
 
-	remoteURL, err := config.LoadRemote()
-	if err != nil {
-		return fmt.Errorf("config error: %w", err)
-	}
+	remoteURL := cliConfig.RemoteURL
 
 	var requestedVerbosity *int
 	if verbosity >= 0 {
 		v := verbosity
 		requestedVerbosity = &v
 	}
-	keywordStore := resolveKeywordLister(historyStore)
+	keywordStore, keywordUserID, closeKeywords := resolveKeywordLister(historyStore)
+	defer closeKeywords()
 	agentName := "default"
 	if agentProfile != "" {
 		agentName = agentProfile
 	}
-	escalationResult, err := executor.ResolveVerbosity(context.Background(), requestedVerbosity, executor.DefaultVerbosity(), agentName, rawPrompt, "", keywordStore)
+	escalationResult, err := executor.ResolveVerbosity(context.Background(), requestedVerbosity, executor.DefaultVerbosity(), agentName, profile, typedPrompt, keywordUserID, keywordStore)
 	if err != nil {
 		return fmt.Errorf("verbosity escalation error: %w", err)
 	}
 	effectiveVerbosity := escalationResult.EffectiveVerbosity
+	var warnings []string
 	if escalationResult.Warning != "" {
-		fmt.Fprintf(os.Stderr, "[warning] %s\n", escalationResult.Warning)
+		warnings = append(warnings, escalationResult.Warning)
+		output.Warn(escalationResult.Warning)
 	}
 
 	// Inject system constraint for low verbosity modes
@@ -140,43 +169,105 @@ func RunOneShot(args []string) error {
 	}
 
 	messages := chat.BuildMessages(systemWithConstraint, history, historyLimit, rawPrompt)
+	if budget := executor.EstimateTokenBudget(messages, effectiveVerbosity); budget.EstimatedPromptTokens+max(budget.MaxCompletionTokens, 0) > tokenLimit {
+		return fmt.Errorf("request too large: about %d prompt tokens plus a %d-token reply exceed the %d-token limit (attach less input or raise --token-limit)",
+			budget.EstimatedPromptTokens, max(budget.MaxCompletionTokens, 0), tokenLimit)
+	}
 
-	result, err := cli.ExecuteWithSpinner("", func() (executor.ExecutionResult, error) {
+	execute := func() (executor.ExecutionResult, error) {
 		return executor.ExecuteWithFallback(executor.FallbackConfig{
 			ModelOverride: modelOverride,
 			RemoteURL:     remoteURL,
 			LocalOnly:     localOnly,
 			RemoteOnly:    remoteOnly,
+			RemoteTimeout: cliConfig.RemoteTimeout,
 			Profile:       profile,
 			Verbosity:     effectiveVerbosity,
-			Log:           logf,
+			Log:           output.Logf,
+			OnDelta:       output.OnDelta(),
 		}, messages)
-	})
+	}
+	var result executor.ExecutionResult
+	if output.structured() {
+		// The spinner writes to stderr, which must stay parseable
+		result, err = execute()
+	} else {
+		result, err = cli.ExecuteWithSpinner("", execute)
+	}
 	if err != nil {
 		return fmt.Errorf("executor error: %w", err)
 	}
 
-	fmt.Print(result.Reply)
-	fmt.Printf("(source: %s)\n", result.Source)
-
-	now := time.Now().UTC()
-	_ = historyStore.Append(contextName, store.Message{Role: "user", Content: rawPrompt, Time: now})
+	fileNames := cli.AttachmentNames(attachments)
 	assistantAgent := agentProfile
 	if assistantAgent == "" {
 		assistantAgent = "default"
 	}
+	reply := oneShotResult{
+		Reply:              result.Reply,
+		Source:             result.Source,
+		Agent:              assistantAgent,
+		Model:              result.Model,
+		Context:            contextName,
+		EffectiveVerbosity: effectiveVerbosity,
+		Escalated:          escalationResult.Escalated,
+		MatchedKeywords:    escalationResult.MatchedKeywords,
+		Warnings:           warnings,
+		Files:              fileNames,
+		LatencyMS:          result.Latency.Milliseconds(),
+	}
+	reply.Usage.Usage = result.Usage
+	reply.Usage.TotalTokens = result.Usage.TotalTokens()
+	if reply.MatchedKeywords == nil {
+		reply.MatchedKeywords = []string{}
+	}
+	if reply.Warnings == nil {
+		reply.Warnings = []string{}
+	}
+	if err := output.Result(reply); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_ = historyStore.Append(contextName, store.Message{Role: "user", Content: rawPrompt, Time: now, Files: fileNames})
 	assistantVerbosity := effectiveVerbosity
 	_ = historyStore.Append(contextName, store.Message{
-		Role:      "assistant",
-		Content:   result.Reply,
-		Agent:     &assistantAgent,
-		Verbosity: &assistantVerbosity,
-		Time:      now,
+		Role:             "assistant",
+		Content:          result.Reply,
+		Agent:            &assistantAgent,
+		Verbosity:        &assistantVerbosity,
+		Time:             now,
+		Model:            result.Model,
+		Source:           result.Source,
+		Keywords:         escalationResult.MatchedKeywords,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		LatencyMS:        result.Latency.Milliseconds(),
 	})
 
 	return nil
 }
 
+// inputError points at --token-limit when input was rejected for its size.
+func inputError(err error) error {
+	if errors.Is(err, cli.ErrInputTooLarge) {
+		return fmt.Errorf("%w (raise --token-limit to allow more)", err)
+	}
+	return err
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // PrintUsage prints the usage information
 func PrintUsage() {
 	fmt.Println("Sidekick - AI assistant CLI with context persistence and agent profiles")
@@ -186,16 +277,32 @@ func PrintUsage() {
 	fmt.Println("  sidekick chat [OPTIONS]                       Interactive chat mode")
 	fmt.Println("  sidekick tui [OPTIONS]                        Full-screen TUI mode")
 	fmt.Println("  sidekick contexts [--storage BACKEND]         List all contexts")
-	fmt.Println("  sidekick history --context NAME               Show context history")
+	fmt.Println("  sidekick contexts fork NAME --at N NEWNAME    Copy a context's first N messages")
+	fmt.Println("  sidekick history --context NAME [--verbose]   Show context history")
 	fmt.Println("  sidekick sync push|pull                       Sync contexts SQLite ↔ Postgres")
 	fmt.Println("  sidekick sync agents push|pull                Sync agents SQLite ↔ Postgres")
+	fmt.Println("  sidekick sync keywords push|pull [--user U]   Sync verbosity rules SQLite ↔ Postgres")
 	fmt.Println("  sidekick agents list                          List all agents")
 	fmt.Println("  sidekick agents show <id>                     Show agent details")
 	fmt.Println("  sidekick agents create [--file PATH]          Create agent from JSON")
 	fmt.Println("  sidekick agents update <id> [--file PATH]     Update agent from JSON")
+	fmt.Println("  sidekick agents update <id> --bias N          Set verbosity bias (--min-verbosity, --max-verbosity)")
 	fmt.Println("  sidekick agents delete <id>                   Delete agent")
 	fmt.Println("  sidekick agents enable <id>                   Enable agent")
 	fmt.Println("  sidekick agents disable <id>                  Disable agent")
+	fmt.Println("  sidekick users list                           List server accounts (Postgres)")
+	fmt.Println("  sidekick users create <email> [--role R]      Create account (prompts for password)")
+	fmt.Println("  sidekick users passwd|disable|enable|delete <email>")
+	fmt.Println("  sidekick users role <email> admin|user        Change account role")
+	fmt.Println("  sidekick users assign|unassign <email> <agent>")
+	fmt.Println("  sidekick audit tail [-n N] [--follow]         Show audit log (--action, --actor, --json)")
+	fmt.Println("  sidekick batch in.jsonl --out out.jsonl      Run a JSONL file of prompts (--concurrency N, resumable)")
+	fmt.Println("  sidekick config list|get|set|unset [KEY] [VALUE]  Show or change CLI defaults (config.json)")
+	fmt.Println("  sidekick models list|ps|pull|rm|show [MODEL]  Manage Ollama models (--host URL)")
+	fmt.Println("  sidekick models check [--yes]                 Check that agent models are installed, pull missing")
+	fmt.Println("  sidekick usage [--user EMAIL] [--by DIMS]     Show token usage (--since, --until, --days, --json)")
+	fmt.Println("  sidekick verbosity test \"msg\"                Explain which verbosity rules fire (--agent, --verbosity)")
+	fmt.Println("  sidekick verbosity keywords list|add|rm|import|export [--user EMAIL]")
 	fmt.Println()
 	fmt.Println("COMMON OPTIONS:")
 	fmt.Println("  --agent PROFILE        Use agent profile (see below)")
@@ -203,6 +310,10 @@ func PrintUsage() {
 	fmt.Println("  --system PROMPT        Override system prompt")
 	fmt.Println("  --history N            Number of messages to include (default: 4)")
 	fmt.Println("  --storage BACKEND      Storage backend: file|sqlite|postgres")
+	fmt.Println("  --file PATH            Attach a file to the prompt (repeatable)")
+	fmt.Println("  --glob PATTERN         Attach the files matching a pattern (repeatable)")
+	fmt.Println("  --token-limit N        Largest request in estimated tokens (default: 32768)")
+	fmt.Println("  --output, -o FORMAT    Output format: text|json|ndjson (logs go to stderr as JSON lines)")
 	fmt.Println("  --local                Force local Ollama execution")
 	fmt.Println("  --remote               Force remote execution")
 	fmt.Println("  --model MODEL          Override model selection")
@@ -234,6 +345,9 @@ func PrintUsage() {
 	fmt.Println("  sidekick --agent golang-dev \"write a web server\"")
 	fmt.Println("  sidekick chat --agent code --context myproject")
 	fmt.Println("  sidekick tui --agent sql-dev")
+	fmt.Println("  git diff | sidekick -a code \"review this\"")
+	fmt.Println("  sidekick -o json \"summarize RFC 9110\" | jq -r .reply")
+	fmt.Println("  sidekick --glob 'internal/store/*.go' \"where are migrations run?\"")
 	fmt.Println("  sidekick sync agents push")
 	fmt.Println("  echo '{...}' | sidekick agents create")
 	fmt.Println()
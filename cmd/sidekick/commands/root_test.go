@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+// fakeOllama serves the default model and answers every chat with reply.
+func fakeOllama(t *testing.T, reply string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprintf(w, `{"models":[{"name":%q}]}`, ollama.DefaultModel)
+			return
+		}
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q}}`+"\n", reply)
+			fmt.Fprintln(w, `{"done":true,"prompt_eval_count":3,"eval_count":1}`)
+			return
+		}
+		fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q},"done":true}`+"\n", reply)
+	}))
+	t.Cleanup(srv.Close)
+
+	prev := ollama.BaseURL
+	ollama.BaseURL = srv.URL
+	t.Cleanup(func() { ollama.BaseURL = prev })
+}
+
+// putRules stores verbosity rules in the local SQLite database.
+func putRules(t *testing.T, rules ...store.VerbosityKeyword) {
+	t.Helper()
+	if err := os.MkdirAll(config.Dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(db.SQLitePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.Close()
+	for i, kw := range rules {
+		if rules[i], err = store.NormalizeVerbosityKeyword(kw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sqliteStore.PutVerbosityKeywords(context.Background(), store.LocalUserID, rules, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureStdout runs fn with stdin empty and returns what it printed.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevIn, prevOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, w
+	defer func() { os.Stdin, os.Stdout = prevIn, prevOut }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	runErr := fn()
+	w.Close()
+	return <-out, runErr
+}
+
+// verbosityRulesIgnoringAttachments escalate on a keyword or a code block
+// that only the attachment has, and on a plain typed prompt.
+var verbosityRulesIgnoringAttachments = []store.VerbosityKeyword{
+	{Keyword: "benchmark", EscalateTo: 5, Enabled: true},
+	{Keyword: "explain", EscalateTo: 4, Enabled: true, CodeBlock: store.CodeBlockRequired},
+	{Keyword: "this", EscalateTo: 3, Enabled: true, CodeBlock: store.CodeBlockForbidden},
+}
+
+func writeAttachment(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notes.md")
+	content := "Run the benchmark first:\n\n```sh\ngo test -bench .\n```\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOneShotVerbosityRulesIgnoreAttachments(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fakeOllama(t, "ok")
+	putRules(t, verbosityRulesIgnoringAttachments...)
+
+	out, err := captureStdout(t, func() error {
+		return RunOneShot([]string{"--quiet", "--local", "--storage", "sqlite", "--verbosity", "1", "--output", "json", "--file", writeAttachment(t), "explain", "this"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result oneShotResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("output %q: %v", out, err)
+	}
+	if result.EffectiveVerbosity != 3 || len(result.MatchedKeywords) != 1 || result.MatchedKeywords[0] != "this" {
+		t.Errorf("verbosity = %d from %v, want 3 from the code-block-free rule only", result.EffectiveVerbosity, result.MatchedKeywords)
+	}
+}
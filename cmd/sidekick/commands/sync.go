@@ -1,9 +1,13 @@
 package commands
 
 import (
+	"context"
+	"flag"
 	"fmt"
 
+	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/notify"
 	"github.com/earlysvahn/sidekick/internal/store"
 	"github.com/earlysvahn/sidekick/internal/sync"
 )
@@ -11,7 +15,7 @@ import (
 // RunSyncCommand handles the 'sync' subcommand
 func RunSyncCommand(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("sync requires arguments: 'push|pull' for contexts or 'agents push|pull' for agents")
+		return fmt.Errorf("sync requires arguments: 'push|pull' for contexts, 'agents push|pull' for agents or 'keywords push|pull' for verbosity rules")
 	}
 
 	// Check if first arg is "agents"
@@ -21,6 +25,12 @@ func RunSyncCommand(args []string) error {
 		}
 		return RunAgentSyncCommand(args[1])
 	}
+	if args[0] == "keywords" {
+		if len(args) < 2 {
+			return fmt.Errorf("sync keywords requires a direction: push or pull")
+		}
+		return RunKeywordSyncCommand(args[1], args[2:])
+	}
 
 	// Otherwise, assume context sync
 	direction := args[0]
@@ -110,10 +120,83 @@ func RunAgentSyncCommand(direction string) error {
 		fmt.Println("Pulling agents from Postgres to SQLite...")
 	}
 
-	if err := sync.SyncAgents(sqliteDB, postgresDB, direction); err != nil {
-		return fmt.Errorf("agent sync failed: %w", err)
+	syncErr := sync.SyncAgents(sqliteDB, postgresDB, direction)
+	notifyAgentSyncFinished(direction, syncErr)
+	if syncErr != nil {
+		return fmt.Errorf("agent sync failed: %w", syncErr)
 	}
 
 	fmt.Println("Agent sync complete!")
 	return nil
 }
+
+// RunKeywordSyncCommand copies the local verbosity rules to a server account
+// (push) or the account's rules to the local ones (pull).
+func RunKeywordSyncCommand(direction string, args []string) error {
+	if direction != "push" && direction != "pull" {
+		return fmt.Errorf("sync keywords direction must be 'push' or 'pull', got: %s", direction)
+	}
+	fs := flag.NewFlagSet("sync keywords", flag.ExitOnError)
+	user := fs.String("user", store.CLI_DEFAULT_USER_ID, "server account (email or ID) to sync with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	localStore, localUserID, closeLocal, err := openKeywordStore("")
+	if err != nil {
+		return err
+	}
+	defer closeLocal()
+	remoteStore, remoteUserID, closeRemote, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeRemote()
+
+	ctx := context.Background()
+	var synced int
+	if direction == "push" {
+		fmt.Println("Syncing verbosity rules from SQLite to Postgres...")
+		synced, err = sync.SyncKeywords(ctx, localStore, remoteStore, localUserID, remoteUserID)
+	} else {
+		fmt.Println("Pulling verbosity rules from Postgres to SQLite...")
+		synced, err = sync.SyncKeywords(ctx, remoteStore, localStore, remoteUserID, localUserID)
+	}
+	if err != nil {
+		return fmt.Errorf("keyword sync failed after %d rules: %w", synced, err)
+	}
+
+	fmt.Printf("Keyword sync complete! %d rules synced.\n", synced)
+	return nil
+}
+
+// notifyAgentSyncFinished sends an agent_sync_finished event using the notify
+// settings from the server config, so sync runs from cron are visible in the
+// same channels as server alerts. Silently does nothing if unconfigured.
+func notifyAgentSyncFinished(direction string, syncErr error) {
+	cfg, err := config.LoadServer()
+	if err != nil {
+		return
+	}
+	notifier, err := notify.New(cfg.Notify)
+	if err != nil {
+		return
+	}
+
+	status := "ok"
+	message := fmt.Sprintf("agent sync %s finished", direction)
+	if syncErr != nil {
+		status = "failed"
+		message = fmt.Sprintf("agent sync %s failed: %v", direction, syncErr)
+	}
+	notifier.Send(notify.Event{
+		Type:    notify.EventAgentSyncFinished,
+		Title:   "Agent sync finished",
+		Message: message,
+		Fields: map[string]string{
+			"direction": direction,
+			"status":    status,
+		},
+	})
+	notifier.Wait()
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/earlysvahn/sidekick/internal/agent"
 	"github.com/earlysvahn/sidekick/internal/chat"
-	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/executor"
 	"github.com/earlysvahn/sidekick/internal/tui"
 )
@@ -27,20 +26,20 @@ func RunTUICommand(args []string) error {
 	var verbosity int
 
 	fs.StringVar(&modelOverride, "model", "", "force a specific Ollama model")
-	fs.StringVar(&contextName, "context", "misc", "context|ctx: context name")
-	fs.StringVar(&contextName, "ctx", "misc", "")
-	fs.IntVar(&historyLimit, "history", 4, "history|h: number of prior messages to include")
-	fs.IntVar(&historyLimit, "h", 4, "")
+	fs.StringVar(&contextName, "context", cliConfig.Context, "context|ctx: context name")
+	fs.StringVar(&contextName, "ctx", cliConfig.Context, "")
+	fs.IntVar(&historyLimit, "history", cliConfig.History, "history|h: number of prior messages to include")
+	fs.IntVar(&historyLimit, "h", cliConfig.History, "")
 	fs.StringVar(&systemPrompt, "system", "", "system|sp: system prompt for this context")
 	fs.StringVar(&systemPrompt, "sp", "", "")
-	fs.StringVar(&agentProfile, "agent", "", "agent|a: agent profile (code, golang-dev, etc)")
-	fs.StringVar(&agentProfile, "a", "", "")
+	fs.StringVar(&agentProfile, "agent", cliConfig.Agent, "agent|a: agent profile (code, golang-dev, etc)")
+	fs.StringVar(&agentProfile, "a", cliConfig.Agent, "")
 	fs.BoolVar(&localOnly, "local", false, "force local Ollama execution")
 	fs.BoolVar(&remoteOnly, "remote", false, "force remote execution")
-	fs.StringVar(&storageBackend, "storage", "file", "storage|s: storage backend (file|sqlite)")
-	fs.StringVar(&storageBackend, "s", "file", "")
-	fs.IntVar(&verbosity, "verbosity", -1, "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
-	fs.IntVar(&verbosity, "v", -1, "")
+	fs.StringVar(&storageBackend, "storage", cliConfig.Storage, "storage|s: storage backend (file|sqlite|postgres)")
+	fs.StringVar(&storageBackend, "s", cliConfig.Storage, "")
+	fs.IntVar(&verbosity, "verbosity", defaultVerbosity(), "verbosity|v: output verbosity (0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose, 5=exhaustive)")
+	fs.IntVar(&verbosity, "v", defaultVerbosity(), "")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -72,11 +71,7 @@ func RunTUICommand(args []string) error {
 		return fmt.Errorf("storage error: %w", err)
 	}
 
-	// Load remote URL
-	remoteURL, err := config.LoadRemote()
-	if err != nil {
-		return fmt.Errorf("config error: %w", err)
-	}
+	remoteURL := cliConfig.RemoteURL
 
 	// Load context
 	ctxHist, err := historyStore.LoadContext(contextName)
@@ -87,7 +82,7 @@ func RunTUICommand(args []string) error {
 	// Apply system prompt override if provided
 	if systemPrompt != "" {
 		ctxHist.System = systemPrompt
-		if err := historyStore.SaveContext(contextName, ctxHist); err != nil {
+		if err := historyStore.SaveSystem(contextName, ctxHist.System); err != nil {
 			return fmt.Errorf("save system prompt: %w", err)
 		}
 	}
@@ -112,6 +107,7 @@ func RunTUICommand(args []string) error {
 			RemoteURL:     remoteURL,
 			LocalOnly:     localOnly,
 			RemoteOnly:    remoteOnly,
+			RemoteTimeout: cliConfig.RemoteTimeout,
 			Profile:       profile,
 			Verbosity:     currentVerbosity,
 			Log:           logf,
@@ -119,7 +115,13 @@ func RunTUICommand(args []string) error {
 		if err != nil {
 			return tui.ExecutionResult{}, err
 		}
-		return tui.ExecutionResult{Reply: result.Reply, Source: result.Source}, nil
+		return tui.ExecutionResult{
+			Reply:   result.Reply,
+			Source:  result.Source,
+			Model:   result.Model,
+			Usage:   result.Usage,
+			Latency: result.Latency,
+		}, nil
 	}
 
 	// Determine agent name for display
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/usage"
+)
+
+// RunUsageCommand handles the 'usage' command: token usage from the server's
+// Postgres database (SIDEKICK_POSTGRES_DSN), like 'users' and 'audit'.
+func RunUsageCommand(args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	var user, since, until, by string
+	var days int
+	var asJSON bool
+	fs.StringVar(&user, "user", "", "user email or ID (default: all users)")
+	fs.StringVar(&since, "since", "", "first day, YYYY-MM-DD")
+	fs.StringVar(&until, "until", "", "last day, YYYY-MM-DD (default: today)")
+	fs.IntVar(&days, "days", 7, "number of days to show when --since is not set")
+	fs.StringVar(&by, "by", "day", "group by: comma-separated user, day, agent, model")
+	fs.BoolVar(&asJSON, "json", false, "print rows as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	groupBy, err := usage.ParseGroupBy(by)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.OpenPostgres()
+	if err != nil {
+		return fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	defer database.Close()
+
+	if err := usage.InitSchema(database); err != nil {
+		return fmt.Errorf("init usage schema: %w", err)
+	}
+
+	filter := usage.Filter{GroupBy: groupBy}
+	filter.Until = time.Now().UTC()
+	if until != "" {
+		if filter.Until, err = time.Parse("2006-01-02", until); err != nil {
+			return fmt.Errorf("--until must be YYYY-MM-DD")
+		}
+	}
+	filter.Since = filter.Until.AddDate(0, 0, -(days - 1))
+	if since != "" {
+		if filter.Since, err = time.Parse("2006-01-02", since); err != nil {
+			return fmt.Errorf("--since must be YYYY-MM-DD")
+		}
+	}
+
+	var email string
+	if user != "" {
+		if strings.Contains(user, "@") {
+			u, err := lookupUser(database, user)
+			if err != nil {
+				return err
+			}
+			filter.UserID = u.ID.String()
+			email = u.Email
+		} else {
+			filter.UserID = user
+		}
+	}
+
+	rows, err := usage.Query(database, filter)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if rows == nil {
+			rows = []usage.Row{}
+		}
+		data, _ := json.MarshalIndent(rows, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+
+	printUsageRows(rows, groupBy)
+
+	// Quota status for a single user, using the server's quota config
+	if filter.UserID != "" {
+		serverCfg, err := config.LoadServer()
+		if err != nil {
+			return nil
+		}
+		tracker := usage.NewTracker(database, serverCfg.Quota)
+		limit, err := tracker.Limit(filter.UserID)
+		if err != nil || limit <= 0 {
+			return nil
+		}
+		used, err := tracker.UsedToday(filter.UserID)
+		if err != nil {
+			return nil
+		}
+		who := email
+		if who == "" {
+			who = filter.UserID
+		}
+		fmt.Printf("\nQuota for %s: %d of %d tokens used today (resets in %s)\n",
+			who, used, limit, tracker.UntilReset().Round(time.Minute))
+	}
+	return nil
+}
+
+func printUsageRows(rows []usage.Row, groupBy []string) {
+	if len(rows) == 0 {
+		fmt.Println("No usage recorded.")
+		return
+	}
+
+	widths := map[string]int{"user": 36, "day": 10, "agent": 16, "model": 24}
+	header := ""
+	for _, dim := range groupBy {
+		header += fmt.Sprintf("%-*s ", widths[dim], strings.ToUpper(dim))
+	}
+	fmt.Printf("%s%9s %12s %12s %12s\n", header, "REQUESTS", "PROMPT", "COMPLETION", "TOTAL")
+
+	var total usage.Row
+	for _, r := range rows {
+		line := ""
+		for _, dim := range groupBy {
+			val := map[string]string{"user": r.UserID, "day": r.Day, "agent": r.Agent, "model": r.Model}[dim]
+			if val == "" {
+				val = "-"
+			}
+			line += fmt.Sprintf("%-*s ", widths[dim], val)
+		}
+		fmt.Printf("%s%9d %12d %12d %12d\n", line, r.Requests, r.PromptTokens, r.CompletionTokens, r.TotalTokens)
+		total.Requests += r.Requests
+		total.PromptTokens += r.PromptTokens
+		total.CompletionTokens += r.CompletionTokens
+		total.TotalTokens += r.TotalTokens
+	}
+	if len(rows) > 1 && len(groupBy) > 0 {
+		pad := 0
+		for _, dim := range groupBy {
+			pad += widths[dim] + 1
+		}
+		fmt.Printf("%-*s%9d %12d %12d %12d\n", pad, "TOTAL", total.Requests, total.PromptTokens, total.CompletionTokens, total.TotalTokens)
+	}
+}
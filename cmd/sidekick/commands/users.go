@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"golang.org/x/term"
+)
+
+// RunUsersCommand handles the 'users' subcommand. It manages server accounts
+// directly in Postgres (SIDEKICK_POSTGRES_DSN), so it works without a running
+// server and can be used to recover a locked-out admin.
+func RunUsersCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("users command requires a subcommand: list, create, passwd, role, disable, enable, delete, assign, unassign")
+	}
+
+	database, err := db.OpenPostgres()
+	if err != nil {
+		return fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	defer database.Close()
+
+	if err := auth.InitSchema(database); err != nil {
+		return fmt.Errorf("init auth schema: %w", err)
+	}
+
+	subcommand := args[0]
+	subArgs := args[1:]
+
+	switch subcommand {
+	case "list":
+		return runUsersListCommand(database)
+	case "create":
+		return runUsersCreateCommand(database, subArgs)
+	case "passwd":
+		return runUsersPasswdCommand(database, subArgs)
+	case "role":
+		return runUsersRoleCommand(database, subArgs)
+	case "disable":
+		return runUsersSetDisabledCommand(database, subArgs, true)
+	case "enable":
+		return runUsersSetDisabledCommand(database, subArgs, false)
+	case "delete":
+		return runUsersDeleteCommand(database, subArgs)
+	case "assign":
+		return runUsersAssignCommand(database, subArgs, true)
+	case "unassign":
+		return runUsersAssignCommand(database, subArgs, false)
+	default:
+		return fmt.Errorf("unknown users subcommand: %s", subcommand)
+	}
+}
+
+func runUsersListCommand(database *sql.DB) error {
+	users, err := auth.ListUsers(database)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-36s %-30s %-6s %-9s %-20s\n", "ID", "EMAIL", "ROLE", "STATUS", "LAST LOGIN")
+	for _, u := range users {
+		status := "active"
+		if u.Disabled() {
+			status = "disabled"
+		}
+		lastLogin := "-"
+		if u.LastLoginAt != nil {
+			lastLogin = u.LastLoginAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-36s %-30s %-6s %-9s %-20s\n", u.ID, u.Email, u.Role, status, lastLogin)
+	}
+	return nil
+}
+
+func runUsersCreateCommand(database *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: sidekick users create <email> [--role admin|user]")
+	}
+	email := args[0]
+
+	fs := flag.NewFlagSet("users create", flag.ExitOnError)
+	role := fs.String("role", auth.RoleUser, "role: admin|user")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if !auth.ValidRole(*role) {
+		return fmt.Errorf("role must be 'admin' or 'user'")
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+
+	user, err := auth.CreateUser(database, email, password, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created %s (%s, role %s)\n", user.Email, user.ID, user.Role)
+	return nil
+}
+
+func runUsersPasswdCommand(database *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sidekick users passwd <email>")
+	}
+	user, err := lookupUser(database, args[0])
+	if err != nil {
+		return err
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := auth.SetPassword(database, user.ID, password); err != nil {
+		return err
+	}
+	// A reset password should not leave old sessions alive.
+	if _, err := database.Exec(`DELETE FROM sessions WHERE user_id = $1`, user.ID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	fmt.Printf("Password updated for %s; existing sessions revoked\n", user.Email)
+	return nil
+}
+
+func runUsersRoleCommand(database *sql.DB, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: sidekick users role <email> admin|user")
+	}
+	user, err := lookupUser(database, args[0])
+	if err != nil {
+		return err
+	}
+	if err := auth.SetUserRole(database, user.ID, args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", user.Email, args[1])
+	return nil
+}
+
+func runUsersSetDisabledCommand(database *sql.DB, args []string, disabled bool) error {
+	verb := "enable"
+	if disabled {
+		verb = "disable"
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sidekick users %s <email>", verb)
+	}
+	user, err := lookupUser(database, args[0])
+	if err != nil {
+		return err
+	}
+	if err := auth.SetUserDisabled(database, user.ID, disabled); err != nil {
+		return err
+	}
+	fmt.Printf("%s %sd\n", user.Email, verb)
+	return nil
+}
+
+func runUsersDeleteCommand(database *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sidekick users delete <email>")
+	}
+	user, err := lookupUser(database, args[0])
+	if err != nil {
+		return err
+	}
+	if err := auth.DeleteUser(database, user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %s\n", user.Email)
+	return nil
+}
+
+func runUsersAssignCommand(database *sql.DB, args []string, assign bool) error {
+	verb := "unassign"
+	if assign {
+		verb = "assign"
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: sidekick users %s <email> <agent-id>", verb)
+	}
+	user, err := lookupUser(database, args[0])
+	if err != nil {
+		return err
+	}
+	agentID := args[1]
+
+	repo := agent.NewPostgresRepository(database)
+	if assign {
+		existing, err := repo.Get(agentID)
+		if err != nil {
+			return fmt.Errorf("get agent: %w", err)
+		}
+		if existing == nil {
+			return fmt.Errorf("agent not found in Postgres: %s (run 'sidekick sync agents push' first?)", agentID)
+		}
+		if err := repo.AssignAgentToUser(user.ID.String(), agentID); err != nil {
+			return fmt.Errorf("assign agent: %w", err)
+		}
+		fmt.Printf("Assigned %s to %s\n", agentID, user.Email)
+		return nil
+	}
+
+	if err := repo.UnassignAgentFromUser(user.ID.String(), agentID); err != nil {
+		return fmt.Errorf("unassign agent: %w", err)
+	}
+	fmt.Printf("Unassigned %s from %s\n", agentID, user.Email)
+	return nil
+}
+
+func lookupUser(database *sql.DB, email string) (*auth.User, error) {
+	user, err := auth.GetUserByEmail(database, strings.TrimSpace(email))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found: %s", email)
+	}
+	return user, nil
+}
+
+// promptNewPassword reads a new password. On a terminal it prompts twice
+// without echo; otherwise it reads a single line from stdin so scripts can
+// pipe a password in.
+func promptNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		return password, auth.ValidatePassword(password)
+	}
+
+	fmt.Fprint(os.Stderr, "New password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	if err := auth.ValidatePassword(string(first)); err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(first), nil
+}
@@ -1,11 +1,452 @@
 package commands
 
-import "github.com/earlysvahn/sidekick/internal/store"
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
-func resolveKeywordLister(historyStore store.HistoryStore) store.VerbosityKeywordLister {
-	if lister, ok := historyStore.(store.VerbosityKeywordLister); ok {
-		return lister
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+// resolveKeywordLister returns the local verbosity rules, the pseudo-user
+// they are stored under and a func that closes the database it opened, if
+// any. Like agents the rules always live in SQLite, whatever backend holds
+// the history, so escalation also works offline.
+func resolveKeywordLister(historyStore store.HistoryStore) (store.VerbosityKeywordLister, string, func() error) {
+	noop := func() error { return nil }
+	if sqliteStore, ok := historyStore.(*store.SQLiteStore); ok {
+		return sqliteStore, store.LocalUserID, noop
+	}
+	sqliteStore, err := store.NewSQLiteStore(db.SQLitePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[warning] verbosity rules unavailable: %v\n", err)
+		return store.NoopVerbosityKeywordStore{}, "", noop
+	}
+	return sqliteStore, store.LocalUserID, sqliteStore.Close
+}
+
+// RunVerbosityCommand handles the 'verbosity' command: dry runs and rule
+// management for verbosity escalation.
+func RunVerbosityCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("verbosity command requires a subcommand: test, keywords")
+	}
+
+	switch args[0] {
+	case "test":
+		return runVerbosityTestCommand(args[1:])
+	case "keywords":
+		return runVerbosityKeywordsCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown verbosity subcommand: %s", args[0])
+	}
+}
+
+func runVerbosityKeywordsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("verbosity keywords requires a subcommand: list, add, rm, import, export")
+	}
+
+	switch args[0] {
+	case "list":
+		return runVerbosityKeywordsListCommand(args[1:])
+	case "add":
+		return runVerbosityKeywordsAddCommand(args[1:])
+	case "rm":
+		return runVerbosityKeywordsRmCommand(args[1:])
+	case "import":
+		return runVerbosityKeywordsImportCommand(args[1:])
+	case "export":
+		return runVerbosityKeywordsExportCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown verbosity keywords subcommand: %s", args[0])
+	}
+}
+
+// runVerbosityTestCommand shows how a message would be resolved without
+// calling a model: the effective level and what every rule did.
+func runVerbosityTestCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity test", flag.ExitOnError)
+	agentName := fs.String("agent", "default", "agent the message is sent to")
+	verbosity := fs.Int("verbosity", -1, "requested verbosity (default: the configured default)")
+	user := fs.String("user", "", "server account (email or ID, default: local rules) whose rules to use")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	words, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	message := strings.Join(words, " ")
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("usage: sidekick verbosity test \"message\" [--agent NAME] [--verbosity N]")
+	}
+
+	profile := agent.GetProfile(*agentName)
+	if profile == nil {
+		return fmt.Errorf("unknown agent profile: %s\nAvailable profiles: %s", *agentName, strings.Join(agent.ListProfiles(), ", "))
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var requested *int
+	if *verbosity >= 0 {
+		requested = verbosity
+	}
+	result, err := executor.EvaluateVerbosity(context.Background(), requested, executor.DefaultVerbosity(), *agentName, profile, message, userID, keywordStore)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(map[string]any{
+			"agent":               *agentName,
+			"effective_verbosity": result.EffectiveVerbosity,
+			"escalated":           result.Escalated,
+			"deescalated":         result.Deescalated,
+			"warning":             result.Warning,
+			"matched_keywords":    result.MatchedKeywords,
+			"rules":               result.Rules,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Effective verbosity: %d\n", result.EffectiveVerbosity)
+	if result.Warning != "" {
+		fmt.Printf("Note: %s\n", result.Warning)
 	}
-	return store.NoopVerbosityKeywordStore{}
+	if len(result.Rules) == 0 {
+		fmt.Println("No rules configured.")
+		return nil
+	}
+	fmt.Println()
+	fmt.Printf("%-24s %-12s %-10s %8s  %s\n", "KEYWORD", "AGENT", "ACTION", "PRIORITY", "RESULT")
+	for _, ev := range result.Rules {
+		outcome := "skipped"
+		if ev.Applied {
+			outcome = "applied"
+		} else if ev.Matched {
+			outcome = "matched"
+		}
+		fmt.Printf("%-24s %-12s %-10s %8d  %s: %s\n", ev.Keyword, agentLabel(ev.Agent), ev.Action, ev.Priority, outcome, ev.Reason)
+	}
+	return nil
+}
+
+func runVerbosityKeywordsListCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity keywords list", flag.ExitOnError)
+	user := fs.String("user", "", "server account (email or ID, default: local rules) whose rules to list")
+	asJSON := fs.Bool("json", false, "print rules as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	keywords, err := keywordStore.ListVerbosityKeywords(context.Background(), userID)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if keywords == nil {
+			keywords = []store.VerbosityKeyword{}
+		}
+		data, _ := json.MarshalIndent(keywords, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(keywords) == 0 {
+		fmt.Println("No rules configured.")
+		return nil
+	}
+	fmt.Printf("%-24s %-12s %-8s %-10s %3s %3s %8s %-8s %s\n", "KEYWORD", "AGENT", "MATCH", "ACTION", "MIN", "TO", "PRIORITY", "ENABLED", "CONDITIONS")
+	for _, kw := range keywords {
+		fmt.Printf("%-24s %-12s %-8s %-10s %3d %3d %8d %-8t %s\n",
+			kw.Keyword, agentLabel(kw.Agent), kw.Match, kw.Action, kw.MinRequested, kw.EscalateTo, kw.Priority, kw.Enabled, ruleConditions(kw))
+	}
+	return nil
 }
 
+func runVerbosityKeywordsAddCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity keywords add", flag.ExitOnError)
+	user := fs.String("user", "", "server account (email or ID, default: local rules) to add the rule for")
+	agentName := fs.String("agent", "", "only apply to this agent (default: all agents)")
+	var kw store.VerbosityKeyword
+	fs.IntVar(&kw.EscalateTo, "to", 0, "verbosity to escalate or de-escalate to")
+	fs.IntVar(&kw.MinRequested, "min", 0, "minimum requested verbosity for the rule to apply")
+	fs.StringVar(&kw.Match, "match", store.MatchContains, "how to match: contains, word or regex")
+	fs.StringVar(&kw.Action, "action", store.ActionEscalate, "escalate, deescalate or suppress")
+	fs.IntVar(&kw.Priority, "priority", 0, "higher priority rules override lower ones")
+	fs.IntVar(&kw.MinLength, "min-length", 0, "only match messages at least this many characters long")
+	fs.IntVar(&kw.MaxLength, "max-length", 0, "only match messages at most this many characters long")
+	fs.StringVar(&kw.CodeBlock, "code", store.CodeBlockAny, "code block condition: any, required or forbidden")
+	disabled := fs.Bool("disabled", false, "add the rule disabled")
+	words, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) != 1 {
+		return fmt.Errorf("usage: sidekick verbosity keywords add KEYWORD --to N [--action A] [--match M]")
+	}
+	kw.Keyword = words[0]
+	kw.Enabled = !*disabled
+	if *agentName != "" {
+		kw.Agent = agentName
+	}
+	kw, err = store.NormalizeVerbosityKeyword(kw)
+	if err != nil {
+		return err
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if _, err := keywordStore.CreateVerbosityKeyword(context.Background(), userID, kw); err != nil {
+		return err
+	}
+	fmt.Printf("Added rule %q\n", kw.Keyword)
+	return nil
+}
+
+func runVerbosityKeywordsRmCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity keywords rm", flag.ExitOnError)
+	user := fs.String("user", "", "server account (email or ID, default: local rules) to remove the rule from")
+	words, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) != 1 {
+		return fmt.Errorf("usage: sidekick verbosity keywords rm KEYWORD")
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if err := keywordStore.DeleteVerbosityKeyword(context.Background(), userID, words[0]); err != nil {
+		return fmt.Errorf("remove rule %q: %w", words[0], err)
+	}
+	fmt.Printf("Removed rule %q\n", words[0])
+	return nil
+}
+
+// runVerbosityKeywordsExportCommand writes all rules as a JSON array, the
+// format 'verbosity keywords import' reads.
+func runVerbosityKeywordsExportCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity keywords export", flag.ExitOnError)
+	user := fs.String("user", "", "server account (email or ID, default: local rules) whose rules to export")
+	filePath := fs.String("file", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	keywords, err := keywordStore.ListVerbosityKeywords(context.Background(), userID)
+	if err != nil {
+		return err
+	}
+	if keywords == nil {
+		keywords = []store.VerbosityKeyword{}
+	}
+	data, err := json.MarshalIndent(keywords, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	data = append(data, '\n')
+
+	if *filePath == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*filePath, data, 0o644); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	fmt.Printf("Exported %d rules to %s\n", len(keywords), *filePath)
+	return nil
+}
+
+// runVerbosityKeywordsImportCommand reads a JSON array of rules. Imported
+// rules replace existing rules with the same keyword; with --replace, rules
+// missing from the input are removed.
+func runVerbosityKeywordsImportCommand(args []string) error {
+	fs := flag.NewFlagSet("verbosity keywords import", flag.ExitOnError)
+	user := fs.String("user", "", "server account (email or ID, default: local rules) to import the rules for")
+	filePath := fs.String("file", "", "read from this file instead of stdin")
+	replace := fs.Bool("replace", false, "remove rules that are not in the input")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	if *filePath != "" {
+		data, err = os.ReadFile(*filePath)
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+	}
+
+	var rules []struct {
+		store.VerbosityKeyword
+		Enabled *bool `json:"enabled"` // rules are enabled unless they say otherwise
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse json: %w", err)
+	}
+	// Validate everything before touching the store
+	input := make([]store.VerbosityKeyword, 0, len(rules))
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		rule.VerbosityKeyword.Enabled = rule.Enabled == nil || *rule.Enabled
+		kw, err := store.NormalizeVerbosityKeyword(rule.VerbosityKeyword)
+		if err != nil {
+			return fmt.Errorf("rule %d (%q): %w", i+1, rule.Keyword, err)
+		}
+		if seen[kw.Keyword] {
+			return fmt.Errorf("rule %q appears more than once", kw.Keyword)
+		}
+		seen[kw.Keyword] = true
+		input = append(input, kw)
+	}
+
+	keywordStore, userID, closeStore, err := openKeywordStore(*user)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	existing, err := keywordStore.ListVerbosityKeywords(ctx, userID)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, kw := range existing {
+		if *replace && !seen[kw.Keyword] {
+			removed++
+		}
+	}
+	// All or nothing: a failed import leaves the old rules in place
+	if err := keywordStore.PutVerbosityKeywords(ctx, userID, input, *replace); err != nil {
+		return fmt.Errorf("import rules: %w", err)
+	}
+
+	fmt.Printf("Imported %d rules", len(input))
+	if removed > 0 {
+		fmt.Printf(", removed %d", removed)
+	}
+	fmt.Println()
+	return nil
+}
+
+// openKeywordStore opens the local verbosity rules, or those of a server
+// account (email or ID) in the server's Postgres database
+// (SIDEKICK_POSTGRES_DSN) when user is set.
+func openKeywordStore(user string) (store.VerbosityKeywordStore, string, func() error, error) {
+	if strings.TrimSpace(user) == "" {
+		sqliteStore, err := store.NewSQLiteStore(db.SQLitePath())
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to open SQLite: %w", err)
+		}
+		return sqliteStore, store.LocalUserID, sqliteStore.Close, nil
+	}
+	dsn, ok := db.PostgresDSN()
+	if !ok {
+		return nil, "", nil, &db.PostgresNotConfiguredError{}
+	}
+
+	userID := user
+	if strings.Contains(user, "@") {
+		database, err := db.OpenPostgresDSN(dsn)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to open Postgres: %w", err)
+		}
+		u, err := lookupUser(database, user)
+		database.Close()
+		if err != nil {
+			return nil, "", nil, err
+		}
+		userID = u.ID.String()
+	}
+
+	pgStore, err := store.NewPostgresStore(dsn)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	return pgStore, userID, pgStore.Close, nil
+}
+
+// parseInterleaved parses args with fs, allowing flags before, between and
+// after the positional arguments, which it returns.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func agentLabel(agent *string) string {
+	if agent == nil {
+		return "*"
+	}
+	return *agent
+}
+
+// ruleConditions summarises a rule's message conditions for listings.
+func ruleConditions(kw store.VerbosityKeyword) string {
+	var conds []string
+	if kw.MinLength > 0 {
+		conds = append(conds, fmt.Sprintf("length>=%d", kw.MinLength))
+	}
+	if kw.MaxLength > 0 {
+		conds = append(conds, fmt.Sprintf("length<=%d", kw.MaxLength))
+	}
+	switch kw.CodeBlock {
+	case store.CodeBlockRequired:
+		conds = append(conds, "code")
+	case store.CodeBlockForbidden:
+		conds = append(conds, "no code")
+	}
+	if len(conds) == 0 {
+		return "-"
+	}
+	return strings.Join(conds, ", ")
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/earlysvahn/sidekick/cmd/sidekick/commands"
 	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/audit"
 	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/cli"
+	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/earlysvahn/sidekick/internal/logging"
+	"github.com/earlysvahn/sidekick/internal/notify"
+	"github.com/earlysvahn/sidekick/internal/ollama"
 	"github.com/earlysvahn/sidekick/internal/server"
 	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
 )
 
 func main() {
@@ -31,6 +42,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 'config' must work even when the current config does not validate
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := commands.RunConfigCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Flag defaults come from config.json and SIDEKICK_* variables
+	if err := commands.LoadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "[config error] %v\n", err)
+		os.Exit(1)
+	}
+
 	// Route to appropriate command
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
@@ -70,18 +96,56 @@ func main() {
 				os.Exit(1)
 			}
 			return
+		case "users":
+			if err := commands.RunUsersCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "audit":
+			if err := commands.RunAuditCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "batch":
+			if err := commands.RunBatchCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "models":
+			if err := commands.RunModelsCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "usage":
+			if err := commands.RunUsageCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "verbosity":
+			if err := commands.RunVerbosityCommand(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
 		}
 	}
 
-	// One-shot mode or help
-	if len(os.Args) == 1 || os.Args[1] == "--help" || os.Args[1] == "-h" || os.Args[1] == "help" {
+	// One-shot mode or help; a bare 'sidekick' with piped stdin is a prompt
+	if (len(os.Args) == 1 && !cli.StdinPiped()) || (len(os.Args) > 1 && (os.Args[1] == "--help" || os.Args[1] == "-h" || os.Args[1] == "help")) {
 		commands.PrintUsage()
 		os.Exit(0)
 	}
 
 	// Execute one-shot query
 	if err := commands.RunOneShot(os.Args[1:]); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		if !errors.Is(err, commands.ErrReported) {
+			fmt.Fprintln(os.Stderr, err)
+		}
 		os.Exit(1)
 	}
 }
@@ -118,6 +182,28 @@ func runServer() error {
 		return fmt.Errorf("SIDEKICK_POSTGRES_DSN environment variable is required for API mode")
 	}
 
+	serverCfg, err := config.LoadServer()
+	if err != nil {
+		return fmt.Errorf("failed to load server config: %w", err)
+	}
+
+	// Structured JSON logs on stderr
+	if err := logging.Setup(serverCfg.Log); err != nil {
+		return fmt.Errorf("invalid log config: %w", err)
+	}
+
+	// Notifications (login alerts, failed generations, ...)
+	notifier, err := notify.New(serverCfg.Notify)
+	if err != nil {
+		return fmt.Errorf("invalid notify config: %w", err)
+	}
+	notify.SetDefault(notifier)
+
+	// Ollama hosts; generations are routed to a host that has the model
+	if err := setupOllamaPool(serverCfg.Ollama); err != nil {
+		return fmt.Errorf("invalid ollama config: %w", err)
+	}
+
 	// Open Postgres connection
 	postgresDB, err := db.OpenPostgres()
 	if err != nil {
@@ -151,6 +237,20 @@ func runServer() error {
 		return fmt.Errorf("failed to init auth schema: %w", err)
 	}
 
+	// Audit: append-only audit_events table (idempotent)
+	if err := audit.InitSchema(postgresDB); err != nil {
+		historyStore.Close()
+		postgresDB.Close()
+		return fmt.Errorf("failed to init audit schema: %w", err)
+	}
+
+	// Usage: daily token rollup table (idempotent)
+	if err := usage.InitSchema(postgresDB); err != nil {
+		historyStore.Close()
+		postgresDB.Close()
+		return fmt.Errorf("failed to init usage schema: %w", err)
+	}
+
 	// Auth: create bootstrap user from env vars if not already present
 	if err := auth.EnsureBootstrapUser(postgresDB); err != nil {
 		historyStore.Close()
@@ -158,7 +258,68 @@ func runServer() error {
 		return fmt.Errorf("failed to ensure bootstrap user: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "[sidekick] using Postgres for storage\n")
+	// Auth: session lifetime policy and expired-row cleanup
+	auth.SetSessionPolicy(auth.SessionPolicy{
+		TTL:         serverCfg.Sessions.TTL.Std(),
+		MaxLifetime: serverCfg.Sessions.MaxLifetime.Std(),
+		Sliding:     serverCfg.Sessions.Sliding,
+	})
+	auth.StartSessionSweeper(postgresDB, serverCfg.Sessions.SweepEvery())
 
-	return server.Run("", historyStore, agentRepo, postgresDB)
+	// Auth: optional OpenID Connect login. The client secret may come from
+	// the environment to keep it out of server.json.
+	if secret := os.Getenv("SIDEKICK_OIDC_CLIENT_SECRET"); secret != "" {
+		serverCfg.OIDC.ClientSecret = secret
+	}
+	if token := os.Getenv("SIDEKICK_METRICS_TOKEN"); token != "" {
+		serverCfg.Metrics.Token = token
+	}
+
+	oidcProvider, err := auth.NewOIDCProvider(context.Background(), serverCfg.OIDC)
+	if err != nil {
+		historyStore.Close()
+		postgresDB.Close()
+		return fmt.Errorf("failed to initialize OIDC: %w", err)
+	}
+	if oidcProvider != nil {
+		slog.Info("OIDC login enabled", "issuer", serverCfg.OIDC.Issuer)
+	}
+
+	slog.Info("using Postgres for storage")
+
+	return server.Run("", historyStore, agentRepo, postgresDB, server.Options{
+		OIDC:      oidcProvider,
+		Metrics:   serverCfg.Metrics,
+		Scheduler: serverCfg.Scheduler,
+		Quota:     serverCfg.Quota,
+		WebSocket: serverCfg.WebSocket,
+	})
+}
+
+// setupOllamaPool makes the configured Ollama hosts the default pool and
+// starts their health checks.
+func setupOllamaPool(cfg config.OllamaConfig) error {
+	if url := os.Getenv("SIDEKICK_OLLAMA_URL"); url != "" {
+		ollama.BaseURL = strings.TrimRight(url, "/")
+	}
+	if len(cfg.Hosts) == 0 {
+		return nil
+	}
+
+	hosts := make([]ollama.Host, 0, len(cfg.Hosts))
+	for i, h := range cfg.Hosts {
+		if strings.TrimSpace(h.URL) == "" {
+			return fmt.Errorf("hosts[%d]: url is required", i)
+		}
+		if h.MaxConcurrent < 0 {
+			return fmt.Errorf("hosts[%d]: max_concurrent must be >= 0", i)
+		}
+		hosts = append(hosts, ollama.Host{URL: h.URL, MaxConcurrent: h.MaxConcurrent})
+	}
+	pool := ollama.NewPool(hosts, cfg.ProbeInterval.Std())
+	ollama.BaseURL = pool.Status()[0].URL
+	ollama.SetDefaultPool(pool)
+	pool.Start()
+	slog.Info("ollama pool configured", "hosts", len(hosts))
+	return nil
 }
@@ -28,6 +28,9 @@ func (r *PostgresRepository) InitSchema() error {
 		model TEXT NOT NULL,
 		system_prompt TEXT NOT NULL DEFAULT '',
 		default_verbosity INTEGER NOT NULL DEFAULT 2 CHECK(default_verbosity >= 0 AND default_verbosity <= 4),
+		verbosity_bias INTEGER NOT NULL DEFAULT 0,
+		min_verbosity INTEGER NOT NULL DEFAULT 0,
+		max_verbosity INTEGER,
 		enabled BOOLEAN NOT NULL DEFAULT TRUE,
 		revision INTEGER NOT NULL DEFAULT 1,
 		updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -35,6 +38,9 @@ func (r *PostgresRepository) InitSchema() error {
 
 	-- Migrate existing tables that predate these columns.
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS verbosity_bias INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS min_verbosity INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS max_verbosity INTEGER;
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
 
@@ -55,8 +61,8 @@ func (r *PostgresRepository) Create(agent *AgentRecord) error {
 	agent.UpdatedAt = time.Now().UTC()
 
 	query := `
-	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
 	_, err := r.db.Exec(query,
 		agent.ID,
@@ -65,6 +71,9 @@ func (r *PostgresRepository) Create(agent *AgentRecord) error {
 		agent.Model,
 		agent.SystemPrompt,
 		agent.DefaultVerbosity,
+		agent.VerbosityBias,
+		agent.MinVerbosity,
+		agent.MaxVerbosity,
 		agent.Enabled,
 		agent.Revision,
 		agent.UpdatedAt,
@@ -84,8 +93,9 @@ func (r *PostgresRepository) Update(agent *AgentRecord) error {
 	query := `
 	UPDATE agents
 	SET name = $1, base_agent = $2, model = $3, system_prompt = $4,
-	    default_verbosity = $5, enabled = $6, revision = $7, updated_at = $8
-	WHERE id = $9
+	    default_verbosity = $5, verbosity_bias = $6, min_verbosity = $7, max_verbosity = $8,
+	    enabled = $9, revision = $10, updated_at = $11
+	WHERE id = $12
 	`
 	result, err := r.db.Exec(query,
 		agent.Name,
@@ -93,6 +103,9 @@ func (r *PostgresRepository) Update(agent *AgentRecord) error {
 		agent.Model,
 		agent.SystemPrompt,
 		agent.DefaultVerbosity,
+		agent.VerbosityBias,
+		agent.MinVerbosity,
+		agent.MaxVerbosity,
 		agent.Enabled,
 		agent.Revision,
 		agent.UpdatedAt,
@@ -116,7 +129,7 @@ func (r *PostgresRepository) Update(agent *AgentRecord) error {
 // Get retrieves an agent by ID.
 func (r *PostgresRepository) Get(id string) (*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	WHERE id = $1
 	`
@@ -128,6 +141,9 @@ func (r *PostgresRepository) Get(id string) (*AgentRecord, error) {
 		&agent.Model,
 		&agent.SystemPrompt,
 		&agent.DefaultVerbosity,
+		&agent.VerbosityBias,
+		&agent.MinVerbosity,
+		&agent.MaxVerbosity,
 		&agent.Enabled,
 		&agent.Revision,
 		&agent.UpdatedAt,
@@ -144,7 +160,7 @@ func (r *PostgresRepository) Get(id string) (*AgentRecord, error) {
 // List returns all agents (enabled or disabled).
 func (r *PostgresRepository) List() ([]*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	ORDER BY name
 	`
@@ -164,6 +180,9 @@ func (r *PostgresRepository) List() ([]*AgentRecord, error) {
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -179,7 +198,7 @@ func (r *PostgresRepository) List() ([]*AgentRecord, error) {
 // ListEnabled returns only enabled agents.
 func (r *PostgresRepository) ListEnabled() ([]*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	WHERE enabled = TRUE
 	ORDER BY name
@@ -200,6 +219,9 @@ func (r *PostgresRepository) ListEnabled() ([]*AgentRecord, error) {
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -241,7 +263,8 @@ func (r *PostgresRepository) ListAgentsByUser(userID string, enabledOnly bool) (
 
 	query := fmt.Sprintf(`
 	SELECT a.id, a.name, a.base_agent, a.model, a.system_prompt,
-	       a.default_verbosity, a.enabled, a.revision, a.updated_at
+	       a.default_verbosity, a.verbosity_bias, a.min_verbosity, a.max_verbosity,
+	       a.enabled, a.revision, a.updated_at
 	FROM agents a
 	INNER JOIN user_agents ua ON ua.agent_id = a.id
 	%s
@@ -264,6 +287,9 @@ func (r *PostgresRepository) ListAgentsByUser(userID string, enabledOnly bool) (
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -281,7 +307,8 @@ func (r *PostgresRepository) ListAgentsByUser(userID string, enabledOnly bool) (
 func (r *PostgresRepository) GetAgentByUser(userID, agentID string) (*AgentRecord, error) {
 	query := `
 	SELECT a.id, a.name, a.base_agent, a.model, a.system_prompt,
-	       a.default_verbosity, a.enabled, a.revision, a.updated_at
+	       a.default_verbosity, a.verbosity_bias, a.min_verbosity, a.max_verbosity,
+	       a.enabled, a.revision, a.updated_at
 	FROM agents a
 	INNER JOIN user_agents ua ON ua.agent_id = a.id
 	WHERE ua.user_id = $1::uuid
@@ -297,6 +324,9 @@ func (r *PostgresRepository) GetAgentByUser(userID, agentID string) (*AgentRecor
 		&agent.Model,
 		&agent.SystemPrompt,
 		&agent.DefaultVerbosity,
+		&agent.VerbosityBias,
+		&agent.MinVerbosity,
+		&agent.MaxVerbosity,
 		&agent.Enabled,
 		&agent.Revision,
 		&agent.UpdatedAt,
@@ -351,6 +381,23 @@ func (r *PostgresRepository) SetUserAgentEnabled(userID, agentID string, enabled
 	return nil
 }
 
+// UserAgentEnabled reports a user's enabled flag for an agent and whether
+// the agent is assigned to them at all.
+func (r *PostgresRepository) UserAgentEnabled(userID, agentID string) (enabled, assigned bool, err error) {
+	query := `
+	SELECT enabled FROM user_agents
+	WHERE user_id = $1::uuid AND agent_id = $2
+	`
+	err = r.db.QueryRow(query, userID, agentID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return enabled, true, nil
+}
+
 // IsAssignedToUser checks if an agent is assigned to a user.
 func (r *PostgresRepository) IsAssignedToUser(userID, agentID string) (bool, error) {
 	query := `
@@ -6,7 +6,10 @@ type AgentProfile struct {
 	LocalModel       string
 	RemoteModel      string
 	SystemPrompt     string
-	DefaultVerbosity int // 0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose
+	DefaultVerbosity int  // 0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose
+	VerbosityBias    int  // Added to the requested verbosity before keyword rules
+	MinVerbosity     int  // Lowest verbosity the agent answers at
+	MaxVerbosity     *int // Highest verbosity the agent answers at (nil = no cap)
 }
 
 // Profiles is the registry of all available agent profiles
@@ -16,6 +16,9 @@ type AgentRecord struct {
 	Model            string    // Ollama model name
 	SystemPrompt     string    // System prompt text
 	DefaultVerbosity int       // 0=minimal, 1=concise, 2=normal, 3=verbose, 4=very verbose
+	VerbosityBias    int       // Added to the requested verbosity before keyword rules
+	MinVerbosity     int       // Lowest verbosity the agent answers at
+	MaxVerbosity     *int      // Highest verbosity the agent answers at (nil = no cap)
 	Enabled          bool      // Whether agent is active
 	Revision         int       // Monotonic version counter for sync
 	UpdatedAt        time.Time // Last modification timestamp
@@ -42,6 +45,9 @@ func (r *Repository) InitSchema() error {
 		model TEXT NOT NULL,
 		system_prompt TEXT NOT NULL DEFAULT '',
 		default_verbosity INTEGER NOT NULL DEFAULT 2 CHECK(default_verbosity >= 0 AND default_verbosity <= 4),
+		verbosity_bias INTEGER NOT NULL DEFAULT 0,
+		min_verbosity INTEGER NOT NULL DEFAULT 0,
+		max_verbosity INTEGER,
 		enabled INTEGER NOT NULL DEFAULT 1,
 		revision INTEGER NOT NULL DEFAULT 1,
 		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -49,8 +55,49 @@ func (r *Repository) InitSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_agents_enabled ON agents(enabled);
 	CREATE INDEX IF NOT EXISTS idx_agents_name ON agents(name);
 	`
-	_, err := r.db.Exec(schema)
-	return err
+	if _, err := r.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Migrate existing tables that predate these columns
+	columns := []struct{ name, definition string }{
+		{"verbosity_bias", "INTEGER NOT NULL DEFAULT 0"},
+		{"min_verbosity", "INTEGER NOT NULL DEFAULT 0"},
+		{"max_verbosity", "INTEGER"},
+	}
+	for _, c := range columns {
+		if err := r.ensureColumn(c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds a column to the agents table unless it exists.
+func (r *Repository) ensureColumn(name, definition string) error {
+	rows, err := r.db.Query(`SELECT name FROM pragma_table_info('agents')`)
+	if err != nil {
+		return fmt.Errorf("inspect agents table: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var colName string
+		if err := rows.Scan(&colName); err != nil {
+			return fmt.Errorf("scan agents columns: %w", err)
+		}
+		if colName == name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate agents columns: %w", err)
+	}
+
+	if _, err := r.db.Exec(fmt.Sprintf(`ALTER TABLE agents ADD COLUMN %s %s`, name, definition)); err != nil {
+		return fmt.Errorf("add agents.%s: %w", name, err)
+	}
+	return nil
 }
 
 // Create inserts a new agent. Sets revision=1 and updated_at=now.
@@ -64,8 +111,8 @@ func (r *Repository) Create(agent *AgentRecord) error {
 	agent.UpdatedAt = time.Now().UTC()
 
 	query := `
-	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	_, err := r.db.Exec(query,
 		agent.ID,
@@ -74,6 +121,9 @@ func (r *Repository) Create(agent *AgentRecord) error {
 		agent.Model,
 		agent.SystemPrompt,
 		agent.DefaultVerbosity,
+		agent.VerbosityBias,
+		agent.MinVerbosity,
+		agent.MaxVerbosity,
 		agent.Enabled,
 		agent.Revision,
 		agent.UpdatedAt,
@@ -95,7 +145,8 @@ func (r *Repository) Update(agent *AgentRecord) error {
 	query := `
 	UPDATE agents
 	SET name = ?, base_agent = ?, model = ?, system_prompt = ?,
-	    default_verbosity = ?, enabled = ?, revision = ?, updated_at = ?
+	    default_verbosity = ?, verbosity_bias = ?, min_verbosity = ?, max_verbosity = ?,
+	    enabled = ?, revision = ?, updated_at = ?
 	WHERE id = ?
 	`
 	result, err := r.db.Exec(query,
@@ -104,6 +155,9 @@ func (r *Repository) Update(agent *AgentRecord) error {
 		agent.Model,
 		agent.SystemPrompt,
 		agent.DefaultVerbosity,
+		agent.VerbosityBias,
+		agent.MinVerbosity,
+		agent.MaxVerbosity,
 		agent.Enabled,
 		agent.Revision,
 		agent.UpdatedAt,
@@ -127,7 +181,7 @@ func (r *Repository) Update(agent *AgentRecord) error {
 // Get retrieves an agent by ID.
 func (r *Repository) Get(id string) (*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	WHERE id = ?
 	`
@@ -139,6 +193,9 @@ func (r *Repository) Get(id string) (*AgentRecord, error) {
 		&agent.Model,
 		&agent.SystemPrompt,
 		&agent.DefaultVerbosity,
+		&agent.VerbosityBias,
+		&agent.MinVerbosity,
+		&agent.MaxVerbosity,
 		&agent.Enabled,
 		&agent.Revision,
 		&agent.UpdatedAt,
@@ -155,7 +212,7 @@ func (r *Repository) Get(id string) (*AgentRecord, error) {
 // List returns all agents (enabled or disabled).
 func (r *Repository) List() ([]*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	ORDER BY name
 	`
@@ -175,6 +232,9 @@ func (r *Repository) List() ([]*AgentRecord, error) {
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -190,7 +250,7 @@ func (r *Repository) List() ([]*AgentRecord, error) {
 // ListEnabled returns only enabled agents.
 func (r *Repository) ListEnabled() ([]*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	WHERE enabled = 1
 	ORDER BY name
@@ -211,6 +271,9 @@ func (r *Repository) ListEnabled() ([]*AgentRecord, error) {
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -256,6 +319,20 @@ func validateAgent(agent *AgentRecord) error {
 	if agent.DefaultVerbosity < 0 || agent.DefaultVerbosity > 4 {
 		return fmt.Errorf("default verbosity must be 0-4, got %d", agent.DefaultVerbosity)
 	}
+	if agent.VerbosityBias < -4 || agent.VerbosityBias > 4 {
+		return fmt.Errorf("verbosity bias must be between -4 and 4, got %d", agent.VerbosityBias)
+	}
+	if agent.MinVerbosity < 0 || agent.MinVerbosity > 4 {
+		return fmt.Errorf("min verbosity must be 0-4, got %d", agent.MinVerbosity)
+	}
+	if agent.MaxVerbosity != nil {
+		if *agent.MaxVerbosity < 0 || *agent.MaxVerbosity > 4 {
+			return fmt.Errorf("max verbosity must be 0-4, got %d", *agent.MaxVerbosity)
+		}
+		if *agent.MaxVerbosity < agent.MinVerbosity {
+			return fmt.Errorf("max verbosity %d is below min verbosity %d", *agent.MaxVerbosity, agent.MinVerbosity)
+		}
+	}
 	return nil
 }
 
@@ -267,5 +344,8 @@ func (a *AgentRecord) ToAgentProfile() *AgentProfile {
 		RemoteModel:      a.Model, // For now, same model for local/remote
 		SystemPrompt:     a.SystemPrompt,
 		DefaultVerbosity: a.DefaultVerbosity,
+		VerbosityBias:    a.VerbosityBias,
+		MinVerbosity:     a.MinVerbosity,
+		MaxVerbosity:     a.MaxVerbosity,
 	}
 }
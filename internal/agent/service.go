@@ -178,6 +178,9 @@ func MigrateHardcodedAgents(repo AgentRepository) error {
 			Model:            profile.LocalModel,
 			SystemPrompt:     profile.SystemPrompt,
 			DefaultVerbosity: profile.DefaultVerbosity,
+			VerbosityBias:    profile.VerbosityBias,
+			MinVerbosity:     profile.MinVerbosity,
+			MaxVerbosity:     profile.MaxVerbosity,
 			Enabled:          true,
 		}
 
@@ -94,6 +94,9 @@ func initPostgresSchema(db *sql.DB) error {
 		model TEXT NOT NULL,
 		system_prompt TEXT NOT NULL DEFAULT '',
 		default_verbosity INTEGER NOT NULL DEFAULT 2 CHECK(default_verbosity >= 0 AND default_verbosity <= 4),
+		verbosity_bias INTEGER NOT NULL DEFAULT 0,
+		min_verbosity INTEGER NOT NULL DEFAULT 0,
+		max_verbosity INTEGER,
 		enabled BOOLEAN NOT NULL DEFAULT TRUE,
 		revision INTEGER NOT NULL DEFAULT 1,
 		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -101,6 +104,9 @@ func initPostgresSchema(db *sql.DB) error {
 
 	-- Migrate existing tables that predate these columns.
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS verbosity_bias INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS min_verbosity INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE agents ADD COLUMN IF NOT EXISTS max_verbosity INTEGER;
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
 	ALTER TABLE agents ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
 
@@ -115,14 +121,17 @@ func initPostgresSchema(db *sql.DB) error {
 // ONLY overwrites if local revision >= Postgres revision.
 func upsertToPostgres(db *sql.DB, agent *AgentRecord) error {
 	query := `
-	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO agents (id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	ON CONFLICT (id) DO UPDATE SET
 		name = EXCLUDED.name,
 		base_agent = EXCLUDED.base_agent,
 		model = EXCLUDED.model,
 		system_prompt = EXCLUDED.system_prompt,
 		default_verbosity = EXCLUDED.default_verbosity,
+		verbosity_bias = EXCLUDED.verbosity_bias,
+		min_verbosity = EXCLUDED.min_verbosity,
+		max_verbosity = EXCLUDED.max_verbosity,
 		enabled = EXCLUDED.enabled,
 		revision = EXCLUDED.revision,
 		updated_at = EXCLUDED.updated_at
@@ -135,6 +144,9 @@ func upsertToPostgres(db *sql.DB, agent *AgentRecord) error {
 		agent.Model,
 		agent.SystemPrompt,
 		agent.DefaultVerbosity,
+		agent.VerbosityBias,
+		agent.MinVerbosity,
+		agent.MaxVerbosity,
 		agent.Enabled,
 		agent.Revision,
 		agent.UpdatedAt,
@@ -145,7 +157,7 @@ func upsertToPostgres(db *sql.DB, agent *AgentRecord) error {
 // listFromPostgres retrieves all agents from Postgres.
 func listFromPostgres(db *sql.DB) ([]*AgentRecord, error) {
 	query := `
-	SELECT id, name, base_agent, model, system_prompt, default_verbosity, enabled, revision, updated_at
+	SELECT id, name, base_agent, model, system_prompt, default_verbosity, verbosity_bias, min_verbosity, max_verbosity, enabled, revision, updated_at
 	FROM agents
 	ORDER BY name
 	`
@@ -165,6 +177,9 @@ func listFromPostgres(db *sql.DB) ([]*AgentRecord, error) {
 			&agent.Model,
 			&agent.SystemPrompt,
 			&agent.DefaultVerbosity,
+			&agent.VerbosityBias,
+			&agent.MinVerbosity,
+			&agent.MaxVerbosity,
 			&agent.Enabled,
 			&agent.Revision,
 			&agent.UpdatedAt,
@@ -0,0 +1,277 @@
+// Package audit records security-relevant and administrative actions in an
+// append-only Postgres table.
+//
+// Recording is best-effort: a failed insert is logged to stderr and never
+// fails the request that triggered it.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Actions recorded by sidekick. Names are "<area>.<object>.<verb>" so that
+// filters can match by prefix (e.g. "auth.").
+const (
+	ActionLoginSuccess   = "auth.login.success"
+	ActionLoginFailure   = "auth.login.failure"
+	ActionLoginBlocked   = "auth.login.blocked"
+	ActionLogout         = "auth.logout"
+	ActionPasswordChange = "auth.password.change"
+	ActionSessionRevoke  = "auth.session.revoke"
+	ActionTOTPEnable     = "auth.totp.enable"
+	ActionTOTPDisable    = "auth.totp.disable"
+
+	ActionUserCreate   = "admin.user.create"
+	ActionUserUpdate   = "admin.user.update"
+	ActionUserDelete   = "admin.user.delete"
+	ActionUserAssign   = "admin.user.agent_assign"
+	ActionUserUnassign = "admin.user.agent_unassign"
+
+	ActionAgentCreate   = "agent.create"
+	ActionAgentAssign   = "agent.assign"
+	ActionAgentUpdate   = "agent.update"
+	ActionAgentUnassign = "agent.unassign"
+
+	ActionContextUpdate = "context.update"
+	ActionContextDelete = "context.delete"
+)
+
+// Target types.
+const (
+	TargetUser    = "user"
+	TargetSession = "session"
+	TargetAgent   = "agent"
+	TargetContext = "context"
+)
+
+// Event is one audit record.
+type Event struct {
+	ID         int64          `json:"id"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	ActorID    string         `json:"actor_id,omitempty"`    // empty for unauthenticated actions
+	ActorEmail string         `json:"actor_email,omitempty"` // attempted email for failed logins
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type,omitempty"`
+	TargetID   string         `json:"target_id,omitempty"`
+	IP         string         `json:"ip,omitempty"`
+	UserAgent  string         `json:"user_agent,omitempty"`
+	Diff       map[string]any `json:"diff,omitempty"`
+}
+
+// InitSchema creates the audit_events table. UPDATE and DELETE are turned
+// into no-ops by rules, so rows can only ever be appended.
+// Safe to call on every startup (idempotent).
+func InitSchema(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_events (
+			id          BIGSERIAL   PRIMARY KEY,
+			occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			actor_id    TEXT,
+			actor_email TEXT,
+			action      TEXT        NOT NULL,
+			target_type TEXT,
+			target_id   TEXT,
+			ip          TEXT,
+			user_agent  TEXT,
+			diff        JSONB
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id    ON audit_events(actor_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_events_action      ON audit_events(action);
+
+		CREATE OR REPLACE RULE audit_events_no_update AS
+			ON UPDATE TO audit_events DO INSTEAD NOTHING;
+		CREATE OR REPLACE RULE audit_events_no_delete AS
+			ON DELETE TO audit_events DO INSTEAD NOTHING;
+	`)
+	return err
+}
+
+// Record appends ev. db may be nil (auditing disabled, e.g. in tests).
+func Record(db *sql.DB, ev Event) {
+	if db == nil {
+		return
+	}
+	var diff any
+	if len(ev.Diff) > 0 {
+		b, err := json.Marshal(ev.Diff)
+		if err == nil {
+			diff = string(b)
+		}
+	}
+	_, err := db.Exec(`
+		INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id, ip, user_agent, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb)
+	`, nullIfEmpty(ev.ActorID), nullIfEmpty(ev.ActorEmail), ev.Action,
+		nullIfEmpty(ev.TargetType), nullIfEmpty(ev.TargetID), nullIfEmpty(ev.IP),
+		nullIfEmpty(ev.UserAgent), diff)
+	if err != nil {
+		slog.Error("audit write failed", "action", ev.Action, "err", err)
+	}
+}
+
+// Diff returns the fields that differ between before and after as
+// {"field": {"from": x, "to": y}}. Both values are compared through their
+// JSON form, so structs, maps and pointers can be mixed. A nil before
+// records a creation; a nil after records a deletion.
+func Diff(before, after any) map[string]any {
+	b, a := toMap(before), toMap(after)
+	out := make(map[string]any)
+	for k, bv := range b {
+		av, ok := a[k]
+		if !ok {
+			out[k] = map[string]any{"from": bv, "to": nil}
+		} else if !reflect.DeepEqual(bv, av) {
+			out[k] = map[string]any{"from": bv, "to": av}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = map[string]any{"from": nil, "to": av}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func toMap(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Filter selects audit events. Zero-value fields are ignored.
+type Filter struct {
+	Actor      string // actor id or email
+	Action     string // exact action, or prefix when ending in "*" or "."
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	AfterID    int64 // only events with id > AfterID, returned oldest first
+	Limit      int
+}
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Query returns matching events, newest first (oldest first when AfterID is
+// set, which is what a follow/tail loop wants).
+func Query(db *sql.DB, f Filter) ([]Event, error) {
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Actor != "" {
+		args = append(args, f.Actor)
+		where = append(where, fmt.Sprintf("(actor_id = $%d OR actor_email = $%d)", len(args), len(args)))
+	}
+	if f.Action != "" {
+		if prefix, ok := actionPrefix(f.Action); ok {
+			add("action LIKE $%d", escapeLike(prefix)+"%")
+		} else {
+			add("action = $%d", f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < $%d", f.Until)
+	}
+	order := "DESC"
+	if f.AfterID > 0 {
+		add("id > $%d", f.AfterID)
+		order = "ASC"
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	query := `
+		SELECT id, occurred_at, COALESCE(actor_id, ''), COALESCE(actor_email, ''), action,
+		       COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(ip, ''),
+		       COALESCE(user_agent, ''), diff
+		FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id %s LIMIT %d", order, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var ev Event
+		var diff []byte
+		if err := rows.Scan(&ev.ID, &ev.OccurredAt, &ev.ActorID, &ev.ActorEmail, &ev.Action,
+			&ev.TargetType, &ev.TargetID, &ev.IP, &ev.UserAgent, &diff); err != nil {
+			return nil, fmt.Errorf("scan audit event: %w", err)
+		}
+		if len(diff) > 0 {
+			_ = json.Unmarshal(diff, &ev.Diff)
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+func actionPrefix(action string) (string, bool) {
+	if strings.HasSuffix(action, "*") {
+		return strings.TrimSuffix(action, "*"), true
+	}
+	if strings.HasSuffix(action, ".") {
+		return action, true
+	}
+	return "", false
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
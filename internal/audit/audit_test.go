@@ -0,0 +1,37 @@
+package audit
+
+import "testing"
+
+func TestDiff_ReportsChangedFieldsOnly(t *testing.T) {
+	type ctx struct {
+		Name      string `json:"name"`
+		Agent     string `json:"agent"`
+		Verbosity int    `json:"verbosity"`
+	}
+	d := Diff(ctx{"a", "default", 2}, ctx{"b", "default", 3})
+
+	if len(d) != 2 {
+		t.Fatalf("got %d changed fields, want 2: %v", len(d), d)
+	}
+	name, ok := d["name"].(map[string]any)
+	if !ok || name["from"] != "a" || name["to"] != "b" {
+		t.Fatalf("unexpected name diff: %v", d["name"])
+	}
+	if _, ok := d["agent"]; ok {
+		t.Fatal("unchanged field should not appear in diff")
+	}
+}
+
+func TestDiff_CreateAndDelete(t *testing.T) {
+	created := Diff(nil, map[string]any{"id": "x"})
+	if v := created["id"].(map[string]any); v["from"] != nil || v["to"] != "x" {
+		t.Fatalf("unexpected create diff: %v", created)
+	}
+	deleted := Diff(map[string]any{"id": "x"}, nil)
+	if v := deleted["id"].(map[string]any); v["from"] != "x" || v["to"] != nil {
+		t.Fatalf("unexpected delete diff: %v", deleted)
+	}
+	if Diff(map[string]any{"a": 1}, map[string]any{"a": 1}) != nil {
+		t.Fatal("identical values should yield nil diff")
+	}
+}
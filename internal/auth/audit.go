@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/earlysvahn/sidekick/internal/audit"
+)
+
+// RecordAudit appends an audit event for request r, filling in the client IP,
+// user agent and, when not set, the authenticated actor.
+func RecordAudit(db *sql.DB, r *http.Request, ev audit.Event) {
+	ev.IP = ClientIP(r)
+	ev.UserAgent = r.UserAgent()
+	if ev.ActorID == "" {
+		if id, ok := UserIDFromContext(r.Context()); ok {
+			ev.ActorID = id.String()
+		}
+	}
+	audit.Record(db, ev)
+}
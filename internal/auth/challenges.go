@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// challengeTTL bounds how long a password-verified login may wait for its
+	// second factor.
+	challengeTTL = 5 * time.Minute
+	// challengeMaxAttempts invalidates a challenge after this many wrong codes,
+	// independent of the per-IP limiter.
+	challengeMaxAttempts = 5
+)
+
+// LoginChallenge is a pending login that passed the password check and
+// still needs a second factor.
+type LoginChallenge struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	Attempts  int
+	Redirect  string // where an OIDC login continues once verified; "" otherwise
+}
+
+// CreateLoginChallenge issues a short-lived challenge for the user.
+func CreateLoginChallenge(db *sql.DB, userID uuid.UUID, redirect string) (*LoginChallenge, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate challenge: %w", err)
+	}
+	c := &LoginChallenge{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(challengeTTL),
+		Redirect:  redirect,
+	}
+	if _, err := db.Exec(`
+		INSERT INTO login_challenges (token, user_id, expires_at, redirect) VALUES ($1, $2, $3, $4)
+	`, c.Token, c.UserID, c.ExpiresAt, c.Redirect); err != nil {
+		return nil, fmt.Errorf("insert challenge: %w", err)
+	}
+	// Opportunistic cleanup; challenges are too short-lived to need a sweeper.
+	_, _ = db.Exec(`DELETE FROM login_challenges WHERE expires_at <= NOW()`)
+	return c, nil
+}
+
+// GetLoginChallenge loads an unexpired challenge. Returns (nil, nil) if the
+// token is unknown, expired or exhausted.
+func GetLoginChallenge(db *sql.DB, token string) (*LoginChallenge, error) {
+	var c LoginChallenge
+	err := db.QueryRow(`
+		SELECT token, user_id, expires_at, attempts, redirect
+		FROM login_challenges
+		WHERE token = $1 AND expires_at > NOW() AND attempts < $2
+	`, token, challengeMaxAttempts).Scan(&c.Token, &c.UserID, &c.ExpiresAt, &c.Attempts, &c.Redirect)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get challenge: %w", err)
+	}
+	return &c, nil
+}
+
+// RecordChallengeFailure increments the challenge's failed attempt counter.
+func RecordChallengeFailure(db *sql.DB, token string) error {
+	_, err := db.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token = $1`, token)
+	return err
+}
+
+// DeleteLoginChallenge removes a challenge once it has been completed.
+func DeleteLoginChallenge(db *sql.DB, token string) error {
+	_, err := db.Exec(`DELETE FROM login_challenges WHERE token = $1`, token)
+	return err
+}
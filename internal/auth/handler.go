@@ -7,6 +7,9 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/earlysvahn/sidekick/internal/audit"
+	"github.com/earlysvahn/sidekick/internal/metrics"
 )
 
 // secureCookies returns true only if SIDEKICK_COOKIE_SECURE is explicitly "true".
@@ -16,8 +19,36 @@ func secureCookies() bool {
 	return strings.ToLower(os.Getenv("SIDEKICK_COOKIE_SECURE")) == "true"
 }
 
+// setSessionCookie issues (or re-issues, after renewal) the session cookie.
+func setSessionCookie(w http.ResponseWriter, sess *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.Token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  sess.ExpiresAt,
+	})
+}
+
+// clearSessionCookie instructs the browser to drop the session cookie.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
 // HandleLogin handles POST /auth/login.
 // Validates email + password, creates a session, and sets the session cookie.
+// If the user has TOTP enabled, no session is created; the response carries
+// mfa_required and a challenge token to complete via /auth/login/totp.
 // limiter may be nil (disables rate limiting).
 func HandleLogin(db *sql.DB, limiter *LoginLimiter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -27,7 +58,7 @@ func HandleLogin(db *sql.DB, limiter *LoginLimiter) http.HandlerFunc {
 		}
 
 		if limiter != nil {
-			ip := clientIP(r)
+			ip := ClientIP(r)
 			if limiter.IsBlocked(ip) {
 				http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
 				return
@@ -56,44 +87,106 @@ func HandleLogin(db *sql.DB, limiter *LoginLimiter) http.HandlerFunc {
 		}
 		// Deliberate: same response for "user not found" and "wrong password".
 		if user == nil || !user.CheckPassword(req.Password) {
+			failure := audit.Event{Action: audit.ActionLoginFailure, ActorEmail: email, Diff: map[string]any{"method": "password"}}
+			if user != nil {
+				failure.ActorID = user.ID.String()
+			}
+			RecordAudit(db, r, failure)
+			metrics.LoginFailures.WithLabelValues("password").Inc()
 			if limiter != nil {
-				ip := clientIP(r)
+				ip := ClientIP(r)
 				if newlyBlocked := limiter.RecordFailure(ip); newlyBlocked {
-					go notifyLoginBlock(ip, time.Now().Add(loginBlock))
+					metrics.LoginBlocks.WithLabelValues("password").Inc()
+					notifyLoginBlock(ip, time.Now().Add(loginBlock))
+					RecordAudit(db, r, audit.Event{Action: audit.ActionLoginBlocked, ActorEmail: email})
 				}
 			}
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
-
-		sess, err := CreateSession(db, user.ID)
-		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+		if user.Disabled() {
+			RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionLoginFailure,
+				ActorID:    user.ID.String(),
+				ActorEmail: user.Email,
+				Diff:       map[string]any{"method": "password", "reason": "disabled"},
+			})
+			http.Error(w, "account disabled", http.StatusForbidden)
 			return
 		}
 
-		if err := MarkLogin(db, user.ID); err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+		if user.TOTPEnabled {
+			challenge, err := CreateLoginChallenge(db, user.ID, "")
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"mfa_required": true,
+				"mfa_method":   "totp",
+				"challenge":    challenge.Token,
+				"expires_at":   challenge.ExpiresAt.UTC().Format(time.RFC3339),
+			})
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     sessionCookie,
-			Value:    sess.Token,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   secureCookies(),
-			SameSite: http.SameSiteLaxMode,
-			Expires:  sess.ExpiresAt,
-		})
+		completeLogin(db, w, r, user, "password", "")
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"user_id":    user.ID.String(),
-			"email":      user.Email,
-			"expires_at": sess.ExpiresAt.UTC().Format(time.RFC3339),
-		})
+// completeLogin starts a session for a fully authenticated user and writes
+// the JSON login response. A non-empty redirect is the path the client
+// should continue to, as for an OIDC login that needed a second factor.
+func completeLogin(db *sql.DB, w http.ResponseWriter, r *http.Request, user *User, method, redirect string) {
+	sess, err := startSession(db, w, r, user, method)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]any{
+		"user_id":    user.ID.String(),
+		"email":      user.Email,
+		"expires_at": sess.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if redirect != "" {
+		resp["redirect"] = redirect
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// startSession creates a session for an authenticated user, records the
+// login and sets the session cookie. Shared by password, TOTP and OIDC logins;
+// method names the final factor for the audit log.
+func startSession(db *sql.DB, w http.ResponseWriter, r *http.Request, user *User, method string) (*Session, error) {
+	ip := ClientIP(r)
+	sess, err := CreateSession(db, user.ID, r.UserAgent(), ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := MarkLogin(db, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Best-effort: a tracking failure must not block a valid login.
+	if isNew, err := RecordLoginIP(db, user.ID, ip); err == nil && isNew {
+		notifyNewLoginIP(user.Email, ip, r.UserAgent())
+	}
+
+	RecordAudit(db, r, audit.Event{
+		Action:     audit.ActionLoginSuccess,
+		ActorID:    user.ID.String(),
+		ActorEmail: user.Email,
+		TargetType: audit.TargetSession,
+		TargetID:   sess.ID,
+		Diff:       map[string]any{"method": method},
+	})
+
+	setSessionCookie(w, sess)
+	return sess, nil
 }
 
 // HandleLogout handles POST /auth/logout.
@@ -107,18 +200,18 @@ func HandleLogout(db *sql.DB) http.HandlerFunc {
 		}
 
 		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if sess, err := GetSession(db, cookie.Value); err == nil && sess != nil {
+				RecordAudit(db, r, audit.Event{
+					Action:     audit.ActionLogout,
+					ActorID:    sess.UserID.String(),
+					TargetType: audit.TargetSession,
+					TargetID:   sess.ID,
+				})
+			}
 			_ = DeleteSession(db, cookie.Value) // best-effort
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     sessionCookie,
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   secureCookies(),
-			SameSite: http.SameSiteLaxMode,
-			MaxAge:   -1,
-		})
+		clearSessionCookie(w)
 
 		w.WriteHeader(http.StatusNoContent)
 	}
@@ -139,31 +232,95 @@ func HandleMe(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var email string
-		var createdAt time.Time
-		var lastLogin sql.NullTime
-		err := db.QueryRow(`
-			SELECT email, created_at, last_login_at FROM users WHERE id = $1
-		`, userID).Scan(&email, &createdAt, &lastLogin)
-		if err == sql.ErrNoRows {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
+		user, err := GetUserByID(db, userID)
 		if err != nil {
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		if user == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
 
 		resp := map[string]any{
 			"user_id":    userID.String(),
-			"email":      email,
-			"created_at": createdAt.UTC().Format(time.RFC3339),
+			"email":      user.Email,
+			"role":       user.Role,
+			"totp":       user.TOTPEnabled,
+			"created_at": user.CreatedAt.UTC().Format(time.RFC3339),
 		}
-		if lastLogin.Valid {
-			resp["last_login_at"] = lastLogin.Time.UTC().Format(time.RFC3339)
+		if user.LastLoginAt != nil {
+			resp["last_login_at"] = user.LastLoginAt.UTC().Format(time.RFC3339)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
+
+// HandleChangePassword handles POST /auth/password.
+// Must be wrapped with RequireAuth. Requires the current password and revokes
+// all of the user's other sessions on success.
+func HandleChangePassword(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.CurrentPassword == "" || req.NewPassword == "" {
+			http.Error(w, "current_password and new_password required", http.StatusBadRequest)
+			return
+		}
+		if err := ValidatePassword(req.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || !user.CheckPassword(req.CurrentPassword) {
+			http.Error(w, "current password is incorrect", http.StatusForbidden)
+			return
+		}
+
+		if err := SetPassword(db, userID, req.NewPassword); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Over an API key there is no current session, so every session
+		// is revoked
+		currentID, _ := SessionIDFromContext(r.Context())
+		revoked, err := DeleteOtherSessions(db, userID, currentID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionPasswordChange,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Diff:       map[string]any{"sessions_revoked": revoked},
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/earlysvahn/sidekick/internal/notify"
+	"github.com/google/uuid"
+)
+
+// RecordLoginIP records a successful login from ip for the user.
+// Returns true if the IP has not been seen for this user before AND the user
+// has logged in from at least one other IP (the very first login is not
+// treated as suspicious).
+func RecordLoginIP(db *sql.DB, userID uuid.UUID, ip string) (bool, error) {
+	var known int
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM user_login_ips WHERE user_id = $1
+	`, userID).Scan(&known); err != nil {
+		return false, fmt.Errorf("count login ips: %w", err)
+	}
+
+	var inserted bool
+	err := db.QueryRow(`
+		INSERT INTO user_login_ips (user_id, ip)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, ip) DO UPDATE SET last_seen_at = NOW()
+		RETURNING (xmax = 0)
+	`, userID, ip).Scan(&inserted)
+	if err != nil {
+		return false, fmt.Errorf("record login ip: %w", err)
+	}
+	return inserted && known > 0, nil
+}
+
+// notifyNewLoginIP emits a login_new_ip event.
+func notifyNewLoginIP(email, ip, userAgent string) {
+	notify.Send(notify.Event{
+		Type:    notify.EventLoginNewIP,
+		Title:   "New login location",
+		Message: fmt.Sprintf("%s signed in from a previously unseen IP %s", email, ip),
+		Fields: map[string]string{
+			"email":      email,
+			"ip":         ip,
+			"user_agent": userAgent,
+		},
+		Key: email + "|" + ip,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/earlysvahn/sidekick/internal/logging"
 	"github.com/google/uuid"
 )
 
@@ -16,6 +17,8 @@ const sessionCookie = "sidekick_session"
 
 type contextKey struct{}
 
+type sessionContextKey struct{}
+
 // UserIDFromContext extracts the authenticated user's UUID from the request
 // context. Returns (uuid.Nil, false) if no authenticated user is present.
 func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
@@ -23,6 +26,19 @@ func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 	return id, ok
 }
 
+// WithUserID returns ctx authenticated as userID, as RequireAuth would for
+// an API-key request. For tests and in-process callers.
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// SessionIDFromContext returns the public ID of the session that authenticated
+// the request. Returns ("", false) for API-key requests.
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionContextKey{}).(string)
+	return id, ok && id != ""
+}
+
 // RequireAuth wraps a handler with authentication. It first checks for an API
 // key in the Authorization: Bearer header matched against SIDEKICK_API_KEY. If
 // that check is absent or does not match, it falls through to cookie-based
@@ -42,6 +58,7 @@ func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 						http.Error(w, "server misconfigured: SIDEKICK_API_USER_ID not set or invalid", http.StatusInternalServerError)
 						return
 					}
+					logging.Annotate(r.Context(), "user", userID.String())
 					ctx := context.WithValue(r.Context(), contextKey{}, userID)
 					next(w, r.WithContext(ctx))
 					return
@@ -62,7 +79,36 @@ func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Best-effort: a failed touch must not reject an otherwise valid session.
+		if renewed, err := TouchSession(db, sess); err == nil && renewed {
+			setSessionCookie(w, sess)
+		}
+
+		logging.Annotate(r.Context(), "user", sess.UserID.String())
 		ctx := context.WithValue(r.Context(), contextKey{}, sess.UserID)
+		ctx = context.WithValue(ctx, sessionContextKey{}, sess.ID)
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// RequireAdmin wraps a handler so that only authenticated, active users with
+// the admin role can reach it. Implies RequireAuth.
+func RequireAdmin(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Disabled() || !user.IsAdmin() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
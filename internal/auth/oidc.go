@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie = "sidekick_oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+
+	// oidcChallengeCookie carries the TOTP challenge of an OIDC login to
+	// /auth/login/totp; the browser arrives by redirect and cannot be
+	// handed a JSON challenge.
+	oidcChallengeCookie = "sidekick_mfa_challenge"
+	// oidcTOTPPath is the web UI route that asks for the TOTP code.
+	oidcTOTPPath = "/login/totp"
+)
+
+var (
+	// ErrOIDCState is returned when the callback state is unknown, expired or
+	// does not match the browser's state cookie.
+	ErrOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCEmailUnverified is returned when the IdP does not assert a verified email.
+	ErrOIDCEmailUnverified = errors.New("identity provider did not return a verified email")
+	// ErrOIDCNoAccount is returned when no local user matches and signup is disabled.
+	ErrOIDCNoAccount = errors.New("no sidekick account for this identity")
+)
+
+// OIDCIdentity is the verified result of an authorization-code exchange.
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Redirect      string // post-login path requested at /auth/oidc/login
+}
+
+// oidcPending is the server-side half of an in-flight login.
+type oidcPending struct {
+	nonce    string
+	verifier string
+	redirect string
+	expires  time.Time
+}
+
+// OIDCProvider runs the authorization-code flow with PKCE against one issuer.
+type OIDCProvider struct {
+	oauth       oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	issuer      string
+	allowSignup bool
+
+	mu      sync.Mutex
+	pending map[string]oidcPending // keyed by state
+}
+
+// NewOIDCProvider discovers the issuer's endpoints and keys. Returns (nil, nil)
+// when OIDC is not configured.
+func NewOIDCProvider(ctx context.Context, cfg config.OIDCConfig) (*OIDCProvider, error) {
+	if strings.TrimSpace(cfg.Issuer) == "" {
+		return nil, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc: client_id and redirect_url are required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+
+	return &OIDCProvider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:    provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		issuer:      cfg.Issuer,
+		allowSignup: cfg.AllowSignup,
+		pending:     make(map[string]oidcPending),
+	}, nil
+}
+
+// AuthCodeURL starts a login: it records state, nonce and PKCE verifier and
+// returns the IdP authorization URL plus the state to bind to the browser.
+// redirect is the local path to return to after login ("" means "/").
+func (p *OIDCProvider) AuthCodeURL(redirect string) (authURL, state string, err error) {
+	state, err = randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	p.mu.Lock()
+	for k, v := range p.pending {
+		if now.After(v.expires) {
+			delete(p.pending, k)
+		}
+	}
+	p.pending[state] = oidcPending{
+		nonce:    nonce,
+		verifier: verifier,
+		redirect: safeRedirect(redirect),
+		expires:  now.Add(oidcStateTTL),
+	}
+	p.mu.Unlock()
+
+	authURL = p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+// Exchange completes a login: it consumes the state, redeems code with the
+// PKCE verifier, and verifies the ID token signature, audience and nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (*OIDCIdentity, error) {
+	p.mu.Lock()
+	pending, ok := p.pending[state]
+	delete(p.pending, state) // single use, even on failure
+	p.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, ErrOIDCState
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok || rawID == "" {
+		return nil, fmt.Errorf("oidc: token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawID)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: verify id_token: %w", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, fmt.Errorf("oidc: nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: parse claims: %w", err)
+	}
+
+	return &OIDCIdentity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Redirect:      pending.redirect,
+	}, nil
+}
+
+// ResolveOIDCUser maps a verified identity to a local user. Lookup order:
+//  1. an existing (issuer, subject) link in user_identities
+//  2. a user with the same verified email, which is then linked
+//  3. a new user with role "user" and no password, if allowSignup
+func ResolveOIDCUser(db *sql.DB, id *OIDCIdentity, allowSignup bool) (*User, error) {
+	var userID uuid.UUID
+	err := db.QueryRow(`
+		SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2
+	`, id.Issuer, id.Subject).Scan(&userID)
+	if err == nil {
+		return GetUserByID(db, userID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("lookup identity: %w", err)
+	}
+
+	if id.Email == "" || !id.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	user, err := GetUserByEmail(db, id.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if !allowSignup {
+			return nil, ErrOIDCNoAccount
+		}
+		user, err = createPasswordlessUser(db, id.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO user_identities (issuer, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`, id.Issuer, id.Subject, user.ID, id.Email); err != nil {
+		return nil, fmt.Errorf("link identity: %w", err)
+	}
+	return user, nil
+}
+
+// createPasswordlessUser inserts a user whose password_hash is empty, which
+// never matches in CheckPassword, so the account can only sign in via OIDC
+// until an admin sets a password.
+func createPasswordlessUser(db *sql.DB, email string) (*User, error) {
+	user, err := scanUser(db.QueryRow(`
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, $2, '', $3)
+		RETURNING `+userColumns,
+		uuid.New(), email, RoleUser,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+	return user, nil
+}
+
+// safeRedirect only allows local absolute paths, preventing open redirects.
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// HandleOIDCLogin handles GET /auth/oidc/login.
+// Redirects the browser to the identity provider. An optional ?redirect=/path
+// selects where to land after a successful login.
+func HandleOIDCLogin(p *OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		authURL, state, err := p.AuthCodeURL(r.URL.Query().Get("redirect"))
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Bind the state to this browser so a callback URL cannot be replayed
+		// from elsewhere (login CSRF).
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/auth/oidc",
+			HttpOnly: true,
+			Secure:   secureCookies(),
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   int(oidcStateTTL.Seconds()),
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// HandleOIDCCallback handles GET /auth/oidc/callback.
+// Verifies the IdP response, resolves or links the local user by verified
+// email, issues the normal session cookie and redirects into the app.
+// Users with TOTP enabled get no session yet: the challenge goes into a
+// short-lived cookie and the browser is redirected to the web UI's TOTP
+// page, whose POST /auth/login/totp finishes the login and returns the
+// original redirect.
+func HandleOIDCCallback(db *sql.DB, p *OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "identity provider error: "+e, http.StatusUnauthorized)
+			return
+		}
+
+		state := q.Get("state")
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || state == "" || cookie.Value != state {
+			http.Error(w, ErrOIDCState.Error(), http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    "",
+			Path:     "/auth/oidc",
+			HttpOnly: true,
+			Secure:   secureCookies(),
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   -1,
+		})
+
+		identity, err := p.Exchange(r.Context(), state, q.Get("code"))
+		if errors.Is(err, ErrOIDCState) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "oidc callback failed", "err", err)
+			http.Error(w, "login failed", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := ResolveOIDCUser(db, identity, p.allowSignup)
+		switch {
+		case errors.Is(err, ErrOIDCEmailUnverified), errors.Is(err, ErrOIDCNoAccount):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		case user == nil:
+			http.Error(w, ErrOIDCNoAccount.Error(), http.StatusForbidden)
+			return
+		case user.Disabled():
+			http.Error(w, "account disabled", http.StatusForbidden)
+			return
+		}
+
+		if user.TOTPEnabled {
+			challenge, err := CreateLoginChallenge(db, user.ID, identity.Redirect)
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     oidcChallengeCookie,
+				Value:    challenge.Token,
+				Path:     "/auth/login/totp",
+				HttpOnly: true,
+				Secure:   secureCookies(),
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   int(challengeTTL.Seconds()),
+			})
+			http.Redirect(w, r, oidcTOTPPath, http.StatusFound)
+			return
+		}
+
+		if _, err := startSession(db, w, r, user, "oidc"); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, identity.Redirect, http.StatusFound)
+	}
+}
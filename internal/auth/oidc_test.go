@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// fakeIdP is a minimal OpenID provider: discovery, JWKS, and a token
+// endpoint that enforces PKCE and returns an RS256-signed ID token.
+type fakeIdP struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	client string
+
+	mu    sync.Mutex
+	codes map[string]authRequest // code -> request it was issued for
+	email string
+}
+
+type authRequest struct {
+	nonce     string
+	challenge string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, client: "sidekick", codes: map[string]authRequest{}, email: "user@example.com"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.srv.URL,
+			"authorization_endpoint":                idp.srv.URL + "/authorize",
+			"token_endpoint":                        idp.srv.URL + "/token",
+			"jwks_uri":                              idp.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", idp.handleToken)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize simulates the user approving the login at the IdP and returns
+// the authorization code the IdP would hand back via redirect.
+func (idp *fakeIdP) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		idp.t.Fatalf("authorization request missing PKCE: %s", authURL)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + q.Get("state")
+	idp.codes[code] = authRequest{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	return code
+}
+
+func (idp *fakeIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	req, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		http.Error(w, `{"error":"invalid_grant","error_description":"pkce"}`, http.StatusBadRequest)
+		return
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: idp.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "k1"),
+	)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	now := time.Now()
+	claims, _ := json.Marshal(map[string]any{
+		"iss":            idp.srv.URL,
+		"sub":            "subject-1",
+		"aud":            idp.client,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          req.nonce,
+		"email":          idp.email,
+		"email_verified": true,
+	})
+	sig, err := signer.Sign(claims)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idToken, _ := sig.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newTestProvider(t *testing.T, idp *fakeIdP) *OIDCProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(context.Background(), config.OIDCConfig{
+		Issuer:      idp.srv.URL,
+		ClientID:    idp.client,
+		RedirectURL: "http://sidekick.test/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return p
+}
+
+func TestOIDC_ExchangeReturnsVerifiedIdentity(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp)
+
+	authURL, state, err := p.AuthCodeURL("/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := idp.authorize(authURL)
+
+	id, err := p.Exchange(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if id.Email != "user@example.com" || !id.EmailVerified || id.Subject != "subject-1" || id.Issuer != idp.srv.URL {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if id.Redirect != "/chat" {
+		t.Fatalf("redirect = %q, want /chat", id.Redirect)
+	}
+}
+
+func TestOIDC_StateIsSingleUse(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp)
+
+	authURL, state, _ := p.AuthCodeURL("")
+	code := idp.authorize(authURL)
+	if _, err := p.Exchange(context.Background(), state, code); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("replayed state: got %v, want ErrOIDCState", err)
+	}
+	if _, err := p.Exchange(context.Background(), "unknown", code); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("unknown state: got %v, want ErrOIDCState", err)
+	}
+}
+
+func TestOIDC_LoginRedirectSetsStateCookie(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp)
+
+	rec := httptest.NewRecorder()
+	HandleOIDCLogin(p)(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?redirect=//evil.example", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302", rec.Code)
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || loc.Host != mustHost(t, idp.srv.URL) || loc.Path != "/authorize" {
+		t.Fatalf("unexpected redirect %q", rec.Header().Get("Location"))
+	}
+
+	var stateCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil || stateCookie.Value != loc.Query().Get("state") || !stateCookie.HttpOnly {
+		t.Fatalf("state cookie missing or mismatched: %+v", stateCookie)
+	}
+
+	// Open redirect attempts collapse to "/".
+	code := idp.authorize(loc.String())
+	id, err := p.Exchange(context.Background(), stateCookie.Value, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Redirect != "/" {
+		t.Fatalf("redirect = %q, want /", id.Redirect)
+	}
+}
+
+func TestOIDC_CallbackRejectsStateCookieMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp)
+
+	authURL, state, _ := p.AuthCodeURL("")
+	code := idp.authorize(authURL)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state="+state+"&code="+code, nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "other"})
+	rec := httptest.NewRecorder()
+	HandleOIDCCallback(nil, p)(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+// TOTP is enforced on the account, not the login method: an OIDC login
+// must not issue a session before the second factor.
+func TestOIDC_CallbackRequiresTOTP(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := newTestProvider(t, idp)
+
+	// The statements the callback runs are portable, so SQLite stands in for
+	// Postgres with just the tables they touch.
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL,
+			role TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME, disabled_at DATETIME, totp_enabled_at DATETIME
+		);
+		CREATE TABLE user_identities (
+			issuer TEXT NOT NULL, subject TEXT NOT NULL, user_id TEXT NOT NULL, email TEXT NOT NULL,
+			PRIMARY KEY (issuer, subject)
+		);
+		CREATE TABLE login_challenges (
+			token TEXT PRIMARY KEY, user_id TEXT NOT NULL, attempts INT NOT NULL DEFAULT 0, expires_at DATETIME NOT NULL,
+			redirect TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, role, totp_enabled_at) VALUES ($1, $2, 'x', $3, CURRENT_TIMESTAMP)`,
+		userID, idp.email, RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, state, _ := p.AuthCodeURL("/chat")
+	code := idp.authorize(authURL)
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state="+state+"&code="+code, nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+	rec := httptest.NewRecorder()
+	HandleOIDCCallback(db, p)(rec, req)
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d (%s), want 302 to the TOTP step", rec.Code, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); loc != oidcTOTPPath {
+		t.Fatalf("Location = %q, want %q", loc, oidcTOTPPath)
+	}
+	var challenge string
+	for _, c := range rec.Result().Cookies() {
+		switch c.Name {
+		case sessionCookie:
+			t.Fatal("session cookie issued before the TOTP challenge")
+		case oidcChallengeCookie:
+			if !c.HttpOnly {
+				t.Fatal("challenge cookie is readable from scripts")
+			}
+			challenge = c.Value
+		}
+	}
+	if challenge == "" {
+		t.Fatal("no challenge cookie set")
+	}
+	var challengeUser uuid.UUID
+	var redirect string
+	if err := db.QueryRow(`SELECT user_id, redirect FROM login_challenges WHERE token = $1`, challenge).Scan(&challengeUser, &redirect); err != nil {
+		t.Fatal(err)
+	}
+	if challengeUser != userID || redirect != "/chat" {
+		t.Fatalf("challenge = (%s, %q), want (%s, %q)", challengeUser, redirect, userID, "/chat")
+	}
+}
+
+func mustHost(t *testing.T, raw string) string {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -1,15 +1,14 @@
 package auth
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/earlysvahn/sidekick/internal/notify"
 )
 
 const (
@@ -79,34 +78,56 @@ func (l *LoginLimiter) RecordFailure(ip string) (newlyBlocked bool) {
 	return false
 }
 
-// notifyLoginBlock posts a Discord message if SIDEKICK_DISCORD_WEBHOOK is set.
-// Runs in a goroutine — never blocks the request path.
-func notifyLoginBlock(ip string, until time.Time) {
-	webhookURL := os.Getenv("SIDEKICK_DISCORD_WEBHOOK")
-	if webhookURL == "" {
-		return
-	}
+// LimiterScope separates independent attempt counters in one LoginLimiter.
+type LimiterScope string
 
-	msg := fmt.Sprintf(
-		"[sidekick] Login blocked: IP %s exceeded %d failed attempts. Blocked until %s.",
-		ip, loginMaxFails, until.UTC().Format(time.RFC3339),
-	)
-	body, err := json.Marshal(map[string]string{"content": msg})
-	if err != nil {
-		return
-	}
+const (
+	// ScopePassword counts failed email/password checks.
+	ScopePassword LimiterScope = ""
+	// ScopeTOTP counts failed second-factor codes, so guessing TOTP codes
+	// does not consume (or reset) the password budget and vice versa.
+	ScopeTOTP LimiterScope = "totp"
+)
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return
+// key maps (scope, ip) to an entries key. The password scope uses the bare
+// IP so existing entries and callers are unaffected.
+func (s LimiterScope) key(ip string) string {
+	if s == ScopePassword {
+		return ip
 	}
-	resp.Body.Close()
+	return string(s) + "|" + ip
+}
+
+// IsBlockedScope reports whether the IP is currently blocked in scope.
+func (l *LoginLimiter) IsBlockedScope(scope LimiterScope, ip string) bool {
+	return l.IsBlocked(scope.key(ip))
+}
+
+// RecordFailureScope records a failed attempt for the IP in scope.
+// Returns true if this call triggered a new block.
+func (l *LoginLimiter) RecordFailureScope(scope LimiterScope, ip string) bool {
+	return l.RecordFailure(scope.key(ip))
+}
+
+// notifyLoginBlock emits a login_blocked event through the notify package.
+// Delivery is asynchronous — never blocks the request path.
+func notifyLoginBlock(ip string, until time.Time) {
+	notify.Send(notify.Event{
+		Type:    notify.EventLoginBlocked,
+		Title:   "Login blocked",
+		Message: fmt.Sprintf("IP %s exceeded %d failed attempts", ip, loginMaxFails),
+		Fields: map[string]string{
+			"ip":            ip,
+			"blocked_until": until.UTC().Format(time.RFC3339),
+		},
+		Key: ip,
+	})
 }
 
-// clientIP extracts the real client IP from the request. It checks
+// ClientIP extracts the real client IP from the request. It checks
 // X-Forwarded-For and X-Real-IP (set by reverse proxies such as Caddy)
 // before falling back to RemoteAddr.
-func clientIP(r *http.Request) string {
+func ClientIP(r *http.Request) string {
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		// X-Forwarded-For may be a comma-separated list; the leftmost is the
 		// original client.
@@ -2,7 +2,8 @@ package auth
 
 import "database/sql"
 
-// InitSchema creates the users and sessions tables if they do not exist.
+// InitSchema creates the users, sessions and login IP tables if they do not
+// exist and applies additive column migrations.
 // Safe to call on every startup (idempotent).
 func InitSchema(db *sql.DB) error {
 	_, err := db.Exec(`
@@ -14,6 +15,42 @@ func InitSchema(db *sql.DB) error {
 			last_login_at   TIMESTAMPTZ
 		);
 
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS role        TEXT NOT NULL DEFAULT 'user';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+		-- TOTP: totp_secret is set on enrollment; totp_enabled_at once confirmed.
+		-- totp_last_step is the last accepted time step (replay protection).
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret     TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step  BIGINT NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			user_id   TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT        NOT NULL,
+			used_at   TIMESTAMPTZ,
+			PRIMARY KEY (user_id, code_hash)
+		);
+
+		CREATE TABLE IF NOT EXISTS user_identities (
+			issuer     TEXT        NOT NULL,
+			subject    TEXT        NOT NULL,
+			user_id    TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			email      TEXT        NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (issuer, subject)
+		);
+
+		CREATE TABLE IF NOT EXISTS login_challenges (
+			token      TEXT        PRIMARY KEY,
+			user_id    TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			attempts   INT         NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		-- Where an OIDC login continues after its TOTP step.
+		ALTER TABLE login_challenges ADD COLUMN IF NOT EXISTS redirect TEXT NOT NULL DEFAULT '';
+
 		CREATE TABLE IF NOT EXISTS sessions (
 			token      TEXT        PRIMARY KEY,
 			user_id    TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -23,6 +60,27 @@ func InitSchema(db *sql.DB) error {
 
 		CREATE INDEX IF NOT EXISTS idx_sessions_user_id    ON sessions(user_id);
 		CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+		-- Session metadata for listing/revoking devices. id is a public
+		-- identifier so the secret token never leaves the cookie.
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS id           TEXT;
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent   TEXT NOT NULL DEFAULT '';
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip           TEXT NOT NULL DEFAULT '';
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+		UPDATE sessions SET id = md5(token) WHERE id IS NULL;
+		UPDATE sessions SET last_seen_at = issued_at WHERE last_seen_at IS NULL;
+		ALTER TABLE sessions ALTER COLUMN id SET NOT NULL;
+		ALTER TABLE sessions ALTER COLUMN last_seen_at SET NOT NULL;
+		ALTER TABLE sessions ALTER COLUMN last_seen_at SET DEFAULT NOW();
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_id ON sessions(id);
+
+		CREATE TABLE IF NOT EXISTS user_login_ips (
+			user_id       TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			ip            TEXT        NOT NULL,
+			first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, ip)
+		);
 	`)
 	return err
 }
@@ -5,19 +5,64 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-const sessionDuration = 24 * time.Hour
+const (
+	defaultSessionTTL         = 24 * time.Hour
+	defaultSessionMaxLifetime = 30 * 24 * time.Hour
+
+	// lastSeenResolution throttles last_seen_at writes so authenticated
+	// requests do not each cost an UPDATE.
+	lastSeenResolution = time.Minute
+
+	maxUserAgentLen = 512
+)
+
+// SessionPolicy controls session lifetime.
+//
+// Without Sliding, a session expires TTL after login. With Sliding, every
+// authenticated request pushes expiry out to now+TTL, but never beyond
+// IssuedAt+MaxLifetime.
+type SessionPolicy struct {
+	TTL         time.Duration
+	MaxLifetime time.Duration
+	Sliding     bool
+}
+
+var sessionPolicy = SessionPolicy{
+	TTL:         defaultSessionTTL,
+	MaxLifetime: defaultSessionMaxLifetime,
+}
+
+// SetSessionPolicy replaces the session policy. Zero durations keep defaults.
+// Call once at startup before serving requests.
+func SetSessionPolicy(p SessionPolicy) {
+	if p.TTL <= 0 {
+		p.TTL = defaultSessionTTL
+	}
+	if p.MaxLifetime <= 0 {
+		p.MaxLifetime = defaultSessionMaxLifetime
+	}
+	if p.MaxLifetime < p.TTL {
+		p.MaxLifetime = p.TTL
+	}
+	sessionPolicy = p
+}
 
 // Session represents a row in the sessions table.
 type Session struct {
-	Token     string
-	UserID    uuid.UUID
-	IssuedAt  time.Time
-	ExpiresAt time.Time
+	ID         string
+	Token      string
+	UserID     uuid.UUID
+	UserAgent  string
+	IP         string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
 }
 
 // newToken generates a cryptographically random 32-byte token, hex-encoded (64 chars).
@@ -29,37 +74,48 @@ func newToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// CreateSession inserts a new session for the given user with a 24-hour lifetime.
-func CreateSession(db *sql.DB, userID uuid.UUID) (*Session, error) {
+// CreateSession inserts a new session for the given user, recording the
+// client's user agent and IP. Lifetime follows the current SessionPolicy.
+func CreateSession(db *sql.DB, userID uuid.UUID, userAgent, ip string) (*Session, error) {
 	token, err := newToken()
 	if err != nil {
 		return nil, fmt.Errorf("generate token: %w", err)
 	}
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = userAgent[:maxUserAgentLen]
+	}
 
 	now := time.Now().UTC()
-	expiresAt := now.Add(sessionDuration)
+	expiresAt := now.Add(sessionPolicy.TTL)
 
 	var sess Session
 	err = db.QueryRow(`
-		INSERT INTO sessions (token, user_id, issued_at, expires_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING token, user_id, issued_at, expires_at
-	`, token, userID, now, expiresAt).Scan(&sess.Token, &sess.UserID, &sess.IssuedAt, &sess.ExpiresAt)
+		INSERT INTO sessions (id, token, user_id, user_agent, ip, issued_at, expires_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $6)
+		RETURNING `+sessionColumns,
+		uuid.NewString(), token, userID, userAgent, ip, now, expiresAt,
+	).Scan(sessionDest(&sess)...)
 	if err != nil {
 		return nil, fmt.Errorf("insert session: %w", err)
 	}
 	return &sess, nil
 }
 
+const sessionColumns = `id, token, user_id, user_agent, ip, issued_at, expires_at, last_seen_at`
+
+func sessionDest(s *Session) []any {
+	return []any{&s.ID, &s.Token, &s.UserID, &s.UserAgent, &s.IP, &s.IssuedAt, &s.ExpiresAt, &s.LastSeenAt}
+}
+
 // GetSession loads a session by token. Returns (nil, nil) if the token does
 // not exist or has expired.
 func GetSession(db *sql.DB, token string) (*Session, error) {
 	var sess Session
 	err := db.QueryRow(`
-		SELECT token, user_id, issued_at, expires_at
+		SELECT `+sessionColumns+`
 		FROM sessions
 		WHERE token = $1 AND expires_at > NOW()
-	`, token).Scan(&sess.Token, &sess.UserID, &sess.IssuedAt, &sess.ExpiresAt)
+	`, token).Scan(sessionDest(&sess)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -69,8 +125,118 @@ func GetSession(db *sql.DB, token string) (*Session, error) {
 	return &sess, nil
 }
 
+// TouchSession records activity on sess and, under a sliding policy, extends
+// its expiry. Writes are throttled to lastSeenResolution. Returns true if
+// ExpiresAt changed, in which case the caller should re-issue the cookie.
+func TouchSession(db *sql.DB, sess *Session) (renewed bool, err error) {
+	now := time.Now().UTC()
+	if now.Sub(sess.LastSeenAt) < lastSeenResolution {
+		return false, nil
+	}
+
+	expiresAt := sess.ExpiresAt
+	if sessionPolicy.Sliding {
+		expiresAt = now.Add(sessionPolicy.TTL)
+		if hardLimit := sess.IssuedAt.Add(sessionPolicy.MaxLifetime); expiresAt.After(hardLimit) {
+			expiresAt = hardLimit
+		}
+		if expiresAt.Before(sess.ExpiresAt) {
+			expiresAt = sess.ExpiresAt
+		}
+	}
+
+	if _, err := db.Exec(`
+		UPDATE sessions SET last_seen_at = $2, expires_at = $3 WHERE id = $1
+	`, sess.ID, now, expiresAt); err != nil {
+		return false, fmt.Errorf("touch session: %w", err)
+	}
+	renewed = !expiresAt.Equal(sess.ExpiresAt)
+	sess.LastSeenAt = now
+	sess.ExpiresAt = expiresAt
+	return renewed, nil
+}
+
+// ListSessions returns the user's unexpired sessions, most recently active first.
+func ListSessions(db *sql.DB, userID uuid.UUID) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(sessionDest(&s)...); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
 // DeleteSession removes a session by token. No error if the row does not exist.
 func DeleteSession(db *sql.DB, token string) error {
 	_, err := db.Exec(`DELETE FROM sessions WHERE token = $1`, token)
 	return err
 }
+
+// DeleteSessionByID removes one of the user's sessions by its public ID.
+// Returns false if no such session belongs to the user.
+func DeleteSessionByID(db *sql.DB, userID uuid.UUID, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteOtherSessions removes all of the user's sessions except keepID; an
+// empty keepID removes every one. Returns the number of sessions revoked.
+func DeleteOtherSessions(db *sql.DB, userID uuid.UUID, keepID string) (int64, error) {
+	res, err := db.Exec(`DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("delete sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredSessions removes all expired session rows.
+func DeleteExpiredSessions(db *sql.DB) (int64, error) {
+	res, err := db.Exec(`DELETE FROM sessions WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartSessionSweeper deletes expired sessions every interval for the
+// lifetime of the process. A non-positive interval disables the sweeper.
+func StartSessionSweeper(db *sql.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := DeleteExpiredSessions(db)
+			if err != nil {
+				slog.Error("session sweep failed", "err", err)
+				continue
+			}
+			if n > 0 {
+				slog.Info("session sweep removed expired sessions", "count", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/audit"
+)
+
+type sessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	IssuedAt   string `json:"issued_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+// HandleSessions handles /auth/sessions.
+// Must be wrapped with RequireAuth.
+//
+//	GET    lists the caller's active sessions
+//	DELETE revokes every session except the current one ("sign out other devices");
+//	       rejected for API-key requests, which have no current session
+func HandleSessions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		currentID, hasSession := SessionIDFromContext(r.Context())
+
+		switch r.Method {
+		case http.MethodGet:
+			sessions, err := ListSessions(db, userID)
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			resp := make([]sessionResponse, 0, len(sessions))
+			for _, s := range sessions {
+				resp = append(resp, sessionResponse{
+					ID:         s.ID,
+					UserAgent:  s.UserAgent,
+					IP:         s.IP,
+					IssuedAt:   s.IssuedAt.UTC().Format(time.RFC3339),
+					LastSeenAt: s.LastSeenAt.UTC().Format(time.RFC3339),
+					ExpiresAt:  s.ExpiresAt.UTC().Format(time.RFC3339),
+					Current:    s.ID == currentID,
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+
+		case http.MethodDelete:
+			// An API-key request has no session to keep; revoking "the
+			// others" would sign out every device.
+			if !hasSession {
+				http.Error(w, "no current session to keep; revoke sessions one at a time with DELETE /auth/sessions/{id}", http.StatusBadRequest)
+				return
+			}
+			revoked, err := DeleteOtherSessions(db, userID, currentID)
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionSessionRevoke,
+				TargetType: audit.TargetSession,
+				TargetID:   "*",
+				Diff:       map[string]any{"revoked": revoked, "kept": currentID},
+			})
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"revoked": revoked})
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleSession handles DELETE /auth/sessions/{id}.
+// Must be wrapped with RequireAuth. Users can only revoke their own sessions;
+// revoking the current session also clears the cookie.
+func HandleSession(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/auth/sessions/"), "/")
+		if id == "" {
+			http.Error(w, "session id required", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := DeleteSessionByID(db, userID, id)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionSessionRevoke,
+			TargetType: audit.TargetSession,
+			TargetID:   id,
+		})
+
+		if currentID, ok := SessionIDFromContext(r.Context()); ok && currentID == id {
+			clearSessionCookie(w)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+func TestHandleSessionsDeleteRequiresSession(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE sessions (token TEXT PRIMARY KEY, id TEXT, user_id TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if _, err := db.Exec(`INSERT INTO sessions (token, id, user_id) VALUES ($1, $2, $3)`, "tok-"+id, id, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remaining := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// API-key request: no current session
+	req := httptest.NewRequest(http.MethodDelete, "/auth/sessions", nil)
+	rec := httptest.NewRecorder()
+	HandleSessions(db)(rec, req.WithContext(WithUserID(req.Context(), userID)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if n := remaining(); n != 3 {
+		t.Fatalf("%d sessions left, want all 3", n)
+	}
+
+	ctx := context.WithValue(WithUserID(req.Context(), userID), sessionContextKey{}, "s2")
+	rec = httptest.NewRecorder()
+	HandleSessions(db)(rec, req.WithContext(ctx))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var kept string
+	if err := db.QueryRow(`SELECT id FROM sessions`).Scan(&kept); err != nil || remaining() != 1 || kept != "s2" {
+		t.Fatalf("kept %q (err %v), want only the current session s2", kept, err)
+	}
+}
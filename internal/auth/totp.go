@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app supports).
+const (
+	totpIssuer = "sidekick"
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew accepts codes from one step before/after the current one to
+	// tolerate clock drift.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+var (
+	// ErrTOTPNotEnrolled is returned when verifying without a pending or active secret.
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrTOTPAlreadyEnabled is returned when enrolling while TOTP is active.
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random 160-bit secret, base32-encoded.
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) for the given counter.
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("decode totp secret: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// totpStep returns the RFC 6238 time step for t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// matchTOTP returns the time step that code matches within the skew window,
+// considering only steps after lastStep (replay protection). ok is false if
+// no step matches.
+func matchTOTP(secret, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for delta := int64(-totpSkew); delta <= totpSkew; delta++ {
+		s := current + delta
+		if s <= lastStep || s < 0 {
+			continue
+		}
+		want, err := totpCode(secret, uint64(s))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI that authenticator apps
+// import, typically rendered as a QR code by the client.
+func TOTPProvisioningURI(email, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + email)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// BeginTOTPEnrollment stores a fresh pending secret for the user, replacing
+// any earlier unconfirmed one. TOTP is not enforced until ConfirmTOTP.
+func BeginTOTPEnrollment(db *sql.DB, userID uuid.UUID) (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", fmt.Errorf("generate totp secret: %w", err)
+	}
+	res, err := db.Exec(`
+		UPDATE users SET totp_secret = $2, totp_last_step = 0
+		WHERE id = $1 AND totp_enabled_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return "", fmt.Errorf("store totp secret: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrTOTPAlreadyEnabled
+	}
+	return secret, nil
+}
+
+// ConfirmTOTP activates a pending enrollment if code is valid, and returns a
+// fresh set of single-use recovery codes (shown to the user once).
+func ConfirmTOTP(db *sql.DB, userID uuid.UUID, code string) ([]string, error) {
+	secret, enabled, lastStep, err := loadTOTP(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return nil, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $2 WHERE id = $1
+	`, userID, step); err != nil {
+		return nil, fmt.Errorf("enable totp: %w", err)
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor auth and removes the secret and recovery codes.
+func DisableTOTP(db *sql.DB, userID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1
+	`, userID); err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// VerifyTOTP checks code against the user's active secret and records the
+// matched step so the same code cannot be replayed.
+func VerifyTOTP(db *sql.DB, userID uuid.UUID, code string) (bool, error) {
+	secret, enabled, lastStep, err := loadTOTP(db, userID)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, ErrTOTPNotEnrolled
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return false, nil
+	}
+	// Conditional update closes the race between two concurrent uses of one code.
+	res, err := db.Exec(`
+		UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("record totp step: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// UseRecoveryCode consumes a recovery code. Returns false if the code is
+// unknown or already used.
+func UseRecoveryCode(db *sql.DB, userID uuid.UUID, code string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func loadTOTP(db *sql.DB, userID uuid.UUID) (secret string, enabled bool, lastStep int64, err error) {
+	var s sql.NullString
+	err = db.QueryRow(`
+		SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users WHERE id = $1
+	`, userID).Scan(&s, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		return "", false, 0, ErrUserNotFound
+	}
+	if err != nil {
+		return "", false, 0, fmt.Errorf("load totp: %w", err)
+	}
+	if !s.Valid || s.String == "" {
+		return "", false, 0, ErrTOTPNotEnrolled
+	}
+	return s.String, enabled, lastStep, nil
+}
+
+// replaceRecoveryCodes deletes existing codes and stores new ones (hashed).
+// Codes are 10 hex chars in two groups, e.g. "3f9a1-0c2d7".
+func replaceRecoveryCodes(tx *sql.Tx, userID uuid.UUID) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("delete recovery codes: %w", err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(b)
+		code := h[:5] + "-" + h[5:]
+		if _, err := tx.Exec(`
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hashRecoveryCode(code)); err != nil {
+			return nil, fmt.Errorf("store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode normalizes and hashes a recovery code. Codes carry 40 bits
+// of randomness and are single-use, so a fast hash is sufficient.
+func hashRecoveryCode(code string) string {
+	norm := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/audit"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+)
+
+// HandleLoginTOTP handles POST /auth/login/totp, the second step of a login
+// for users with TOTP enabled. Accepts the challenge from /auth/login (or,
+// for an OIDC login, from its challenge cookie) plus either a current TOTP
+// code or an unused recovery code. Failures count against the limiter's
+// TOTP scope, separate from password attempts.
+// limiter may be nil (disables rate limiting).
+func HandleLoginTOTP(db *sql.DB, limiter *LoginLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := ClientIP(r)
+		if limiter != nil && limiter.IsBlockedScope(ScopeTOTP, ip) {
+			http.Error(w, "too many failed verification attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		var req struct {
+			Challenge    string `json:"challenge"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Challenge == "" {
+			if cookie, err := r.Cookie(oidcChallengeCookie); err == nil {
+				req.Challenge = cookie.Value
+			}
+		}
+		if req.Challenge == "" || (req.Code == "" && req.RecoveryCode == "") {
+			http.Error(w, "challenge and code or recovery_code required", http.StatusBadRequest)
+			return
+		}
+
+		challenge, err := GetLoginChallenge(db, req.Challenge)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if challenge == nil {
+			http.Error(w, "login challenge expired, sign in again", http.StatusUnauthorized)
+			return
+		}
+
+		var ok bool
+		if req.RecoveryCode != "" {
+			ok, err = UseRecoveryCode(db, challenge.UserID, req.RecoveryCode)
+		} else {
+			ok, err = VerifyTOTP(db, challenge.UserID, req.Code)
+		}
+		if err != nil && !errors.Is(err, ErrTOTPNotEnrolled) {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		method := "totp"
+		if req.RecoveryCode != "" {
+			method = "recovery_code"
+		}
+		if !ok {
+			RecordAudit(db, r, audit.Event{
+				Action:  audit.ActionLoginFailure,
+				ActorID: challenge.UserID.String(),
+				Diff:    map[string]any{"method": method},
+			})
+			_ = RecordChallengeFailure(db, challenge.Token)
+			metrics.LoginFailures.WithLabelValues("totp").Inc()
+			if limiter != nil && limiter.RecordFailureScope(ScopeTOTP, ip) {
+				metrics.LoginBlocks.WithLabelValues("totp").Inc()
+				notifyLoginBlock(ip, time.Now().Add(loginBlock))
+			}
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := GetUserByID(db, challenge.UserID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Disabled() {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		_ = DeleteLoginChallenge(db, challenge.Token)
+		if _, err := r.Cookie(oidcChallengeCookie); err == nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     oidcChallengeCookie,
+				Value:    "",
+				Path:     "/auth/login/totp",
+				HttpOnly: true,
+				Secure:   secureCookies(),
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   -1,
+			})
+		}
+
+		completeLogin(db, w, r, user, method, challenge.Redirect)
+	}
+}
+
+// HandleTOTPEnroll handles POST /auth/totp/enroll.
+// Must be wrapped with RequireAuth. Generates a pending secret and returns it
+// with an otpauth:// provisioning URI for QR display. TOTP is not enforced
+// until the code is confirmed via /auth/totp/verify.
+func HandleTOTPEnroll(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		secret, err := BeginTOTPEnrollment(db, userID)
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"secret":           secret,
+			"provisioning_uri": TOTPProvisioningURI(user.Email, secret),
+		})
+	}
+}
+
+// HandleTOTPVerify handles POST /auth/totp/verify.
+// Must be wrapped with RequireAuth. Confirms a pending enrollment with a code
+// from the authenticator and returns one-time recovery codes.
+func HandleTOTPVerify(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Code) == "" {
+			http.Error(w, "code required", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := ConfirmTOTP(db, userID, req.Code)
+		switch {
+		case errors.Is(err, ErrTOTPNotEnrolled):
+			http.Error(w, "start enrollment first", http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrTOTPAlreadyEnabled):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		case codes == nil:
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionTOTPEnable,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"enabled":        true,
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// HandleTOTPDisable handles POST /auth/totp/disable.
+// Must be wrapped with RequireAuth. Requires the account password so a
+// hijacked session alone cannot strip the second factor.
+func HandleTOTPDisable(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		user, err := GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || !user.CheckPassword(req.Password) {
+			http.Error(w, "password is incorrect", http.StatusForbidden)
+			return
+		}
+
+		if err := DisableTOTP(db, userID); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionTOTPDisable,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B test secret (SHA1): ASCII "12345678901234567890".
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is the same value mod 10^6.
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := totpCode(rfcSecret, uint64(totpStep(time.Unix(c.unix, 0))))
+		if err != nil {
+			t.Fatalf("t=%d: %v", c.unix, err)
+		}
+		if got != c.want {
+			t.Errorf("t=%d: got %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestMatchTOTP_SkewAndReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+	prev, _ := totpCode(rfcSecret, uint64(step-1))
+	old, _ := totpCode(rfcSecret, uint64(step-2))
+
+	if s, ok := matchTOTP(rfcSecret, prev, now, 0); !ok || s != step-1 {
+		t.Fatalf("previous-step code should match within skew, got step=%d ok=%v", s, ok)
+	}
+	if _, ok := matchTOTP(rfcSecret, old, now, 0); ok {
+		t.Fatal("code two steps old should be rejected")
+	}
+	if _, ok := matchTOTP(rfcSecret, prev, now, step-1); ok {
+		t.Fatal("code for an already-used step should be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("me@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/sidekick:me@example.com?") {
+		t.Fatalf("unexpected uri prefix: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=sidekick") {
+		t.Fatalf("uri missing secret or issuer: %s", uri)
+	}
+}
+
+func TestLoginLimiter_ScopesAreIndependent(t *testing.T) {
+	l := &LoginLimiter{entries: make(map[string]*ipEntry)}
+	ip := "1.2.3.4"
+
+	for i := 0; i < loginMaxFails; i++ {
+		l.RecordFailureScope(ScopeTOTP, ip)
+	}
+	if !l.IsBlockedScope(ScopeTOTP, ip) {
+		t.Fatal("TOTP scope should be blocked")
+	}
+	if l.IsBlocked(ip) || l.IsBlockedScope(ScopePassword, ip) {
+		t.Fatal("password scope must not be affected by TOTP failures")
+	}
+}
@@ -2,70 +2,153 @@ package auth
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// User roles.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// MinPasswordLength is enforced for passwords set through the API and CLI.
+const MinPasswordLength = 8
+
+var (
+	// ErrLastAdmin is returned when an operation would leave no active admin.
+	ErrLastAdmin = errors.New("cannot remove the last active admin")
+	// ErrUserNotFound is returned by mutations that target a missing user.
+	ErrUserNotFound = errors.New("user not found")
+)
+
 // User represents a row in the users table.
 type User struct {
 	ID           uuid.UUID
 	Email        string
 	PasswordHash string
+	Role         string
 	CreatedAt    time.Time
 	LastLoginAt  *time.Time
+	DisabledAt   *time.Time
+	TOTPEnabled  bool
 }
 
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool { return u.Role == RoleAdmin }
+
+// Disabled reports whether the account has been disabled.
+func (u *User) Disabled() bool { return u.DisabledAt != nil }
+
 // CheckPassword returns true if password matches the stored bcrypt hash.
 func (u *User) CheckPassword(password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
 }
 
-// CreateUser inserts a new user with a bcrypt-hashed password.
-// Returns the full user record as persisted (id and created_at set by the DB).
-func CreateUser(db *sql.DB, email, password string) (*User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, fmt.Errorf("hash password: %w", err)
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser
+}
+
+// ValidatePassword checks password strength requirements.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
 	}
+	return nil
+}
+
+const userColumns = `id, email, password_hash, role, created_at, last_login_at, disabled_at, totp_enabled_at IS NOT NULL`
 
+type userScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row userScanner) (*User, error) {
 	var user User
-	var lastLogin sql.NullTime
-	err = db.QueryRow(`
-		INSERT INTO users (email, password_hash)
-		VALUES ($1, $2)
-		RETURNING id, email, password_hash, created_at, last_login_at
-	`, email, string(hash)).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &lastLogin)
-	if err != nil {
-		return nil, fmt.Errorf("insert user: %w", err)
+	var lastLogin, disabledAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &lastLogin, &disabledAt, &user.TOTPEnabled); err != nil {
+		return nil, err
 	}
 	if lastLogin.Valid {
 		user.LastLoginAt = &lastLogin.Time
 	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
 	return &user, nil
 }
 
+// CreateUser inserts a new user with a bcrypt-hashed password and the given
+// role. Returns the full user record as persisted.
+func CreateUser(db *sql.DB, email, password, role string) (*User, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	user, err := scanUser(db.QueryRow(`
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+userColumns,
+		uuid.New(), strings.TrimSpace(email), string(hash), role,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+	return user, nil
+}
+
 // GetUserByEmail loads a user by email. Returns (nil, nil) if no row exists.
 func GetUserByEmail(db *sql.DB, email string) (*User, error) {
-	var user User
-	var lastLogin sql.NullTime
-	err := db.QueryRow(`
-		SELECT id, email, password_hash, created_at, last_login_at
-		FROM users WHERE email = $1
-	`, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &lastLogin)
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = $1`, email))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get user: %w", err)
 	}
-	if lastLogin.Valid {
-		user.LastLoginAt = &lastLogin.Time
+	return user, nil
+}
+
+// GetUserByID loads a user by ID. Returns (nil, nil) if no row exists.
+func GetUserByID(db *sql.DB, id uuid.UUID) (*User, error) {
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	return &user, nil
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return user, nil
+}
+
+// ListUsers returns all users ordered by email.
+func ListUsers(db *sql.DB) ([]*User, error) {
+	rows, err := db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY email`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
 }
 
 // MarkLogin updates last_login_at to now for the given user.
@@ -74,9 +157,177 @@ func MarkLogin(db *sql.DB, userID uuid.UUID) error {
 	return err
 }
 
-// EnsureBootstrapUser creates the initial user from SIDEKICK_AUTH_EMAIL and
+// SetPassword replaces the user's password hash.
+func SetPassword(db *sql.DB, userID uuid.UUID, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	res, err := db.Exec(`UPDATE users SET password_hash = $2 WHERE id = $1`, userID, string(hash))
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	return requireAffected(res)
+}
+
+// SetUserRole changes the user's role. Demoting the last active admin fails
+// with ErrLastAdmin.
+func SetUserRole(db *sql.DB, userID uuid.UUID, role string) error {
+	_, err := UpdateUser(db, userID, UserUpdate{Role: &role})
+	return err
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also revokes
+// all of the user's sessions. Disabling the last active admin fails with
+// ErrLastAdmin.
+func SetUserDisabled(db *sql.DB, userID uuid.UUID, disabled bool) error {
+	_, err := UpdateUser(db, userID, UserUpdate{Disabled: &disabled})
+	return err
+}
+
+// UserUpdate holds the account fields an admin can change. Nil fields are
+// left as they are.
+type UserUpdate struct {
+	Role     *string
+	Disabled *bool
+	Password *string
+}
+
+// UpdateUser applies every field of update in one transaction, so either all
+// of them change or none does. Disabling the account or resetting its
+// password also revokes all of the user's sessions; it returns how many were
+// revoked. Removing the last active admin fails with ErrLastAdmin.
+func UpdateUser(db *sql.DB, userID uuid.UUID, update UserUpdate) (int64, error) {
+	if update.Role != nil && !ValidRole(*update.Role) {
+		return 0, fmt.Errorf("invalid role %q", *update.Role)
+	}
+	var hash []byte
+	if update.Password != nil {
+		if err := ValidatePassword(*update.Password); err != nil {
+			return 0, err
+		}
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost); err != nil {
+			return 0, fmt.Errorf("hash password: %w", err)
+		}
+	}
+
+	removesAdmin := (update.Role != nil && *update.Role != RoleAdmin) || (update.Disabled != nil && *update.Disabled)
+	var revoked int64
+	err := withAdminGuard(db, userID, removesAdmin, func(tx *sql.Tx) error {
+		exec := func(what, query string, args ...any) error {
+			res, err := tx.Exec(query, args...)
+			if err != nil {
+				return fmt.Errorf("%s: %w", what, err)
+			}
+			return requireAffected(res)
+		}
+		if update.Role != nil {
+			if err := exec("update role", `UPDATE users SET role = $2 WHERE id = $1`, userID, *update.Role); err != nil {
+				return err
+			}
+		}
+		if update.Disabled != nil {
+			query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+			if *update.Disabled {
+				query = `UPDATE users SET disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP) WHERE id = $1`
+			}
+			if err := exec("update user", query, userID); err != nil {
+				return err
+			}
+		}
+		if hash != nil {
+			if err := exec("update password", `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, string(hash)); err != nil {
+				return err
+			}
+		}
+		if hash != nil || (update.Disabled != nil && *update.Disabled) {
+			res, err := tx.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+			if err != nil {
+				return fmt.Errorf("revoke sessions: %w", err)
+			}
+			if revoked, err = res.RowsAffected(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// DeleteUser removes a user and (via cascade) their sessions. Deleting the
+// last active admin fails with ErrLastAdmin.
+func DeleteUser(db *sql.DB, userID uuid.UUID) error {
+	return withAdminGuard(db, userID, true, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID)
+		if err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+		return requireAffected(res)
+	})
+}
+
+// withAdminGuard runs fn in a transaction. When removesAdmin is true and the
+// target is currently an active admin, the transaction is rolled back with
+// ErrLastAdmin if no other active admin would remain.
+func withAdminGuard(db *sql.DB, userID uuid.UUID, removesAdmin bool, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if removesAdmin {
+		// Lock admin rows so concurrent demotions cannot both succeed. A
+		// no-op UPDATE takes the same row locks as SELECT ... FOR UPDATE
+		// and also runs on SQLite.
+		if _, err := tx.Exec(`UPDATE users SET role = role WHERE role = 'admin' AND disabled_at IS NULL`); err != nil {
+			return fmt.Errorf("lock admins: %w", err)
+		}
+		var others int
+		var targetIsAdmin bool
+		if err := tx.QueryRow(`
+			SELECT
+				COUNT(*) FILTER (WHERE id <> $1),
+				COUNT(*) FILTER (WHERE id = $1) > 0
+			FROM users
+			WHERE role = 'admin' AND disabled_at IS NULL
+		`, userID).Scan(&others, &targetIsAdmin); err != nil {
+			return fmt.Errorf("count admins: %w", err)
+		}
+		if targetIsAdmin && others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// EnsureBootstrapUser creates the initial admin from SIDEKICK_AUTH_EMAIL and
 // SIDEKICK_AUTH_PASSWORD if both are set and no user with that email exists yet.
-// This is the single-user bootstrap path. Idempotent on repeated calls.
+// If the user exists but there is no active admin at all (e.g. a database
+// created before roles existed), the bootstrap user is promoted to admin.
+// Idempotent on repeated calls.
 func EnsureBootstrapUser(db *sql.DB) error {
 	email := os.Getenv("SIDEKICK_AUTH_EMAIL")
 	password := os.Getenv("SIDEKICK_AUTH_PASSWORD")
@@ -88,12 +339,24 @@ func EnsureBootstrapUser(db *sql.DB) error {
 	if err != nil {
 		return fmt.Errorf("check bootstrap user: %w", err)
 	}
-	if existing != nil {
-		return nil // already exists
+	if existing == nil {
+		if _, err := CreateUser(db, email, password, RoleAdmin); err != nil {
+			return fmt.Errorf("create bootstrap user: %w", err)
+		}
+		return nil
+	}
+	if existing.IsAdmin() {
+		return nil
 	}
 
-	if _, err := CreateUser(db, email, password); err != nil {
-		return fmt.Errorf("create bootstrap user: %w", err)
+	var admins int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = 'admin' AND disabled_at IS NULL`).Scan(&admins); err != nil {
+		return fmt.Errorf("count admins: %w", err)
+	}
+	if admins == 0 {
+		if _, err := db.Exec(`UPDATE users SET role = 'admin' WHERE id = $1`, existing.ID); err != nil {
+			return fmt.Errorf("promote bootstrap user: %w", err)
+		}
 	}
 	return nil
 }
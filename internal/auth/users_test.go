@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// newUsersDB returns an in-memory SQLite database with the users and
+// sessions tables.
+func newUsersDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL,
+			role TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME, disabled_at DATETIME, totp_enabled_at DATETIME
+		);
+		CREATE TABLE sessions (token TEXT PRIMARY KEY, id TEXT, user_id TEXT NOT NULL);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func insertUser(t *testing.T, db *sql.DB, email, role string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, role) VALUES ($1, $2, 'hash', $3)`, id, email, role); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO sessions (token, id, user_id) VALUES ($1, $2, $3)`, "tok-"+email, "s-"+email, id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestLastAdminGuard(t *testing.T) {
+	password := "new-password-123"
+	tests := []struct {
+		name   string
+		mutate func(db *sql.DB, id uuid.UUID) error
+	}{
+		{"demote", func(db *sql.DB, id uuid.UUID) error { return SetUserRole(db, id, RoleUser) }},
+		{"disable", func(db *sql.DB, id uuid.UUID) error { return SetUserDisabled(db, id, true) }},
+		{"delete", func(db *sql.DB, id uuid.UUID) error { return DeleteUser(db, id) }},
+		{"password with demote", func(db *sql.DB, id uuid.UUID) error {
+			role := RoleUser
+			_, err := UpdateUser(db, id, UserUpdate{Role: &role, Password: &password})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newUsersDB(t)
+			admin := insertUser(t, db, "admin@example.com", RoleAdmin)
+			insertUser(t, db, "user@example.com", RoleUser)
+			// A disabled admin does not count as a remaining admin
+			disabled := insertUser(t, db, "old@example.com", RoleAdmin)
+			if _, err := db.Exec(`UPDATE users SET disabled_at = CURRENT_TIMESTAMP WHERE id = $1`, disabled); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.mutate(db, admin); !errors.Is(err, ErrLastAdmin) {
+				t.Fatalf("err = %v, want ErrLastAdmin", err)
+			}
+			user, err := GetUserByID(db, admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user == nil || user.Role != RoleAdmin || user.Disabled() || user.PasswordHash != "hash" {
+				t.Fatalf("admin = %+v, want unchanged", user)
+			}
+			var sessions int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = $1`, admin).Scan(&sessions); err != nil || sessions != 1 {
+				t.Fatalf("admin sessions = %d (err %v), want 1", sessions, err)
+			}
+
+			// With a second active admin the same change goes through
+			insertUser(t, db, "second@example.com", RoleAdmin)
+			if err := tt.mutate(db, admin); err != nil {
+				t.Fatalf("with another admin: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateUserRevokesSessionsOnPasswordReset(t *testing.T) {
+	db := newUsersDB(t)
+	id := insertUser(t, db, "user@example.com", RoleUser)
+	password := "new-password-123"
+	revoked, err := UpdateUser(db, id, UserUpdate{Password: &password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 1 {
+		t.Errorf("revoked = %d, want 1", revoked)
+	}
+	user, err := GetUserByID(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.CheckPassword(password) {
+		t.Error("password not changed")
+	}
+}
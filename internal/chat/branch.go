@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+// RetryPoint returns the index in history of the question /retry answers
+// again: the user message behind the last reply, or a trailing unanswered
+// one. It must already be stored.
+func RetryPoint(history []store.Message) (int, bool) {
+	i := len(history) - 1
+	if i >= 0 && history[i].Role == "assistant" {
+		i--
+	}
+	if i < 0 || history[i].Role != "user" || history[i].ID == 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+// EditPoint returns the index in history of message n (1-based, as listed
+// by `sidekick history --verbose`) for /edit n. Only stored user messages
+// can be edited.
+func EditPoint(history []store.Message, n int) (int, error) {
+	if n < 1 || n > len(history) {
+		return 0, fmt.Errorf("message number must be between 1 and %d", len(history))
+	}
+	if history[n-1].Role != "user" || history[n-1].ID == 0 {
+		return 0, fmt.Errorf("message %d is not one of your messages", n)
+	}
+	return n - 1, nil
+}
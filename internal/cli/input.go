@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// StdinLabel names piped stdin among a prompt's attachments.
+const StdinLabel = "stdin"
+
+// ErrInputTooLarge is returned when piped or attached input exceeds the
+// size limit.
+var ErrInputTooLarge = errors.New("input too large")
+
+// Attachment is a piece of input embedded in a prompt, such as a file or
+// piped stdin.
+type Attachment struct {
+	Name    string
+	Content string
+}
+
+// StdinPiped reports whether stdin is redirected from a pipe or file rather
+// than a terminal.
+func StdinPiped() bool {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return (fileInfo.Mode() & os.ModeCharDevice) == 0
+}
+
+// ReadStdin reads piped input of at most maxBytes. Empty input returns nil.
+func ReadStdin(r io.Reader, maxBytes int) (*Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("%w: stdin is larger than %d bytes", ErrInputTooLarge, maxBytes)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, nil
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("stdin is not text")
+	}
+	return &Attachment{Name: StdinLabel, Content: string(data)}, nil
+}
+
+// ReadAttachments reads the given files and the files matched by globs, in
+// order and without duplicates. The files may total at most maxBytes.
+func ReadAttachments(files, globs []string, maxBytes int) ([]Attachment, error) {
+	paths := append([]string{}, files...)
+	for _, pattern := range globs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		for _, match := range matches {
+			// Globs like *.go may match directories; skip them silently
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				paths = append(paths, match)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	attachments := make([]Attachment, 0, len(paths))
+	total := 0
+	for _, path := range paths {
+		clean := filepath.Clean(path)
+		if seen[clean] {
+			continue
+		}
+		seen[clean] = true
+
+		// Check the size before reading so a huge file is never loaded
+		info, err := os.Stat(clean)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", clean)
+		}
+		total += int(info.Size())
+		if total > maxBytes {
+			return nil, fmt.Errorf("%w: attached files are larger than %d bytes (at %s)", ErrInputTooLarge, maxBytes, clean)
+		}
+
+		data, err := os.ReadFile(clean)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("%s is not a text file", clean)
+		}
+		attachments = append(attachments, Attachment{Name: filepath.ToSlash(clean), Content: string(data)})
+	}
+	return attachments, nil
+}
+
+// BuildPrompt appends each attachment to prompt as a fenced block labelled
+// with its name.
+func BuildPrompt(prompt string, attachments []Attachment) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(prompt))
+	for _, a := range attachments {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fence := fenceFor(a.Content)
+		b.WriteString(fence + a.Name + "\n")
+		b.WriteString(a.Content)
+		if !strings.HasSuffix(a.Content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(fence)
+	}
+	return b.String()
+}
+
+// fenceFor returns a backtick fence longer than any run of backticks in
+// content, so Markdown files cannot close the block early.
+func fenceFor(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// AttachmentNames returns the names of attachments, for recording on the
+// stored message.
+func AttachmentNames(attachments []Attachment) []string {
+	if len(attachments) == 0 {
+		return nil
+	}
+	names := make([]string, len(attachments))
+	for i, a := range attachments {
+		names[i] = a.Name
+	}
+	return names
+}
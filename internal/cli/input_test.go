@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadAttachmentsAndBuildPrompt(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	main := write("main.go", "package main\n")
+	write("util.go", "package main")
+	readme := write("README.md", "```sh\nmake\n```\n")
+
+	attachments, err := ReadAttachments([]string{main, readme}, []string{filepath.Join(dir, "*.go")}, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := AttachmentNames(attachments)
+	if len(names) != 3 || !strings.HasSuffix(names[2], "util.go") {
+		t.Fatalf("names = %v, want main.go, README.md, util.go without duplicates", names)
+	}
+
+	prompt := BuildPrompt("review this", attachments)
+	if !strings.HasPrefix(prompt, "review this\n\n```"+filepath.ToSlash(main)+"\npackage main\n```\n\n") {
+		t.Fatalf("prompt = %q", prompt)
+	}
+	if !strings.Contains(prompt, "````"+filepath.ToSlash(readme)+"\n```sh\nmake\n```\n````") {
+		t.Fatalf("fence not lengthened around backticks: %q", prompt)
+	}
+
+	if _, err := ReadAttachments([]string{main, readme}, nil, 20); err == nil {
+		t.Fatal("expected the size guard to reject the files")
+	}
+	if _, err := ReadAttachments(nil, []string{filepath.Join(dir, "*.rs")}, 1024); err == nil {
+		t.Fatal("expected an error for a glob without matches")
+	}
+	if _, err := ReadStdin(strings.NewReader(strings.Repeat("x", 21)), 20); err == nil {
+		t.Fatal("expected the size guard to reject stdin")
+	}
+}
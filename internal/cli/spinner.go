@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -21,7 +23,6 @@ type spinnerModel struct {
 func newSpinnerModel(message string) spinnerModel {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	s.Style = s.Style
 	return spinnerModel{
 		spinner: s,
 		message: message,
@@ -39,6 +40,9 @@ func (m spinnerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.quitting = true
 			return m, tea.Quit
 		}
+	case statusMsg:
+		m.message = string(msg)
+		return m, nil
 	case resultMsg:
 		m.result = msg.result
 		m.quitting = true
@@ -67,6 +71,9 @@ type resultMsg struct {
 	result interface{}
 }
 
+// statusMsg replaces the spinner's message
+type statusMsg string
+
 // ExecuteWithSpinner runs executeFn with a loading spinner (or simple message if no TTY)
 func ExecuteWithSpinner[T any](message string, executeFn func() (T, error)) (T, error) {
 	// Check if we have a TTY for the spinner
@@ -121,6 +128,49 @@ func ExecuteWithSpinner[T any](message string, executeFn func() (T, error)) (T,
 	return result, execErr
 }
 
+// ExecuteWithProgress runs executeFn with a spinner whose message executeFn
+// replaces through update, for long tasks such as model pulls. Without a TTY
+// a changed message is printed at most once per second. Quitting the
+// spinner with ctrl+c calls cancel, which should cancel the context
+// executeFn runs under, and waits for executeFn to return.
+func ExecuteWithProgress(message string, cancel context.CancelFunc, executeFn func(update func(string)) error) error {
+	if !IsATTY() {
+		fmt.Fprintf(os.Stderr, "%s\n", message)
+		last, lastAt := message, time.Now()
+		return executeFn(func(status string) {
+			if status != last && time.Since(lastAt) >= time.Second {
+				fmt.Fprintf(os.Stderr, "%s\n", status)
+				last, lastAt = status, time.Now()
+			}
+		})
+	}
+
+	p := tea.NewProgram(newSpinnerModel(message))
+	done := make(chan error, 1)
+	go func() {
+		err := executeFn(func(status string) { p.Send(statusMsg(status)) })
+		done <- err
+		if err != nil {
+			p.Send(err)
+		} else {
+			p.Send(resultMsg{result: true})
+		}
+	}()
+
+	finalModel, err := p.Run()
+	if err != nil {
+		// Fallback: the task keeps running without the spinner
+		return <-done
+	}
+	if fm, ok := finalModel.(spinnerModel); ok && fm.err == nil && fm.result == nil {
+		// Quit with ctrl+c before the task finished
+		cancel()
+		<-done
+		return fmt.Errorf("interrupted")
+	}
+	return <-done
+}
+
 // IsATTY checks if stdout is a terminal
 func IsATTY() bool {
 	fileInfo, err := os.Stdout.Stat()
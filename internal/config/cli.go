@@ -0,0 +1,430 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLIConfig holds the defaults of the CLI commands. Values are layered:
+// built-in defaults, then config.json, then SIDEKICK_* environment
+// variables; command-line flags override the result.
+type CLIConfig struct {
+	Agent         string        // agent profile when --agent is not given; "" is the default profile
+	Context       string        // context when --context is not given
+	Storage       string        // history backend: file, sqlite or postgres
+	History       int           // prior messages sent with a prompt
+	Verbosity     *int          // nil uses the default agent's verbosity
+	OllamaURL     string        // local Ollama endpoint; a comma-separated list is a pool of hosts
+	RemoteURL     string        // sidekick server to try before local Ollama; "" for local only
+	RemoteTimeout time.Duration // limit for a remote request
+	OllamaTimeout time.Duration // limit for a local Ollama request; 0 for none
+	Render        string        // reply rendering: plain, auto, dark or light
+
+	sources map[string]string
+}
+
+// Sources a CLI setting can come from, as reported by Source.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+)
+
+// Render styles for replies.
+const (
+	RenderPlain = "plain" // print replies as they are
+	RenderAuto  = "auto"  // render Markdown when stdout is a terminal
+	RenderDark  = "dark"
+	RenderLight = "light"
+)
+
+// cliKey is a setting of config.json. The environment variable is
+// SIDEKICK_ followed by the upper-cased name.
+type cliKey struct {
+	name        string
+	description string
+	number      bool // stored as a JSON number rather than a string
+	get         func(c *CLIConfig) string
+	set         func(c *CLIConfig, value string) error
+}
+
+var cliKeys = []cliKey{
+	{
+		name:        "agent",
+		description: "agent profile used when --agent is not given",
+		get:         func(c *CLIConfig) string { return c.Agent },
+		set: func(c *CLIConfig, v string) error {
+			c.Agent = strings.TrimSpace(v)
+			return nil
+		},
+	},
+	{
+		name:        "context",
+		description: "context used when --context is not given",
+		get:         func(c *CLIConfig) string { return c.Context },
+		set: func(c *CLIConfig, v string) error {
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("must not be empty")
+			}
+			c.Context = strings.TrimSpace(v)
+			return nil
+		},
+	},
+	{
+		name:        "storage",
+		description: "history backend: file, sqlite or postgres",
+		get:         func(c *CLIConfig) string { return c.Storage },
+		set: func(c *CLIConfig, v string) error {
+			switch v {
+			case "file", "sqlite", "postgres":
+				c.Storage = v
+				return nil
+			}
+			return fmt.Errorf("must be file, sqlite or postgres")
+		},
+	},
+	{
+		name:        "history",
+		description: "number of prior messages sent with a prompt",
+		number:      true,
+		get:         func(c *CLIConfig) string { return strconv.Itoa(c.History) },
+		set: func(c *CLIConfig, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("must be a number >= 0")
+			}
+			c.History = n
+			return nil
+		},
+	},
+	{
+		name:        "verbosity",
+		description: "verbosity 0-5 used when --verbosity is not given (unset: the default agent's)",
+		number:      true,
+		get: func(c *CLIConfig) string {
+			if c.Verbosity == nil {
+				return ""
+			}
+			return strconv.Itoa(*c.Verbosity)
+		},
+		set: func(c *CLIConfig, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 5 {
+				return fmt.Errorf("must be a number from 0 to 5")
+			}
+			c.Verbosity = &n
+			return nil
+		},
+	},
+	{
+		name:        "ollama_url",
+		description: "local Ollama endpoint; comma-separate several hosts for a pool",
+		get:         func(c *CLIConfig) string { return c.OllamaURL },
+		set: func(c *CLIConfig, v string) error {
+			var urls []string
+			for _, u := range strings.Split(v, ",") {
+				if err := validateURL(u); err != nil {
+					return err
+				}
+				urls = append(urls, strings.TrimRight(strings.TrimSpace(u), "/"))
+			}
+			c.OllamaURL = strings.Join(urls, ",")
+			return nil
+		},
+	},
+	{
+		name:        "remote_url",
+		description: "sidekick server tried before local Ollama (empty: local only)",
+		get:         func(c *CLIConfig) string { return c.RemoteURL },
+		set: func(c *CLIConfig, v string) error {
+			if v = strings.TrimSpace(v); v != "" {
+				if err := validateURL(v); err != nil {
+					return err
+				}
+			}
+			c.RemoteURL = strings.TrimRight(v, "/")
+			return nil
+		},
+	},
+	{
+		name:        "remote_timeout",
+		description: "limit for a remote request, e.g. 30s",
+		get:         func(c *CLIConfig) string { return c.RemoteTimeout.String() },
+		set: func(c *CLIConfig, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("must be a positive duration such as 30s")
+			}
+			c.RemoteTimeout = d
+			return nil
+		},
+	},
+	{
+		name:        "ollama_timeout",
+		description: "limit for a local Ollama request, e.g. 5m (0: none)",
+		get:         func(c *CLIConfig) string { return c.OllamaTimeout.String() },
+		set: func(c *CLIConfig, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return fmt.Errorf("must be a duration such as 5m, or 0 for none")
+			}
+			c.OllamaTimeout = d
+			return nil
+		},
+	},
+	{
+		name:        "render",
+		description: "reply rendering: plain, auto (Markdown on a terminal), dark or light",
+		get:         func(c *CLIConfig) string { return c.Render },
+		set: func(c *CLIConfig, v string) error {
+			switch v {
+			case RenderPlain, RenderAuto, RenderDark, RenderLight:
+				c.Render = v
+				return nil
+			}
+			return fmt.Errorf("must be %s, %s, %s or %s", RenderPlain, RenderAuto, RenderDark, RenderLight)
+		},
+	},
+}
+
+func validateURL(v string) error {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
+
+func findCLIKey(name string) (cliKey, error) {
+	for _, k := range cliKeys {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return cliKey{}, fmt.Errorf("unknown config key %q (known keys: %s)", name, strings.Join(CLIKeys(), ", "))
+}
+
+// CLIKeys returns the names of the CLI settings in display order.
+func CLIKeys() []string {
+	names := make([]string, len(cliKeys))
+	for i, k := range cliKeys {
+		names[i] = k.name
+	}
+	return names
+}
+
+// CLIKeyDescription describes a CLI setting.
+func CLIKeyDescription(name string) string {
+	k, err := findCLIKey(name)
+	if err != nil {
+		return ""
+	}
+	return k.description
+}
+
+// CLIKeyEnv returns the environment variable that overrides a CLI setting.
+func CLIKeyEnv(name string) string {
+	return "SIDEKICK_" + strings.ToUpper(name)
+}
+
+// DefaultCLIConfig returns the built-in defaults.
+func DefaultCLIConfig() CLIConfig {
+	return CLIConfig{
+		Context:       "misc",
+		Storage:       "file",
+		History:       4,
+		OllamaURL:     "http://localhost:11434",
+		RemoteTimeout: 30 * time.Second,
+		Render:        RenderPlain,
+		sources:       map[string]string{},
+	}
+}
+
+// OllamaHosts returns the Ollama endpoints of OllamaURL.
+func (c CLIConfig) OllamaHosts() []string {
+	return strings.Split(c.OllamaURL, ",")
+}
+
+// Get returns a setting as text.
+func (c CLIConfig) Get(name string) (string, error) {
+	k, err := findCLIKey(name)
+	if err != nil {
+		return "", err
+	}
+	return k.get(&c), nil
+}
+
+// Source reports where a setting's value came from.
+func (c CLIConfig) Source(name string) string {
+	if source, ok := c.sources[name]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// LoadCLI loads the layered CLI config and validates every layer. Errors
+// name the file or environment variable holding the bad value.
+func LoadCLI() (CLIConfig, error) {
+	cfg := DefaultCLIConfig()
+
+	// remote.json predates config.json and still provides remote_url
+	if remote, err := LoadRemote(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", RemoteFile(), err)
+	} else if remote != "" {
+		if err := cfg.apply("remote_url", remote, SourceFile); err != nil {
+			return cfg, fmt.Errorf("%s: base_url %w", RemoteFile(), err)
+		}
+	}
+
+	values, err := readCLIFile()
+	if err != nil {
+		return cfg, err
+	}
+	for _, name := range sortedKeys(values) {
+		if err := cfg.apply(name, values[name], SourceFile); err != nil {
+			return cfg, fmt.Errorf("%s: %w", File(), err)
+		}
+	}
+
+	for _, k := range cliKeys {
+		if v, ok := os.LookupEnv(CLIKeyEnv(k.name)); ok {
+			if err := cfg.apply(k.name, strings.TrimSpace(v), SourceEnv); err != nil {
+				return cfg, fmt.Errorf("%s: %w", CLIKeyEnv(k.name), err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (c *CLIConfig) apply(name, value, source string) error {
+	k, err := findCLIKey(name)
+	if err != nil {
+		return err
+	}
+	if err := k.set(c, value); err != nil {
+		return fmt.Errorf("%s %w", name, err)
+	}
+	c.sources[name] = source
+	return nil
+}
+
+// SetCLI validates value and stores it in config.json. Other entries of
+// the file, including unknown keys, are kept as they are.
+func SetCLI(name, value string) error {
+	k, err := findCLIKey(name)
+	if err != nil {
+		return err
+	}
+	check := DefaultCLIConfig()
+	if err := check.apply(name, value, SourceFile); err != nil {
+		return err
+	}
+
+	raw, err := readRawCLIFile()
+	if err != nil {
+		return err
+	}
+	var stored any = k.get(&check)
+	if n, err := strconv.Atoi(k.get(&check)); err == nil && k.number {
+		stored = n
+	}
+	msg, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	raw[name] = msg
+	return writeCLIFile(raw)
+}
+
+// UnsetCLI removes a setting from config.json, restoring its default. It
+// also removes unknown keys, so a misspelled setting can be dropped.
+func UnsetCLI(name string) error {
+	raw, err := readRawCLIFile()
+	if err != nil {
+		return err
+	}
+	if _, ok := raw[name]; !ok {
+		if _, err := findCLIKey(name); err != nil {
+			return err
+		}
+	}
+	delete(raw, name)
+	return writeCLIFile(raw)
+}
+
+// readRawCLIFile returns the entries of config.json without checking
+// them. A missing file has no entries.
+func readRawCLIFile() (map[string]json.RawMessage, error) {
+	raw := map[string]json.RawMessage{}
+	b, err := os.ReadFile(File())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return raw, nil
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return raw, nil
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", File(), err)
+	}
+	if raw == nil {
+		raw = map[string]json.RawMessage{}
+	}
+	return raw, nil
+}
+
+// readCLIFile returns the settings in config.json as text and rejects
+// unknown keys.
+func readCLIFile() (map[string]string, error) {
+	raw, err := readRawCLIFile()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for name, msg := range raw {
+		if _, err := findCLIKey(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", File(), err)
+		}
+		var s string
+		if err := json.Unmarshal(msg, &s); err == nil {
+			values[name] = s
+			continue
+		}
+		var n json.Number
+		if err := json.Unmarshal(msg, &n); err != nil {
+			return nil, fmt.Errorf("%s: %s must be a string or number", File(), name)
+		}
+		values[name] = n.String()
+	}
+	return values, nil
+}
+
+func writeCLIFile(raw map[string]json.RawMessage) error {
+	b, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(File()), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(File(), append(b, '\n'), 0o644)
+}
+
+func sortedKeys(values map[string]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCLILayers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SIDEKICK_STORAGE", "")
+	os.Unsetenv("SIDEKICK_STORAGE")
+
+	if err := SetCLI("history", "8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCLI("storage", "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCLI("storage", "bogus"); err == nil {
+		t.Fatal("expected invalid storage to be rejected")
+	}
+	t.Setenv("SIDEKICK_STORAGE", "postgres")
+
+	cfg, err := LoadCLI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.History != 8 || cfg.Source("history") != SourceFile {
+		t.Errorf("history = %d from %s, want 8 from file", cfg.History, cfg.Source("history"))
+	}
+	if cfg.Storage != "postgres" || cfg.Source("storage") != SourceEnv {
+		t.Errorf("storage = %s from %s, want postgres from env", cfg.Storage, cfg.Source("storage"))
+	}
+	if cfg.Context != "misc" || cfg.Source("context") != SourceDefault {
+		t.Errorf("context = %s from %s, want misc from default", cfg.Context, cfg.Source("context"))
+	}
+
+	t.Setenv("SIDEKICK_VERBOSITY", "9")
+	if _, err := LoadCLI(); err == nil || !strings.Contains(err.Error(), "SIDEKICK_VERBOSITY") {
+		t.Errorf("err = %v, want error naming SIDEKICK_VERBOSITY", err)
+	}
+}
+
+func TestLoadCLIRejectsUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "sidekick"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(File(), []byte(`{"histroy": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCLI(); err == nil || !strings.Contains(err.Error(), "histroy") {
+		t.Errorf("err = %v, want unknown key error", err)
+	}
+}
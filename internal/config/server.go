@@ -0,0 +1,184 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds settings for API mode (--serve). Secrets such as the
+// Postgres DSN and API key stay in environment variables; this file carries
+// structured settings that are awkward to express as env vars.
+type ServerConfig struct {
+	Notify    NotifyConfig    `json:"notify"`
+	Sessions  SessionsConfig  `json:"sessions"`
+	OIDC      OIDCConfig      `json:"oidc"`
+	Metrics   MetricsConfig   `json:"metrics"`
+	Log       LogConfig       `json:"log"`
+	Scheduler SchedulerConfig `json:"scheduler"`
+	Quota     QuotaConfig     `json:"quota"`
+	Ollama    OllamaConfig    `json:"ollama"`
+	WebSocket WebSocketConfig `json:"websocket"`
+}
+
+// WebSocketConfig controls /ws/chat. Pages served from the API's own
+// origin may always connect.
+type WebSocketConfig struct {
+	// AllowedOrigins are further page origins allowed to connect, e.g.
+	// "https://sidekick.lan".
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// OllamaConfig lists the Ollama hosts generations are routed across. With
+// no hosts, SIDEKICK_OLLAMA_URL (default http://localhost:11434) is the
+// only host.
+type OllamaConfig struct {
+	Hosts         []OllamaHost `json:"hosts"`
+	ProbeInterval Duration     `json:"probe_interval"` // health check interval, default 30s
+}
+
+// OllamaHost is one Ollama server of the pool.
+type OllamaHost struct {
+	URL           string `json:"url"`
+	MaxConcurrent int    `json:"max_concurrent"` // concurrent requests sent to the host; 0 for no limit
+}
+
+// QuotaConfig sets optional daily token quotas (prompt + completion tokens
+// per UTC day). Zero means unlimited.
+type QuotaConfig struct {
+	DailyTokens int            `json:"daily_tokens"` // default for every user
+	Users       map[string]int `json:"users"`        // per-user override, keyed by email or user ID
+}
+
+// SchedulerConfig limits concurrent Ollama generations on the server.
+// Zero values use defaults: one generation at a time, a queue of 32 requests
+// and at most 8 queued requests per user.
+type SchedulerConfig struct {
+	Concurrency     int            `json:"concurrency"`        // total concurrent generations
+	PerModel        map[string]int `json:"per_model"`          // optional cap per model name
+	MaxQueue        int            `json:"max_queue"`          // waiting requests across all users
+	MaxQueuePerUser int            `json:"max_queue_per_user"` // waiting requests per user
+}
+
+// LogConfig controls the server's structured logging.
+type LogConfig struct {
+	Level  string `json:"level"`  // debug, info (default), warn, error
+	Format string `json:"format"` // json (default) or text
+	// Prompts logs message content verbatim. Off by default: prompts are
+	// logged as length and hash only.
+	Prompts bool `json:"prompts"`
+}
+
+// MetricsConfig controls the Prometheus /metrics endpoint.
+type MetricsConfig struct {
+	Disabled bool `json:"disabled"`
+	// Token, when set, must be sent as "Authorization: Bearer <token>".
+	// Scrapers on the LAN usually leave it empty.
+	Token string `json:"token"`
+}
+
+// OIDCConfig enables login through an external OpenID Connect provider.
+// OIDC is disabled when Issuer is empty.
+type OIDCConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"` // e.g. https://sidekick.lan/auth/oidc/callback
+	Scopes       []string `json:"scopes,omitempty"`
+	// AllowSignup creates a local user on first login when no user with the
+	// verified email exists. Otherwise unknown identities are rejected.
+	AllowSignup bool `json:"allow_signup"`
+}
+
+// SessionsConfig controls login session lifetime. Zero values use defaults
+// (24h TTL, 30d max lifetime, fixed expiry, hourly sweep).
+type SessionsConfig struct {
+	TTL           Duration `json:"ttl"`
+	MaxLifetime   Duration `json:"max_lifetime"`
+	Sliding       bool     `json:"sliding"`
+	SweepInterval Duration `json:"sweep_interval"`
+}
+
+// SweepEvery returns the expired-session sweep interval, defaulting to 1h.
+func (c SessionsConfig) SweepEvery() time.Duration {
+	if c.SweepInterval > 0 {
+		return c.SweepInterval.Std()
+	}
+	return time.Hour
+}
+
+// NotifyConfig declares named notification sinks and which events are routed
+// to them. Routes map an event type (or "*" for all events) to sink names.
+type NotifyConfig struct {
+	Sinks    map[string]NotifySink `json:"sinks"`
+	Routes   map[string][]string   `json:"routes"`
+	Cooldown Duration              `json:"cooldown"`
+}
+
+// NotifySink configures a single notification target.
+// Type is one of: discord, webhook, ntfy, file.
+type NotifySink struct {
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"` // HMAC key for webhook sinks
+	Token  string `json:"token,omitempty"`  // bearer token for ntfy sinks
+	Path   string `json:"path,omitempty"`   // output path for file sinks
+}
+
+// Duration is a time.Duration that unmarshals from a Go duration string
+// ("30s", "24h") or from a number of seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return fmt.Errorf("duration must be a string or number of seconds")
+	}
+	*d = Duration(secs * float64(time.Second))
+	return nil
+}
+
+// Std returns the value as a time.Duration.
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+// ServerFile returns the path to the server config file.
+// SIDEKICK_SERVER_CONFIG overrides the default location.
+func ServerFile() string {
+	if p := strings.TrimSpace(os.Getenv("SIDEKICK_SERVER_CONFIG")); p != "" {
+		return p
+	}
+	return filepath.Join(Dir(), "server.json")
+}
+
+// LoadServer reads the server config file. A missing file yields the zero
+// config, so every section must have usable defaults.
+func LoadServer() (ServerConfig, error) {
+	var cfg ServerConfig
+	b, err := os.ReadFile(ServerFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", ServerFile(), err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/earlysvahn/sidekick/internal/metrics"
+)
+
+// countingConnector wraps a driver.Connector and counts driver errors in
+// metrics.DBErrors, so every query through the pool is covered without
+// touching individual call sites.
+type countingConnector struct {
+	driver.Connector
+}
+
+func (c countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		observeDBError("connect", err)
+		return nil, err
+	}
+	return &countingConn{conn}, nil
+}
+
+// countingConn forwards to the wrapped connection. The inner connection must
+// implement the context-aware driver interfaces (lib/pq does).
+type countingConn struct {
+	driver.Conn
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	observeDBError("query", err)
+	return rows, err
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	observeDBError("exec", err)
+	return res, err
+}
+
+func (c *countingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	observeDBError("prepare", err)
+	return stmt, err
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	observeDBError("begin", err)
+	return tx, err
+}
+
+func (c *countingConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		err := p.Ping(ctx)
+		observeDBError("ping", err)
+		return err
+	}
+	return nil
+}
+
+func (c *countingConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *countingConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// observeDBError counts err unless it is nil, a driver control-flow signal,
+// or a cancellation caused by the client going away.
+func observeDBError(op string, err error) {
+	if err == nil || errors.Is(err, driver.ErrSkip) || errors.Is(err, context.Canceled) {
+		return
+	}
+	metrics.DBErrors.WithLabelValues(op).Inc()
+}
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"os"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // PostgresDSN returns the Postgres DSN from environment and whether it was set.
@@ -15,12 +15,23 @@ func PostgresDSN() (string, bool) {
 
 // OpenPostgres opens a connection to the Postgres database.
 // Returns an error if SIDEKICK_POSTGRES_DSN is not set.
+// Driver errors are counted in the sidekick_db_errors_total metric.
 func OpenPostgres() (*sql.DB, error) {
 	dsn, ok := PostgresDSN()
 	if !ok {
 		return nil, &PostgresNotConfiguredError{}
 	}
-	return sql.Open("postgres", dsn)
+	return OpenPostgresDSN(dsn)
+}
+
+// OpenPostgresDSN opens a Postgres pool for an explicit DSN, with the same
+// error instrumentation as OpenPostgres.
+func OpenPostgresDSN(dsn string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(countingConnector{connector}), nil
 }
 
 // PostgresNotConfiguredError is returned when Postgres DSN is not configured.
@@ -6,12 +6,31 @@ import (
 
 	"github.com/earlysvahn/sidekick/internal/agent"
 	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/ollama"
 )
 
 // ExecutionResult contains the reply and source of an LLM execution
 type ExecutionResult struct {
-	Reply  string
-	Source string // "local", "remote", or "fallback"
+	Reply   string
+	Source  string // "local", "remote", or "fallback"
+	Model   string // model that answered; empty if a remote did not report it
+	Usage   Usage
+	Latency time.Duration
+}
+
+// Usage is the token accounting Ollama reports for one generation.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// TotalTokens returns prompt plus completion tokens.
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func usageFromStats(stats ollama.Stats) Usage {
+	return Usage{PromptTokens: stats.PromptEvalCount, CompletionTokens: stats.EvalCount}
 }
 
 // FallbackConfig configures the fallback execution behavior
@@ -20,9 +39,15 @@ type FallbackConfig struct {
 	RemoteURL     string
 	LocalOnly     bool
 	RemoteOnly    bool
+	RemoteTimeout time.Duration // zero uses 30s
 	Profile       *agent.AgentProfile
 	Verbosity     int
 	Log           func(string)
+
+	// OnDelta, when set, receives the reply as it is generated. Local
+	// Ollama streams token chunks; a remote server sends the whole reply
+	// as a single delta.
+	OnDelta func(string) error
 }
 
 // ExecuteWithFallback executes an LLM request with fallback logic:
@@ -31,6 +56,13 @@ type FallbackConfig struct {
 // 3. If remote available and healthy, try remote first
 // 4. On remote failure (if not remoteOnly), fallback to local Ollama
 func ExecuteWithFallback(cfg FallbackConfig, messages []chat.Message) (ExecutionResult, error) {
+	start := time.Now()
+	result, err := executeWithFallback(cfg, messages)
+	result.Latency = time.Since(start)
+	return result, err
+}
+
+func executeWithFallback(cfg FallbackConfig, messages []chat.Message) (ExecutionResult, error) {
 	logf := cfg.Log
 	if logf == nil {
 		logf = func(string) {} // No-op logger
@@ -45,8 +77,7 @@ func ExecuteWithFallback(cfg FallbackConfig, messages []chat.Message) (Execution
 	// Force local execution
 	if cfg.LocalOnly {
 		logf("execution path: local ollama (forced)")
-		reply, err := (&OllamaExecutor{Model: localModel, Log: nil, Verbosity: cfg.Verbosity}).Execute(messages)
-		return ExecutionResult{Reply: reply, Source: "local"}, err
+		return executeLocal(localModel, cfg.Verbosity, "local", messages, cfg.OnDelta, logf)
 	}
 
 	// No remote configured, use local
@@ -55,12 +86,15 @@ func ExecuteWithFallback(cfg FallbackConfig, messages []chat.Message) (Execution
 			return ExecutionResult{}, fmt.Errorf("remote execution requested but no remote is configured")
 		}
 		logf("execution path: local ollama (no remote configured)")
-		reply, err := (&OllamaExecutor{Model: localModel, Log: nil, Verbosity: cfg.Verbosity}).Execute(messages)
-		return ExecutionResult{Reply: reply, Source: "local"}, err
+		return executeLocal(localModel, cfg.Verbosity, "local", messages, cfg.OnDelta, logf)
 	}
 
 	// Try remote execution
-	httpExec := NewHTTPExecutor(cfg.RemoteURL, 30*time.Second, nil)
+	remoteTimeout := cfg.RemoteTimeout
+	if remoteTimeout <= 0 {
+		remoteTimeout = 30 * time.Second
+	}
+	httpExec := NewHTTPExecutor(cfg.RemoteURL, remoteTimeout, nil)
 	httpExec.Verbosity = cfg.Verbosity
 
 	// If using profile, pass the remote model to HTTP executor
@@ -71,9 +105,14 @@ func ExecuteWithFallback(cfg FallbackConfig, messages []chat.Message) (Execution
 
 	ok, healthErr := httpExec.Available()
 	if ok {
-		reply, err := httpExec.Execute(messages)
+		result, err := httpExec.ExecuteResult(messages)
 		if err == nil {
-			return ExecutionResult{Reply: reply, Source: "remote"}, nil
+			if cfg.OnDelta != nil {
+				if err := cfg.OnDelta(result.Reply); err != nil {
+					return result, err
+				}
+			}
+			return result, nil
 		}
 		if cfg.RemoteOnly {
 			return ExecutionResult{}, err
@@ -89,6 +128,39 @@ func ExecuteWithFallback(cfg FallbackConfig, messages []chat.Message) (Execution
 	}
 
 	// Fallback to local
-	reply, err := (&OllamaExecutor{Model: localModel, Log: nil, Verbosity: cfg.Verbosity}).Execute(messages)
-	return ExecutionResult{Reply: reply, Source: "fallback"}, err
+	return executeLocal(localModel, cfg.Verbosity, "fallback", messages, cfg.OnDelta, logf)
+}
+
+func executeLocal(model string, verbosity int, source string, messages []chat.Message, onDelta func(string) error, logf func(string)) (ExecutionResult, error) {
+	ollamaExec := &OllamaExecutor{Model: model, Log: nil, Verbosity: verbosity, OnPull: pullLogger(ollama.SelectedModel(model), logf)}
+	var reply string
+	var usage Usage
+	var err error
+	if onDelta != nil {
+		reply, usage, err = ollamaExec.ExecuteStreamingWithUsage(messages, onDelta)
+	} else {
+		reply, usage, err = ollamaExec.ExecuteWithUsage(messages)
+	}
+	return ExecutionResult{Reply: reply, Source: source, Model: ollama.SelectedModel(model), Usage: usage}, err
+}
+
+// pullLogger reports a model pull through logf: each new stage, and the
+// download of a layer in steps of 10%.
+func pullLogger(model string, logf func(string)) func(ollama.PullProgress) {
+	lastStatus, lastStep := "", -1
+	return func(p ollama.PullProgress) {
+		step := -1
+		if pct := p.Percent(); pct >= 0 {
+			step = pct / 10
+		}
+		if p.Status == lastStatus && step == lastStep {
+			return
+		}
+		lastStatus, lastStep = p.Status, step
+		if step >= 0 {
+			logf(fmt.Sprintf("pulling model %s: %s %d%%", model, p.Status, step*10))
+			return
+		}
+		logf(fmt.Sprintf("pulling model %s: %s", model, p.Status))
+	}
 }
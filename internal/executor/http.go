@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/logging"
 )
 
 type HTTPExecutor struct {
@@ -30,19 +32,72 @@ func NewHTTPExecutor(baseURL string, timeout time.Duration, log func(string)) *H
 	}
 }
 
+// Available reports whether the remote server can take requests. It reads
+// /health/ready, which checks the server's Postgres and Ollama; a degraded
+// server (some agent models not pulled yet) still counts as available.
+// Servers without /health/ready fall back to the plain /health probe.
 func (e *HTTPExecutor) Available() (bool, error) {
 	if e.Log != nil {
-		e.Log(fmt.Sprintf("remote health check start %s/health", e.BaseURL))
+		e.Log(fmt.Sprintf("remote readiness check start %s/health/ready", e.BaseURL))
 	}
-	// Use a short timeout for health check (1 second)
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	// Short timeout: the server bounds its own dependency checks at 2s.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", e.BaseURL+"/health", nil)
+	resp, err := e.get(ctx, "/health/ready")
 	if err != nil {
-		return false, fmt.Errorf("create health check request: %w", err)
+		if e.Log != nil {
+			e.Log(fmt.Sprintf("remote health check failed: %v", err))
+		}
+		return false, err
 	}
-	resp, err := e.Client.Do(req)
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return e.availableLegacy(ctx)
+	}
+
+	var ready struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		} `json:"checks"`
+		Models struct {
+			Missing []string `json:"missing"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+		return false, fmt.Errorf("decode readiness response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failed []string
+		for name, check := range ready.Checks {
+			if !check.OK {
+				failed = append(failed, fmt.Sprintf("%s: %s", name, check.Error))
+			}
+		}
+		sort.Strings(failed)
+		if e.Log != nil {
+			e.Log(fmt.Sprintf("remote not ready: status %d %s", resp.StatusCode, strings.Join(failed, "; ")))
+		}
+		return false, fmt.Errorf("remote not ready (%s): %s", ready.Status, strings.Join(failed, "; "))
+	}
+
+	if e.Log != nil {
+		if len(ready.Models.Missing) > 0 {
+			e.Log(fmt.Sprintf("remote ready (%s), missing models: %s", ready.Status, strings.Join(ready.Models.Missing, ", ")))
+		} else {
+			e.Log("remote health check ok")
+		}
+	}
+	return true, nil
+}
+
+// availableLegacy probes /health on servers that predate /health/ready.
+func (e *HTTPExecutor) availableLegacy(ctx context.Context) (bool, error) {
+	resp, err := e.get(ctx, "/health")
 	if err != nil {
 		if e.Log != nil {
 			e.Log(fmt.Sprintf("remote health check failed: %v", err))
@@ -62,7 +117,23 @@ func (e *HTTPExecutor) Available() (bool, error) {
 	return true, nil
 }
 
+func (e *HTTPExecutor) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", e.BaseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create health check request: %w", err)
+	}
+	req.Header.Set(logging.ClientHeader, "cli")
+	return e.Client.Do(req)
+}
+
 func (e *HTTPExecutor) Execute(messages []chat.Message) (string, error) {
+	result, err := e.ExecuteResult(messages)
+	return result.Reply, err
+}
+
+// ExecuteResult is Execute that also returns the model and token usage
+// reported by the remote server (empty for servers that predate them).
+func (e *HTTPExecutor) ExecuteResult(messages []chat.Message) (ExecutionResult, error) {
 	if e.Log != nil {
 		e.Log("remote execute start")
 	}
@@ -72,20 +143,21 @@ func (e *HTTPExecutor) Execute(messages []chat.Message) (string, error) {
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return ExecutionResult{}, fmt.Errorf("marshal request: %w", err)
 	}
 	req, err := http.NewRequest("POST", e.BaseURL+"/execute", bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return ExecutionResult{}, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logging.ClientHeader, "cli")
 
 	resp, err := e.Client.Do(req)
 	if err != nil {
 		if e.Log != nil {
 			e.Log(fmt.Sprintf("remote execute failed: %v", err))
 		}
-		return "", err
+		return ExecutionResult{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
@@ -93,20 +165,22 @@ func (e *HTTPExecutor) Execute(messages []chat.Message) (string, error) {
 		if e.Log != nil {
 			e.Log(fmt.Sprintf("remote execute non-200: %d", resp.StatusCode))
 		}
-		return "", fmt.Errorf("http executor error: %d %s", resp.StatusCode, strings.TrimSpace(string(b)))
+		return ExecutionResult{}, fmt.Errorf("http executor error: %d %s", resp.StatusCode, strings.TrimSpace(string(b)))
 	}
 	var out struct {
 		Reply   string `json:"reply"`
 		Warning string `json:"warning"`
+		Model   string `json:"model"`
+		Usage   Usage  `json:"usage"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
+		return ExecutionResult{}, err
 	}
 	if out.Reply == "" {
-		return "", errors.New("empty reply")
+		return ExecutionResult{}, errors.New("empty reply")
 	}
 	if e.Log != nil {
 		e.Log("remote execute ok")
 	}
-	return out.Reply, nil
+	return ExecutionResult{Reply: out.Reply, Source: "remote", Model: out.Model, Usage: out.Usage}, nil
 }
@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPExecutorAvailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    bool
+	}{
+		{
+			name: "ready",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"ready","checks":{"postgres":{"ok":true},"ollama":{"ok":true}}}`))
+			},
+			want: true,
+		},
+		{
+			name: "degraded still available",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"degraded","models":{"missing":["qwen2.5:14b"]}}`))
+			},
+			want: true,
+		},
+		{
+			name: "ollama down",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"status":"unavailable","checks":{"ollama":{"ok":false,"error":"connection refused"}}}`))
+			},
+			want: false,
+		},
+		{
+			name: "legacy server",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/health" {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				http.NotFound(w, r)
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			got, err := NewHTTPExecutor(srv.URL, time.Second, nil).Available()
+			if got != tt.want {
+				t.Fatalf("Available() = %v (err %v), want %v", got, err, tt.want)
+			}
+			if !got && err == nil {
+				t.Fatal("expected an error when unavailable")
+			}
+		})
+	}
+}
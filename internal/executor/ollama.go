@@ -1,7 +1,13 @@
 package executor
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+	"github.com/earlysvahn/sidekick/internal/notify"
 	"github.com/earlysvahn/sidekick/internal/ollama"
 )
 
@@ -9,16 +15,26 @@ type OllamaExecutor struct {
 	Model     string
 	Log       func(string)
 	Verbosity int // 0=minimal, 1=concise, 2=normal, 3=verbose, 4=exhaustive, 5=max (no token cap)
+
+	// Ctx, when set, cancels an in-flight streaming request.
+	Ctx context.Context
+
+	// Pool picks the Ollama host; nil uses ollama.DefaultPool().
+	Pool *ollama.Pool
+
+	// OnPull, when set, receives the progress of a model pulled because the
+	// host does not have it yet.
+	OnPull func(ollama.PullProgress)
 }
 
 func (e *OllamaExecutor) Execute(messages []chat.Message) (string, error) {
+	reply, _, err := e.ExecuteWithUsage(messages)
+	return reply, err
+}
+
+// ExecuteWithUsage is Execute that also returns the token usage.
+func (e *OllamaExecutor) ExecuteWithUsage(messages []chat.Message) (string, Usage, error) {
 	model := ollama.SelectedModel(e.Model)
-	if err := ollama.EnsureModel(model, e.Log); err != nil {
-		return "", err
-	}
-	if e.Log != nil {
-		e.Log("local ollama request start")
-	}
 
 	// Hard cap tokens per verbosity. Verbosity 5 (max) omits num_predict entirely,
 	// letting Ollama use the model's default context limit.
@@ -27,24 +43,30 @@ func (e *OllamaExecutor) Execute(messages []chat.Message) (string, error) {
 		options = map[string]int{"num_predict": tokens}
 	}
 
-	reply, err := ollama.AskWithOptions(model, messages, options)
+	reply, stats, err := e.generate(model, func(baseURL string) (string, ollama.Stats, error) {
+		if e.Log != nil {
+			e.Log("local ollama request start")
+		}
+		return ollama.AskWithStatsAt(baseURL, model, messages, options)
+	}, nil)
 	if err == nil && e.Log != nil {
 		e.Log("local ollama response received")
 	}
-	return reply, err
+	return reply, usageFromStats(stats), err
 }
 
 // ExecuteStreaming executes with real-time token streaming.
 // The onDelta callback is called for each token chunk as it arrives from Ollama.
 // Returns the complete response text or an error.
 func (e *OllamaExecutor) ExecuteStreaming(messages []chat.Message, onDelta func(string) error) (string, error) {
+	reply, _, err := e.ExecuteStreamingWithUsage(messages, onDelta)
+	return reply, err
+}
+
+// ExecuteStreamingWithUsage is ExecuteStreaming that also returns the token
+// usage. Usage is zero when the stream is aborted.
+func (e *OllamaExecutor) ExecuteStreamingWithUsage(messages []chat.Message, onDelta func(string) error) (string, Usage, error) {
 	model := ollama.SelectedModel(e.Model)
-	if err := ollama.EnsureModel(model, e.Log); err != nil {
-		return "", err
-	}
-	if e.Log != nil {
-		e.Log("local ollama streaming request start")
-	}
 
 	// Hard cap tokens per verbosity. Verbosity 5 (max) omits num_predict entirely,
 	// letting Ollama use the model's default context limit.
@@ -53,9 +75,107 @@ func (e *OllamaExecutor) ExecuteStreaming(messages []chat.Message, onDelta func(
 		options = map[string]int{"num_predict": tokens}
 	}
 
-	reply, err := ollama.AskWithStreaming(model, messages, options, onDelta)
+	ctx := e.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	streamed := false
+	reply, stats, err := e.generate(model, func(baseURL string) (string, ollama.Stats, error) {
+		if e.Log != nil {
+			e.Log("local ollama streaming request start")
+		}
+		return ollama.AskStreamingAt(ctx, baseURL, model, messages, options, func(delta string) error {
+			streamed = true
+			if onDelta == nil {
+				return nil
+			}
+			return onDelta(delta)
+		})
+	}, func() bool { return streamed })
 	if err == nil && e.Log != nil {
 		e.Log("local ollama streaming response complete")
 	}
-	return reply, err
+	return reply, usageFromStats(stats), err
+}
+
+// generate runs call on a pool host that serves model, pulling the model
+// there first if needed. When a host is unreachable it fails over to the
+// next one, unless streamed (may be nil) reports that part of the reply was
+// already delivered.
+func (e *OllamaExecutor) generate(model string, call func(baseURL string) (string, ollama.Stats, error), streamed func() bool) (string, ollama.Stats, error) {
+	pool := e.Pool
+	if pool == nil {
+		pool = ollama.DefaultPool()
+	}
+	ctx := e.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var tried []string
+	for {
+		lease, err := pool.Acquire(ctx, model, tried...)
+		if err != nil {
+			return "", ollama.Stats{}, err
+		}
+		if pool.Size() > 1 && e.Log != nil {
+			e.Log(fmt.Sprintf("ollama host: %s", lease.URL()))
+		}
+
+		var (
+			reply string
+			stats ollama.Stats
+			ran   bool
+		)
+		err = ollama.EnsureModelAt(lease.URL(), model, e.Log, e.OnPull)
+		if err == nil {
+			ran = true
+			reply, stats, err = call(lease.URL())
+		}
+		lease.Release(err)
+		if ollama.IsUnreachable(err) {
+			reportUnreachable(err, lease.URL())
+		}
+		if ran {
+			observeGeneration(model, stats, err)
+		}
+		tried = append(tried, lease.URL())
+		if err == nil || !ollama.IsUnreachable(err) || (streamed != nil && streamed()) || len(tried) >= pool.Size() {
+			return reply, stats, err
+		}
+
+		if e.Log != nil {
+			e.Log(fmt.Sprintf("ollama host unreachable, trying the next: %s", lease.URL()))
+		}
+	}
+}
+
+// observeGeneration records metrics for a finished Ollama call.
+func observeGeneration(model string, stats ollama.Stats, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil {
+		metrics.ObserveGenerationError(model)
+		return
+	}
+	metrics.ObserveGeneration(metrics.Generation{
+		Model:            model,
+		PromptTokens:     stats.PromptEvalCount,
+		CompletionTokens: stats.EvalCount,
+		EvalDuration:     stats.EvalDuration,
+		FirstToken:       stats.FirstToken,
+	})
+}
+
+// reportUnreachable emits an ollama_unreachable notification for the host
+// at url.
+func reportUnreachable(err error, url string) {
+	notify.Send(notify.Event{
+		Type:    notify.EventOllamaUnreachable,
+		Title:   "Ollama unreachable",
+		Message: err.Error(),
+		Fields:  map[string]string{"url": url},
+		Key:     url,
+	})
 }
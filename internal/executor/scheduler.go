@@ -0,0 +1,270 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+)
+
+// Scheduler defaults, used when the corresponding config value is zero.
+const (
+	DefaultConcurrency     = 1
+	DefaultMaxQueue        = 32
+	DefaultMaxQueuePerUser = 8
+)
+
+// ErrQueueFull is returned by Enqueue when the request cannot be queued.
+var ErrQueueFull = errors.New("generation queue is full")
+
+// Scheduler limits concurrent Ollama generations, in total and per model,
+// and serves waiting requests round-robin across users so one user's burst
+// cannot starve everyone else. A nil *Scheduler admits everything.
+type Scheduler struct {
+	mu sync.Mutex
+
+	concurrency     int
+	perModel        map[string]int
+	maxQueue        int
+	maxQueuePerUser int
+
+	active        int
+	activeByModel map[string]int
+	queues        map[string][]*Ticket // per-user FIFO of waiting tickets
+	rotation      []string             // users with waiting tickets, next to serve first
+	waiting       int
+}
+
+// NewScheduler builds a scheduler from server config.
+func NewScheduler(cfg config.SchedulerConfig) *Scheduler {
+	s := &Scheduler{
+		concurrency:     cfg.Concurrency,
+		perModel:        make(map[string]int),
+		maxQueue:        cfg.MaxQueue,
+		maxQueuePerUser: cfg.MaxQueuePerUser,
+		activeByModel:   make(map[string]int),
+		queues:          make(map[string][]*Ticket),
+	}
+	if s.concurrency <= 0 {
+		s.concurrency = DefaultConcurrency
+	}
+	if s.maxQueue <= 0 {
+		s.maxQueue = DefaultMaxQueue
+	}
+	if s.maxQueuePerUser <= 0 {
+		s.maxQueuePerUser = DefaultMaxQueuePerUser
+	}
+	for model, n := range cfg.PerModel {
+		if n > 0 {
+			s.perModel[ollama.SelectedModel(model)] = n
+		}
+	}
+	return s
+}
+
+type ticketState int
+
+const (
+	ticketWaiting ticketState = iota
+	ticketGranted
+	ticketDone
+)
+
+// Ticket is one request's place in the scheduler. Call Wait to block until
+// it is granted and Release exactly once when the generation is finished (or
+// abandoned).
+type Ticket struct {
+	s        *Scheduler
+	model    string
+	user     string
+	state    ticketState
+	ready    chan struct{}
+	position chan int
+}
+
+// Enqueue adds a request for model on behalf of user. It is granted at once
+// when capacity allows. Returns ErrQueueFull when the global or per-user
+// queue limit is reached.
+func (s *Scheduler) Enqueue(model, user string) (*Ticket, error) {
+	t := &Ticket{
+		s:        s,
+		model:    ollama.SelectedModel(model),
+		user:     user,
+		ready:    make(chan struct{}),
+		position: make(chan int, 1),
+	}
+	if s == nil {
+		t.state = ticketGranted
+		close(t.ready)
+		return t, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Served immediately when nobody is waiting and there is room; this keeps
+	// the common uncontended path from ever touching the queue.
+	if s.waiting == 0 && s.hasCapacity(t.model) {
+		s.grant(t)
+		return t, nil
+	}
+	if s.waiting >= s.maxQueue || len(s.queues[user]) >= s.maxQueuePerUser {
+		metrics.QueueRejected.WithLabelValues(metrics.ModelLabel(t.model)).Inc()
+		return nil, ErrQueueFull
+	}
+
+	if len(s.queues[user]) == 0 {
+		s.rotation = append(s.rotation, user)
+	}
+	s.queues[user] = append(s.queues[user], t)
+	s.waiting++
+	metrics.QueueWaiting.Inc()
+
+	s.dispatch()
+	return t, nil
+}
+
+// Wait blocks until the ticket is granted or ctx is done. While queued,
+// onPosition (may be nil) is called with the 1-based queue position whenever
+// it changes. On ctx cancellation the ticket is released.
+func (t *Ticket) Wait(ctx context.Context, onPosition func(int)) error {
+	for {
+		select {
+		case <-t.ready:
+			return nil
+		case pos := <-t.position:
+			if onPosition != nil {
+				onPosition(pos)
+			}
+		case <-ctx.Done():
+			t.Release()
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees the ticket's slot, or removes it from the queue if it was
+// never granted. Safe to call more than once.
+func (t *Ticket) Release() {
+	s := t.s
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch t.state {
+	case ticketWaiting:
+		s.removeWaiting(t)
+	case ticketGranted:
+		s.active--
+		s.activeByModel[t.model]--
+	default:
+		return
+	}
+	t.state = ticketDone
+	s.dispatch()
+}
+
+func (s *Scheduler) modelLimit(model string) int {
+	if n, ok := s.perModel[model]; ok {
+		return n
+	}
+	return s.concurrency
+}
+
+func (s *Scheduler) hasCapacity(model string) bool {
+	return s.active < s.concurrency && s.activeByModel[model] < s.modelLimit(model)
+}
+
+func (s *Scheduler) grant(t *Ticket) {
+	t.state = ticketGranted
+	s.active++
+	s.activeByModel[t.model]++
+	close(t.ready)
+}
+
+// dispatch grants waiting tickets while capacity allows, visiting users in
+// rotation order. Within a user's queue the oldest ticket whose model has a
+// free slot goes first. Must be called with s.mu held.
+func (s *Scheduler) dispatch() {
+	for s.active < s.concurrency && len(s.rotation) > 0 {
+		granted := false
+		for i, user := range s.rotation {
+			queue := s.queues[user]
+			for j, t := range queue {
+				if !s.hasCapacity(t.model) {
+					continue
+				}
+				s.queues[user] = append(queue[:j:j], queue[j+1:]...)
+				s.waiting--
+				metrics.QueueWaiting.Dec()
+				s.grant(t)
+
+				// Served users move to the back of the rotation.
+				s.rotation = append(s.rotation[:i:i], s.rotation[i+1:]...)
+				if len(s.queues[user]) > 0 {
+					s.rotation = append(s.rotation, user)
+				} else {
+					delete(s.queues, user)
+				}
+				granted = true
+				break
+			}
+			if granted {
+				break
+			}
+		}
+		if !granted {
+			break
+		}
+	}
+	s.publishPositions()
+}
+
+func (s *Scheduler) removeWaiting(t *Ticket) {
+	queue := s.queues[t.user]
+	for i, q := range queue {
+		if q == t {
+			s.queues[t.user] = append(queue[:i:i], queue[i+1:]...)
+			s.waiting--
+			metrics.QueueWaiting.Dec()
+			break
+		}
+	}
+	if len(s.queues[t.user]) > 0 {
+		return
+	}
+	delete(s.queues, t.user)
+	for i, user := range s.rotation {
+		if user == t.user {
+			s.rotation = append(s.rotation[:i:i], s.rotation[i+1:]...)
+			break
+		}
+	}
+}
+
+// publishPositions sends every waiting ticket its position in the order the
+// round-robin would serve them if all models had capacity. Only the latest
+// position is kept for slow readers.
+func (s *Scheduler) publishPositions() {
+	pos := 0
+	for depth := 0; depth < s.maxQueuePerUser && pos < s.waiting; depth++ {
+		for _, user := range s.rotation {
+			queue := s.queues[user]
+			if depth >= len(queue) {
+				continue
+			}
+			pos++
+			t := queue[depth]
+			select {
+			case <-t.position:
+			default:
+			}
+			t.position <- pos
+		}
+	}
+}
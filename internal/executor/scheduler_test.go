@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+func granted(t *Ticket) bool {
+	select {
+	case <-t.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func mustEnqueue(t *testing.T, s *Scheduler, model, user string) *Ticket {
+	t.Helper()
+	tk, err := s.Enqueue(model, user)
+	if err != nil {
+		t.Fatalf("Enqueue(%s, %s): %v", model, user, err)
+	}
+	return tk
+}
+
+func TestSchedulerRoundRobinAcrossUsers(t *testing.T) {
+	s := NewScheduler(config.SchedulerConfig{Concurrency: 1})
+
+	holder := mustEnqueue(t, s, "m", "alice")
+	if !granted(holder) {
+		t.Fatal("first ticket should be granted immediately")
+	}
+	a1 := mustEnqueue(t, s, "m", "alice")
+	a2 := mustEnqueue(t, s, "m", "alice")
+	b1 := mustEnqueue(t, s, "m", "bob")
+
+	if got := <-b1.position; got != 2 {
+		t.Fatalf("bob position = %d, want 2 (after alice's first)", got)
+	}
+	if got := <-a2.position; got != 3 {
+		t.Fatalf("alice's second position = %d, want 3", got)
+	}
+
+	holder.Release()
+	if !granted(a1) || granted(b1) || granted(a2) {
+		t.Fatal("alice's first queued ticket should run next")
+	}
+	a1.Release()
+	if !granted(b1) || granted(a2) {
+		t.Fatal("bob should be served before alice's second ticket")
+	}
+	b1.Release()
+	if !granted(a2) {
+		t.Fatal("alice's second ticket should run last")
+	}
+	a2.Release()
+}
+
+func TestSchedulerPerModelLimit(t *testing.T) {
+	s := NewScheduler(config.SchedulerConfig{Concurrency: 2, PerModel: map[string]int{"big": 1}})
+
+	big1 := mustEnqueue(t, s, "big", "alice")
+	big2 := mustEnqueue(t, s, "big", "bob")
+	small := mustEnqueue(t, s, "small", "carol")
+
+	if !granted(big1) || granted(big2) {
+		t.Fatal("only one 'big' generation may run at a time")
+	}
+	if !granted(small) {
+		t.Fatal("'small' should use the remaining global slot")
+	}
+	big1.Release()
+	if !granted(big2) {
+		t.Fatal("second 'big' should run after the first is released")
+	}
+}
+
+func TestSchedulerQueueFull(t *testing.T) {
+	s := NewScheduler(config.SchedulerConfig{Concurrency: 1, MaxQueue: 2, MaxQueuePerUser: 1})
+
+	mustEnqueue(t, s, "m", "alice")
+	mustEnqueue(t, s, "m", "alice")
+	if _, err := s.Enqueue("m", "alice"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("per-user limit: err = %v, want ErrQueueFull", err)
+	}
+	mustEnqueue(t, s, "m", "bob")
+	if _, err := s.Enqueue("m", "carol"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("global limit: err = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestTicketWaitCancelLeavesQueue(t *testing.T) {
+	s := NewScheduler(config.SchedulerConfig{Concurrency: 1})
+	holder := mustEnqueue(t, s, "m", "alice")
+	waiter := mustEnqueue(t, s, "m", "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var positions []int
+	err := waiter.Wait(ctx, func(p int) { positions = append(positions, p) })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait err = %v, want deadline exceeded", err)
+	}
+	if len(positions) == 0 || positions[0] != 1 {
+		t.Fatalf("positions = %v, want [1]", positions)
+	}
+
+	next := mustEnqueue(t, s, "m", "carol")
+	holder.Release()
+	if !granted(next) {
+		t.Fatal("cancelled waiter should no longer hold a queue slot")
+	}
+}
+
+func TestNilSchedulerAdmitsAll(t *testing.T) {
+	var s *Scheduler
+	tk := mustEnqueue(t, s, "m", "alice")
+	if err := tk.Wait(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	tk.Release()
+}
@@ -4,6 +4,14 @@ import (
 	"github.com/earlysvahn/sidekick/internal/chat"
 )
 
+// CharsPerToken is the rough average used to estimate tokens from text.
+const CharsPerToken = 4
+
+// DefaultTokenLimit is the largest request, prompt plus reply budget, the CLI
+// sends without being told otherwise. Inputs beyond it are most likely an
+// accident, like piping a whole build log.
+const DefaultTokenLimit = 32768
+
 // TokenBudget represents estimated token usage for a request
 type TokenBudget struct {
 	EstimatedPromptTokens int `json:"estimated_prompt_tokens"`
@@ -15,9 +23,6 @@ type TokenBudget struct {
 // of token usage before model execution.
 // This is NOT precise - it's a rough approximation for progress reporting.
 func EstimateTokenBudget(messages []chat.Message, verbosity int) TokenBudget {
-	// Heuristic: ~4 characters per token (rough average)
-	const charsPerToken = 4
-
 	totalChars := 0
 	for _, msg := range messages {
 		// Count content
@@ -26,7 +31,7 @@ func EstimateTokenBudget(messages []chat.Message, verbosity int) TokenBudget {
 		totalChars += 20
 	}
 
-	estimatedPromptTokens := totalChars / charsPerToken
+	estimatedPromptTokens := totalChars / CharsPerToken
 	maxCompletionTokens := MaxTokens(verbosity)
 	totalEstimatedTokens := estimatedPromptTokens + maxCompletionTokens
 
@@ -3,8 +3,12 @@ package executor
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/metrics"
 	"github.com/earlysvahn/sidekick/internal/store"
 )
 
@@ -13,10 +17,40 @@ type EscalationResult struct {
 	EffectiveVerbosity int
 	Warning            string
 	Escalated          bool
-	MatchedKeywords    []string
+	Deescalated        bool
+	MatchedKeywords    []string         // the rules that decided the level
+	Rules              []RuleEvaluation // every rule considered, in evaluation order
 }
 
-func ResolveVerbosity(ctx context.Context, requested *int, defaultLevel int, agentName string, lastUserMessage string, userID string, keywordStore store.VerbosityKeywordLister) (EscalationResult, error) {
+// RuleEvaluation explains what one verbosity rule did for a message.
+type RuleEvaluation struct {
+	Keyword  string  `json:"keyword"`
+	Agent    *string `json:"agent,omitempty"`
+	Action   string  `json:"action"`
+	Priority int     `json:"priority"`
+	Matched  bool    `json:"matched"`
+	Applied  bool    `json:"applied"`
+	Reason   string  `json:"reason"`
+}
+
+// ResolveVerbosity returns the verbosity to answer lastUserMessage at: the
+// requested level shifted by the agent profile's bias, adjusted by the
+// user's keyword rules and kept within the profile's bounds. profile may be
+// nil.
+func ResolveVerbosity(ctx context.Context, requested *int, defaultLevel int, agentName string, profile *agent.AgentProfile, lastUserMessage string, userID string, keywordStore store.VerbosityKeywordLister) (EscalationResult, error) {
+	result, err := EvaluateVerbosity(ctx, requested, defaultLevel, agentName, profile, lastUserMessage, userID, keywordStore)
+	if err != nil {
+		return EscalationResult{}, err
+	}
+	if result.Escalated {
+		metrics.ObserveEscalation(agentName, result.MatchedKeywords)
+	}
+	return result, nil
+}
+
+// EvaluateVerbosity is ResolveVerbosity without recording metrics, for dry
+// runs that explain which rules would fire.
+func EvaluateVerbosity(ctx context.Context, requested *int, defaultLevel int, agentName string, profile *agent.AgentProfile, lastUserMessage string, userID string, keywordStore store.VerbosityKeywordLister) (EscalationResult, error) {
 	warning := ""
 	requestedValue := defaultLevel
 	if requested != nil {
@@ -28,97 +62,205 @@ func ResolveVerbosity(ctx context.Context, requested *int, defaultLevel int, age
 	}
 
 	biasedVerbosity := requestedValue
-	if bias := agentBaselineBias(agentName); bias > 0 {
-		if requestedValue+bias > biasedVerbosity {
-			biasedVerbosity = requestedValue + bias
-		}
+	if profile != nil && profile.VerbosityBias != 0 {
+		biasedVerbosity, _ = ClampVerbosity(requestedValue + profile.VerbosityBias)
 	}
 
 	effectiveVerbosity := biasedVerbosity
 	matchedKeywords := []string{}
+	evaluations := []RuleEvaluation{}
 	escalated := false
+	deescalated := false
 
 	if keywordStore != nil && strings.TrimSpace(lastUserMessage) != "" && userID != "" {
 		keywords, err := keywordStore.ListVerbosityKeywords(ctx, userID)
 		if err != nil {
 			return EscalationResult{}, err
 		}
-		lowered := strings.ToLower(lastUserMessage)
-
-		// Separate agent-specific and global keywords
-		agentKeywords := []store.VerbosityKeyword{}
-		globalKeywords := []store.VerbosityKeyword{}
 
-		for _, kw := range keywords {
-			if !kw.Enabled {
-				continue
-			}
-			if kw.Agent != nil && *kw.Agent == agentName {
-				agentKeywords = append(agentKeywords, kw)
-			} else if kw.Agent == nil {
-				globalKeywords = append(globalKeywords, kw)
+		rules := orderRules(keywords)
+		var matched []store.VerbosityKeyword
+		for _, kw := range rules {
+			ok, reason := evaluateRule(kw, agentName, lastUserMessage, requestedValue, biasedVerbosity)
+			evaluations = append(evaluations, RuleEvaluation{
+				Keyword:  kw.Keyword,
+				Agent:    kw.Agent,
+				Action:   kw.Action,
+				Priority: kw.Priority,
+				Matched:  ok,
+				Reason:   reason,
+			})
+			if ok {
+				matched = append(matched, kw)
 			}
 		}
 
-		// Try agent-specific keywords first, then global
-		candidateKeywords := append(agentKeywords, globalKeywords...)
-
-		highestEscalateTo := effectiveVerbosity
-		for _, kw := range candidateKeywords {
-			if kw.Keyword == "" {
-				continue
+		// Only the matching rules with the highest priority take effect,
+		// and among those only the strongest action
+		var top int
+		if len(matched) > 0 {
+			top = matched[0].Priority
+		}
+		var winners []store.VerbosityKeyword
+		for _, kw := range matched {
+			if kw.Priority == top {
+				winners = append(winners, kw)
 			}
-			if !strings.Contains(lowered, strings.ToLower(kw.Keyword)) {
+		}
+		action := strongestAction(winners)
+
+		for i, kw := range rules {
+			ev := &evaluations[i]
+			switch {
+			case !ev.Matched:
 				continue
-			}
-			if requestedValue < kw.MinRequested {
+			case kw.Priority < top:
+				ev.Reason = fmt.Sprintf("outranked by a priority %d rule", top)
 				continue
-			}
-			if requestedValue >= kw.EscalateTo {
+			case kw.Action != action:
+				ev.Reason = fmt.Sprintf("overridden by a %s rule of the same priority", action)
 				continue
 			}
-
-			// Track this keyword as matched
+			ev.Applied = true
 			matchedKeywords = append(matchedKeywords, kw.Keyword)
 
-			if kw.EscalateTo > highestEscalateTo {
-				highestEscalateTo = kw.EscalateTo
+			switch action {
+			case store.ActionEscalate:
+				ev.Reason = fmt.Sprintf("escalates to %d", kw.EscalateTo)
+				if kw.EscalateTo > effectiveVerbosity {
+					effectiveVerbosity = kw.EscalateTo
+					escalated = true
+				}
+			case store.ActionDeescalate:
+				ev.Reason = fmt.Sprintf("de-escalates to %d", kw.EscalateTo)
+				if kw.EscalateTo < effectiveVerbosity {
+					effectiveVerbosity = kw.EscalateTo
+					deescalated = true
+				}
+			case store.ActionSuppress:
+				ev.Reason = "suppresses escalation"
 			}
 		}
-
-		if highestEscalateTo > effectiveVerbosity {
-			effectiveVerbosity = highestEscalateTo
-			escalated = true
-		}
 	}
 
 	if v, clamped := ClampVerbosity(effectiveVerbosity); clamped {
 		effectiveVerbosity = v
 	}
+	if profile != nil {
+		if effectiveVerbosity < profile.MinVerbosity {
+			warning = joinWarning(warning, fmt.Sprintf("verbosity %d raised to the agent's minimum of %d", effectiveVerbosity, profile.MinVerbosity))
+			effectiveVerbosity = profile.MinVerbosity
+		}
+		if profile.MaxVerbosity != nil && effectiveVerbosity > *profile.MaxVerbosity {
+			warning = joinWarning(warning, fmt.Sprintf("verbosity %d lowered to the agent's maximum of %d", effectiveVerbosity, *profile.MaxVerbosity))
+			effectiveVerbosity = *profile.MaxVerbosity
+		}
+	}
 
 	if escalated {
 		warning = joinWarning(warning, fmt.Sprintf("verbosity auto-escalated from %d to %d due to detected intent", requestedValue, effectiveVerbosity))
 	}
+	if deescalated {
+		warning = joinWarning(warning, fmt.Sprintf("verbosity reduced from %d to %d due to detected intent", requestedValue, effectiveVerbosity))
+	}
 
 	return EscalationResult{
 		EffectiveVerbosity: effectiveVerbosity,
 		Warning:            warning,
 		Escalated:          escalated,
+		Deescalated:        deescalated,
 		MatchedKeywords:    matchedKeywords,
+		Rules:              evaluations,
 	}, nil
 }
 
-func agentBaselineBias(agentName string) int {
-	switch strings.TrimSpace(strings.ToLower(agentName)) {
-	case "go-dev":
-		return 1
-	case "go-architect":
-		return 2
-	case "fitness":
-		return 0
-	default:
-		return 0
+// orderRules returns keywords highest priority first, with agent-specific
+// rules before global ones of the same priority.
+func orderRules(keywords []store.VerbosityKeyword) []store.VerbosityKeyword {
+	rules := make([]store.VerbosityKeyword, len(keywords))
+	for i, kw := range keywords {
+		if kw.Action == "" {
+			kw.Action = store.ActionEscalate
+		}
+		rules[i] = kw
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].Agent != nil && rules[j].Agent == nil
+	})
+	return rules
+}
+
+// evaluateRule reports whether kw applies to message for agentName: its
+// keyword matches, the message meets its conditions and its action would
+// change the level. The reason says why not.
+func evaluateRule(kw store.VerbosityKeyword, agentName, message string, requested, current int) (bool, string) {
+	if !kw.Enabled {
+		return false, "disabled"
+	}
+	if kw.Agent != nil && *kw.Agent != agentName {
+		return false, fmt.Sprintf("only for agent %s", *kw.Agent)
+	}
+	if kw.Keyword == "" {
+		return false, "empty keyword"
+	}
+
+	re, err := kw.Pattern()
+	if err != nil {
+		return false, err.Error()
+	}
+	if !re.MatchString(message) {
+		return false, "keyword not in message"
+	}
+
+	length := utf8.RuneCountInString(strings.TrimSpace(message))
+	if length < kw.MinLength {
+		return false, fmt.Sprintf("message shorter than %d characters", kw.MinLength)
+	}
+	if kw.MaxLength > 0 && length > kw.MaxLength {
+		return false, fmt.Sprintf("message longer than %d characters", kw.MaxLength)
+	}
+	hasCode := strings.Contains(message, "```")
+	if kw.CodeBlock == store.CodeBlockRequired && !hasCode {
+		return false, "message has no code block"
+	}
+	if kw.CodeBlock == store.CodeBlockForbidden && hasCode {
+		return false, "message has a code block"
+	}
+
+	if requested < kw.MinRequested {
+		return false, fmt.Sprintf("requested verbosity %d below min_requested %d", requested, kw.MinRequested)
+	}
+	switch kw.Action {
+	case store.ActionEscalate:
+		if requested >= kw.EscalateTo {
+			return false, fmt.Sprintf("requested verbosity %d already at or above %d", requested, kw.EscalateTo)
+		}
+	case store.ActionDeescalate:
+		if current <= kw.EscalateTo {
+			return false, fmt.Sprintf("verbosity %d already at or below %d", current, kw.EscalateTo)
+		}
+	}
+	return true, ""
+}
+
+// strongestAction picks the action that wins among rules of equal
+// priority: asking for less beats asking for more.
+func strongestAction(rules []store.VerbosityKeyword) string {
+	action := ""
+	for _, kw := range rules {
+		switch {
+		case kw.Action == store.ActionSuppress:
+			return store.ActionSuppress
+		case kw.Action == store.ActionDeescalate:
+			action = store.ActionDeescalate
+		case action == "":
+			action = store.ActionEscalate
+		}
 	}
+	return action
 }
 
 func joinWarning(existing, next string) string {
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+type staticKeywords []store.VerbosityKeyword
+
+func (k staticKeywords) ListVerbosityKeywords(ctx context.Context, userID string) ([]store.VerbosityKeyword, error) {
+	return k, nil
+}
+
+func TestResolveVerbosityRules(t *testing.T) {
+	rules := staticKeywords{
+		{Keyword: "explain", Enabled: true, MinRequested: 0, EscalateTo: 3},
+		{Keyword: "go", Match: store.MatchWord, Enabled: true, EscalateTo: 4},
+		{Keyword: `step[- ]by[- ]step`, Match: store.MatchRegex, Enabled: true, EscalateTo: 4, Priority: 1},
+		{Keyword: "tl;dr", Match: store.MatchWord, Action: store.ActionDeescalate, Enabled: true, EscalateTo: 0, Priority: 5},
+		{Keyword: "briefly", Action: store.ActionSuppress, Enabled: true},
+		{Keyword: "review", Enabled: true, EscalateTo: 3, CodeBlock: store.CodeBlockRequired},
+		{Keyword: "why", Enabled: true, EscalateTo: 3, MaxLength: 10},
+	}
+
+	tests := []struct {
+		message string
+		want    int
+		matched []string
+	}{
+		{"please explain this", 3, []string{"explain"}},
+		{"explain in google docs", 3, []string{"explain"}},
+		{"how do I write this in Go?", 4, []string{"go"}},
+		{"explain it step by step", 4, []string{`step[- ]by[- ]step`}},
+		{"explain it, tl;dr please", 0, []string{"tl;dr"}},
+		{"explain briefly", 1, []string{"briefly"}},
+		{"review this", 1, []string{}},
+		{"review this\n```\nx := 1\n```", 3, []string{"review"}},
+		{"why?", 3, []string{"why"}},
+		{"why is the sky blue at noon?", 1, []string{}},
+	}
+
+	requested := 1
+	for _, tt := range tests {
+		got, err := ResolveVerbosity(context.Background(), &requested, 2, "", nil, tt.message, "u", rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.EffectiveVerbosity != tt.want {
+			t.Errorf("%q: verbosity = %d, want %d", tt.message, got.EffectiveVerbosity, tt.want)
+		}
+		if len(got.MatchedKeywords) != len(tt.matched) || (len(tt.matched) > 0 && got.MatchedKeywords[0] != tt.matched[0]) {
+			t.Errorf("%q: matched = %v, want %v", tt.message, got.MatchedKeywords, tt.matched)
+		}
+	}
+}
+
+func TestEvaluateVerbosityExplainsRules(t *testing.T) {
+	rules := staticKeywords{
+		{Keyword: "explain", Enabled: true, EscalateTo: 3},
+		{Keyword: "briefly", Action: store.ActionSuppress, Enabled: true},
+		{Keyword: "details", Enabled: true, EscalateTo: 4, Priority: -1},
+		{Keyword: "code", Enabled: false, EscalateTo: 4},
+	}
+	requested := 1
+	got, err := EvaluateVerbosity(context.Background(), &requested, 2, "", nil, "explain briefly, details too", "u", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"explain": "overridden by a suppress rule of the same priority",
+		"briefly": "suppresses escalation",
+		"details": "outranked by a priority 0 rule",
+		"code":    "disabled",
+	}
+	if len(got.Rules) != len(want) {
+		t.Fatalf("got %d evaluations, want %d", len(got.Rules), len(want))
+	}
+	for _, ev := range got.Rules {
+		if ev.Reason != want[ev.Keyword] {
+			t.Errorf("%s: reason = %q, want %q", ev.Keyword, ev.Reason, want[ev.Keyword])
+		}
+	}
+}
+
+func TestResolveVerbosityAgentProfile(t *testing.T) {
+	rules := staticKeywords{{Keyword: "explain", Enabled: true, EscalateTo: 4}}
+	maxVerbosity := 3
+	profile := &agent.AgentProfile{VerbosityBias: 1, MinVerbosity: 1, MaxVerbosity: &maxVerbosity}
+
+	tests := []struct {
+		requested int
+		message   string
+		want      int
+	}{
+		{0, "hello", 1},   // bias
+		{2, "hello", 3},   // bias
+		{3, "hello", 3},   // bias capped at the maximum
+		{1, "explain", 3}, // escalation capped at the maximum
+	}
+	for _, tt := range tests {
+		got, err := ResolveVerbosity(context.Background(), &tt.requested, 2, "golang-dev", profile, tt.message, "u", rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.EffectiveVerbosity != tt.want {
+			t.Errorf("requested %d, %q: verbosity = %d, want %d", tt.requested, tt.message, got.EffectiveVerbosity, tt.want)
+		}
+	}
+
+	profile = &agent.AgentProfile{VerbosityBias: -2, MinVerbosity: 1}
+	requested := 2
+	got, _ := ResolveVerbosity(context.Background(), &requested, 2, "golang-dev", profile, "hello", "u", rules)
+	if got.EffectiveVerbosity != 1 {
+		t.Errorf("negative bias below the minimum: verbosity = %d, want 1", got.EffectiveVerbosity)
+	}
+}
+
+func TestNormalizeVerbosityKeywordRejectsBadRegex(t *testing.T) {
+	if _, err := store.NormalizeVerbosityKeyword(store.VerbosityKeyword{Keyword: "(", Match: store.MatchRegex}); err == nil {
+		t.Fatal("expected an error for an invalid regex")
+	}
+}
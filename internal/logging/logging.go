@@ -0,0 +1,115 @@
+// Package logging configures the server's structured logger (log/slog) and
+// carries per-request fields such as the request ID.
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+// logPrompts controls whether Prompt attaches message content verbatim.
+var logPrompts bool
+
+// Setup installs the default slog logger from cfg. SIDEKICK_LOG_LEVEL,
+// SIDEKICK_LOG_FORMAT and SIDEKICK_LOG_PROMPTS override the config file.
+func Setup(cfg config.LogConfig) error {
+	if v := os.Getenv("SIDEKICK_LOG_LEVEL"); v != "" {
+		cfg.Level = v
+	}
+	if v := os.Getenv("SIDEKICK_LOG_FORMAT"); v != "" {
+		cfg.Format = v
+	}
+	if v := os.Getenv("SIDEKICK_LOG_PROMPTS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("SIDEKICK_LOG_PROMPTS: %w", err)
+		}
+		cfg.Prompts = b
+	}
+
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(os.Stderr, cfg.Format, level)
+	if err != nil {
+		return err
+	}
+
+	logPrompts = cfg.Prompts
+	slog.SetDefault(slog.New(&contextHandler{handler}))
+	return nil
+}
+
+// ParseLevel accepts debug, info, warn or error (case-insensitive).
+// Empty means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+}
+
+func newHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		return slog.NewJSONHandler(w, opts), nil
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want json or text)", format)
+	}
+}
+
+// Prompt returns a log attribute for user-supplied text. Unless prompt
+// logging is enabled, only the length and a short hash are logged, which is
+// enough to correlate repeated prompts without storing them.
+func Prompt(key, content string) slog.Attr {
+	if logPrompts {
+		return slog.String(key, content)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return slog.Group(key,
+		slog.Int("chars", len(content)),
+		slog.String("sha256", hex.EncodeToString(sum[:6])),
+	)
+}
+
+// contextHandler adds the request ID from the context to every record, so
+// handlers only need to use the *Context logging functions.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
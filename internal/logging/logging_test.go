@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(&contextHandler{slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})}))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	buf := captureLogs(t)
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Annotate(r.Context(), "agent", "golang-dev")
+		Annotate(r.Context(), "agent", "default")
+		slog.InfoContext(r.Context(), "inside")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Fatalf("response header = %q, want client ID echoed", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["request_id"] != "abc-123" {
+			t.Errorf("request_id = %v in %s", rec["request_id"], line)
+		}
+	}
+
+	var access map[string]any
+	_ = json.Unmarshal([]byte(lines[1]), &access)
+	if access["status"] != float64(http.StatusTeapot) || access["agent"] != "default" || access["source"] != "web" {
+		t.Errorf("unexpected access line: %s", lines[1])
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	captureLogs(t)
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	got := rec.Header().Get(RequestIDHeader)
+	if got == "" || strings.ContainsAny(got, " \n") {
+		t.Fatalf("request ID = %q, want a generated one", got)
+	}
+}
+
+func TestPromptRedaction(t *testing.T) {
+	buf := captureLogs(t)
+
+	logPrompts = false
+	slog.Info("x", Prompt("last", "my secret prompt"))
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("prompt leaked: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"chars":16`) {
+		t.Fatalf("missing length: %s", buf.String())
+	}
+
+	buf.Reset()
+	logPrompts = true
+	t.Cleanup(func() { logPrompts = false })
+	slog.Info("x", Prompt("last", "my secret prompt"))
+	if !strings.Contains(buf.String(), "my secret prompt") {
+		t.Fatalf("prompt logging enabled but content missing: %s", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"": slog.LevelInfo, "DEBUG": slog.LevelDebug, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		got, err := ParseLevel(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/utils"
+)
+
+// RequestIDHeader is read from incoming requests (when well-formed) and always
+// set on responses.
+const RequestIDHeader = "X-Request-ID"
+
+// ClientHeader identifies the calling client ("cli" for the HTTP executor).
+// It is logged as the request source; requests without it count as "web".
+const ClientHeader = "X-Sidekick-Client"
+
+type requestKey struct{}
+
+// requestInfo is shared by pointer through the request context, so handlers
+// deeper in the chain can attach fields to the single access log line.
+type requestInfo struct {
+	id     string
+	mu     sync.Mutex
+	fields []slog.Attr
+}
+
+// RequestID returns the ID assigned by Middleware, or "".
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// Annotate attaches a field to the request's access log line. Setting the
+// same key twice keeps the last value. No-op outside Middleware.
+func Annotate(ctx context.Context, key string, value any) {
+	info, ok := ctx.Value(requestKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	for i, a := range info.fields {
+		if a.Key == key {
+			info.fields[i] = slog.Any(key, value)
+			return
+		}
+	}
+	info.fields = append(info.fields, slog.Any(key, value))
+}
+
+// Middleware assigns a request ID, echoes it in the X-Request-ID response
+// header, and writes one access log line per request when it completes.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &requestInfo{id: id}
+		ctx := context.WithValue(r.Context(), requestKey{}, info)
+
+		rec := utils.NewStatusRecorder(w)
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		source := r.Header.Get(ClientHeader)
+		if source == "" {
+			source = "web"
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status()),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.String("source", source),
+		}
+		info.mu.Lock()
+		attrs = append(attrs, info.fields...)
+		info.mu.Unlock()
+
+		level := slog.LevelInfo
+		switch {
+		case rec.Status() >= 500:
+			level = slog.LevelError
+		case r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") || r.URL.Path == "/metrics":
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// validRequestID accepts client-supplied IDs of up to 64 URL-safe characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/utils"
+)
+
+// Middleware records request count and latency for every request served by
+// mux. The route label is the mux pattern that matched ("/contexts/"), never
+// the raw path, so IDs in URLs do not become label values.
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		rec := utils.NewStatusRecorder(w)
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		method := normalizeMethod(r.Method)
+		HTTPRequests.WithLabelValues(route, method, strconv.Itoa(rec.Status())).Inc()
+		HTTPDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+func normalizeMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return m
+	default:
+		return "OTHER"
+	}
+}
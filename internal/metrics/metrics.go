@@ -0,0 +1,220 @@
+// Package metrics exposes server metrics in the Prometheus text format.
+//
+// Label values are limited to route patterns, agent IDs, model names and a
+// few fixed enums. Free-form values (escalation keywords) go through a
+// LabelLimiter so a flood of distinct values cannot blow up cardinality.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sidekick"
+
+// Registry holds all sidekick collectors plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method. Streaming routes include generation time.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"route", "method"})
+
+	TimeToFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_time_to_first_token_seconds",
+		Help:      "Time from sending a request to Ollama until the first token, per model.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 40, 80},
+	}, []string{"model"})
+
+	TokensPerSecond = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_tokens_per_second",
+		Help:      "Completion tokens per second as reported by Ollama (eval_count / eval_duration), per model.",
+		Buckets:   []float64{1, 2.5, 5, 10, 15, 20, 30, 45, 60, 90, 120},
+	}, []string{"model"})
+
+	GeneratedTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_tokens_total",
+		Help:      "Tokens processed by Ollama, per model and kind (prompt or completion).",
+	}, []string{"model", "kind"})
+
+	GenerationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_errors_total",
+		Help:      "Failed Ollama generations per model.",
+	}, []string{"model"})
+
+	ActiveStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_streams_active",
+		Help:      "SSE responses currently streaming.",
+	})
+
+	VerbosityEscalations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verbosity_escalations_total",
+		Help:      "Verbosity escalations per agent and matched keyword.",
+	}, []string{"agent", "keyword"})
+
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Failed login attempts per method (password, totp).",
+	}, []string{"method"})
+
+	LoginBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_blocks_total",
+		Help:      "IPs blocked by the login rate limiter per method (password, totp).",
+	}, []string{"method"})
+
+	QueueWaiting = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "generation_queue_waiting",
+		Help:      "Generation requests waiting in the scheduler queue.",
+	})
+
+	QueueRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_queue_rejected_total",
+		Help:      "Generation requests rejected because the queue was full, per model.",
+	}, []string{"model"})
+
+	DBErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "Postgres driver errors per operation (query, exec, begin, prepare, connect).",
+	}, []string{"op"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		TimeToFirstToken,
+		TokensPerSecond,
+		GeneratedTokens,
+		GenerationErrors,
+		ActiveStreams,
+		VerbosityEscalations,
+		LoginFailures,
+		LoginBlocks,
+		QueueWaiting,
+		QueueRejected,
+		DBErrors,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Generation is what Ollama reports for one completed chat call.
+type Generation struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	EvalDuration     time.Duration // time spent producing completion tokens
+	FirstToken       time.Duration // zero when unknown (non-streaming calls)
+}
+
+// ObserveGeneration records token counts, throughput and time to first token.
+func ObserveGeneration(g Generation) {
+	model := modelLabels.Value(g.Model)
+	GeneratedTokens.WithLabelValues(model, "prompt").Add(float64(g.PromptTokens))
+	GeneratedTokens.WithLabelValues(model, "completion").Add(float64(g.CompletionTokens))
+	if g.CompletionTokens > 0 && g.EvalDuration > 0 {
+		TokensPerSecond.WithLabelValues(model).Observe(float64(g.CompletionTokens) / g.EvalDuration.Seconds())
+	}
+	if g.FirstToken > 0 {
+		TimeToFirstToken.WithLabelValues(model).Observe(g.FirstToken.Seconds())
+	}
+}
+
+// ModelLabel returns model as a bounded label value.
+func ModelLabel(model string) string {
+	return modelLabels.Value(model)
+}
+
+// ObserveGenerationError counts a failed generation for model.
+func ObserveGenerationError(model string) {
+	GenerationErrors.WithLabelValues(modelLabels.Value(model)).Inc()
+}
+
+// ObserveEscalation counts one escalation per matched keyword.
+func ObserveEscalation(agentID string, keywords []string) {
+	agentID = agentLabels.Value(agentID)
+	for _, kw := range keywords {
+		VerbosityEscalations.WithLabelValues(agentID, keywordLabels.Value(kw)).Inc()
+	}
+}
+
+// StreamStarted increments the active stream gauge and returns the matching
+// decrement, meant to be deferred.
+func StreamStarted() func() {
+	ActiveStreams.Inc()
+	var once sync.Once
+	return func() { once.Do(ActiveStreams.Dec) }
+}
+
+// Default label budgets. Real deployments have a handful of agents and
+// models; the limits only matter if something upstream misbehaves.
+var (
+	agentLabels   = NewLabelLimiter(64)
+	modelLabels   = NewLabelLimiter(64)
+	keywordLabels = NewLabelLimiter(128)
+)
+
+// OtherLabel replaces label values once a LabelLimiter is full.
+const OtherLabel = "other"
+
+// LabelLimiter admits at most max distinct label values; later values are
+// reported as OtherLabel.
+type LabelLimiter struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+// NewLabelLimiter returns a limiter admitting max distinct values.
+func NewLabelLimiter(max int) *LabelLimiter {
+	return &LabelLimiter{max: max, seen: make(map[string]struct{})}
+}
+
+// Value returns v if it is already known or there is room for it, otherwise
+// OtherLabel. Empty values become "unknown".
+func (l *LabelLimiter) Value(v string) string {
+	if v == "" {
+		return "unknown"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return OtherLabel
+	}
+	l.seen[v] = struct{}{}
+	return v
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLabelLimiter(t *testing.T) {
+	l := NewLabelLimiter(2)
+	if got := l.Value("a"); got != "a" {
+		t.Fatalf("got %q, want a", got)
+	}
+	if got := l.Value("b"); got != "b" {
+		t.Fatalf("got %q, want b", got)
+	}
+	if got := l.Value("c"); got != OtherLabel {
+		t.Fatalf("got %q, want %q once full", got, OtherLabel)
+	}
+	if got := l.Value("a"); got != "a" {
+		t.Fatalf("known value should still pass, got %q", got)
+	}
+	if got := l.Value(""); got != "unknown" {
+		t.Fatalf("got %q, want unknown", got)
+	}
+}
+
+func TestMiddlewareUsesRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contexts/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	h := Middleware(mux, mux)
+
+	for _, path := range []string{"/contexts/a", "/contexts/b", "/contexts/c"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("/contexts/", "GET", "404")); got != 3 {
+		t.Fatalf("route counter = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("unmatched", "GET", "404")); got != 1 {
+		t.Fatalf("unmatched counter = %v, want 1", got)
+	}
+}
+
+func TestStreamStartedIsIdempotent(t *testing.T) {
+	done := StreamStarted()
+	if got := testutil.ToFloat64(ActiveStreams); got != 1 {
+		t.Fatalf("active = %v, want 1", got)
+	}
+	done()
+	done()
+	if got := testutil.ToFloat64(ActiveStreams); got != 0 {
+		t.Fatalf("active = %v, want 0", got)
+	}
+}
@@ -0,0 +1,282 @@
+// Package notify delivers operational events (blocked logins, failed
+// generations, unreachable Ollama, ...) to pluggable sinks such as Discord,
+// signed webhooks, ntfy topics and local log files.
+//
+// Delivery is asynchronous and best-effort: Send never blocks the caller and
+// sink errors are logged, not returned.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+// Event types emitted by sidekick.
+const (
+	EventLoginBlocked      = "login_blocked"
+	EventLoginNewIP        = "login_new_ip"
+	EventGenerationFailed  = "generation_failed"
+	EventOllamaUnreachable = "ollama_unreachable"
+	EventAgentSyncFinished = "agent_sync_finished"
+)
+
+// EventTypes lists every known event type, used to validate routes.
+var EventTypes = []string{
+	EventLoginBlocked,
+	EventLoginNewIP,
+	EventGenerationFailed,
+	EventOllamaUnreachable,
+	EventAgentSyncFinished,
+}
+
+const (
+	defaultCooldown = 5 * time.Minute
+	sendTimeout     = 10 * time.Second
+)
+
+// Event is a single notification.
+type Event struct {
+	Type    string            `json:"type"`
+	Time    time.Time         `json:"time"`
+	Title   string            `json:"title"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+
+	// Key deduplicates repeated events of the same type (e.g. the blocked IP
+	// or the unreachable host). Events with the same Type and Key are
+	// suppressed for the notifier's cooldown. Empty Key disables dedupe.
+	Key string `json:"-"`
+}
+
+// Text renders the event as a single human-readable message.
+func (e Event) Text() string {
+	var b strings.Builder
+	b.WriteString("[sidekick] ")
+	b.WriteString(e.Title)
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", k, e.Fields[k])
+	}
+	return b.String()
+}
+
+// Sink delivers events to one destination.
+type Sink interface {
+	Send(ctx context.Context, ev Event) error
+}
+
+// Notifier routes events to sinks according to NotifyConfig.Routes.
+// Safe for concurrent use. A nil *Notifier discards all events.
+type Notifier struct {
+	sinks    map[string]Sink
+	routes   map[string][]string
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+	wg   sync.WaitGroup
+}
+
+// New builds a Notifier from config. Routes may reference an event type or
+// "*" (all events). When no sinks are configured but SIDEKICK_DISCORD_WEBHOOK
+// is set, login_blocked is routed to that webhook for backwards compatibility.
+func New(cfg config.NotifyConfig) (*Notifier, error) {
+	n := &Notifier{
+		sinks:    make(map[string]Sink),
+		routes:   make(map[string][]string),
+		cooldown: cfg.Cooldown.Std(),
+		last:     make(map[string]time.Time),
+	}
+	if n.cooldown <= 0 {
+		n.cooldown = defaultCooldown
+	}
+
+	if len(cfg.Sinks) == 0 {
+		if url := os.Getenv("SIDEKICK_DISCORD_WEBHOOK"); url != "" {
+			n.sinks["discord"] = &DiscordSink{URL: url}
+			n.routes[EventLoginBlocked] = []string{"discord"}
+		}
+		return n, nil
+	}
+
+	for name, sc := range cfg.Sinks {
+		sink, err := newSink(sc)
+		if err != nil {
+			return nil, fmt.Errorf("notify sink %q: %w", name, err)
+		}
+		n.sinks[name] = sink
+	}
+
+	for event, names := range cfg.Routes {
+		if event != "*" && !knownEvent(event) {
+			return nil, fmt.Errorf("notify route: unknown event type %q", event)
+		}
+		for _, name := range names {
+			if _, ok := n.sinks[name]; !ok {
+				return nil, fmt.Errorf("notify route %q: unknown sink %q", event, name)
+			}
+		}
+		n.routes[event] = append([]string(nil), names...)
+	}
+	return n, nil
+}
+
+func newSink(sc config.NotifySink) (Sink, error) {
+	switch strings.ToLower(strings.TrimSpace(sc.Type)) {
+	case "discord":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("discord sink requires url")
+		}
+		return &DiscordSink{URL: sc.URL}, nil
+	case "webhook":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("webhook sink requires url")
+		}
+		return &WebhookSink{URL: sc.URL, Secret: sc.Secret}, nil
+	case "ntfy":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("ntfy sink requires url")
+		}
+		return &NtfySink{URL: sc.URL, Token: sc.Token}, nil
+	case "file":
+		if sc.Path == "" {
+			return nil, fmt.Errorf("file sink requires path")
+		}
+		return &FileSink{Path: sc.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+	}
+}
+
+func knownEvent(t string) bool {
+	for _, e := range EventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Send dispatches ev to every sink routed for its type. It returns
+// immediately; delivery happens in background goroutines.
+func (n *Notifier) Send(ev Event) {
+	if n == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	targets := n.targets(ev.Type)
+	if len(targets) == 0 || n.suppressed(ev) {
+		return
+	}
+
+	for _, name := range targets {
+		sink := n.sinks[name]
+		n.wg.Add(1)
+		go func(name string, sink Sink) {
+			defer n.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := sink.Send(ctx, ev); err != nil {
+				slog.Error("notify failed", "sink", name, "event", ev.Type, "err", err)
+			}
+		}(name, sink)
+	}
+}
+
+// Wait blocks until all in-flight deliveries finish. Short-lived processes
+// (CLI commands) call this before exiting.
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+// targets returns the deduplicated sink names for an event type.
+func (n *Notifier) targets(eventType string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, key := range []string{eventType, "*"} {
+		for _, name := range n.routes[key] {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// suppressed reports whether an identical event was sent within the cooldown,
+// recording this one otherwise.
+func (n *Notifier) suppressed(ev Event) bool {
+	if ev.Key == "" {
+		return false
+	}
+	k := ev.Type + "\x00" + ev.Key
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if last, ok := n.last[k]; ok && ev.Time.Sub(last) < n.cooldown {
+		return true
+	}
+	// Opportunistic pruning keeps the map bounded.
+	for key, t := range n.last {
+		if ev.Time.Sub(t) >= n.cooldown {
+			delete(n.last, key)
+		}
+	}
+	n.last[k] = ev.Time
+	return false
+}
+
+// httpClient is shared by all HTTP-based sinks.
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+var (
+	defaultMu sync.RWMutex
+	defaultN  *Notifier
+)
+
+// SetDefault installs the process-wide notifier used by Send.
+func SetDefault(n *Notifier) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultN = n
+}
+
+// Default returns the process-wide notifier (may be nil).
+func Default() *Notifier {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultN
+}
+
+// Send dispatches ev through the process-wide notifier. No-op if none is set.
+func Send(ev Event) {
+	Default().Send(ev)
+}
+
+// Wait waits for in-flight deliveries on the process-wide notifier.
+func Wait() {
+	Default().Wait()
+}
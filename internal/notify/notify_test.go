@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordingSink) Send(_ context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func TestNotifier_RoutesByEventType(t *testing.T) {
+	security, all := &recordingSink{}, &recordingSink{}
+	n := &Notifier{
+		sinks: map[string]Sink{"security": security, "all": all},
+		routes: map[string][]string{
+			EventLoginBlocked: {"security", "all"},
+			"*":               {"all"},
+		},
+		cooldown: time.Minute,
+		last:     make(map[string]time.Time),
+	}
+
+	n.Send(Event{Type: EventLoginBlocked, Title: "blocked"})
+	n.Send(Event{Type: EventGenerationFailed, Title: "failed"})
+	n.Wait()
+
+	if got := security.count(); got != 1 {
+		t.Fatalf("security sink: got %d events, want 1", got)
+	}
+	if got := all.count(); got != 2 {
+		t.Fatalf("wildcard sink: got %d events, want 2 (no duplicate for explicit+wildcard route)", got)
+	}
+}
+
+func TestNotifier_CooldownSuppressesDuplicates(t *testing.T) {
+	sink := &recordingSink{}
+	n := &Notifier{
+		sinks:    map[string]Sink{"s": sink},
+		routes:   map[string][]string{EventOllamaUnreachable: {"s"}},
+		cooldown: time.Minute,
+		last:     make(map[string]time.Time),
+	}
+
+	now := time.Now()
+	n.Send(Event{Type: EventOllamaUnreachable, Key: "host", Time: now})
+	n.Send(Event{Type: EventOllamaUnreachable, Key: "host", Time: now.Add(time.Second)})
+	n.Send(Event{Type: EventOllamaUnreachable, Key: "other", Time: now.Add(time.Second)})
+	n.Send(Event{Type: EventOllamaUnreachable, Key: "host", Time: now.Add(2 * time.Minute)})
+	n.Wait()
+
+	if got := sink.count(); got != 3 {
+		t.Fatalf("got %d events, want 3", got)
+	}
+}
+
+func TestNew_RejectsUnknownSinkInRoute(t *testing.T) {
+	_, err := New(config.NotifyConfig{
+		Sinks:  map[string]config.NotifySink{"log": {Type: "file", Path: "/tmp/x"}},
+		Routes: map[string][]string{EventLoginBlocked: {"discord"}},
+	})
+	if err == nil {
+		t.Fatal("expected error for route referencing undefined sink")
+	}
+}
+
+func TestWebhookSink_SignsBody(t *testing.T) {
+	const secret = "s3cret"
+	var gotSig string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-Sidekick-Signature")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: secret}
+	if err := sink.Send(context.Background(), Event{Type: EventLoginNewIP, Title: "t"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if want := "sha256=" + Sign(secret, gotBody); gotSig != want {
+		t.Fatalf("signature = %q, want %q", gotSig, want)
+	}
+	var ev Event
+	if err := json.Unmarshal(gotBody, &ev); err != nil || ev.Type != EventLoginNewIP {
+		t.Fatalf("unexpected body %s (err %v)", gotBody, err)
+	}
+}
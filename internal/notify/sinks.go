@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DiscordSink posts events to a Discord webhook.
+type DiscordSink struct {
+	URL string
+}
+
+func (s *DiscordSink) Send(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(map[string]string{"content": ev.Text()})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.URL, "application/json", body, nil)
+}
+
+// WebhookSink posts the event as JSON. When Secret is set, the body is signed
+// with HMAC-SHA256 and the hex digest is sent as
+// "X-Sidekick-Signature: sha256=<digest>".
+type WebhookSink struct {
+	URL    string
+	Secret string
+}
+
+func (s *WebhookSink) Send(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if s.Secret != "" {
+		headers["X-Sidekick-Signature"] = "sha256=" + Sign(s.Secret, body)
+	}
+	headers["X-Sidekick-Event"] = ev.Type
+	return post(ctx, s.URL, "application/json", body, headers)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NtfySink publishes a plain-text message to an ntfy-style topic URL.
+type NtfySink struct {
+	URL   string
+	Token string
+}
+
+func (s *NtfySink) Send(ctx context.Context, ev Event) error {
+	headers := map[string]string{
+		"Title": "sidekick: " + ev.Title,
+		"Tags":  ev.Type,
+	}
+	if s.Token != "" {
+		headers["Authorization"] = "Bearer " + s.Token
+	}
+	return post(ctx, s.URL, "text/plain; charset=utf-8", []byte(ev.Text()), headers)
+}
+
+// FileSink appends events as JSON lines to a local file.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileSink) Send(_ context.Context, ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func post(ctx context.Context, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
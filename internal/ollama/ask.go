@@ -3,15 +3,31 @@ package ollama
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/earlysvahn/sidekick/internal/chat"
 )
 
-const BaseURL = "http://localhost:11434"
+// BaseURL is the Ollama endpoint used by the functions without a base URL
+// argument, and the single host of the default pool. The CLI sets it from
+// its config.
+var BaseURL = "http://localhost:11434"
+
+// Timeout limits a chat request, streaming included; zero means no limit.
+// Model pulls are never limited.
+var Timeout time.Duration
+
+func chatClient() *http.Client {
+	if Timeout <= 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{Timeout: Timeout}
+}
 
 type chatReq struct {
 	Model    string         `json:"model"`
@@ -23,6 +39,39 @@ type chatReq struct {
 type chatResp struct {
 	Message chat.Message `json:"message"`
 	Error   string       `json:"error"`
+	Done    bool         `json:"done"`
+
+	// Set on the final response (the only one when not streaming).
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
+}
+
+// Stats are the counters Ollama reports with the final chat response.
+type Stats struct {
+	PromptEvalCount    int
+	EvalCount          int
+	TotalDuration      time.Duration
+	LoadDuration       time.Duration
+	PromptEvalDuration time.Duration
+	EvalDuration       time.Duration
+	// FirstToken is measured client-side for streaming calls: the time from
+	// sending the request to receiving the first content chunk.
+	FirstToken time.Duration
+}
+
+func (r chatResp) stats() Stats {
+	return Stats{
+		PromptEvalCount:    r.PromptEvalCount,
+		EvalCount:          r.EvalCount,
+		TotalDuration:      time.Duration(r.TotalDuration),
+		LoadDuration:       time.Duration(r.LoadDuration),
+		PromptEvalDuration: time.Duration(r.PromptEvalDuration),
+		EvalDuration:       time.Duration(r.EvalDuration),
+	}
 }
 
 func Ask(model string, messages []chat.Message) (string, error) {
@@ -30,6 +79,18 @@ func Ask(model string, messages []chat.Message) (string, error) {
 }
 
 func AskWithOptions(model string, messages []chat.Message, options map[string]int) (string, error) {
+	reply, _, err := AskWithStats(model, messages, options)
+	return reply, err
+}
+
+// AskWithStats is AskWithOptions that also returns Ollama's token counts and
+// durations.
+func AskWithStats(model string, messages []chat.Message, options map[string]int) (string, Stats, error) {
+	return AskWithStatsAt(BaseURL, model, messages, options)
+}
+
+// AskWithStatsAt is AskWithStats against the Ollama host at baseURL.
+func AskWithStatsAt(baseURL, model string, messages []chat.Message, options map[string]int) (string, Stats, error) {
 	req := chatReq{
 		Model:    model,
 		Messages: messages,
@@ -38,38 +99,56 @@ func AskWithOptions(model string, messages []chat.Message, options map[string]in
 	}
 	b, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", Stats{}, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", BaseURL+"/api/chat", bytes.NewReader(b))
+	httpReq, err := http.NewRequest("POST", baseURL+"/api/chat", bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return "", Stats{}, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := chatClient().Do(httpReq)
 	if err != nil {
-		return "", err
+		return "", Stats{}, err
 	}
 	defer resp.Body.Close()
 
 	var out chatResp
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
+		return "", Stats{}, err
 	}
 	if out.Error != "" {
-		return "", fmt.Errorf("%s", out.Error)
+		return "", Stats{}, fmt.Errorf("%s", out.Error)
 	}
 	if out.Message.Content == "" {
-		return "", fmt.Errorf("no response from Ollama")
+		return "", Stats{}, fmt.Errorf("no response from Ollama")
 	}
-	return out.Message.Content, nil
+	return out.Message.Content, out.stats(), nil
 }
 
 // AskWithStreaming executes a request with streaming enabled.
 // The onDelta callback is called for each token chunk as it arrives.
 // Returns the complete response text or an error.
 func AskWithStreaming(model string, messages []chat.Message, options map[string]int, onDelta func(string) error) (string, error) {
+	reply, _, err := AskStreamingWithStats(model, messages, options, onDelta)
+	return reply, err
+}
+
+// AskStreamingWithStats is AskWithStreaming that also returns Ollama's token
+// counts and durations, plus the measured time to first token.
+func AskStreamingWithStats(model string, messages []chat.Message, options map[string]int, onDelta func(string) error) (string, Stats, error) {
+	return AskStreamingContext(context.Background(), model, messages, options, onDelta)
+}
+
+// AskStreamingContext is AskStreamingWithStats bound to ctx: cancelling ctx
+// aborts the request to Ollama, including while the model is loading.
+func AskStreamingContext(ctx context.Context, model string, messages []chat.Message, options map[string]int, onDelta func(string) error) (string, Stats, error) {
+	return AskStreamingAt(ctx, BaseURL, model, messages, options, onDelta)
+}
+
+// AskStreamingAt is AskStreamingContext against the Ollama host at baseURL.
+func AskStreamingAt(ctx context.Context, baseURL, model string, messages []chat.Message, options map[string]int, onDelta func(string) error) (string, Stats, error) {
 	req := chatReq{
 		Model:    model,
 		Messages: messages,
@@ -78,26 +157,29 @@ func AskWithStreaming(model string, messages []chat.Message, options map[string]
 	}
 	b, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", Stats{}, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", BaseURL+"/api/chat", bytes.NewReader(b))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/chat", bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return "", Stats{}, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	start := time.Now()
+	resp, err := chatClient().Do(httpReq)
 	if err != nil {
-		return "", err
+		return "", Stats{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ollama returned status %d", resp.StatusCode)
+		return "", Stats{}, fmt.Errorf("ollama returned status %d", resp.StatusCode)
 	}
 
 	var fullResponse strings.Builder
+	var stats Stats
+	var firstToken time.Duration
 	scanner := bufio.NewScanner(resp.Body)
 
 	for scanner.Scan() {
@@ -108,26 +190,34 @@ func AskWithStreaming(model string, messages []chat.Message, options map[string]
 
 		var chunk chatResp
 		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
-			return "", fmt.Errorf("parse streaming response: %w", err)
+			return "", Stats{}, fmt.Errorf("parse streaming response: %w", err)
 		}
 
 		if chunk.Error != "" {
-			return "", fmt.Errorf("%s", chunk.Error)
+			return "", Stats{}, fmt.Errorf("%s", chunk.Error)
+		}
+
+		if chunk.Done {
+			stats = chunk.stats()
 		}
 
 		if chunk.Message.Content != "" {
+			if firstToken == 0 {
+				firstToken = time.Since(start)
+			}
 			fullResponse.WriteString(chunk.Message.Content)
 			if onDelta != nil {
 				if err := onDelta(chunk.Message.Content); err != nil {
-					return "", fmt.Errorf("delta callback error: %w", err)
+					return "", Stats{}, fmt.Errorf("delta callback error: %w", err)
 				}
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("read streaming response: %w", err)
+		return "", Stats{}, fmt.Errorf("read streaming response: %w", err)
 	}
 
-	return fullResponse.String(), nil
+	stats.FirstToken = firstToken
+	return fullResponse.String(), stats, nil
 }
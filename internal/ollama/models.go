@@ -1,15 +1,36 @@
 package ollama
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const DefaultModel = "qwen2.5:7b"
 
+// ProbeTimeout limits a model listing (GET /api/tags), which doubles as the
+// health check of a host.
+const ProbeTimeout = 5 * time.Second
+
+var (
+	probeClient = &http.Client{Timeout: ProbeTimeout}
+
+	// pullClient bounds connecting to a host but not the pull itself, which
+	// may take minutes for a large model.
+	pullClient = &http.Client{Transport: &http.Transport{
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{Timeout: ProbeTimeout}).DialContext,
+	}}
+)
+
 func SelectedModel(override string) string {
 	if strings.TrimSpace(override) != "" {
 		return strings.TrimSpace(override)
@@ -18,11 +39,17 @@ func SelectedModel(override string) string {
 }
 
 func EnsureModel(model string, logf func(string)) error {
+	return EnsureModelAt(BaseURL, model, logf, nil)
+}
+
+// EnsureModelAt pulls model onto the Ollama host at baseURL unless it is
+// already installed there, streaming pull progress to onPull (may be nil).
+func EnsureModelAt(baseURL, model string, logf func(string), onPull func(PullProgress)) error {
 	name := SelectedModel(model)
 	if logf != nil {
 		logf(fmt.Sprintf("model selected: %s", name))
 	}
-	ok, err := hasModel(name)
+	ok, err := hasModel(baseURL, name)
 	if err != nil {
 		return err
 	}
@@ -36,7 +63,7 @@ func EnsureModel(model string, logf func(string)) error {
 		logf(fmt.Sprintf("model missing: %s", name))
 		logf(fmt.Sprintf("pulling model: %s", name))
 	}
-	if err := pullModel(name); err != nil {
+	if err := pullModel(baseURL, name, logf, onPull); err != nil {
 		return err
 	}
 	if logf != nil {
@@ -45,49 +72,295 @@ func EnsureModel(model string, logf func(string)) error {
 	return nil
 }
 
-func hasModel(model string) (bool, error) {
-	resp, err := http.Get(BaseURL + "/api/tags")
+func hasModel(baseURL, model string) (bool, error) {
+	names, err := ListModelsAt(context.Background(), baseURL)
 	if err != nil {
 		return false, err
 	}
+	return ContainsModel(names, model), nil
+}
+
+// ListModels returns the names of the models installed in Ollama
+// (GET /api/tags).
+func ListModels(ctx context.Context) ([]string, error) {
+	return ListModelsAt(ctx, BaseURL)
+}
+
+// ListModelsAt is ListModels against the Ollama host at baseURL.
+func ListModelsAt(ctx context.Context, baseURL string) ([]string, error) {
+	models, err := ListModelInfoAt(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// ModelDetails describes a model's weights.
+type ModelDetails struct {
+	Format            string `json:"format"`
+	Family            string `json:"family"`
+	ParameterSize     string `json:"parameter_size"`
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// ModelInfo is an installed model as listed by GET /api/tags.
+type ModelInfo struct {
+	Name       string       `json:"name"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	ModifiedAt time.Time    `json:"modified_at"`
+	Details    ModelDetails `json:"details"`
+}
+
+// ListModelInfoAt returns the models installed on the Ollama host at
+// baseURL, with their sizes and details.
+func ListModelInfoAt(ctx context.Context, baseURL string) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("ollama tags status %d", resp.StatusCode)
+		return nil, fmt.Errorf("ollama tags status %d", resp.StatusCode)
 	}
 	var out struct {
-		Models []struct {
-			Name string `json:"name"`
-		} `json:"models"`
+		Models []ModelInfo `json:"models"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return false, err
+		return nil, err
 	}
-	for _, m := range out.Models {
-		if m.Name == model {
-			return true, nil
+	return out.Models, nil
+}
+
+// ContainsModel reports whether model is in names. A model without a tag
+// matches its ":latest" variant, as in the Ollama CLI.
+func ContainsModel(names []string, model string) bool {
+	want := normalizeModelName(model)
+	for _, name := range names {
+		if normalizeModelName(name) == want {
+			return true
 		}
 	}
-	return false, nil
+	return false
+}
+
+func normalizeModelName(name string) string {
+	name = strings.TrimSpace(name)
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
 }
 
-func pullModel(model string) error {
-	payload := map[string]any{"name": model, "stream": false}
-	b, err := json.Marshal(payload)
+// PullProgress is one status update of a streamed pull. Total and
+// Completed are byte counts of the layer named by Digest, when known.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+}
+
+// Percent returns the completed share of the current layer, or -1 when the
+// update carries no byte counts.
+func (p PullProgress) Percent() int {
+	if p.Total <= 0 {
+		return -1
+	}
+	return int(p.Completed * 100 / p.Total)
+}
+
+// PullModelAt pulls model onto the Ollama host at baseURL, streaming
+// progress to onProgress (may be nil). Cancelling ctx aborts the pull.
+func PullModelAt(ctx context.Context, baseURL, model string, onProgress func(PullProgress)) error {
+	b, err := json.Marshal(map[string]any{"model": model, "stream": true})
 	if err != nil {
 		return fmt.Errorf("marshal pull request: %w", err)
 	}
-	req, err := http.NewRequest("POST", BaseURL+"/api/pull", bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/pull", bytes.NewReader(b))
 	if err != nil {
 		return fmt.Errorf("create pull request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := pullClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ollama pull status %d", resp.StatusCode)
+		return fmt.Errorf("ollama pull status %d: %s", resp.StatusCode, errorBody(resp.Body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var update struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &update); err != nil {
+			return fmt.Errorf("parse pull progress: %w", err)
+		}
+		if update.Error != "" {
+			return fmt.Errorf("pull %s: %s", model, update.Error)
+		}
+		if onProgress != nil {
+			onProgress(update.PullProgress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read pull progress: %w", err)
 	}
 	return nil
 }
+
+// pullModel pulls model for EnsureModelAt, logging each new pull stage.
+func pullModel(baseURL, model string, logf func(string), onPull func(PullProgress)) error {
+	last := ""
+	return PullModelAt(context.Background(), baseURL, model, func(p PullProgress) {
+		if logf != nil && p.Status != last {
+			last = p.Status
+			logf(fmt.Sprintf("pull %s: %s", model, p.Status))
+		}
+		if onPull != nil {
+			onPull(p)
+		}
+	})
+}
+
+// ErrModelNotFound is returned when the Ollama host does not have the
+// requested model.
+var ErrModelNotFound = errors.New("model not found")
+
+// DeleteModelAt removes model from the Ollama host at baseURL.
+func DeleteModelAt(ctx context.Context, baseURL, model string) error {
+	b, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return fmt.Errorf("marshal delete request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", baseURL+"/api/delete", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create delete request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	default:
+		return fmt.Errorf("ollama delete status %d: %s", resp.StatusCode, errorBody(resp.Body))
+	}
+}
+
+// ModelShow is a model's description from POST /api/show.
+type ModelShow struct {
+	Details      ModelDetails   `json:"details"`
+	Parameters   string         `json:"parameters"`
+	Template     string         `json:"template"`
+	License      string         `json:"license"`
+	Capabilities []string       `json:"capabilities"`
+	ModelInfo    map[string]any `json:"model_info"`
+	ModifiedAt   time.Time      `json:"modified_at"`
+}
+
+// ContextLength returns the model's trained context length, or 0 when
+// Ollama does not report it.
+func (m ModelShow) ContextLength() int {
+	for key, v := range m.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// ShowModelAt describes model on the Ollama host at baseURL.
+func ShowModelAt(ctx context.Context, baseURL, model string) (*ModelShow, error) {
+	b, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return nil, fmt.Errorf("marshal show request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/show", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create show request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	default:
+		return nil, fmt.Errorf("ollama show status %d: %s", resp.StatusCode, errorBody(resp.Body))
+	}
+	var out ModelShow
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunningModel is a model loaded in memory, as listed by GET /api/ps.
+type RunningModel struct {
+	Name      string       `json:"name"`
+	Size      int64        `json:"size"`
+	SizeVRAM  int64        `json:"size_vram"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Details   ModelDetails `json:"details"`
+}
+
+// RunningModelsAt lists the models loaded on the Ollama host at baseURL.
+func RunningModelsAt(ctx context.Context, baseURL string) ([]RunningModel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/ps", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama ps status %d", resp.StatusCode)
+	}
+	var out struct {
+		Models []RunningModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Models, nil
+}
+
+// errorBody extracts the message of an Ollama error response.
+func errorBody(r io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(r, 4096))
+	var out struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &out) == nil && out.Error != "" {
+		return out.Error
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,46 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPullModelAtStreamsProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "pull") {
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"status":"pulling abc","digest":"sha256:abc","total":200,"completed":50}`)
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), "broken") {
+				fmt.Fprintln(w, `{"error":"disk full"}`)
+				return
+			}
+			fmt.Fprintln(w, `{"status":"success"}`)
+			return
+		}
+		http.Error(w, `{"error":"model 'x' not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	var updates []PullProgress
+	if err := PullModelAt(ctx, srv.URL, "m", func(p PullProgress) { updates = append(updates, p) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 3 || updates[1].Percent() != 25 || updates[0].Percent() != -1 || updates[2].Status != "success" {
+		t.Errorf("updates = %+v", updates)
+	}
+
+	if err := PullModelAt(ctx, srv.URL, "broken", nil); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("err = %v, want the streamed error", err)
+	}
+	if err := DeleteModelAt(ctx, srv.URL, "x"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("err = %v, want ErrModelNotFound", err)
+	}
+}
@@ -0,0 +1,361 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval is how long a host's health check is trusted before
+// the pool probes it again.
+const DefaultProbeInterval = 30 * time.Second
+
+// ErrNoHost is returned by Acquire when no healthy host is left to try.
+var ErrNoHost = errors.New("no healthy ollama host")
+
+// Host is one Ollama server of a pool.
+type Host struct {
+	URL           string
+	MaxConcurrent int // concurrent requests sent to the host; 0 for no limit
+}
+
+// HostStatus is a snapshot of a pool host.
+type HostStatus struct {
+	URL           string
+	Healthy       bool
+	Active        int
+	MaxConcurrent int
+	Models        []string
+	CheckedAt     time.Time // zero until the first probe
+	Error         string
+}
+
+type poolHost struct {
+	Host
+	active  int
+	healthy bool
+	models  []string
+	checked time.Time
+	err     error
+}
+
+// Pool routes requests across Ollama hosts. Each host is probed with
+// GET /api/tags, which tells both whether it is up and which models it has.
+// A request goes to the least busy healthy host that has its model, or to
+// the least busy healthy host when none has it yet (the model is pulled
+// there). A pool of one host is never probed: its host is always used, as
+// with a plain BaseURL.
+type Pool struct {
+	mu            sync.Mutex
+	hosts         []*poolHost
+	probeInterval time.Duration
+	changed       chan struct{} // closed and replaced when a slot frees up
+}
+
+// NewPool builds a pool of hosts, probed every probeInterval (zero uses
+// DefaultProbeInterval).
+func NewPool(hosts []Host, probeInterval time.Duration) *Pool {
+	if probeInterval <= 0 {
+		probeInterval = DefaultProbeInterval
+	}
+	p := &Pool{probeInterval: probeInterval, changed: make(chan struct{})}
+	for _, h := range hosts {
+		h.URL = strings.TrimRight(strings.TrimSpace(h.URL), "/")
+		p.hosts = append(p.hosts, &poolHost{Host: h})
+	}
+	return p
+}
+
+var (
+	defaultMu   sync.Mutex
+	defaultPool *Pool
+	implicitURL string // BaseURL the implicit default pool was built for
+)
+
+// SetDefaultPool makes p the pool used when no pool is given. Nil restores
+// the single-host pool for BaseURL.
+func SetDefaultPool(p *Pool) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultPool = p
+	implicitURL = ""
+}
+
+// DefaultPool returns the pool set with SetDefaultPool, or else a pool of
+// the single host BaseURL.
+func DefaultPool() *Pool {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultPool == nil || (implicitURL != "" && implicitURL != BaseURL) {
+		defaultPool = NewPool([]Host{{URL: BaseURL}}, 0)
+		implicitURL = BaseURL
+	}
+	return defaultPool
+}
+
+// Size returns the number of hosts.
+func (p *Pool) Size() int {
+	return len(p.hosts)
+}
+
+// Refresh probes every host concurrently. It returns ErrNoHost, with each
+// host's error, when none is healthy.
+func (p *Pool) Refresh(ctx context.Context) error {
+	type probe struct {
+		models []string
+		err    error
+	}
+	results := make([]probe, len(p.hosts))
+	var wg sync.WaitGroup
+	for i, h := range p.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models, err := ListModelsAt(ctx, h.URL)
+			results[i] = probe{models, err}
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for i, h := range p.hosts {
+		h.checked = now
+		h.healthy = results[i].err == nil
+		h.err = results[i].err
+		if h.healthy {
+			h.models = results[i].models
+		}
+	}
+	p.signal()
+	for _, h := range p.hosts {
+		if h.healthy {
+			return nil
+		}
+	}
+	return p.noHostError()
+}
+
+// Start probes the hosts every probe interval in the background and logs
+// hosts going down or coming back. A pool of one host is not probed.
+func (p *Pool) Start() {
+	if len(p.hosts) < 2 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(p.probeInterval)
+		defer ticker.Stop()
+		for {
+			before := p.Status()
+			ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+			_ = p.Refresh(ctx)
+			cancel()
+			for i, h := range p.Status() {
+				switch {
+				case before[i].Healthy && !h.Healthy:
+					slog.Warn("ollama host down", "url", h.URL, "err", h.Error)
+				case !before[i].Healthy && h.Healthy && !before[i].CheckedAt.IsZero():
+					slog.Info("ollama host up", "url", h.URL)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Status returns a snapshot of the hosts in configuration order.
+func (p *Pool) Status() []HostStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]HostStatus, len(p.hosts))
+	for i, h := range p.hosts {
+		out[i] = HostStatus{
+			URL:           h.URL,
+			Healthy:       h.healthy,
+			Active:        h.active,
+			MaxConcurrent: h.MaxConcurrent,
+			Models:        append([]string{}, h.models...),
+			CheckedAt:     h.checked,
+		}
+		if h.err != nil {
+			out[i].Error = h.err.Error()
+		}
+	}
+	return out
+}
+
+// Models returns the distinct, sorted models installed on healthy hosts as
+// of the last probe.
+func (p *Pool) Models() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[string]bool)
+	models := []string{}
+	for _, h := range p.hosts {
+		if !h.healthy {
+			continue
+		}
+		for _, m := range h.models {
+			if !seen[m] {
+				seen[m] = true
+				models = append(models, m)
+			}
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Acquire picks a host for model, skipping the URLs in exclude, and holds
+// one of its request slots until the lease is released. When every
+// suitable host is at its concurrency limit, Acquire waits for a free slot
+// or for ctx to be done. Stale health checks are refreshed first.
+func (p *Pool) Acquire(ctx context.Context, model string, exclude ...string) (*Lease, error) {
+	if p.stale() {
+		_ = p.Refresh(ctx)
+	}
+	model = SelectedModel(model)
+	for {
+		p.mu.Lock()
+		candidates := p.candidates(model, exclude)
+		if len(candidates) == 0 {
+			err := p.noHostError()
+			p.mu.Unlock()
+			return nil, err
+		}
+		var best *poolHost
+		for _, h := range candidates {
+			if h.MaxConcurrent > 0 && h.active >= h.MaxConcurrent {
+				continue
+			}
+			if best == nil || h.active < best.active {
+				best = h
+			}
+		}
+		if best != nil {
+			best.active++
+			p.mu.Unlock()
+			return &Lease{pool: p, host: best}, nil
+		}
+		wait := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// stale reports whether a multi-host pool has a host whose last probe is
+// older than the probe interval.
+func (p *Pool) stale() bool {
+	if len(p.hosts) < 2 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range p.hosts {
+		if time.Since(h.checked) > p.probeInterval {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns the usable hosts that have model, or all usable hosts
+// when none has it. Must be called with p.mu held.
+func (p *Pool) candidates(model string, exclude []string) []*poolHost {
+	var usable, withModel []*poolHost
+	for _, h := range p.hosts {
+		if containsString(exclude, h.URL) || (!h.healthy && len(p.hosts) > 1) {
+			continue
+		}
+		usable = append(usable, h)
+		if ContainsModel(h.models, model) {
+			withModel = append(withModel, h)
+		}
+	}
+	if len(withModel) > 0 {
+		return withModel
+	}
+	return usable
+}
+
+// noHostError describes why no host is usable. Must be called with p.mu
+// held.
+func (p *Pool) noHostError() error {
+	var reasons []string
+	for _, h := range p.hosts {
+		if h.err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", h.URL, h.err))
+		}
+	}
+	if len(reasons) == 0 {
+		return ErrNoHost
+	}
+	return fmt.Errorf("%w (%s)", ErrNoHost, strings.Join(reasons, "; "))
+}
+
+// signal wakes Acquire calls waiting for a slot. Must be called with p.mu
+// held.
+func (p *Pool) signal() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Lease is a request slot on one pool host.
+type Lease struct {
+	pool     *Pool
+	host     *poolHost
+	released bool
+}
+
+// URL returns the base URL of the leased host.
+func (l *Lease) URL() string {
+	return l.host.URL
+}
+
+// Release frees the slot. When err shows the host unreachable, the host is
+// marked unhealthy until its next probe succeeds. Safe to call more than
+// once.
+func (l *Lease) Release(err error) {
+	p := l.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	l.host.active--
+	if IsUnreachable(err) {
+		l.host.healthy = false
+		l.host.err = err
+		l.host.checked = time.Now()
+	}
+	p.signal()
+}
+
+// IsUnreachable reports whether err is a network-level failure (connection
+// refused, timeout, DNS) rather than an error returned by Ollama itself.
+func IsUnreachable(err error) bool {
+	var opErr *net.OpError
+	return err != nil && errors.As(err, &opErr)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
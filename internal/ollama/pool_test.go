@@ -0,0 +1,119 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeHost serves GET /api/tags with the given models.
+func fakeHost(t *testing.T, models ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[`)
+		for i, m := range models {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"name":%q}`, m)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPoolRoutesToHostWithModel(t *testing.T) {
+	a := fakeHost(t, "llama3:latest")
+	b := fakeHost(t, "qwen2.5:7b")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	p := NewPool([]Host{{URL: down.URL}, {URL: a.URL}, {URL: b.URL}}, time.Minute)
+	ctx := context.Background()
+
+	lease, err := p.Acquire(ctx, "qwen2.5:7b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.URL() != b.URL {
+		t.Errorf("qwen2.5:7b routed to %s, want %s", lease.URL(), b.URL)
+	}
+	lease.Release(nil)
+
+	// A model no host has goes to the least busy healthy host
+	busy, _ := p.Acquire(ctx, "llama3")
+	lease, err = p.Acquire(ctx, "mistral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.URL() != b.URL {
+		t.Errorf("mistral routed to %s, want the idle host %s", lease.URL(), b.URL)
+	}
+	lease.Release(nil)
+	busy.Release(nil)
+
+	// Failing over past the only host with the model
+	lease, err = p.Acquire(ctx, "qwen2.5:7b", b.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.URL() != a.URL {
+		t.Errorf("failover went to %s, want %s", lease.URL(), a.URL)
+	}
+	lease.Release(nil)
+
+	if _, err := p.Acquire(ctx, "qwen2.5:7b", a.URL, b.URL); !errors.Is(err, ErrNoHost) {
+		t.Errorf("err = %v, want ErrNoHost", err)
+	}
+}
+
+func TestPoolConcurrencyLimit(t *testing.T) {
+	a := fakeHost(t, "m:latest")
+	b := fakeHost(t, "m:latest")
+	p := NewPool([]Host{{URL: a.URL, MaxConcurrent: 1}, {URL: b.URL, MaxConcurrent: 1}}, time.Minute)
+	ctx := context.Background()
+
+	first, _ := p.Acquire(ctx, "m")
+	second, _ := p.Acquire(ctx, "m")
+	if first.URL() == second.URL() {
+		t.Fatal("two leases on the same host despite max_concurrent 1")
+	}
+
+	got := make(chan *Lease)
+	go func() {
+		lease, _ := p.Acquire(ctx, "m")
+		got <- lease
+	}()
+	select {
+	case <-got:
+		t.Fatal("third lease granted while both hosts are full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	second.Release(nil)
+	select {
+	case lease := <-got:
+		if lease.URL() != second.URL() {
+			t.Errorf("waiting lease went to %s, want the freed host %s", lease.URL(), second.URL())
+		}
+		lease.Release(nil)
+	case <-time.After(time.Second):
+		t.Fatal("waiting lease not granted after a release")
+	}
+	first.Release(nil)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	a1, _ := p.Acquire(context.Background(), "m")
+	b1, _ := p.Acquire(context.Background(), "m")
+	if _, err := p.Acquire(ctx, "m"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	a1.Release(nil)
+	b1.Release(nil)
+}
@@ -45,6 +45,31 @@ func Markdown(text string) string {
 	return rendered
 }
 
+// Reply renders a model reply in a configured style: "plain" returns it
+// unchanged, "auto" renders Markdown only when stdout is a terminal, and
+// "dark" or "light" always render with that style.
+func Reply(text, style string) string {
+	switch style {
+	case "auto":
+		if !isTTY() {
+			return text
+		}
+		return Markdown(text)
+	case "dark", "light":
+		r, err := glamour.NewTermRenderer(glamour.WithStandardStyle(style), glamour.WithWordWrap(0))
+		if err != nil {
+			return text
+		}
+		rendered, err := r.Render(NormalizeModelOutput(text))
+		if err != nil {
+			return text
+		}
+		return rendered
+	default:
+		return text
+	}
+}
+
 // isTTY checks if stdout is a terminal.
 func isTTY() bool {
 	return term.IsTerminal(int(os.Stdout.Fd()))
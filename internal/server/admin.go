@@ -0,0 +1,408 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/audit"
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type adminUserResponse struct {
+	ID          string  `json:"id"`
+	Email       string  `json:"email"`
+	Role        string  `json:"role"`
+	CreatedAt   string  `json:"created_at"`
+	LastLoginAt *string `json:"last_login_at"`
+	DisabledAt  *string `json:"disabled_at"`
+}
+
+func toAdminUserResponse(u *auth.User) adminUserResponse {
+	resp := adminUserResponse{
+		ID:        u.ID.String(),
+		Email:     u.Email,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if u.LastLoginAt != nil {
+		s := u.LastLoginAt.UTC().Format(time.RFC3339)
+		resp.LastLoginAt = &s
+	}
+	if u.DisabledAt != nil {
+		s := u.DisabledAt.UTC().Format(time.RFC3339)
+		resp.DisabledAt = &s
+	}
+	return resp
+}
+
+// handleAdminUsers handles /admin/users (list, create). Admin only.
+func handleAdminUsers(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			users, err := auth.ListUsers(db)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp := make([]adminUserResponse, 0, len(users))
+			for _, u := range users {
+				resp = append(resp, toAdminUserResponse(u))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+		case http.MethodPost:
+			var input struct {
+				Email    string `json:"email"`
+				Password string `json:"password"`
+				Role     string `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			email := strings.TrimSpace(input.Email)
+			if email == "" || input.Password == "" {
+				http.Error(w, "email and password required", http.StatusBadRequest)
+				return
+			}
+			role := strings.TrimSpace(input.Role)
+			if role == "" {
+				role = auth.RoleUser
+			}
+			if !auth.ValidRole(role) {
+				http.Error(w, "role must be 'admin' or 'user'", http.StatusBadRequest)
+				return
+			}
+			if err := auth.ValidatePassword(input.Password); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			user, err := auth.CreateUser(db, email, input.Password, role)
+			if err != nil {
+				var pqErr *pq.Error
+				if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+					http.Error(w, "user already exists", http.StatusConflict)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionUserCreate,
+				TargetType: audit.TargetUser,
+				TargetID:   user.ID.String(),
+				Diff:       audit.Diff(nil, map[string]any{"email": user.Email, "role": user.Role}),
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(toAdminUserResponse(user))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleAdminUserRoutes handles /admin/users/{id} and
+// /admin/users/{id}/agents[/{agent_id}]. Admin only.
+func handleAdminUserRoutes(db *sql.DB, agentRepo agent.AgentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/")
+		parts := strings.Split(rest, "/")
+		if parts[0] == "" {
+			http.Error(w, "user id required", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := uuid.Parse(parts[0])
+		if err != nil {
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case len(parts) == 1:
+			handleAdminUser(db, userID, w, r)
+		case len(parts) >= 2 && parts[1] == "agents" && len(parts) <= 3:
+			agentID := ""
+			if len(parts) == 3 {
+				agentID = parts[2]
+			}
+			handleAdminUserAgents(db, agentRepo, userID, agentID, w, r)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}
+}
+
+func handleAdminUser(db *sql.DB, userID uuid.UUID, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		user, err := auth.GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(toAdminUserResponse(user))
+	case http.MethodPatch:
+		var input struct {
+			Role     *string `json:"role"`
+			Disabled *bool   `json:"disabled"`
+			Password *string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if input.Role == nil && input.Disabled == nil && input.Password == nil {
+			http.Error(w, "no fields to update", http.StatusBadRequest)
+			return
+		}
+		if input.Role != nil && !auth.ValidRole(*input.Role) {
+			http.Error(w, "role must be 'admin' or 'user'", http.StatusBadRequest)
+			return
+		}
+		if input.Password != nil {
+			if err := auth.ValidatePassword(*input.Password); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		before, err := auth.GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		// All fields change together, so a rejected field (such as
+		// disabling the last admin) leaves the others unchanged. A disable
+		// or password reset signs the user out everywhere.
+		update := auth.UserUpdate{Role: input.Role, Disabled: input.Disabled, Password: input.Password}
+		revoked, err := auth.UpdateUser(db, userID, update)
+		if err != nil {
+			writeAdminUserError(w, err)
+			return
+		}
+
+		user, err := auth.GetUserByID(db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		diff := audit.Diff(auditUserFields(before), auditUserFields(user))
+		if input.Password != nil || revoked > 0 {
+			if diff == nil {
+				diff = map[string]any{}
+			}
+			if input.Password != nil {
+				diff["password"] = "reset"
+			}
+			diff["sessions_revoked"] = revoked
+		}
+		auth.RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionUserUpdate,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Diff:       diff,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(toAdminUserResponse(user))
+	case http.MethodDelete:
+		if err := auth.DeleteUser(db, userID); err != nil {
+			writeAdminUserError(w, err)
+			return
+		}
+		auth.RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionUserDelete,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleAdminUserAgents(db *sql.DB, agentRepo agent.AgentRepository, userID uuid.UUID, agentID string, w http.ResponseWriter, r *http.Request) {
+	pgRepo, ok := agentRepo.(*agent.PostgresRepository)
+	if !ok {
+		http.Error(w, "repository does not support user-scoped operations", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.GetUserByID(db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case agentID == "" && r.Method == http.MethodGet:
+		agents, err := pgRepo.ListAgentsByUser(userID.String(), false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ids := make([]string, 0, len(agents))
+		for _, a := range agents {
+			ids = append(ids, a.ID)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"agents": ids})
+	case agentID == "" && r.Method == http.MethodPost:
+		var input struct {
+			AgentID string `json:"agent_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		id := strings.TrimSpace(input.AgentID)
+		if id == "" {
+			http.Error(w, "agent_id required", http.StatusBadRequest)
+			return
+		}
+		existing, err := agentRepo.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing == nil {
+			http.Error(w, "agent not found", http.StatusNotFound)
+			return
+		}
+		if err := pgRepo.AssignAgentToUser(userID.String(), id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auth.RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionUserAssign,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Diff:       map[string]any{"agent": id},
+		})
+		w.WriteHeader(http.StatusNoContent)
+	case agentID != "" && r.Method == http.MethodDelete:
+		if err := pgRepo.UnassignAgentFromUser(userID.String(), agentID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auth.RecordAudit(db, r, audit.Event{
+			Action:     audit.ActionUserUnassign,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Diff:       map[string]any{"agent": agentID},
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// auditUserFields is the subset of user fields compared in audit diffs.
+func auditUserFields(u *auth.User) map[string]any {
+	return map[string]any{"role": u.Role, "disabled": u.Disabled()}
+}
+
+// handleAdminAudit handles GET /admin/audit. Admin only.
+// Query parameters: actor, action (exact, or prefix ending in "*" or "."),
+// target_type, target_id, since, until (RFC3339), after_id, limit.
+func handleAdminAudit(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		filter := audit.Filter{
+			Actor:      strings.TrimSpace(q.Get("actor")),
+			Action:     strings.TrimSpace(q.Get("action")),
+			TargetType: strings.TrimSpace(q.Get("target_type")),
+			TargetID:   strings.TrimSpace(q.Get("target_id")),
+		}
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &filter.Since}, {"until", &filter.Until}} {
+			if v := q.Get(p.name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, p.name+" must be RFC3339", http.StatusBadRequest)
+					return
+				}
+				*p.dst = t
+			}
+		}
+		if v := q.Get("after_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 0 {
+				http.Error(w, "after_id must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			filter.AfterID = id
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = n
+		}
+
+		events, err := audit.Query(db, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if events == nil {
+			events = []audit.Event{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(events)
+	}
+}
+
+func writeAdminUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		http.Error(w, "user not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrLastAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
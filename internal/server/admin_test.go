@@ -0,0 +1,78 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+func newAdminDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL,
+			role TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME, disabled_at DATETIME, totp_enabled_at DATETIME
+		);
+		CREATE TABLE sessions (token TEXT PRIMARY KEY, id TEXT, user_id TEXT NOT NULL);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func adminUserRequest(t *testing.T, db *sql.DB, method string, userID uuid.UUID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/admin/users/"+userID.String(), strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleAdminUser(db, userID, rec, req)
+	return rec
+}
+
+func TestAdminUserPatchIsAtomic(t *testing.T) {
+	db := newAdminDB(t)
+	admin := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, role) VALUES ($1, 'admin@example.com', 'hash', 'admin')`, admin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO sessions (token, id, user_id) VALUES ('tok', 's1', $1)`, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// The password is valid but disabling the last admin is not
+	rec := adminUserRequest(t, db, http.MethodPatch, admin, `{"password":"new-password-123","disabled":true}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if rec := adminUserRequest(t, db, http.MethodDelete, admin, ""); rec.Code != http.StatusConflict {
+		t.Fatalf("delete: status = %d, want 409", rec.Code)
+	}
+	user, err := auth.GetUserByID(db, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.PasswordHash != "hash" || user.Disabled() {
+		t.Fatalf("admin = %+v, want unchanged", user)
+	}
+
+	rec = adminUserRequest(t, db, http.MethodPatch, admin, `{"password":"new-password-123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var sessions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&sessions); err != nil || sessions != 0 {
+		t.Fatalf("sessions = %d (err %v), want the reset to revoke them", sessions, err)
+	}
+}
@@ -0,0 +1,465 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
+)
+
+// chatStore is the part of the history store that chat generation uses.
+type chatStore interface {
+	store.VerbosityKeywordLister
+	LoadContext(userID, contextName string) (store.ContextHistory, error)
+	LoadMessageTree(userID, contextName string) ([]store.Message, error)
+	GetContextMeta(userID, name string) (store.ContextInfo, bool, error)
+	AppendMessagesWithMeta(userID, contextName, agent string, verbosity int, messages []store.Message) error
+	UpdateContext(userID, name string, newName, agent *string, verbosity *int) (store.ContextInfo, error)
+}
+
+// chatRequest is the body of POST /chat and of a WebSocket "chat" message.
+type chatRequest struct {
+	Context   string         `json:"context"`
+	Agent     string         `json:"agent"`
+	Verbosity *int           `json:"verbosity"`
+	Messages  []chat.Message `json:"messages"`
+	Stream    bool           `json:"stream"`
+}
+
+// chatTurn is a validated chat request with agent, verbosity and prompt
+// resolved, ready to be generated and persisted.
+type chatTurn struct {
+	UserID       string
+	Context      string
+	Agent        string
+	Model        string
+	Verbosity    int
+	Warning      string
+	Escalation   executor.EscalationResult
+	SystemPrompt string
+	Incoming     []chat.Message  // messages sent by the client this turn
+	History      []store.Message // context messages before this turn
+	ExecMessages []chat.Message
+
+	// Regenerate re-runs a turn whose incoming messages are already
+	// persisted; only the new reply is stored.
+	Regenerate bool
+
+	// ParentID is the message the turn's first stored message follows;
+	// nil continues the context's active branch. Regenerations set it to
+	// the question being answered again.
+	ParentID *int64
+}
+
+// prepareChatTurn validates req, resolves the agent, verbosity and prompt
+// for userID and loads the context history. On error it also returns the
+// HTTP status to report.
+func prepareChatTurn(ctx context.Context, historyStore chatStore, userID string, req chatRequest) (*chatTurn, int, error) {
+	turn, status, err := resolveChatTurn(ctx, historyStore, userID, req)
+	if err != nil {
+		return nil, status, err
+	}
+	ctxHist, err := historyStore.LoadContext(userID, turn.Context)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	turn.setHistory(ctxHist.Messages)
+	return turn, 0, nil
+}
+
+// resolveChatTurn is prepareChatTurn without the history; callers must
+// call setHistory before running the turn.
+func resolveChatTurn(ctx context.Context, historyStore chatStore, userID string, req chatRequest) (*chatTurn, int, error) {
+	contextName := strings.TrimSpace(req.Context)
+	if contextName == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("context required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("messages required")
+	}
+	defaultAgent := "default"
+	defaultVerbosity := executor.DefaultVerbosity()
+
+	contextMeta, hasContext, err := historyStore.GetContextMeta(userID, contextName)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	agentName := strings.TrimSpace(req.Agent)
+	if agentName == "" {
+		if hasContext && strings.TrimSpace(contextMeta.Agent) != "" {
+			agentName = contextMeta.Agent
+		} else {
+			agentName = defaultAgent
+		}
+	}
+
+	warning := ""
+	profile := agent.GetProfileForUser(userID, agentName)
+	if profile == nil {
+		warning = fmt.Sprintf("agent %q not found or not assigned; falling back to %q", agentName, defaultAgent)
+		agentName = defaultAgent
+		profile = agent.GetProfileForUser(userID, agentName)
+	}
+	verbosityInput := req.Verbosity
+	if verbosityInput == nil && hasContext {
+		verbosityInput = &contextMeta.Verbosity
+	}
+	lastUserMessage := latestUserMessage(req.Messages)
+	escalationResult, err := executor.ResolveVerbosity(ctx, verbosityInput, defaultVerbosity, agentName, profile, lastUserMessage, userID, historyStore)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	verbosity := escalationResult.EffectiveVerbosity
+	warning = joinWarnings(warning, escalationResult.Warning)
+
+	systemPrompt := ""
+	model := ""
+	if profile != nil {
+		systemPrompt = profile.SystemPrompt
+		model = profile.LocalModel
+	}
+	if constraint := executor.SystemConstraint(verbosity); constraint != "" {
+		if systemPrompt != "" {
+			systemPrompt = systemPrompt + "\n\n" + constraint
+		} else {
+			systemPrompt = constraint
+		}
+	}
+
+	return &chatTurn{
+		UserID:       userID,
+		Context:      contextName,
+		Agent:        agentName,
+		Model:        model,
+		Verbosity:    verbosity,
+		Warning:      warning,
+		Escalation:   escalationResult,
+		SystemPrompt: systemPrompt,
+		Incoming:     req.Messages,
+	}, 0, nil
+}
+
+// setHistory sets the context messages preceding the turn and builds the
+// prompt sent to the model.
+func (t *chatTurn) setHistory(history []store.Message) {
+	t.History = history
+	t.ExecMessages = buildChatMessages(t.SystemPrompt, history, t.Incoming)
+}
+
+// serveChatTurn generates the reply for turn and writes the /chat response:
+// a resumable SSE job stream if stream is set, JSON otherwise.
+func serveChatTurn(w http.ResponseWriter, r *http.Request, historyStore chatStore, sched *executor.Scheduler, jobs *jobRegistry, tracker *usage.Tracker, turn *chatTurn, stream bool) {
+	annotateGeneration(r.Context(), turn.Agent, turn.Model, turn.Verbosity, turn.Escalation)
+
+	if !checkQuota(w, tracker, turn.UserID) {
+		return
+	}
+
+	ticket, ok := enqueueGeneration(w, sched, turn.Model, turn.UserID)
+	if !ok {
+		return
+	}
+
+	if stream {
+		// Streaming path: the generation runs as a job that buffers its
+		// events, so a client that drops can resume via /chat/jobs/{id}.
+		job := jobs.start(r.Context(), turn.UserID, func(ctx context.Context, job *chatJob) {
+			runChatTurn(ctx, job, historyStore, tracker, ticket, turn)
+		})
+		serveJobStream(w, r, job, 0)
+		return
+	}
+
+	// Non-streaming path
+	defer ticket.Release()
+	if err := ticket.Wait(r.Context(), nil); err != nil {
+		return
+	}
+	start := time.Now()
+	reply, tokens, err := (&executor.OllamaExecutor{Model: turn.Model, Verbosity: turn.Verbosity}).ExecuteWithUsage(turn.ExecMessages)
+	latency := time.Since(start)
+	if err != nil {
+		notifyGenerationFailed(r.Context(), turn.UserID, turn.Agent, turn.Model, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tracker.Record(turn.usageEntry(tokens))
+
+	messageID, err := persistChatTurn(historyStore, turn, chatReply{Content: reply, Usage: tokens, Latency: latency})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Auto-rename context based on first message
+	contextName := turn.Context
+	if len(turn.History) == 0 && !turn.Regenerate {
+		contextName = autoRenameContext(historyStore, turn.UserID, turn.Context, turn.Model, turn.Incoming)
+	}
+
+	type contextResponse struct {
+		Name      string `json:"name"`
+		Agent     string `json:"agent"`
+		Verbosity int    `json:"verbosity"`
+	}
+	type response struct {
+		Reply     string          `json:"reply"`
+		MessageID int64           `json:"message_id"`
+		Context   contextResponse `json:"context"`
+		Warning   string          `json:"warning,omitempty"`
+		Model     string          `json:"model"`
+		Usage     executor.Usage  `json:"usage"`
+		LatencyMS int64           `json:"latency_ms"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response{
+		Reply:     reply,
+		MessageID: messageID,
+		Context: contextResponse{
+			Name:      contextName,
+			Agent:     turn.Agent,
+			Verbosity: turn.Verbosity,
+		},
+		Warning:   turn.Warning,
+		Model:     ollama.SelectedModel(turn.Model),
+		Usage:     tokens,
+		LatencyMS: latency.Milliseconds(),
+	})
+}
+
+// runChatTurn generates the reply for turn as a job, emitting the /chat
+// event protocol: job, progress (planning, queued, generating), info,
+// deltas, then either an error or finalizing and done. It owns ticket.
+//
+// If ctx is cancelled or the model fails mid-stream, the partial reply is
+// persisted with the incomplete flag. It returns the context's name after
+// the turn, which differs from turn.Context if the context was
+// auto-renamed, and reports whether anything was persisted.
+func runChatTurn(ctx context.Context, job *chatJob, historyStore chatStore, tracker *usage.Tracker, ticket *executor.Ticket, turn *chatTurn) (contextName string, persisted bool) {
+	defer ticket.Release()
+
+	job.emit("job", map[string]any{"job_id": job.ID})
+	job.emit("progress", map[string]any{"stage": "planning"})
+
+	// Send escalation info event immediately if warnings occurred
+	if turn.Warning != "" {
+		job.emit("", map[string]any{
+			"type":    "info",
+			"message": turn.Warning,
+		})
+	}
+
+	// Wait for a generation slot, reporting queue position
+	if err := ticket.Wait(ctx, func(position int) {
+		job.emit("progress", map[string]any{"stage": "queued", "position": position})
+	}); err != nil {
+		job.emit("", map[string]any{"type": "error", "error": "generation cancelled", "cancelled": true})
+		return turn.Context, false
+	}
+
+	// Compute token budget before model execution
+	tokenBudget := executor.EstimateTokenBudget(turn.ExecMessages, turn.Verbosity)
+
+	generatingData := map[string]any{
+		"stage":               "generating",
+		"effective_verbosity": turn.Verbosity,
+		"token_budget":        tokenBudget.TotalEstimatedTokens,
+		"escalated":           turn.Escalation.Escalated,
+	}
+	if len(turn.Escalation.MatchedKeywords) > 0 {
+		generatingData["reason"] = turn.Escalation.MatchedKeywords
+	}
+	job.emit("progress", generatingData)
+
+	// Stream tokens as they arrive from Ollama, keeping the partial reply
+	// in case the generation is aborted.
+	var partial strings.Builder
+	onDelta := func(delta string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		partial.WriteString(delta)
+		job.emit("", map[string]any{"delta": delta})
+		return nil
+	}
+
+	start := time.Now()
+	reply, tokens, err := (&executor.OllamaExecutor{Model: turn.Model, Verbosity: turn.Verbosity, Ctx: ctx}).ExecuteStreamingWithUsage(turn.ExecMessages, onDelta)
+	latency := time.Since(start)
+	if err != nil {
+		errData := map[string]any{
+			"type":  "error",
+			"error": err.Error(),
+		}
+		if ctx.Err() != nil {
+			errData["error"] = "generation cancelled"
+			errData["cancelled"] = true
+		} else {
+			notifyGenerationFailed(ctx, turn.UserID, turn.Agent, turn.Model, err)
+		}
+		if partial.Len() > 0 || tokens.TotalTokens() > 0 {
+			// Ollama reports usage only with its final chunk, so an aborted
+			// generation is counted from the prompt and partial reply
+			used := tokens
+			if used.TotalTokens() == 0 {
+				used = executor.Usage{
+					PromptTokens:     tokenBudget.EstimatedPromptTokens,
+					CompletionTokens: (partial.Len() + executor.CharsPerToken - 1) / executor.CharsPerToken,
+				}
+			}
+			tracker.Record(turn.usageEntry(used))
+		}
+		if partial.Len() > 0 {
+			if _, err := persistChatTurn(historyStore, turn, chatReply{Content: partial.String(), Usage: tokens, Latency: latency, Incomplete: true}); err != nil {
+				slog.ErrorContext(ctx, "failed to persist partial reply", "err", err)
+			} else {
+				errData["incomplete"] = true
+				persisted = true
+			}
+		}
+		job.emit("", errData)
+		return turn.Context, persisted
+	}
+
+	tracker.Record(turn.usageEntry(tokens))
+
+	// Persist to DB after streaming completes
+	messageID, err := persistChatTurn(historyStore, turn, chatReply{Content: reply, Usage: tokens, Latency: latency})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to persist messages", "err", err)
+	} else {
+		persisted = true
+	}
+
+	contextName = turn.Context
+	if len(turn.History) == 0 && !turn.Regenerate {
+		contextName = autoRenameContext(historyStore, turn.UserID, turn.Context, turn.Model, turn.Incoming)
+	}
+
+	job.emit("progress", map[string]any{"stage": "finalizing"})
+	job.emit("", map[string]any{
+		"done":       true,
+		"message_id": messageID,
+		"context": map[string]any{
+			"name":      contextName,
+			"agent":     turn.Agent,
+			"verbosity": turn.Verbosity,
+		},
+		"model":      ollama.SelectedModel(turn.Model),
+		"usage":      tokens,
+		"latency_ms": latency.Milliseconds(),
+	})
+	return contextName, persisted
+}
+
+// chatReply is a generated assistant reply and how it was produced.
+type chatReply struct {
+	Content    string
+	Usage      executor.Usage
+	Latency    time.Duration
+	Incomplete bool
+}
+
+// usageEntry returns the usage record for a generation of this turn.
+func (t *chatTurn) usageEntry(u executor.Usage) usage.Entry {
+	return usage.Entry{
+		UserID:           t.UserID,
+		Agent:            t.Agent,
+		Model:            ollama.SelectedModel(t.Model),
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+	}
+}
+
+// persistChatTurn stores the turn's incoming messages (unless regenerating)
+// and the assistant reply, and returns the reply's message ID.
+func persistChatTurn(historyStore chatStore, turn *chatTurn, reply chatReply) (int64, error) {
+	incoming := turn.Incoming
+	if turn.Regenerate {
+		incoming = nil
+	}
+	stored := chatTurnMessages(turn, incoming, reply)
+	stored[0].ParentID = turn.ParentID
+	if err := historyStore.AppendMessagesWithMeta(turn.UserID, turn.Context, turn.Agent, turn.Verbosity, stored); err != nil {
+		return 0, err
+	}
+	return stored[len(stored)-1].ID, nil
+}
+
+// chatTurnMessages converts one /chat turn into stored messages: the
+// client's messages followed by the assistant reply with its metadata.
+// Server generations always run on the local Ollama.
+func chatTurnMessages(turn *chatTurn, incoming []chat.Message, reply chatReply) []store.Message {
+	agentName := turn.Agent
+	verbosity := turn.Verbosity
+	userTime := time.Now().UTC()
+	stored := make([]store.Message, 0, len(incoming)+1)
+	for _, msg := range incoming {
+		var agentNamePtr *string
+		var verbosityPtr *int
+		if msg.Role == "assistant" {
+			agentNamePtr = &agentName
+			verbosityPtr = &verbosity
+		}
+		stored = append(stored, store.Message{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Agent:     agentNamePtr,
+			Verbosity: verbosityPtr,
+			Time:      userTime,
+		})
+	}
+	stored = append(stored, store.Message{
+		Role:             "assistant",
+		Content:          reply.Content,
+		Agent:            &agentName,
+		Verbosity:        &verbosity,
+		Time:             time.Now().UTC(),
+		Incomplete:       reply.Incomplete,
+		PromptTokens:     reply.Usage.PromptTokens,
+		CompletionTokens: reply.Usage.CompletionTokens,
+		Model:            ollama.SelectedModel(turn.Model),
+		Source:           "local",
+		Keywords:         turn.Escalation.MatchedKeywords,
+		LatencyMS:        reply.Latency.Milliseconds(),
+	})
+	return stored
+}
+
+// autoRenameContext names a fresh context after its first user message and
+// returns the resulting context name. Rename failures keep the old name so
+// they never block the response.
+func autoRenameContext(historyStore chatStore, userID, contextName, model string, incoming []chat.Message) string {
+	firstUserMsg := ""
+	for _, msg := range incoming {
+		if msg.Role == "user" {
+			firstUserMsg = msg.Content
+			break
+		}
+	}
+	if firstUserMsg == "" {
+		return contextName
+	}
+
+	newName := autoGenerateContextName(firstUserMsg, model)
+	if newName == "" || newName == contextName {
+		return contextName
+	}
+	updated, err := historyStore.UpdateContext(userID, contextName, &newName, nil, nil)
+	if err != nil {
+		return contextName
+	}
+	return updated.Name
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/config"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
+	_ "modernc.org/sqlite"
+)
+
+// memStore is an in-memory chatStore with the PostgresStore semantics the
+// chat handlers rely on: implicit context creation, message trees and
+// renames that move the messages.
+type memStore struct {
+	mu       sync.Mutex
+	nextID   int64
+	contexts map[string]*memContext // userID + "/" + name
+}
+
+type memContext struct {
+	info     store.ContextInfo
+	messages []store.Message
+}
+
+func newMemStore() *memStore {
+	return &memStore{contexts: make(map[string]*memContext)}
+}
+
+func (s *memStore) ListVerbosityKeywords(ctx context.Context, userID string) ([]store.VerbosityKeyword, error) {
+	return nil, nil
+}
+
+func (s *memStore) LoadContext(userID, contextName string) (store.ContextHistory, error) {
+	tree, err := s.LoadMessageTree(userID, contextName)
+	if err != nil {
+		return store.ContextHistory{}, err
+	}
+	return store.ContextHistory{Messages: store.ActiveBranch(tree)}, nil
+}
+
+func (s *memStore) LoadMessageTree(userID, contextName string) ([]store.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.contexts[userID+"/"+contextName]
+	if c == nil {
+		return []store.Message{}, nil
+	}
+	return append([]store.Message(nil), c.messages...), nil
+}
+
+func (s *memStore) GetContextMeta(userID, name string) (store.ContextInfo, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.contexts[userID+"/"+name]
+	if c == nil {
+		return store.ContextInfo{}, false, nil
+	}
+	return c.info, true, nil
+}
+
+func (s *memStore) AppendMessagesWithMeta(userID, contextName, agent string, verbosity int, messages []store.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.contexts[userID+"/"+contextName]
+	if c == nil {
+		c = &memContext{}
+		s.contexts[userID+"/"+contextName] = c
+	}
+	c.info = store.ContextInfo{Name: contextName, Agent: agent, Verbosity: verbosity}
+	for i := range messages {
+		msg := messages[i]
+		switch {
+		case i > 0:
+			msg.ParentID = store.ParentRef(messages[i-1].ID)
+		case msg.ParentID == nil && len(c.messages) > 0:
+			msg.ParentID = store.ParentRef(c.messages[len(c.messages)-1].ID)
+		case msg.ParentID != nil && *msg.ParentID == 0:
+			msg.ParentID = nil
+		}
+		s.nextID++
+		msg.ID = s.nextID
+		messages[i].ID = msg.ID
+		c.messages = append(c.messages, msg)
+	}
+	return nil
+}
+
+func (s *memStore) UpdateContext(userID, name string, newName, agent *string, verbosity *int) (store.ContextInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.contexts[userID+"/"+name]
+	if c == nil {
+		return store.ContextInfo{}, fmt.Errorf("context not found")
+	}
+	if newName != nil && *newName != "" && *newName != name {
+		if s.contexts[userID+"/"+*newName] != nil {
+			return store.ContextInfo{}, fmt.Errorf("context already exists")
+		}
+		delete(s.contexts, userID+"/"+name)
+		s.contexts[userID+"/"+*newName] = c
+		c.info.Name = *newName
+	}
+	if agent != nil {
+		c.info.Agent = *agent
+	}
+	if verbosity != nil {
+		c.info.Verbosity = *verbosity
+	}
+	return c.info, nil
+}
+
+// fakeOllama serves the default model: streamed chats reply with each
+// entry of deltas and non-streamed chats (context titles) with title. It
+// replaces ollama.BaseURL for the test.
+func fakeOllama(t *testing.T, title string, deltas ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprintf(w, `{"models":[{"name":%q}]}`, ollama.DefaultModel)
+			return
+		}
+		var req struct {
+			Messages []chat.Message `json:"messages"`
+			Stream   bool           `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		enc := json.NewEncoder(w)
+		if !req.Stream {
+			_ = enc.Encode(map[string]any{"message": chat.Message{Role: "assistant", Content: title}, "done": true})
+			return
+		}
+		for _, d := range deltas {
+			_ = enc.Encode(map[string]any{"message": chat.Message{Role: "assistant", Content: d}})
+			w.(http.Flusher).Flush()
+		}
+		_ = enc.Encode(map[string]any{"done": true, "prompt_eval_count": 7, "eval_count": len(deltas)})
+	}))
+	t.Cleanup(srv.Close)
+
+	prev := ollama.BaseURL
+	ollama.BaseURL = srv.URL
+	t.Cleanup(func() { ollama.BaseURL = prev })
+	return srv
+}
+
+// newUsageTracker returns a tracker over an in-memory SQLite usage table;
+// the rollup statements are portable.
+func newUsageTracker(t *testing.T) (*usage.Tracker, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := usage.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return usage.NewTracker(db, config.QuotaConfig{}), db
+}
+
+func TestRunChatTurnRecordsUsageOfFailedGeneration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprintf(w, `{"models":[{"name":%q}]}`, ollama.DefaultModel)
+			return
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"partial reply"}}`)
+		fmt.Fprintln(w, `{"error":"model runner crashed"}`)
+	}))
+	defer srv.Close()
+	prev := ollama.BaseURL
+	ollama.BaseURL = srv.URL
+	defer func() { ollama.BaseURL = prev }()
+
+	tracker, db := newUsageTracker(t)
+	historyStore := newMemStore()
+	turn := &chatTurn{UserID: "u1", Context: "c", Agent: "default", Verbosity: 2, Incoming: []chat.Message{{Role: "user", Content: "hi"}}}
+	turn.setHistory(nil)
+	ticket, _ := (*executor.Scheduler)(nil).Enqueue(turn.Model, turn.UserID)
+
+	var persisted bool
+	job := newJobRegistry().start(context.Background(), "u1", func(ctx context.Context, job *chatJob) {
+		_, persisted = runChatTurn(ctx, job, historyStore, tracker, ticket, turn)
+	})
+	<-job.Done()
+	if !persisted {
+		t.Fatal("partial reply not persisted")
+	}
+
+	rows, err := usage.Query(db, usage.Filter{UserID: "u1", GroupBy: []string{"model"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Requests != 1 || rows[0].Model != ollama.DefaultModel {
+		t.Fatalf("usage rows = %+v, want one request", rows)
+	}
+	// "partial reply" is 13 characters, about 4 tokens
+	if rows[0].CompletionTokens != 4 || rows[0].PromptTokens == 0 {
+		t.Fatalf("usage = %+v, want an estimate from the prompt and partial reply", rows[0])
+	}
+}
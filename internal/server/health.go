@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+)
+
+// readinessTimeout bounds each dependency check in /health/ready.
+const readinessTimeout = 2 * time.Second
+
+// Readiness states reported by /health/ready.
+const (
+	ReadyOK          = "ready"       // all dependencies up, all agent models installed
+	ReadyDegraded    = "degraded"    // dependencies up, some agent models missing (pulled on first use)
+	ReadyUnavailable = "unavailable" // Postgres or Ollama down
+)
+
+type readinessCheck struct {
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type readinessModels struct {
+	Present []string `json:"present"`
+	Missing []string `json:"missing"`
+}
+
+type readinessHost struct {
+	URL           string   `json:"url"`
+	Healthy       bool     `json:"healthy"`
+	Active        int      `json:"active"`
+	MaxConcurrent int      `json:"max_concurrent,omitempty"`
+	Models        []string `json:"models"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status      string                    `json:"status"`
+	Checks      map[string]readinessCheck `json:"checks"`
+	Models      readinessModels           `json:"models"`
+	OllamaHosts []readinessHost           `json:"ollama_hosts"`
+}
+
+// handleHealth handles GET /health and /health/live. It only reports that
+// the process is serving requests.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleHealthReady handles GET /health/ready. It pings Postgres, probes the
+// Ollama hosts and compares the models installed on healthy hosts with the
+// models of enabled agents. Responds 503 when Postgres or every Ollama host
+// is unreachable.
+func handleHealthReady(db *sql.DB, agentRepo agent.AgentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		var (
+			wg      sync.WaitGroup
+			pgCheck readinessCheck
+			olCheck readinessCheck
+			pool    = ollama.DefaultPool()
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			pgCheck = runCheck(func() error { return db.PingContext(ctx) })
+		}()
+		go func() {
+			defer wg.Done()
+			olCheck = runCheck(func() error { return pool.Refresh(ctx) })
+		}()
+		wg.Wait()
+
+		resp := readinessResponse{
+			Status:      ReadyOK,
+			Checks:      map[string]readinessCheck{"postgres": pgCheck, "ollama": olCheck},
+			Models:      readinessModels{Present: []string{}, Missing: []string{}},
+			OllamaHosts: []readinessHost{},
+		}
+		for _, h := range pool.Status() {
+			resp.OllamaHosts = append(resp.OllamaHosts, readinessHost{
+				URL:           h.URL,
+				Healthy:       h.Healthy,
+				Active:        h.Active,
+				MaxConcurrent: h.MaxConcurrent,
+				Models:        h.Models,
+				Error:         h.Error,
+			})
+		}
+		installed := pool.Models()
+
+		if olCheck.OK {
+			for _, model := range agentModels(agentRepo) {
+				if ollama.ContainsModel(installed, model) {
+					resp.Models.Present = append(resp.Models.Present, model)
+				} else {
+					resp.Models.Missing = append(resp.Models.Missing, model)
+				}
+			}
+			if len(resp.Models.Missing) > 0 {
+				resp.Status = ReadyDegraded
+			}
+		}
+
+		status := http.StatusOK
+		if !pgCheck.OK || !olCheck.OK {
+			resp.Status = ReadyUnavailable
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func runCheck(fn func() error) readinessCheck {
+	start := time.Now()
+	err := fn()
+	check := readinessCheck{OK: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// agentModels returns the distinct, sorted models used by enabled agents.
+// An agent without a model uses ollama.DefaultModel.
+func agentModels(agentRepo agent.AgentRepository) []string {
+	if agentRepo == nil {
+		return nil
+	}
+	agents, err := agentRepo.ListEnabled()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var models []string
+	for _, a := range agents {
+		model := ollama.SelectedModel(a.Model)
+		if !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+)
+
+// jobRetention is how long a finished job's events stay available for
+// clients reconnecting with Last-Event-ID.
+const jobRetention = 10 * time.Minute
+
+// jobEvent is one buffered SSE event. Name is empty for plain data events.
+type jobEvent struct {
+	ID   int
+	Name string
+	Data []byte
+}
+
+// chatJob is a streaming generation that runs independently of the HTTP
+// request that started it. Every event is buffered with a sequential ID so
+// a client that loses its connection can reconnect and replay from where it
+// left off.
+type chatJob struct {
+	ID     string
+	UserID string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	events     []jobEvent
+	done       bool
+	finishedAt time.Time
+	wake       chan struct{} // closed and replaced on every change
+	finished   chan struct{} // closed by finish
+}
+
+// emit appends an event and wakes all subscribers.
+func (j *chatJob) emit(name string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.done {
+		return
+	}
+	j.events = append(j.events, jobEvent{ID: len(j.events) + 1, Name: name, Data: data})
+	close(j.wake)
+	j.wake = make(chan struct{})
+}
+
+// finish marks the job complete; subscribers drain remaining events and stop.
+func (j *chatJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.done {
+		return
+	}
+	j.done = true
+	j.finishedAt = time.Now()
+	close(j.finished)
+	close(j.wake)
+	j.wake = make(chan struct{})
+	j.cancel()
+}
+
+// Cancel aborts the generation. The job records whatever was produced so far.
+func (j *chatJob) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel that is closed once the job has finished.
+func (j *chatJob) Done() <-chan struct{} {
+	return j.finished
+}
+
+// since returns events with ID > after, whether the job is done, and a
+// channel that is closed on the next change.
+func (j *chatJob) since(after int) ([]jobEvent, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if after < 0 {
+		after = 0
+	}
+	var pending []jobEvent
+	if after < len(j.events) {
+		pending = j.events[after:]
+	}
+	return pending, j.done, j.wake
+}
+
+// jobRegistry tracks running and recently finished chat jobs.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*chatJob
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*chatJob)}
+}
+
+// start registers a job for userID and runs fn in its own goroutine. The
+// job's context keeps parent's values (request ID) but not its
+// cancellation, so it outlives the request. The job is finished when fn
+// returns.
+func (reg *jobRegistry) start(parent context.Context, userID string, fn func(ctx context.Context, job *chatJob)) *chatJob {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	job := &chatJob{
+		ID:       hex.EncodeToString(b),
+		UserID:   userID,
+		ctx:      ctx,
+		cancel:   cancel,
+		wake:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	reg.mu.Lock()
+	reg.jobs[job.ID] = job
+	reg.mu.Unlock()
+
+	go func() {
+		defer job.finish()
+		fn(ctx, job)
+	}()
+	return job
+}
+
+// get returns the job if it exists and belongs to userID.
+func (reg *jobRegistry) get(id, userID string) *chatJob {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	job := reg.jobs[id]
+	if job == nil || job.UserID != userID {
+		return nil
+	}
+	return job
+}
+
+// sweep drops finished jobs older than jobRetention.
+func (reg *jobRegistry) sweep() {
+	cutoff := time.Now().Add(-jobRetention)
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for id, job := range reg.jobs {
+		job.mu.Lock()
+		expired := job.done && job.finishedAt.Before(cutoff)
+		job.mu.Unlock()
+		if expired {
+			delete(reg.jobs, id)
+		}
+	}
+}
+
+// startSweeper runs sweep every minute for the lifetime of the process.
+func (reg *jobRegistry) startSweeper() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			reg.sweep()
+		}
+	}()
+}
+
+// serveJobStream writes the job's events after the given event ID as SSE and
+// follows the job until it finishes or the client disconnects. Disconnecting
+// does not stop the job.
+func serveJobStream(w http.ResponseWriter, r *http.Request, job *chatJob, after int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	defer metrics.StreamStarted()()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Sidekick-Job", job.ID)
+
+	for {
+		pending, done, wake := job.since(after)
+		for _, ev := range pending {
+			fmt.Fprintf(w, "id: %d\n", ev.ID)
+			if ev.Name != "" {
+				fmt.Fprintf(w, "event: %s\n", ev.Name)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", ev.Data)
+			after = ev.ID
+		}
+		flusher.Flush()
+		if done && len(pending) == 0 {
+			return
+		}
+		if done {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleChatJob handles /chat/jobs/{id}. GET resumes a streaming /chat
+// generation: events after the Last-Event-ID header (or last_event_id query
+// parameter, for clients that cannot set headers) are replayed, then the
+// stream follows the job live. DELETE stops the generation and responds
+// once its partial reply has been persisted as incomplete.
+func handleChatJob(jobs *jobRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/chat/jobs/"), "/")
+		job := jobs.get(id, userID.String())
+		if job == nil {
+			http.Error(w, "job not found or expired", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			job.Cancel()
+			select {
+			case <-job.Done():
+			case <-r.Context().Done():
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		after := 0
+		if lastID != "" {
+			n, err := strconv.Atoi(lastID)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			after = n
+		}
+
+		serveJobStream(w, r, job, after)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"github.com/google/uuid"
+)
+
+func TestServeJobStreamReplaysAfterLastEventID(t *testing.T) {
+	jobs := newJobRegistry()
+	job := jobs.start(context.Background(), "u1", func(ctx context.Context, job *chatJob) {
+		job.emit("progress", map[string]any{"stage": "planning"})
+		job.emit("", map[string]any{"delta": "hel"})
+		job.emit("", map[string]any{"delta": "lo"})
+	})
+	<-job.ctx.Done() // finish cancels the job context
+
+	rec := httptest.NewRecorder()
+	serveJobStream(rec, httptest.NewRequest("GET", "/chat/jobs/"+job.ID, nil), job, 1)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "id: 1\n") || strings.Contains(body, "planning") {
+		t.Fatalf("replayed event at or before Last-Event-ID:\n%s", body)
+	}
+	if !strings.Contains(body, "id: 2\ndata: {\"delta\":\"hel\"}") || !strings.Contains(body, "id: 3\n") {
+		t.Fatalf("missing events after Last-Event-ID:\n%s", body)
+	}
+	if got := rec.Header().Get("X-Sidekick-Job"); got != job.ID {
+		t.Fatalf("X-Sidekick-Job = %q, want %q", got, job.ID)
+	}
+}
+
+func TestJobRegistryGetChecksOwner(t *testing.T) {
+	jobs := newJobRegistry()
+	job := jobs.start(context.Background(), "u1", func(context.Context, *chatJob) {})
+	if jobs.get(job.ID, "u2") != nil {
+		t.Fatal("job visible to another user")
+	}
+	if jobs.get(job.ID, "u1") != job {
+		t.Fatal("job not found for its owner")
+	}
+}
+
+func TestDeleteChatJobPersistsPartialReply(t *testing.T) {
+	// The model streams one delta, then hangs until the request is cancelled
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprintf(w, `{"models":[{"name":%q}]}`, ollama.DefaultModel)
+			return
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"partial"}}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	prev := ollama.BaseURL
+	ollama.BaseURL = srv.URL
+	defer func() { ollama.BaseURL = prev }()
+
+	userID := uuid.New()
+	historyStore := newMemStore()
+	tracker, _ := newUsageTracker(t)
+	turn := &chatTurn{UserID: userID.String(), Context: "c", Agent: "default", Verbosity: 2, Incoming: []chat.Message{{Role: "user", Content: "hi"}}}
+	turn.setHistory(nil)
+	ticket, _ := (*executor.Scheduler)(nil).Enqueue(turn.Model, turn.UserID)
+
+	jobs := newJobRegistry()
+	job := jobs.start(context.Background(), turn.UserID, func(ctx context.Context, job *chatJob) {
+		runChatTurn(ctx, job, historyStore, tracker, ticket, turn)
+	})
+
+	// Wait for the delta so the cancel lands mid-stream
+	deadline := time.After(5 * time.Second)
+	for after := 0; ; {
+		events, _, wake := job.since(after)
+		streaming := false
+		for _, ev := range events {
+			streaming = streaming || strings.Contains(string(ev.Data), `"delta"`)
+			after = ev.ID
+		}
+		if streaming {
+			break
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			t.Fatal("no delta before the deadline")
+		}
+	}
+
+	handler := handleChatJob(jobs)
+	req := httptest.NewRequest(http.MethodDelete, "/chat/jobs/"+job.ID, nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req.WithContext(auth.WithUserID(req.Context(), uuid.New())))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("DELETE by another user: status = %d, want 404", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, req.WithContext(auth.WithUserID(req.Context(), userID)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	history, err := historyStore.LoadContext(turn.UserID, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := history.Messages
+	if len(msgs) != 2 || msgs[1].Content != "partial" || !msgs[1].Incomplete {
+		t.Fatalf("messages = %+v, want the prompt and an incomplete partial reply", msgs)
+	}
+	events, done, _ := job.since(0)
+	if !done || !strings.Contains(string(events[len(events)-1].Data), `"cancelled":true`) {
+		t.Fatalf("job done = %v, last event = %s, want a cancelled error", done, events[len(events)-1].Data)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+)
+
+type modelEntry struct {
+	Name              string    `json:"name"`
+	Size              int64     `json:"size"`
+	Family            string    `json:"family"`
+	ParameterSize     string    `json:"parameter_size"`
+	QuantizationLevel string    `json:"quantization_level"`
+	ModifiedAt        time.Time `json:"modified_at"`
+	Hosts             []string  `json:"hosts"`
+	Agents            []string  `json:"agents"`
+}
+
+type missingModelEntry struct {
+	Name   string   `json:"name"`
+	Agents []string `json:"agents"`
+}
+
+type modelsHost struct {
+	URL   string `json:"url"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type modelsResponse struct {
+	Models  []modelEntry        `json:"models"`
+	Missing []missingModelEntry `json:"missing"`
+	Hosts   []modelsHost        `json:"hosts"`
+}
+
+// userAgentLister lists the agents a user can see; the Postgres repository
+// implements it.
+type userAgentLister interface {
+	ListAgentsByUser(userID string, enabledOnly bool) ([]*agent.AgentRecord, error)
+}
+
+// handleAPIModels handles GET /api/models, a read-only model inventory: the
+// models installed on each Ollama host, which of the caller's enabled agents
+// use them, and the agent models no host has yet (pulled on first use).
+// Responds 503 when no host is reachable.
+func handleAPIModels(agentRepo agent.AgentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		lister, ok := agentRepo.(userAgentLister)
+		if !ok {
+			http.Error(w, "repository does not support user-scoped operations", http.StatusInternalServerError)
+			return
+		}
+		agents, err := lister.ListAgentsByUser(userID.String(), true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Agent IDs per model, for the agents this user can see
+		usedBy := make(map[string][]string)
+		for _, a := range agents {
+			model := ollama.SelectedModel(a.Model)
+			usedBy[model] = append(usedBy[model], a.ID)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), ollama.ProbeTimeout)
+		defer cancel()
+		status := ollama.DefaultPool().Status()
+		installed := make([][]ollama.ModelInfo, len(status))
+		resp := modelsResponse{
+			Models:  []modelEntry{},
+			Missing: []missingModelEntry{},
+			Hosts:   make([]modelsHost, len(status)),
+		}
+		var wg sync.WaitGroup
+		for i, h := range status {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				models, err := ollama.ListModelInfoAt(ctx, h.URL)
+				resp.Hosts[i] = modelsHost{URL: h.URL, OK: err == nil}
+				if err != nil {
+					resp.Hosts[i].Error = err.Error()
+					return
+				}
+				installed[i] = models
+			}()
+		}
+		wg.Wait()
+
+		reachable := false
+		byName := make(map[string]*modelEntry)
+		for i, models := range installed {
+			reachable = reachable || resp.Hosts[i].OK
+			for _, m := range models {
+				entry, ok := byName[m.Name]
+				if !ok {
+					entry = &modelEntry{
+						Name:              m.Name,
+						Size:              m.Size,
+						Family:            m.Details.Family,
+						ParameterSize:     m.Details.ParameterSize,
+						QuantizationLevel: m.Details.QuantizationLevel,
+						ModifiedAt:        m.ModifiedAt,
+						Hosts:             []string{},
+						Agents:            []string{},
+					}
+					byName[m.Name] = entry
+				}
+				entry.Hosts = append(entry.Hosts, status[i].URL)
+			}
+		}
+		if !reachable {
+			http.Error(w, "no Ollama host reachable", http.StatusServiceUnavailable)
+			return
+		}
+
+		for model, ids := range usedBy {
+			found := false
+			for name, entry := range byName {
+				if ollama.ContainsModel([]string{name}, model) {
+					entry.Agents = append(entry.Agents, ids...)
+					found = true
+				}
+			}
+			if !found {
+				resp.Missing = append(resp.Missing, missingModelEntry{Name: model, Agents: ids})
+			}
+		}
+
+		for _, entry := range byName {
+			sort.Strings(entry.Agents)
+			resp.Models = append(resp.Models, *entry)
+		}
+		sort.Slice(resp.Models, func(i, j int) bool { return resp.Models[i].Name < resp.Models[j].Name })
+		sort.Slice(resp.Missing, func(i, j int) bool { return resp.Missing[i].Name < resp.Missing[j].Name })
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/ollama"
+	"github.com/google/uuid"
+)
+
+// fakeAgentRepo returns fixed agents for every user.
+type fakeAgentRepo struct {
+	agent.AgentRepository
+	agents []*agent.AgentRecord
+}
+
+func (r *fakeAgentRepo) ListAgentsByUser(userID string, enabledOnly bool) ([]*agent.AgentRecord, error) {
+	return r.agents, nil
+}
+
+// fakeModelHost serves /api/tags with the given models.
+func fakeModelHost(t *testing.T, models ...string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var list []string
+		for _, m := range models {
+			list = append(list, fmt.Sprintf(`{"name":%q,"size":100,"details":{"family":"test"}}`, m))
+		}
+		fmt.Fprintf(w, `{"models":[%s]}`, strings.Join(list, ","))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// unreachableHost returns the URL of a server that has been shut down.
+func unreachableHost() string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+func setModelPool(t *testing.T, urls ...string) {
+	t.Helper()
+	hosts := make([]ollama.Host, len(urls))
+	for i, u := range urls {
+		hosts[i] = ollama.Host{URL: u}
+	}
+	ollama.SetDefaultPool(ollama.NewPool(hosts, 0))
+	t.Cleanup(func() { ollama.SetDefaultPool(nil) })
+}
+
+func getAPIModels(t *testing.T, repo agent.AgentRepository) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/models", nil)
+	rec := httptest.NewRecorder()
+	handleAPIModels(repo)(rec, req.WithContext(auth.WithUserID(req.Context(), uuid.New())))
+	return rec
+}
+
+func TestAPIModelsReportsHostsAndMissingModels(t *testing.T) {
+	hostA := fakeModelHost(t, "llama3.2:latest", ollama.DefaultModel)
+	hostB := fakeModelHost(t, ollama.DefaultModel)
+	down := unreachableHost()
+	setModelPool(t, hostA, hostB, down)
+
+	repo := &fakeAgentRepo{agents: []*agent.AgentRecord{
+		{ID: "coder", Model: "llama3.2"},
+		{ID: "default"}, // default model
+		{ID: "writer", Model: "mistral"},
+		{ID: "reviewer", Model: "mistral"},
+	}}
+	rec := getAPIModels(t, repo)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp modelsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Models) != 2 {
+		t.Fatalf("models = %+v, want two", resp.Models)
+	}
+	llama, qwen := resp.Models[0], resp.Models[1]
+	if llama.Name != "llama3.2:latest" || !reflect.DeepEqual(llama.Hosts, []string{hostA}) || !reflect.DeepEqual(llama.Agents, []string{"coder"}) {
+		t.Errorf("llama = %+v, want on host A used by coder", llama)
+	}
+	if qwen.Name != ollama.DefaultModel || !reflect.DeepEqual(qwen.Hosts, []string{hostA, hostB}) || !reflect.DeepEqual(qwen.Agents, []string{"default"}) {
+		t.Errorf("qwen = %+v, want on both hosts used by default", qwen)
+	}
+
+	if len(resp.Missing) != 1 || resp.Missing[0].Name != "mistral" || len(resp.Missing[0].Agents) != 2 {
+		t.Errorf("missing = %+v, want mistral for writer and reviewer", resp.Missing)
+	}
+
+	if len(resp.Hosts) != 3 || !resp.Hosts[0].OK || !resp.Hosts[1].OK {
+		t.Fatalf("hosts = %+v, want A and B up", resp.Hosts)
+	}
+	if resp.Hosts[2].URL != down || resp.Hosts[2].OK || resp.Hosts[2].Error == "" {
+		t.Errorf("unreachable host = %+v, want not ok with an error", resp.Hosts[2])
+	}
+}
+
+func TestAPIModelsUnavailableWithoutReachableHost(t *testing.T) {
+	setModelPool(t, unreachableHost(), unreachableHost())
+	if rec := getAPIModels(t, &fakeAgentRepo{}); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
+)
+
+// serveRegenerate handles POST /contexts/{name}/messages/{id}/regenerate:
+// a new reply to the question behind message id (an assistant reply or the
+// user message itself), stored as a sibling of the old reply so the context
+// branches instead of being rewritten. The body is optional and may set
+// agent, verbosity and stream as for /chat.
+func serveRegenerate(w http.ResponseWriter, r *http.Request, historyStore chatStore, sched *executor.Scheduler, jobs *jobRegistry, tracker *usage.Tracker, userID, contextName string, messageID int64) {
+	var body struct {
+		Agent     string `json:"agent"`
+		Verbosity *int   `json:"verbosity"`
+		Stream    bool   `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tree, err := historyStore.LoadMessageTree(userID, contextName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	branch, ok := store.BranchTo(tree, messageID)
+	if !ok {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	i, ok := chat.RetryPoint(branch)
+	if !ok {
+		http.Error(w, "message has no question to answer", http.StatusBadRequest)
+		return
+	}
+	question := branch[i]
+
+	turn, status, err := resolveChatTurn(r.Context(), historyStore, userID, chatRequest{
+		Context:   contextName,
+		Agent:     body.Agent,
+		Verbosity: body.Verbosity,
+		Messages:  []chat.Message{{Role: question.Role, Content: question.Content}},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	turn.setHistory(branch[:i])
+	turn.Regenerate = true
+	turn.ParentID = store.ParentRef(question.ID)
+
+	serveChatTurn(w, r, historyStore, sched, jobs, tracker, turn, body.Stream)
+}
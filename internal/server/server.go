@@ -1,20 +1,31 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/earlysvahn/sidekick/internal/agent"
+	"github.com/earlysvahn/sidekick/internal/audit"
 	"github.com/earlysvahn/sidekick/internal/auth"
 	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/config"
 	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/logging"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+	"github.com/earlysvahn/sidekick/internal/notify"
+	"github.com/earlysvahn/sidekick/internal/ollama"
 	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
 )
 
 const DefaultAddr = "0.0.0.0:1337"
@@ -27,7 +38,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		}
 
 		// Handle preflight requests
@@ -40,51 +52,113 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Options carries optional server features configured at startup.
+type Options struct {
+	// OIDC enables /auth/oidc/* when non-nil.
+	OIDC *auth.OIDCProvider
+	// Metrics configures the Prometheus /metrics endpoint.
+	Metrics config.MetricsConfig
+	// Scheduler limits concurrent generations; zero values use defaults.
+	Scheduler config.SchedulerConfig
+	// Quota sets optional daily token quotas; zero means unlimited.
+	Quota config.QuotaConfig
+	// WebSocket lists extra origins allowed to open /ws/chat.
+	WebSocket config.WebSocketConfig
+}
+
 // Run starts the HTTP server
-func Run(modelOverride string, historyStore *store.PostgresStore, agentRepo agent.AgentRepository, db *sql.DB) error {
+func Run(modelOverride string, historyStore *store.PostgresStore, agentRepo agent.AgentRepository, db *sql.DB, opts Options) error {
 	// Explicitly bind to IPv4 to ensure LAN reachability on Windows/WSL2
 	listener, err := net.Listen("tcp4", DefaultAddr)
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(os.Stderr, "[sidekick] listening on %s\n", listener.Addr())
+	slog.Info("listening", "addr", listener.Addr().String())
+
+	// Ollama concurrency limits and fair queue for /execute and /chat
+	sched := executor.NewScheduler(opts.Scheduler)
+	jobs := newJobRegistry()
+	jobs.startSweeper()
+
+	// Token accounting and optional daily quotas
+	tracker := usage.NewTracker(db, opts.Quota)
 
 	// Auth routes (login and logout do not require an existing session)
 	loginLimiter := auth.NewLoginLimiter()
 	http.HandleFunc("/auth/login", auth.HandleLogin(db, loginLimiter))
+	http.HandleFunc("/auth/login/totp", auth.HandleLoginTOTP(db, loginLimiter))
+	if opts.OIDC != nil {
+		http.HandleFunc("/auth/oidc/login", auth.HandleOIDCLogin(opts.OIDC))
+		http.HandleFunc("/auth/oidc/callback", auth.HandleOIDCCallback(db, opts.OIDC))
+	}
 	http.HandleFunc("/auth/logout", auth.HandleLogout(db))
 	http.HandleFunc("/auth/me", auth.RequireAuth(db, auth.HandleMe(db)))
-
-	// Health probe (no auth)
+	http.HandleFunc("/auth/sessions", auth.RequireAuth(db, auth.HandleSessions(db)))
+	http.HandleFunc("/auth/sessions/", auth.RequireAuth(db, auth.HandleSession(db)))
+	http.HandleFunc("/auth/password", auth.RequireAuth(db, auth.HandleChangePassword(db)))
+	http.HandleFunc("/auth/totp/enroll", auth.RequireAuth(db, auth.HandleTOTPEnroll(db)))
+	http.HandleFunc("/auth/totp/verify", auth.RequireAuth(db, auth.HandleTOTPVerify(db)))
+	http.HandleFunc("/auth/totp/disable", auth.RequireAuth(db, auth.HandleTOTPDisable(db)))
+
+	// Health probes (no auth). /health is kept for older clients.
 	http.HandleFunc("/health", handleHealth)
+	http.HandleFunc("/health/live", handleHealth)
+	http.HandleFunc("/health/ready", handleHealthReady(db, agentRepo))
 
 	// All business routes require a valid session
-	http.HandleFunc("/execute", auth.RequireAuth(db, handleExecute(modelOverride, historyStore)))
-	http.HandleFunc("/chat", auth.RequireAuth(db, handleChat(historyStore)))
+	http.HandleFunc("/execute", auth.RequireAuth(db, handleExecute(modelOverride, historyStore, sched, tracker)))
+	http.HandleFunc("/chat", auth.RequireAuth(db, handleChat(historyStore, sched, jobs, tracker)))
+	http.HandleFunc("/chat/jobs/", auth.RequireAuth(db, handleChatJob(jobs)))
+	http.HandleFunc("/ws/chat", auth.RequireAuth(db, handleChatWS(historyStore, sched, jobs, tracker, opts.WebSocket.AllowedOrigins)))
 	http.HandleFunc("/api/chat", auth.RequireAuth(db, handleLegacyChat(historyStore)))
 	http.HandleFunc("/settings", auth.RequireAuth(db, handleSettings))
-	http.HandleFunc("/agents", auth.RequireAuth(db, handleAPIAgents(agentRepo)))
-	http.HandleFunc("/agents/", auth.RequireAuth(db, handleAPIAgent(agentRepo)))
-	http.HandleFunc("/api/agents", auth.RequireAuth(db, handleAPIAgents(agentRepo)))
-	http.HandleFunc("/api/agents/", auth.RequireAuth(db, handleAPIAgent(agentRepo)))
+	http.HandleFunc("/agents", auth.RequireAuth(db, handleAPIAgents(agentRepo, db)))
+	http.HandleFunc("/agents/", auth.RequireAuth(db, handleAPIAgent(agentRepo, db)))
+	http.HandleFunc("/api/agents", auth.RequireAuth(db, handleAPIAgents(agentRepo, db)))
+	http.HandleFunc("/api/agents/", auth.RequireAuth(db, handleAPIAgent(agentRepo, db)))
+	http.HandleFunc("/api/usage", auth.RequireAuth(db, handleAPIUsage(db, tracker)))
+	http.HandleFunc("/api/models", auth.RequireAuth(db, handleAPIModels(agentRepo)))
 	http.HandleFunc("/api/contexts", auth.RequireAuth(db, handleAPIContexts(historyStore)))
-	http.HandleFunc("/api/contexts/", auth.RequireAuth(db, handleAPIContext(historyStore)))
+	http.HandleFunc("/api/contexts/", auth.RequireAuth(db, handleAPIContext(historyStore, db)))
 	http.HandleFunc("/contexts", auth.RequireAuth(db, handleContexts(historyStore)))
-	http.HandleFunc("/contexts/", auth.RequireAuth(db, handleContextRoutes(historyStore)))
+	http.HandleFunc("/contexts/", auth.RequireAuth(db, handleContextRoutes(historyStore, db, sched, jobs, tracker)))
 	http.HandleFunc("/verbosity/keywords", auth.RequireAuth(db, handleVerbosityKeywords(historyStore)))
 	http.HandleFunc("/verbosity/keywords/", auth.RequireAuth(db, handleVerbosityKeyword(historyStore)))
+	http.HandleFunc("/verbosity/resolve", auth.RequireAuth(db, handleVerbosityResolve(historyStore)))
+
+	// Admin routes
+	http.HandleFunc("/admin/users", auth.RequireAdmin(db, handleAdminUsers(db)))
+	http.HandleFunc("/admin/users/", auth.RequireAdmin(db, handleAdminUserRoutes(db, agentRepo)))
+	http.HandleFunc("/admin/audit", auth.RequireAdmin(db, handleAdminAudit(db)))
+
+	// Prometheus scrape endpoint (no session; optional bearer token)
+	if !opts.Metrics.Disabled {
+		http.Handle("/metrics", requireMetricsToken(opts.Metrics.Token, metrics.Handler()))
+	}
 
-	// Wrap default mux with CORS middleware
-	handler := corsMiddleware(http.DefaultServeMux)
+	// Wrap default mux with request logging, metrics and CORS middleware
+	handler := logging.Middleware(metrics.Middleware(http.DefaultServeMux, corsMiddleware(http.DefaultServeMux)))
 
 	return http.Serve(listener, handler)
 }
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
+// requireMetricsToken guards /metrics with a static bearer token when one is
+// configured.
+func requireMetricsToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordLister) http.HandlerFunc {
+func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordLister, sched *executor.Scheduler, tracker *usage.Tracker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -126,7 +200,7 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 		}
 
 		lastUserMessage := latestUserMessage(req.Messages)
-		escalationResult, err := executor.ResolveVerbosity(r.Context(), req.Verbosity, executor.DefaultVerbosity(), agentID, lastUserMessage, userID.String(), keywordStore)
+		escalationResult, err := executor.ResolveVerbosity(r.Context(), req.Verbosity, executor.DefaultVerbosity(), agentID, profile, lastUserMessage, userID.String(), keywordStore)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -144,17 +218,29 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 
 		messages := applyVerbosityConstraint(buildChatMessages(systemPrompt, nil, req.Messages), verbosity)
 
+		ctx := r.Context()
 		logf := func(msg string) {
-			fmt.Fprintf(os.Stderr, "[sidekick] %s\n", msg)
+			slog.DebugContext(ctx, msg)
 		}
 
-		// Log incoming request
+		annotateGeneration(ctx, agentID, model, verbosity, escalationResult)
 		if len(messages) > 0 {
 			lastMsg := messages[len(messages)-1]
-			logf(fmt.Sprintf("received request: %d messages, last=%q", len(req.Messages), lastMsg.Content))
+			slog.DebugContext(ctx, "execute request", "messages", len(req.Messages), logging.Prompt("last", lastMsg.Content))
 		}
 
+		if !checkQuota(w, tracker, userID.String()) {
+			return
+		}
+
+		ticket, ok := enqueueGeneration(w, sched, model, userID.String())
+		if !ok {
+			return
+		}
+		defer ticket.Release()
+
 		var reply string
+		var tokens executor.Usage
 
 		if req.Stream {
 			// Streaming path
@@ -164,6 +250,8 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 				return
 			}
 
+			defer metrics.StreamStarted()()
+
 			// Set SSE headers immediately
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -190,6 +278,11 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 				flusher.Flush()
 			}
 
+			// Wait for a generation slot, reporting queue position
+			if err := ticket.Wait(r.Context(), sseQueuedProgress(w, flusher)); err != nil {
+				return
+			}
+
 			// Compute token budget before model execution
 			tokenBudget := executor.EstimateTokenBudget(messages, verbosity)
 
@@ -209,7 +302,7 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 
 			// Regression guard: fail if no SSE event sent before model execution
 			if !eventSent {
-				fmt.Fprintf(os.Stderr, "[sidekick] CRITICAL: No SSE event sent before model execution\n")
+				slog.ErrorContext(r.Context(), "no SSE event sent before model execution")
 				http.Error(w, "streaming pipeline failure: no events sent", http.StatusInternalServerError)
 				return
 			}
@@ -227,8 +320,9 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 				return nil
 			}
 
-			reply, err = (&executor.OllamaExecutor{Model: model, Log: logf, Verbosity: verbosity}).ExecuteStreaming(messages, onDelta)
+			reply, tokens, err = (&executor.OllamaExecutor{Model: model, Log: logf, Verbosity: verbosity}).ExecuteStreamingWithUsage(messages, onDelta)
 			if err != nil {
+				notifyGenerationFailed(r.Context(), userID.String(), agentID, model, err)
 				// Can't use http.Error after headers sent
 				errPayload, _ := json.Marshal(map[string]any{
 					"type":  "error",
@@ -239,6 +333,8 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 				return
 			}
 
+			tracker.Record(usage.Entry{UserID: userID.String(), Agent: agentID, Model: ollama.SelectedModel(model), PromptTokens: tokens.PromptTokens, CompletionTokens: tokens.CompletionTokens})
+
 			// Send "finalizing" progress event
 			finalizingPayload, _ := json.Marshal(map[string]any{
 				"stage": "finalizing",
@@ -248,7 +344,9 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 
 			// Send final done event
 			finalPayload, _ := json.Marshal(map[string]any{
-				"done": true,
+				"done":  true,
+				"model": ollama.SelectedModel(model),
+				"usage": tokens,
 			})
 			fmt.Fprintf(w, "data: %s\n\n", finalPayload)
 			flusher.Flush()
@@ -256,14 +354,19 @@ func handleExecute(modelOverride string, keywordStore store.VerbosityKeywordList
 		}
 
 		// Non-streaming path
-		reply, err = (&executor.OllamaExecutor{Model: model, Log: logf, Verbosity: verbosity}).Execute(messages)
+		if err := ticket.Wait(r.Context(), nil); err != nil {
+			return
+		}
+		reply, tokens, err = (&executor.OllamaExecutor{Model: model, Log: logf, Verbosity: verbosity}).ExecuteWithUsage(messages)
 		if err != nil {
+			notifyGenerationFailed(r.Context(), userID.String(), agentID, model, err)
 			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
 		}
+		tracker.Record(usage.Entry{UserID: userID.String(), Agent: agentID, Model: ollama.SelectedModel(model), PromptTokens: tokens.PromptTokens, CompletionTokens: tokens.CompletionTokens})
 
 		w.Header().Set("Content-Type", "application/json")
-		resp := map[string]any{"reply": reply}
+		resp := map[string]any{"reply": reply, "model": ollama.SelectedModel(model), "usage": tokens}
 		if warning != "" {
 			resp["warning"] = warning
 		}
@@ -346,7 +449,7 @@ func handleLegacyChat(historyStore *store.PostgresStore) http.HandlerFunc {
 	}
 }
 
-func handleChat(historyStore *store.PostgresStore) http.HandlerFunc {
+func handleChat(historyStore chatStore, sched *executor.Scheduler, jobs *jobRegistry, tracker *usage.Tracker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -359,330 +462,23 @@ func handleChat(historyStore *store.PostgresStore) http.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			Context   string         `json:"context"`
-			Agent     string         `json:"agent"`
-			Verbosity *int           `json:"verbosity"`
-			Messages  []chat.Message `json:"messages"`
-			Stream    bool           `json:"stream"`
-		}
+		var req chatRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid JSON", http.StatusBadRequest)
 			return
 		}
 
-		contextName := strings.TrimSpace(req.Context)
-		if contextName == "" {
-			http.Error(w, "context required", http.StatusBadRequest)
-			return
-		}
-		if len(req.Messages) == 0 {
-			http.Error(w, "messages required", http.StatusBadRequest)
-			return
-		}
-		defaultAgent := "default"
-		defaultVerbosity := executor.DefaultVerbosity()
-
-		contextMeta, hasContext, err := historyStore.GetContextMeta(userID.String(), contextName)
+		turn, status, err := prepareChatTurn(r.Context(), historyStore, userID.String(), req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), status)
 			return
 		}
 
-		agentName := strings.TrimSpace(req.Agent)
-		if agentName == "" {
-			if hasContext && strings.TrimSpace(contextMeta.Agent) != "" {
-				agentName = contextMeta.Agent
-			} else {
-				agentName = defaultAgent
-			}
-		}
-
-		warning := ""
-		profile := agent.GetProfileForUser(userID.String(), agentName)
-		if profile == nil {
-			warning = fmt.Sprintf("agent %q not found or not assigned; falling back to %q", agentName, defaultAgent)
-			agentName = defaultAgent
-			profile = agent.GetProfileForUser(userID.String(), agentName)
-		}
-		verbosityInput := req.Verbosity
-		if verbosityInput == nil && hasContext {
-			verbosityInput = &contextMeta.Verbosity
-		}
-		lastUserMessage := latestUserMessage(req.Messages)
-		escalationResult, err := executor.ResolveVerbosity(r.Context(), verbosityInput, defaultVerbosity, agentName, lastUserMessage, userID.String(), historyStore)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		verbosity := escalationResult.EffectiveVerbosity
-		warning = joinWarnings(warning, escalationResult.Warning)
-
-		systemPrompt := ""
-		model := ""
-		if profile != nil {
-			systemPrompt = profile.SystemPrompt
-			model = profile.LocalModel
-		}
-		if constraint := executor.SystemConstraint(verbosity); constraint != "" {
-			if systemPrompt != "" {
-				systemPrompt = systemPrompt + "\n\n" + constraint
-			} else {
-				systemPrompt = constraint
-			}
-		}
-
-		ctxHist, err := historyStore.LoadContext(userID.String(), contextName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		execMessages := buildChatMessages(systemPrompt, ctxHist.Messages, req.Messages)
-
-		var reply string
-
-		if req.Stream {
-			// Streaming path: send events in real-time
-			flusher, ok := w.(http.Flusher)
-			if !ok {
-				http.Error(w, "streaming not supported", http.StatusInternalServerError)
-				return
-			}
-
-			// Set SSE headers immediately
-			w.Header().Set("Content-Type", "text/event-stream")
-			w.Header().Set("Cache-Control", "no-cache")
-			w.Header().Set("Connection", "keep-alive")
-
-			// Track whether we've sent at least one SSE event (regression guard)
-			eventSent := false
-
-			// Send "planning" progress event immediately
-			planningPayload, _ := json.Marshal(map[string]any{
-				"stage": "planning",
-			})
-			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", planningPayload)
-			flusher.Flush()
-			eventSent = true
-
-			// Send escalation info event immediately if warnings occurred
-			if warning != "" {
-				infoPayload, _ := json.Marshal(map[string]any{
-					"type":    "info",
-					"message": warning,
-				})
-				fmt.Fprintf(w, "data: %s\n\n", infoPayload)
-				flusher.Flush()
-			}
-
-			// Compute token budget before model execution
-			tokenBudget := executor.EstimateTokenBudget(execMessages, verbosity)
-
-			// Send "generating" progress event with escalation details
-			generatingData := map[string]any{
-				"stage":               "generating",
-				"effective_verbosity": verbosity,
-				"token_budget":        tokenBudget.TotalEstimatedTokens,
-				"escalated":           escalationResult.Escalated,
-			}
-			if len(escalationResult.MatchedKeywords) > 0 {
-				generatingData["reason"] = escalationResult.MatchedKeywords
-			}
-			generatingPayload, _ := json.Marshal(generatingData)
-			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", generatingPayload)
-			flusher.Flush()
-
-			// Regression guard: fail if no SSE event sent before model execution
-			if !eventSent {
-				fmt.Fprintf(os.Stderr, "[sidekick] CRITICAL: No SSE event sent before model execution\n")
-				http.Error(w, "streaming pipeline failure: no events sent", http.StatusInternalServerError)
-				return
-			}
-
-			// Stream tokens as they arrive from Ollama
-			onDelta := func(delta string) error {
-				deltaPayload, err := json.Marshal(map[string]any{
-					"delta": delta,
-				})
-				if err != nil {
-					return err
-				}
-				fmt.Fprintf(w, "data: %s\n\n", deltaPayload)
-				flusher.Flush()
-				return nil
-			}
-
-			reply, err = (&executor.OllamaExecutor{Model: model, Verbosity: verbosity}).ExecuteStreaming(execMessages, onDelta)
-			if err != nil {
-				// Can't use http.Error after headers sent
-				errPayload, _ := json.Marshal(map[string]any{
-					"type":  "error",
-					"error": err.Error(),
-				})
-				fmt.Fprintf(w, "data: %s\n\n", errPayload)
-				flusher.Flush()
-				return
-			}
-
-			// Persist to DB after streaming completes
-			userTime := time.Now().UTC()
-			stored := make([]store.Message, 0, len(req.Messages)+1)
-			for _, msg := range req.Messages {
-				var agentNamePtr *string
-				var verbosityPtr *int
-				if msg.Role == "assistant" {
-					agentNamePtr = &agentName
-					verbosityPtr = &verbosity
-				}
-				stored = append(stored, store.Message{
-					Role:      msg.Role,
-					Content:   msg.Content,
-					Agent:     agentNamePtr,
-					Verbosity: verbosityPtr,
-					Time:      userTime,
-				})
-			}
-			assistantTime := time.Now().UTC()
-			stored = append(stored, store.Message{
-				Role:      "assistant",
-				Content:   reply,
-				Agent:     &agentName,
-				Verbosity: &verbosity,
-				Time:      assistantTime,
-			})
-
-			if err := historyStore.AppendMessagesWithMeta(userID.String(), contextName, agentName, verbosity, stored); err != nil {
-				// Log error but can't return it after headers sent
-				fmt.Fprintf(os.Stderr, "[sidekick] failed to persist messages: %v\n", err)
-			}
-
-			// Auto-rename context based on first message
-			if len(ctxHist.Messages) == 0 && len(req.Messages) > 0 {
-				firstUserMsg := ""
-				for _, msg := range req.Messages {
-					if msg.Role == "user" {
-						firstUserMsg = msg.Content
-						break
-					}
-				}
-
-				if firstUserMsg != "" {
-					newName := autoGenerateContextName(firstUserMsg, model)
-					if newName != "" && newName != contextName {
-						// Attempt to rename - ignore errors to not block the response
-						if updated, err := historyStore.UpdateContext(userID.String(), contextName, &newName, nil, nil); err == nil {
-							contextName = updated.Name
-						}
-					}
-				}
-			}
-
-			// Send "finalizing" progress event
-			finalizingPayload, _ := json.Marshal(map[string]any{
-				"stage": "finalizing",
-			})
-			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", finalizingPayload)
-			flusher.Flush()
-
-			// Send final done event
-			finalPayload, _ := json.Marshal(map[string]any{
-				"done": true,
-				"context": map[string]any{
-					"name":      contextName,
-					"agent":     agentName,
-					"verbosity": verbosity,
-				},
-			})
-			fmt.Fprintf(w, "data: %s\n\n", finalPayload)
-			flusher.Flush()
-			return
-		}
-
-		// Non-streaming path
-		reply, err = (&executor.OllamaExecutor{Model: model, Verbosity: verbosity}).Execute(execMessages)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		userTime := time.Now().UTC()
-		stored := make([]store.Message, 0, len(req.Messages)+1)
-		for _, msg := range req.Messages {
-			var agentNamePtr *string
-			var verbosityPtr *int
-			if msg.Role == "assistant" {
-				agentNamePtr = &agentName
-				verbosityPtr = &verbosity
-			}
-			stored = append(stored, store.Message{
-				Role:      msg.Role,
-				Content:   msg.Content,
-				Agent:     agentNamePtr,
-				Verbosity: verbosityPtr,
-				Time:      userTime,
-			})
-		}
-		assistantTime := time.Now().UTC()
-		stored = append(stored, store.Message{
-			Role:      "assistant",
-			Content:   reply,
-			Agent:     &agentName,
-			Verbosity: &verbosity,
-			Time:      assistantTime,
-		})
-
-		if err := historyStore.AppendMessagesWithMeta(userID.String(), contextName, agentName, verbosity, stored); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Auto-rename context based on first message
-		if len(ctxHist.Messages) == 0 && len(req.Messages) > 0 {
-			firstUserMsg := ""
-			for _, msg := range req.Messages {
-				if msg.Role == "user" {
-					firstUserMsg = msg.Content
-					break
-				}
-			}
-
-			if firstUserMsg != "" {
-				newName := autoGenerateContextName(firstUserMsg, model)
-				if newName != "" && newName != contextName {
-					// Attempt to rename - ignore errors to not block the response
-					if updated, err := historyStore.UpdateContext(userID.String(), contextName, &newName, nil, nil); err == nil {
-						contextName = updated.Name
-					}
-				}
-			}
-		}
-
-		type contextResponse struct {
-			Name      string `json:"name"`
-			Agent     string `json:"agent"`
-			Verbosity int    `json:"verbosity"`
-		}
-		type response struct {
-			Reply   string          `json:"reply"`
-			Context contextResponse `json:"context"`
-			Warning string          `json:"warning,omitempty"`
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(response{
-			Reply: reply,
-			Context: contextResponse{
-				Name:      contextName,
-				Agent:     agentName,
-				Verbosity: verbosity,
-			},
-			Warning: warning,
-		})
+		serveChatTurn(w, r, historyStore, sched, jobs, tracker, turn, req.Stream)
 	}
 }
 
-func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
+func handleAPIAgents(agentRepo agent.AgentRepository, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if agentRepo == nil {
 			http.Error(w, "agent repository not configured", http.StatusInternalServerError)
@@ -727,6 +523,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 				Model            string  `json:"model"`
 				SystemPrompt     string  `json:"system_prompt"`
 				DefaultVerbosity int     `json:"default_verbosity"`
+				VerbosityBias    int     `json:"verbosity_bias"`
+				MinVerbosity     int     `json:"min_verbosity"`
+				MaxVerbosity     *int    `json:"max_verbosity"`
 				Enabled          bool    `json:"enabled"`
 				Revision         int     `json:"revision"`
 				UpdatedAt        string  `json:"updated_at"`
@@ -741,6 +540,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 					Model:            a.Model,
 					SystemPrompt:     a.SystemPrompt,
 					DefaultVerbosity: a.DefaultVerbosity,
+					VerbosityBias:    a.VerbosityBias,
+					MinVerbosity:     a.MinVerbosity,
+					MaxVerbosity:     a.MaxVerbosity,
 					Enabled:          a.Enabled,
 					Revision:         a.Revision,
 					UpdatedAt:        a.UpdatedAt.UTC().Format(time.RFC3339),
@@ -763,6 +565,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 				Model            string  `json:"model"`
 				SystemPrompt     string  `json:"system_prompt"`
 				DefaultVerbosity *int    `json:"default_verbosity"`
+				VerbosityBias    int     `json:"verbosity_bias"`
+				MinVerbosity     int     `json:"min_verbosity"`
+				MaxVerbosity     *int    `json:"max_verbosity"`
 				Enabled          *bool   `json:"enabled"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -789,6 +594,11 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
+				auth.RecordAudit(db, r, audit.Event{
+					Action:     audit.ActionAgentAssign,
+					TargetType: audit.TargetAgent,
+					TargetID:   input.ID,
+				})
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusOK)
@@ -799,6 +609,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 					"model":             existing.Model,
 					"system_prompt":     existing.SystemPrompt,
 					"default_verbosity": existing.DefaultVerbosity,
+					"verbosity_bias":    existing.VerbosityBias,
+					"min_verbosity":     existing.MinVerbosity,
+					"max_verbosity":     existing.MaxVerbosity,
 					"enabled":           existing.Enabled,
 					"revision":          existing.Revision,
 					"updated_at":        existing.UpdatedAt.UTC().Format(time.RFC3339),
@@ -823,6 +636,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 				Model:            input.Model,
 				SystemPrompt:     input.SystemPrompt,
 				DefaultVerbosity: verbosity,
+				VerbosityBias:    input.VerbosityBias,
+				MinVerbosity:     input.MinVerbosity,
+				MaxVerbosity:     input.MaxVerbosity,
 				Enabled:          enabled,
 			}
 
@@ -836,6 +652,12 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionAgentCreate,
+				TargetType: audit.TargetAgent,
+				TargetID:   newAgent.ID,
+				Diff:       audit.Diff(nil, newAgent),
+			})
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusCreated)
@@ -846,6 +668,9 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 				"model":             newAgent.Model,
 				"system_prompt":     newAgent.SystemPrompt,
 				"default_verbosity": newAgent.DefaultVerbosity,
+				"verbosity_bias":    newAgent.VerbosityBias,
+				"min_verbosity":     newAgent.MinVerbosity,
+				"max_verbosity":     newAgent.MaxVerbosity,
 				"enabled":           newAgent.Enabled,
 				"revision":          newAgent.Revision,
 				"updated_at":        newAgent.UpdatedAt.UTC().Format(time.RFC3339),
@@ -856,7 +681,7 @@ func handleAPIAgents(agentRepo agent.AgentRepository) http.HandlerFunc {
 	}
 }
 
-func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
+func handleAPIAgent(agentRepo agent.AgentRepository, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if agentRepo == nil {
 			http.Error(w, "agent repository not configured", http.StatusInternalServerError)
@@ -913,6 +738,9 @@ func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
 				"model":             a.Model,
 				"system_prompt":     a.SystemPrompt,
 				"default_verbosity": a.DefaultVerbosity,
+				"verbosity_bias":    a.VerbosityBias,
+				"min_verbosity":     a.MinVerbosity,
+				"max_verbosity":     a.MaxVerbosity,
 				"enabled":           a.Enabled,
 				"revision":          a.Revision,
 				"updated_at":        a.UpdatedAt.UTC().Format(time.RFC3339),
@@ -934,8 +762,9 @@ func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
 				return
 			}
 
-			// Check if user has access to this agent
-			assigned, err := pgRepo.IsAssignedToUser(userID.String(), id)
+			// Check if user has access to this agent, keeping the current
+			// user-level flag for the audit diff
+			wasEnabled, assigned, err := pgRepo.UserAgentEnabled(userID.String(), id)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -965,6 +794,12 @@ func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
 						http.Error(w, err.Error(), http.StatusInternalServerError)
 						return
 					}
+					auth.RecordAudit(db, r, audit.Event{
+						Action:     audit.ActionAgentUpdate,
+						TargetType: audit.TargetAgent,
+						TargetID:   id,
+						Diff:       audit.Diff(map[string]any{"user_enabled": wasEnabled}, map[string]any{"user_enabled": val}),
+					})
 
 					// Return the agent with updated user-level enabled flag
 					a, err := agentRepo.Get(id)
@@ -981,6 +816,9 @@ func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
 						"model":             a.Model,
 						"system_prompt":     a.SystemPrompt,
 						"default_verbosity": a.DefaultVerbosity,
+						"verbosity_bias":    a.VerbosityBias,
+						"min_verbosity":     a.MinVerbosity,
+						"max_verbosity":     a.MaxVerbosity,
 						"enabled":           a.Enabled,
 						"revision":          a.Revision,
 						"updated_at":        a.UpdatedAt.UTC().Format(time.RFC3339),
@@ -1010,6 +848,11 @@ func handleAPIAgent(agentRepo agent.AgentRepository) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionAgentUnassign,
+				TargetType: audit.TargetAgent,
+				TargetID:   id,
+			})
 			w.WriteHeader(http.StatusNoContent)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1058,7 +901,7 @@ func handleAPIContexts(historyStore *store.PostgresStore) http.HandlerFunc {
 	}
 }
 
-func handleAPIContext(historyStore *store.PostgresStore) http.HandlerFunc {
+func handleAPIContext(historyStore *store.PostgresStore, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := auth.UserIDFromContext(r.Context())
 		if !ok {
@@ -1089,6 +932,7 @@ func handleAPIContext(historyStore *store.PostgresStore) http.HandlerFunc {
 				return
 			}
 
+			before, _, _ := historyStore.GetContextMeta(userID.String(), name)
 			updated, err := historyStore.UpdateContext(userID.String(), name, req.Name, req.Agent, req.Verbosity)
 			if err != nil {
 				if err == sql.ErrNoRows {
@@ -1102,6 +946,12 @@ func handleAPIContext(historyStore *store.PostgresStore) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionContextUpdate,
+				TargetType: audit.TargetContext,
+				TargetID:   updated.Name,
+				Diff:       contextDiff(before, updated),
+			})
 
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]any{
@@ -1118,6 +968,11 @@ func handleAPIContext(historyStore *store.PostgresStore) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionContextDelete,
+				TargetType: audit.TargetContext,
+				TargetID:   name,
+			})
 			w.WriteHeader(http.StatusNoContent)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1166,7 +1021,7 @@ func handleContexts(historyStore *store.PostgresStore) http.HandlerFunc {
 	}
 }
 
-func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
+func handleContextRoutes(historyStore *store.PostgresStore, db *sql.DB, sched *executor.Scheduler, jobs *jobRegistry, tracker *usage.Tracker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := auth.UserIDFromContext(r.Context())
 		if !ok {
@@ -1181,6 +1036,26 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 			return
 		}
 
+		// POST /contexts/{name}/messages/{id}/regenerate
+		if rest, ok := strings.CutSuffix(path, "/regenerate"); ok {
+			sep := strings.LastIndex(rest, "/messages/")
+			if sep <= 0 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			messageID, err := strconv.ParseInt(rest[sep+len("/messages/"):], 10, 64)
+			if err != nil {
+				http.Error(w, "invalid message id", http.StatusBadRequest)
+				return
+			}
+			serveRegenerate(w, r, historyStore, sched, jobs, tracker, userID.String(), rest[:sep], messageID)
+			return
+		}
+
 		if strings.HasSuffix(path, "/messages") {
 			if r.Method != http.MethodGet {
 				w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1205,11 +1080,21 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 			}
 
 			type messageResponse struct {
-				Role      string  `json:"role"`
-				Content   string  `json:"content"`
-				Agent     *string `json:"agent,omitempty"`
-				Verbosity *int    `json:"verbosity,omitempty"`
-				CreatedAt string  `json:"created_at"`
+				ID               int64    `json:"id"`
+				ParentID         *int64   `json:"parent_id,omitempty"`
+				Role             string   `json:"role"`
+				Content          string   `json:"content"`
+				Agent            *string  `json:"agent,omitempty"`
+				Verbosity        *int     `json:"verbosity,omitempty"`
+				CreatedAt        string   `json:"created_at"`
+				Incomplete       bool     `json:"incomplete,omitempty"`
+				Model            string   `json:"model,omitempty"`
+				Source           string   `json:"source,omitempty"`
+				Keywords         []string `json:"keywords,omitempty"`
+				PromptTokens     int      `json:"prompt_tokens,omitempty"`
+				CompletionTokens int      `json:"completion_tokens,omitempty"`
+				LatencyMS        int64    `json:"latency_ms,omitempty"`
+				Files            []string `json:"files,omitempty"`
 			}
 
 			response := make([]messageResponse, 0, len(ctxHist.Messages))
@@ -1221,11 +1106,21 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 					verbosity = msg.Verbosity
 				}
 				response = append(response, messageResponse{
-					Role:      msg.Role,
-					Content:   msg.Content,
-					Agent:     agentName,
-					Verbosity: verbosity,
-					CreatedAt: msg.Time.UTC().Format(time.RFC3339),
+					ID:               msg.ID,
+					ParentID:         msg.ParentID,
+					Role:             msg.Role,
+					Content:          msg.Content,
+					Agent:            agentName,
+					Verbosity:        verbosity,
+					CreatedAt:        msg.Time.UTC().Format(time.RFC3339),
+					Incomplete:       msg.Incomplete,
+					Model:            msg.Model,
+					Source:           msg.Source,
+					Keywords:         msg.Keywords,
+					PromptTokens:     msg.PromptTokens,
+					CompletionTokens: msg.CompletionTokens,
+					LatencyMS:        msg.LatencyMS,
+					Files:            msg.Files,
 				})
 			}
 
@@ -1251,6 +1146,7 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 				return
 			}
 
+			before, _, _ := historyStore.GetContextMeta(userID.String(), contextName)
 			updated, err := historyStore.UpdateContext(userID.String(), contextName, req.Name, req.Agent, req.Verbosity)
 			if err != nil {
 				if err == sql.ErrNoRows {
@@ -1264,6 +1160,12 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionContextUpdate,
+				TargetType: audit.TargetContext,
+				TargetID:   updated.Name,
+				Diff:       contextDiff(before, updated),
+			})
 
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]any{
@@ -1280,6 +1182,11 @@ func handleContextRoutes(historyStore *store.PostgresStore) http.HandlerFunc {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			auth.RecordAudit(db, r, audit.Event{
+				Action:     audit.ActionContextDelete,
+				TargetType: audit.TargetContext,
+				TargetID:   contextName,
+			})
 			w.WriteHeader(http.StatusNoContent)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1315,6 +1222,88 @@ func buildChatMessages(system string, history []store.Message, incoming []chat.M
 	return messages
 }
 
+// contextDiff returns the audit diff of a context's user-editable fields.
+func contextDiff(before, after store.ContextInfo) map[string]any {
+	fields := func(c store.ContextInfo) map[string]any {
+		return map[string]any{"name": c.Name, "agent": c.Agent, "verbosity": c.Verbosity}
+	}
+	return audit.Diff(fields(before), fields(after))
+}
+
+// notifyGenerationFailed logs the failure and emits a generation_failed event.
+// Events are keyed by model so a failing model does not flood sinks during the
+// notify cooldown.
+func notifyGenerationFailed(ctx context.Context, userID, agentName, model string, err error) {
+	slog.ErrorContext(ctx, "generation failed", "agent", agentName, "model", ollama.SelectedModel(model), "err", err)
+	notify.Send(notify.Event{
+		Type:    notify.EventGenerationFailed,
+		Title:   "Generation failed",
+		Message: err.Error(),
+		Fields: map[string]string{
+			"user_id": userID,
+			"agent":   agentName,
+			"model":   ollama.SelectedModel(model),
+		},
+		Key: ollama.SelectedModel(model),
+	})
+}
+
+// enqueueGeneration reserves a place in the scheduler for a generation.
+// When the queue is full it writes 429 and returns false.
+func enqueueGeneration(w http.ResponseWriter, sched *executor.Scheduler, model, userID string) (*executor.Ticket, bool) {
+	ticket, err := sched.Enqueue(model, userID)
+	if errors.Is(err, executor.ErrQueueFull) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "too many pending generations, try again later", http.StatusTooManyRequests)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return ticket, true
+}
+
+// checkQuota rejects the request with 429 when userID has used up their
+// daily token quota.
+func checkQuota(w http.ResponseWriter, tracker *usage.Tracker, userID string) bool {
+	err := tracker.Check(userID)
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(tracker.UntilReset().Seconds())+1))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// sseQueuedProgress returns a queue position callback that emits a
+// "queued" progress event for each position change.
+func sseQueuedProgress(w http.ResponseWriter, flusher http.Flusher) func(int) {
+	return func(position int) {
+		payload, _ := json.Marshal(map[string]any{
+			"stage":    "queued",
+			"position": position,
+		})
+		fmt.Fprintf(w, "event: progress\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+}
+
+// annotateGeneration adds the resolved agent, model and verbosity to the
+// request's access log line.
+func annotateGeneration(ctx context.Context, agentID, model string, verbosity int, escalation executor.EscalationResult) {
+	logging.Annotate(ctx, "agent", agentID)
+	logging.Annotate(ctx, "model", ollama.SelectedModel(model))
+	logging.Annotate(ctx, "verbosity", verbosity)
+	if escalation.Escalated {
+		logging.Annotate(ctx, "escalated", true)
+	}
+}
+
 func normalizeVerbosity(input *int, defaultLevel int) (int, string) {
 	if input == nil {
 		return defaultLevel, ""
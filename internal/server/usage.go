@@ -0,0 +1,163 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/usage"
+	"github.com/google/uuid"
+)
+
+// defaultUsageDays is the window GET /api/usage reports without since.
+const defaultUsageDays = 30
+
+// handleAPIUsage handles GET /api/usage: token usage aggregated by day,
+// agent, model and (admins only) user. Users see their own usage; admins
+// may pass user=<id|email> or user=all.
+func handleAPIUsage(db *sql.DB, tracker *usage.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		filter := usage.Filter{UserID: userID.String()}
+
+		if who := strings.TrimSpace(q.Get("user")); who != "" && who != userID.String() {
+			caller, err := auth.GetUserByID(db, userID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if caller == nil || !caller.IsAdmin() {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			switch {
+			case who == "all":
+				filter.UserID = ""
+			case strings.Contains(who, "@"):
+				u, err := auth.GetUserByEmail(db, who)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if u == nil {
+					http.Error(w, "user not found", http.StatusNotFound)
+					return
+				}
+				filter.UserID = u.ID.String()
+			default:
+				id, err := uuid.Parse(who)
+				if err != nil {
+					http.Error(w, "user must be a user ID, email or \"all\"", http.StatusBadRequest)
+					return
+				}
+				filter.UserID = id.String()
+			}
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		filter.Until = today
+		filter.Since = today.AddDate(0, 0, -(defaultUsageDays - 1))
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &filter.Since}, {"until", &filter.Until}} {
+			if v := q.Get(p.name); v != "" {
+				t, err := time.Parse("2006-01-02", v)
+				if err != nil {
+					http.Error(w, p.name+" must be YYYY-MM-DD", http.StatusBadRequest)
+					return
+				}
+				*p.dst = t
+			}
+		}
+
+		groupBy := "day"
+		if q.Has("group_by") {
+			groupBy = q.Get("group_by")
+		}
+		dims, err := usage.ParseGroupBy(groupBy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if dims == nil {
+			dims = []string{}
+		}
+		filter.GroupBy = dims
+
+		rows, err := usage.Query(db, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rows == nil {
+			rows = []usage.Row{}
+		}
+		var totals usage.Row
+		for _, row := range rows {
+			totals.Requests += row.Requests
+			totals.PromptTokens += row.PromptTokens
+			totals.CompletionTokens += row.CompletionTokens
+			totals.TotalTokens += row.TotalTokens
+		}
+
+		type quotaResponse struct {
+			DailyTokens     int `json:"daily_tokens"`
+			UsedToday       int `json:"used_today"`
+			ResetsInSeconds int `json:"resets_in_seconds"`
+		}
+		type response struct {
+			Since   string         `json:"since"`
+			Until   string         `json:"until"`
+			GroupBy []string       `json:"group_by"`
+			Rows    []usage.Row    `json:"rows"`
+			Totals  usage.Row      `json:"totals"`
+			Quota   *quotaResponse `json:"quota,omitempty"`
+		}
+		resp := response{
+			Since:   filter.Since.Format("2006-01-02"),
+			Until:   filter.Until.Format("2006-01-02"),
+			GroupBy: dims,
+			Rows:    rows,
+			Totals:  totals,
+		}
+
+		// Quota status for a single user
+		if filter.UserID != "" {
+			limit, err := tracker.Limit(filter.UserID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if limit > 0 {
+				used, err := tracker.UsedToday(filter.UserID)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				resp.Quota = &quotaResponse{
+					DailyTokens:     limit,
+					UsedToday:       used,
+					ResetsInSeconds: int(tracker.UntilReset().Seconds()),
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/earlysvahn/sidekick/internal/agent"
 	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/executor"
 	"github.com/earlysvahn/sidekick/internal/store"
 )
 
@@ -32,25 +34,9 @@ func handleVerbosityKeywords(keywordStore store.VerbosityKeywordStore) http.Hand
 				return
 			}
 
-			type keywordResponse struct {
-				Keyword      string  `json:"keyword"`
-				Agent        *string `json:"agent,omitempty"`
-				MinRequested int     `json:"min_requested"`
-				EscalateTo   int     `json:"escalate_to"`
-				Enabled      bool    `json:"enabled"`
-				CreatedAt    string  `json:"created_at"`
-			}
-
 			resp := make([]keywordResponse, 0, len(keywords))
 			for _, kw := range keywords {
-				resp = append(resp, keywordResponse{
-					Keyword:      kw.Keyword,
-					Agent:        kw.Agent,
-					MinRequested: kw.MinRequested,
-					EscalateTo:   kw.EscalateTo,
-					Enabled:      kw.Enabled,
-					CreatedAt:    kw.CreatedAt.UTC().Format(time.RFC3339),
-				})
+				resp = append(resp, newKeywordResponse(kw))
 			}
 
 			w.Header().Set("Content-Type", "application/json")
@@ -62,37 +48,53 @@ func handleVerbosityKeywords(keywordStore store.VerbosityKeywordStore) http.Hand
 				MinRequested *int    `json:"min_requested"`
 				EscalateTo   *int    `json:"escalate_to"`
 				Enabled      *bool   `json:"enabled"`
+				Match        string  `json:"match"`
+				Action       string  `json:"action"`
+				Priority     int     `json:"priority"`
+				MinLength    int     `json:"min_length"`
+				MaxLength    int     `json:"max_length"`
+				CodeBlock    string  `json:"code_block"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 				http.Error(w, "invalid JSON", http.StatusBadRequest)
 				return
 			}
 
-			keyword := strings.TrimSpace(input.Keyword)
-			if keyword == "" {
-				http.Error(w, "keyword required", http.StatusBadRequest)
-				return
-			}
 			if input.MinRequested == nil {
 				http.Error(w, "min_requested required", http.StatusBadRequest)
 				return
 			}
-			if input.EscalateTo == nil {
+			// A suppress rule only keeps the requested level
+			if input.EscalateTo == nil && input.Action != store.ActionSuppress {
 				http.Error(w, "escalate_to required", http.StatusBadRequest)
 				return
 			}
 
-			enabled := true
+			kw := store.VerbosityKeyword{
+				Keyword:      input.Keyword,
+				Agent:        input.Agent,
+				MinRequested: *input.MinRequested,
+				Enabled:      true,
+				Match:        input.Match,
+				Action:       input.Action,
+				Priority:     input.Priority,
+				MinLength:    input.MinLength,
+				MaxLength:    input.MaxLength,
+				CodeBlock:    input.CodeBlock,
+			}
+			if input.EscalateTo != nil {
+				kw.EscalateTo = *input.EscalateTo
+			}
 			if input.Enabled != nil {
-				enabled = *input.Enabled
+				kw.Enabled = *input.Enabled
 			}
-
-			if *input.EscalateTo < *input.MinRequested {
-				http.Error(w, "escalate_to must be >= min_requested", http.StatusBadRequest)
+			kw, err := store.NormalizeVerbosityKeyword(kw)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
-			kw, err := keywordStore.CreateVerbosityKeyword(r.Context(), userID.String(), keyword, input.Agent, *input.MinRequested, *input.EscalateTo, enabled)
+			created, err := keywordStore.CreateVerbosityKeyword(r.Context(), userID.String(), kw)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -100,17 +102,7 @@ func handleVerbosityKeywords(keywordStore store.VerbosityKeywordStore) http.Hand
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusCreated)
-			resp := map[string]any{
-				"keyword":       kw.Keyword,
-				"min_requested": kw.MinRequested,
-				"escalate_to":   kw.EscalateTo,
-				"enabled":       kw.Enabled,
-				"created_at":    kw.CreatedAt.UTC().Format(time.RFC3339),
-			}
-			if kw.Agent != nil {
-				resp["agent"] = *kw.Agent
-			}
-			_ = json.NewEncoder(w).Encode(resp)
+			_ = json.NewEncoder(w).Encode(newKeywordResponse(created))
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
@@ -140,21 +132,38 @@ func handleVerbosityKeyword(keywordStore store.VerbosityKeywordStore) http.Handl
 		switch r.Method {
 		case http.MethodPatch:
 			var input struct {
-				MinRequested *int  `json:"min_requested"`
-				EscalateTo   *int  `json:"escalate_to"`
-				Enabled      *bool `json:"enabled"`
+				MinRequested *int    `json:"min_requested"`
+				EscalateTo   *int    `json:"escalate_to"`
+				Enabled      *bool   `json:"enabled"`
+				Match        *string `json:"match"`
+				Action       *string `json:"action"`
+				Priority     *int    `json:"priority"`
+				MinLength    *int    `json:"min_length"`
+				MaxLength    *int    `json:"max_length"`
+				CodeBlock    *string `json:"code_block"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 				http.Error(w, "invalid JSON", http.StatusBadRequest)
 				return
 			}
 
-			if input.MinRequested == nil && input.EscalateTo == nil && input.Enabled == nil {
+			update := store.VerbosityKeywordUpdate{
+				MinRequested: input.MinRequested,
+				EscalateTo:   input.EscalateTo,
+				Enabled:      input.Enabled,
+				Match:        input.Match,
+				Action:       input.Action,
+				Priority:     input.Priority,
+				MinLength:    input.MinLength,
+				MaxLength:    input.MaxLength,
+				CodeBlock:    input.CodeBlock,
+			}
+			if update == (store.VerbosityKeywordUpdate{}) {
 				http.Error(w, "no fields to update", http.StatusBadRequest)
 				return
 			}
 
-			// Fetch existing keyword to validate escalate_to >= min_requested
+			// Fetch the existing rule to validate it as updated
 			keywords, err := keywordStore.ListVerbosityKeywords(r.Context(), userID.String())
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -171,25 +180,12 @@ func handleVerbosityKeyword(keywordStore store.VerbosityKeywordStore) http.Handl
 				http.Error(w, "keyword not found", http.StatusNotFound)
 				return
 			}
-
-			minRequested := existing.MinRequested
-			escalateTo := existing.EscalateTo
-			if input.MinRequested != nil {
-				minRequested = *input.MinRequested
-			}
-			if input.EscalateTo != nil {
-				escalateTo = *input.EscalateTo
-			}
-			if escalateTo < minRequested {
-				http.Error(w, "escalate_to must be >= min_requested", http.StatusBadRequest)
+			if _, err := store.NormalizeVerbosityKeyword(update.Apply(*existing)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
-			updated, err := keywordStore.UpdateVerbosityKeyword(r.Context(), userID.String(), keyword, store.VerbosityKeywordUpdate{
-				MinRequested: input.MinRequested,
-				EscalateTo:   input.EscalateTo,
-				Enabled:      input.Enabled,
-			})
+			updated, err := keywordStore.UpdateVerbosityKeyword(r.Context(), userID.String(), keyword, update)
 			if err != nil {
 				if err == sql.ErrNoRows {
 					http.Error(w, "keyword not found", http.StatusNotFound)
@@ -200,13 +196,7 @@ func handleVerbosityKeyword(keywordStore store.VerbosityKeywordStore) http.Handl
 			}
 
 			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(map[string]any{
-				"keyword":       updated.Keyword,
-				"min_requested": updated.MinRequested,
-				"escalate_to":   updated.EscalateTo,
-				"enabled":       updated.Enabled,
-				"created_at":    updated.CreatedAt.UTC().Format(time.RFC3339),
-			})
+			_ = json.NewEncoder(w).Encode(newKeywordResponse(updated))
 		case http.MethodDelete:
 			if err := keywordStore.DeleteVerbosityKeyword(r.Context(), userID.String(), keyword); err != nil {
 				if err == sql.ErrNoRows {
@@ -223,3 +213,93 @@ func handleVerbosityKeyword(keywordStore store.VerbosityKeywordStore) http.Handl
 	}
 }
 
+// handleVerbosityResolve handles POST /verbosity/resolve: a dry run of
+// verbosity resolution for a message that reports every rule and why it
+// did or did not fire, without calling a model.
+func handleVerbosityResolve(keywordStore store.VerbosityKeywordLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var input struct {
+			Message   string `json:"message"`
+			Agent     string `json:"agent"`
+			Verbosity *int   `json:"verbosity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(input.Message) == "" {
+			http.Error(w, "message required", http.StatusBadRequest)
+			return
+		}
+		agentName := strings.TrimSpace(input.Agent)
+		if agentName == "" {
+			agentName = "default"
+		}
+		requested := executor.DefaultVerbosity()
+		if input.Verbosity != nil {
+			requested = *input.Verbosity
+		}
+
+		profile := agent.GetProfileForUser(userID.String(), agentName)
+		result, err := executor.EvaluateVerbosity(r.Context(), &requested, requested, agentName, profile, input.Message, userID.String(), keywordStore)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"agent":               agentName,
+			"requested":           requested,
+			"effective_verbosity": result.EffectiveVerbosity,
+			"escalated":           result.Escalated,
+			"deescalated":         result.Deescalated,
+			"warning":             result.Warning,
+			"matched_keywords":    result.MatchedKeywords,
+			"rules":               result.Rules,
+		})
+	}
+}
+
+type keywordResponse struct {
+	Keyword      string  `json:"keyword"`
+	Agent        *string `json:"agent,omitempty"`
+	MinRequested int     `json:"min_requested"`
+	EscalateTo   int     `json:"escalate_to"`
+	Enabled      bool    `json:"enabled"`
+	Match        string  `json:"match"`
+	Action       string  `json:"action"`
+	Priority     int     `json:"priority"`
+	MinLength    int     `json:"min_length"`
+	MaxLength    int     `json:"max_length"`
+	CodeBlock    string  `json:"code_block"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+func newKeywordResponse(kw store.VerbosityKeyword) keywordResponse {
+	return keywordResponse{
+		Keyword:      kw.Keyword,
+		Agent:        kw.Agent,
+		MinRequested: kw.MinRequested,
+		EscalateTo:   kw.EscalateTo,
+		Enabled:      kw.Enabled,
+		Match:        kw.Match,
+		Action:       kw.Action,
+		Priority:     kw.Priority,
+		MinLength:    kw.MinLength,
+		MaxLength:    kw.MaxLength,
+		CodeBlock:    kw.CodeBlock,
+		CreatedAt:    kw.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
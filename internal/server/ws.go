@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/earlysvahn/sidekick/internal/chat"
+	"github.com/earlysvahn/sidekick/internal/executor"
+	"github.com/earlysvahn/sidekick/internal/metrics"
+	"github.com/earlysvahn/sidekick/internal/store"
+	"github.com/earlysvahn/sidekick/internal/usage"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+)
+
+// wsOriginAllowed reports whether a WebSocket handshake may proceed.
+// Browsers send the session cookie with cross-site handshakes and do not
+// apply CORS to them, so only same-origin pages and the configured origins
+// may connect. Requests without an Origin header come from non-browser
+// clients and are allowed.
+func wsOriginAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimRight(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsClientMessage is a message from the client on /ws/chat. Type is one of
+// "chat", "cancel", "regenerate" or "switch_agent"; the chat fields are
+// only used by "chat", Agent also by "switch_agent".
+type wsClientMessage struct {
+	Type string `json:"type"`
+	chatRequest
+}
+
+// wsServerMessage carries one /chat stream event. JobID and ID match the
+// SSE job ID and event ID, so a client can resume via /chat/jobs/{id}.
+type wsServerMessage struct {
+	JobID string `json:"job_id,omitempty"`
+	ID    int    `json:"id,omitempty"`
+	Event string `json:"event,omitempty"`
+	Data  any    `json:"data"`
+}
+
+// handleChatWS handles /ws/chat: the /chat event protocol over a WebSocket,
+// with client messages to cancel, regenerate or switch agent mid-stream.
+// Handshakes from other origins than the server's and allowedOrigins get
+// 403.
+func handleChatWS(historyStore chatStore, sched *executor.Scheduler, jobs *jobRegistry, tracker *usage.Tracker, allowedOrigins []string) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return wsOriginAllowed(r, allowedOrigins) },
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !wsOriginAllowed(r, allowedOrigins) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already replied with an HTTP error
+			return
+		}
+		defer conn.Close()
+		defer metrics.StreamStarted()()
+
+		s := &wsChatSession{
+			ctx:          r.Context(),
+			conn:         conn,
+			historyStore: historyStore,
+			sched:        sched,
+			jobs:         jobs,
+			tracker:      tracker,
+			userID:       userID.String(),
+		}
+		s.serve()
+	}
+}
+
+// wsChatSession is one /ws/chat connection. At most one generation runs at
+// a time; the last turn is kept so it can be regenerated.
+type wsChatSession struct {
+	ctx          context.Context
+	conn         *websocket.Conn
+	historyStore chatStore
+	sched        *executor.Scheduler
+	jobs         *jobRegistry
+	tracker      *usage.Tracker
+	userID       string
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	current       *chatJob
+	lastReq       chatRequest
+	lastTurn      *chatTurn
+	lastPersisted bool
+}
+
+// serve reads client messages until the connection closes. Running jobs
+// are not cancelled on disconnect, like the SSE transport.
+func (s *wsChatSession) serve() {
+	s.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.pingLoop(stop)
+
+	for {
+		var msg wsClientMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.DebugContext(s.ctx, "websocket read", "err", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "chat":
+			s.chat(msg.chatRequest)
+		case "cancel":
+			if job := s.running(); job != nil {
+				job.Cancel()
+			}
+		case "regenerate":
+			s.rerun("")
+		case "switch_agent":
+			agentName := strings.TrimSpace(msg.Agent)
+			if agentName == "" {
+				s.sendError("agent required")
+				continue
+			}
+			s.rerun(agentName)
+		default:
+			s.sendError("unknown message type " + msg.Type)
+		}
+	}
+}
+
+// chat starts a new turn.
+func (s *wsChatSession) chat(req chatRequest) {
+	if s.running() != nil {
+		s.sendError("generation in progress; cancel it first")
+		return
+	}
+	turn, _, err := prepareChatTurn(s.ctx, s.historyStore, s.userID, req)
+	if err != nil {
+		s.sendError(err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.lastReq = req
+	s.mu.Unlock()
+	s.start(turn)
+}
+
+// rerun regenerates the last turn, optionally with a different agent. A
+// running generation is cancelled first; its partial reply is kept as
+// incomplete. With an agent and no previous turn, it only sets the agent
+// for the next "chat" message.
+func (s *wsChatSession) rerun(agentName string) {
+	if job := s.running(); job != nil {
+		job.Cancel()
+		<-job.Done()
+	}
+
+	s.mu.Lock()
+	req := s.lastReq
+	last := s.lastTurn
+	regenerate := last != nil && (last.Regenerate || s.lastPersisted)
+	s.mu.Unlock()
+
+	if last == nil {
+		if agentName == "" {
+			s.sendError("nothing to regenerate")
+			return
+		}
+		s.sendInfo("agent set to " + agentName)
+		return
+	}
+	if agentName != "" {
+		req.Agent = agentName
+		s.mu.Lock()
+		s.lastReq.Agent = agentName
+		s.mu.Unlock()
+	}
+
+	turn, _, err := resolveChatTurn(s.ctx, s.historyStore, s.userID, req)
+	if err != nil {
+		s.sendError(err.Error())
+		return
+	}
+	turn.setHistory(last.History)
+	turn.Regenerate = regenerate
+	if regenerate {
+		// The new reply answers the stored question again, next to the
+		// previous reply
+		ctxHist, err := s.historyStore.LoadContext(s.userID, turn.Context)
+		if err != nil {
+			s.sendError(err.Error())
+			return
+		}
+		if i, ok := chat.RetryPoint(ctxHist.Messages); ok {
+			turn.ParentID = store.ParentRef(ctxHist.Messages[i].ID)
+		}
+	}
+	s.start(turn)
+}
+
+// start enqueues turn and runs it as a job, forwarding its events.
+func (s *wsChatSession) start(turn *chatTurn) {
+	annotateGeneration(s.ctx, turn.Agent, turn.Model, turn.Verbosity, turn.Escalation)
+
+	if err := s.tracker.Check(s.userID); err != nil {
+		s.sendError(err.Error())
+		return
+	}
+
+	ticket, err := s.sched.Enqueue(turn.Model, s.userID)
+	if err != nil {
+		if errors.Is(err, executor.ErrQueueFull) {
+			s.sendError("generation queue is full; try again shortly")
+		} else {
+			s.sendError(err.Error())
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.lastTurn = turn
+	s.lastPersisted = false
+	s.mu.Unlock()
+
+	job := s.jobs.start(s.ctx, s.userID, func(ctx context.Context, job *chatJob) {
+		contextName, persisted := runChatTurn(ctx, job, s.historyStore, s.tracker, ticket, turn)
+		s.mu.Lock()
+		// A first turn may have renamed the context; reruns must follow it
+		s.lastReq.Context = contextName
+		s.lastPersisted = persisted
+		s.mu.Unlock()
+	})
+
+	s.mu.Lock()
+	s.current = job
+	s.mu.Unlock()
+
+	go s.forward(job)
+}
+
+// forward writes the job's events to the socket until the job finishes.
+func (s *wsChatSession) forward(job *chatJob) {
+	after := 0
+	for {
+		pending, done, wake := job.since(after)
+		for _, ev := range pending {
+			if err := s.send(wsServerMessage{JobID: job.ID, ID: ev.ID, Event: ev.Name, Data: json.RawMessage(ev.Data)}); err != nil {
+				return
+			}
+			after = ev.ID
+		}
+		if done && len(pending) == 0 {
+			return
+		}
+		if done {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// running returns the current job if it has not finished.
+func (s *wsChatSession) running() *chatJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+	select {
+	case <-s.current.Done():
+		return nil
+	default:
+		return s.current
+	}
+}
+
+func (s *wsChatSession) pingLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *wsChatSession) send(msg wsServerMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *wsChatSession) sendError(message string) {
+	_ = s.send(wsServerMessage{Data: map[string]any{"type": "error", "error": message}})
+}
+
+func (s *wsChatSession) sendInfo(message string) {
+	_ = s.send(wsServerMessage{Data: map[string]any{"type": "info", "message": message}})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/auth"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestChatWSRejectsForeignOrigin(t *testing.T) {
+	handler := handleChatWS(nil, nil, newJobRegistry(), nil, []string{"https://app.example/"})
+
+	for _, tc := range []struct {
+		origin string
+		status int
+	}{
+		{"https://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+		// Allowed origins get past the check; without a user they are 401
+		{"http://sidekick.lan", http.StatusUnauthorized},
+		{"https://APP.example", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "http://sidekick.lan/ws/chat", nil)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("Origin %q: status %d, want %d", tc.origin, rec.Code, tc.status)
+		}
+	}
+}
+
+// dialChatWS serves /ws/chat for userID over a test server and connects.
+func dialChatWS(t *testing.T, historyStore chatStore, userID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	handler := handleChatWS(historyStore, nil, newJobRegistry(), nil, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readDone reads events until the done event and returns it. Error events
+// fail the test.
+func readDone(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if msg.Data["type"] == "error" {
+			t.Fatalf("error event: %v", msg.Data["error"])
+		}
+		if msg.Data["done"] == true {
+			return msg.Data
+		}
+	}
+}
+
+func TestChatWSRegenerateFollowsRenamedContext(t *testing.T) {
+	fakeOllama(t, "Greeting Chat", "hel", "lo")
+	historyStore := newMemStore()
+	userID := uuid.New()
+	conn := dialChatWS(t, historyStore, userID)
+
+	send := func(v any) {
+		t.Helper()
+		b, _ := json.Marshal(v)
+		if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(map[string]any{"type": "chat", "context": "new", "messages": []map[string]string{{"role": "user", "content": "hi"}}})
+	done := readDone(t, conn)
+	if name := done["context"].(map[string]any)["name"]; name != "Greeting Chat" {
+		t.Fatalf("context after first turn = %v, want the generated title", name)
+	}
+
+	send(map[string]any{"type": "regenerate"})
+	done = readDone(t, conn)
+	if name := done["context"].(map[string]any)["name"]; name != "Greeting Chat" {
+		t.Fatalf("regenerated into context %v, want the renamed one", name)
+	}
+
+	if _, ok, _ := historyStore.GetContextMeta(userID.String(), "new"); ok {
+		t.Fatal("regenerate recreated the context under its old name")
+	}
+	tree, _ := historyStore.LoadMessageTree(userID.String(), "Greeting Chat")
+	if len(tree) != 3 {
+		t.Fatalf("renamed context has %d messages, want question and two replies", len(tree))
+	}
+	question, first, second := tree[0], tree[1], tree[2]
+	if question.Role != "user" || first.Content != "hello" || second.Content != "hello" {
+		t.Fatalf("unexpected messages %+v", tree)
+	}
+	if first.Parent() != question.ID || second.Parent() != question.ID {
+		t.Fatalf("replies should both answer message %d: parents %d, %d", question.ID, first.Parent(), second.Parent())
+	}
+}
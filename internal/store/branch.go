@@ -0,0 +1,90 @@
+package store
+
+// A context is a tree of messages: every message points at the message it
+// follows. Retrying a reply or editing an earlier question appends a
+// sibling instead of rewriting history, and the active branch is the path
+// from the root to the most recently added message.
+
+// Parent returns the ID of the message m follows, or 0 for a root.
+func (m Message) Parent() int64 {
+	if m.ParentID == nil {
+		return 0
+	}
+	return *m.ParentID
+}
+
+// ParentRef returns a ParentID for Append: the ID of the message to branch
+// from, or 0 to start a new root. Messages appended with a nil ParentID
+// continue the active branch.
+func ParentRef(id int64) *int64 {
+	return &id
+}
+
+// ActiveBranch returns the messages on the path from the root to the most
+// recently added message, oldest first.
+func ActiveBranch(messages []Message) []Message {
+	if len(messages) == 0 {
+		return messages
+	}
+	leaf := messages[0].ID
+	for _, m := range messages {
+		if m.ID > leaf {
+			leaf = m.ID
+		}
+	}
+	branch, _ := BranchTo(messages, leaf)
+	return branch
+}
+
+// BranchTo returns the messages on the path from the root to the message
+// with the given ID, oldest first. It reports false if id is not found.
+func BranchTo(messages []Message, id int64) ([]Message, bool) {
+	byID := make(map[int64]int, len(messages))
+	for i, m := range messages {
+		byID[m.ID] = i
+	}
+	i, ok := byID[id]
+	if !ok {
+		return nil, false
+	}
+
+	var branch []Message
+	for {
+		m := messages[i]
+		branch = append(branch, m)
+		parent := m.Parent()
+		// Parents are always older; anything else is a broken link
+		if parent == 0 || parent >= m.ID {
+			break
+		}
+		if i, ok = byID[parent]; !ok {
+			break
+		}
+	}
+	for l, r := 0, len(branch)-1; l < r; l, r = l+1, r-1 {
+		branch[l], branch[r] = branch[r], branch[l]
+	}
+	return branch, true
+}
+
+// chainMessages assigns IDs to messages that have none, each following the
+// message before it. Files written before messages had IDs form one
+// linear branch.
+func chainMessages(messages []Message) {
+	var maxID int64
+	for _, m := range messages {
+		if m.ID > maxID {
+			maxID = m.ID
+		}
+	}
+	for i := range messages {
+		if messages[i].ID != 0 {
+			continue
+		}
+		maxID++
+		messages[i].ID = maxID
+		if i > 0 && messages[i].ParentID == nil {
+			messages[i].ParentID = ParentRef(messages[i-1].ID)
+		}
+	}
+}
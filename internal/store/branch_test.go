@@ -0,0 +1,79 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestActiveBranchFollowsNewestMessage(t *testing.T) {
+	msgs := []Message{
+		{ID: 1, Role: "user", Content: "q"},
+		{ID: 2, ParentID: ParentRef(1), Role: "assistant", Content: "a1"},
+		{ID: 3, ParentID: ParentRef(2), Role: "user", Content: "q2"},
+		{ID: 4, ParentID: ParentRef(1), Role: "assistant", Content: "a2"},
+	}
+	got := contents(ActiveBranch(msgs))
+	if want := "q a2"; got != want {
+		t.Fatalf("ActiveBranch = %q, want %q", got, want)
+	}
+
+	branch, ok := BranchTo(msgs, 3)
+	if !ok || contents(branch) != "q a1 q2" {
+		t.Fatalf("BranchTo(3) = %q, %v", contents(branch), ok)
+	}
+	if _, ok := BranchTo(msgs, 9); ok {
+		t.Fatal("BranchTo found a missing message")
+	}
+}
+
+func TestSQLiteStoreRetryAndEdit(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	appendMsg := func(role, content string, parent *int64) {
+		t.Helper()
+		if err := s.Append("c", Message{Role: role, Content: content, ParentID: parent, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	branch := func() []Message {
+		t.Helper()
+		h, err := s.LoadContext("c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.Messages
+	}
+
+	appendMsg("user", "q", nil)
+	appendMsg("assistant", "a1", nil)
+	first := branch()
+
+	// Retry: a sibling reply to the same question
+	appendMsg("assistant", "a2", ParentRef(first[0].ID))
+	if got := contents(branch()); got != "q a2" {
+		t.Fatalf("after retry = %q", got)
+	}
+
+	// Edit the first question: a new root
+	appendMsg("user", "q'", ParentRef(first[0].Parent()))
+	appendMsg("assistant", "a3", nil)
+	if got := contents(branch()); got != "q' a3" {
+		t.Fatalf("after edit = %q", got)
+	}
+}
+
+func contents(msgs []Message) string {
+	var out string
+	for i, m := range msgs {
+		if i > 0 {
+			out += " "
+		}
+		out += m.Content
+	}
+	return out
+}
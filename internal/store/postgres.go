@@ -4,7 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 
-	_ "github.com/lib/pq"
+	"github.com/earlysvahn/sidekick/internal/db"
+	"github.com/lib/pq"
 )
 
 type PostgresStore struct {
@@ -16,7 +17,7 @@ const CLI_DEFAULT_USER_ID = "00000000-0000-0000-0000-000000000000"
 
 // NewPostgresStore creates a Postgres-backed store with the given DSN
 func NewPostgresStore(dsn string) (*PostgresStore, error) {
-	db, err := sql.Open("postgres", dsn)
+	db, err := db.OpenPostgresDSN(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
@@ -61,6 +62,33 @@ func initPostgresSchema(db *sql.DB) error {
 		FOREIGN KEY (user_id, context_name) REFERENCES contexts(user_id, name) ON DELETE CASCADE
 	);
 
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS incomplete BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS prompt_tokens INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS completion_tokens INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS keywords TEXT[];
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS latency_ms BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS files TEXT[];
+
+	-- Messages form a tree per context. Histories written before parent_id
+	-- existed are chained once, in insert order.
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT FROM information_schema.columns
+			WHERE table_name = 'messages'
+			AND column_name = 'parent_id'
+			AND table_schema = 'public'
+		) THEN
+			ALTER TABLE messages ADD COLUMN parent_id BIGINT;
+			UPDATE messages m SET parent_id = (
+				SELECT MAX(p.id) FROM messages p
+				WHERE p.user_id = m.user_id AND p.context_name = m.context_name AND p.id < m.id
+			);
+		END IF;
+	END $$;
+
 	CREATE INDEX IF NOT EXISTS idx_messages_user_context ON messages(user_id, context_name);
 	CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
 
@@ -74,6 +102,13 @@ func initPostgresSchema(db *sql.DB) error {
 		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY (user_id, keyword)
 	);
+
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS match_type TEXT NOT NULL DEFAULT 'contains';
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS action TEXT NOT NULL DEFAULT 'escalate';
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS min_length INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS max_length INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE verbosity_escalation_keywords ADD COLUMN IF NOT EXISTS code_block TEXT NOT NULL DEFAULT 'any';
 	`
 	if _, err := db.Exec(schema); err != nil {
 		return err
@@ -113,7 +148,8 @@ func (s *PostgresStore) Close() error {
 	return s.db.Close()
 }
 
-// LoadContext loads a context by name for a specific user.
+// LoadContext loads a context by name for a specific user. Messages are the
+// context's active branch.
 func (s *PostgresStore) LoadContext(userID, contextName string) (ContextHistory, error) {
 	// Load system prompt
 	var systemPrompt sql.NullString
@@ -127,53 +163,23 @@ func (s *PostgresStore) LoadContext(userID, contextName string) (ContextHistory,
 		return ContextHistory{}, fmt.Errorf("load system prompt: %w", err)
 	}
 
-	// Load all messages
-	rows, err := s.db.Query(`
-		SELECT role, content, agent, verbosity, created_at
-		FROM messages
-		WHERE user_id = $1 AND context_name = $2
-		ORDER BY created_at ASC, id ASC
-	`, userID, contextName)
+	messages, err := s.LoadMessageTree(userID, contextName)
 	if err != nil {
-		return ContextHistory{}, fmt.Errorf("load messages: %w", err)
-	}
-	defer rows.Close()
-
-	messages := []Message{}
-	for rows.Next() {
-		var msg Message
-		var agent sql.NullString
-		var verbosity sql.NullInt64
-		if err := rows.Scan(&msg.Role, &msg.Content, &agent, &verbosity, &msg.Time); err != nil {
-			return ContextHistory{}, fmt.Errorf("scan message: %w", err)
-		}
-		if agent.Valid {
-			agentValue := agent.String
-			msg.Agent = &agentValue
-		}
-		if verbosity.Valid {
-			v := int(verbosity.Int64)
-			msg.Verbosity = &v
-		}
-		messages = append(messages, msg)
-	}
-
-	if err := rows.Err(); err != nil {
-		return ContextHistory{}, fmt.Errorf("iterate messages: %w", err)
+		return ContextHistory{}, err
 	}
 
 	return ContextHistory{
 		System:   systemPrompt.String,
-		Messages: messages,
+		Messages: ActiveBranch(messages),
 	}, nil
 }
 
-// SaveContext updates the system prompt for an existing context.
-func (s *PostgresStore) SaveContext(userID, contextName string, h ContextHistory) error {
+// SaveSystem updates the system prompt for an existing context.
+func (s *PostgresStore) SaveSystem(userID, contextName, system string) error {
 	// Update system prompt
 	result, err := s.db.Exec(`
 		UPDATE contexts SET system_prompt = $1 WHERE user_id = $2 AND name = $3
-	`, h.System, userID, contextName)
+	`, system, userID, contextName)
 	if err != nil {
 		return fmt.Errorf("update system prompt: %w", err)
 	}
@@ -184,7 +190,7 @@ func (s *PostgresStore) SaveContext(userID, contextName string, h ContextHistory
 	return nil
 }
 
-// Load loads the last N messages for a context for a specific user
+// Load loads the last N messages of a context's active branch for a specific user
 func (s *PostgresStore) Load(userID, contextName string, limit int) ([]Message, error) {
 	if limit <= 0 {
 		return []Message{}, nil
@@ -200,9 +206,24 @@ func (s *PostgresStore) Load(userID, contextName string, limit int) ([]Message,
 		return []Message{}, nil
 	}
 
-	// Load all messages
+	allMessages, err := s.LoadMessageTree(userID, contextName)
+	if err != nil {
+		return nil, err
+	}
+	allMessages = ActiveBranch(allMessages)
+
+	// Return last N messages
+	if len(allMessages) > limit {
+		allMessages = allMessages[len(allMessages)-limit:]
+	}
+
+	return allMessages, nil
+}
+
+// LoadMessageTree loads every message of a context, across all branches.
+func (s *PostgresStore) LoadMessageTree(userID, contextName string) ([]Message, error) {
 	rows, err := s.db.Query(`
-		SELECT role, content, agent, verbosity, created_at
+		SELECT id, parent_id, role, content, agent, verbosity, created_at, incomplete, prompt_tokens, completion_tokens, model, source, keywords, latency_ms, files
 		FROM messages
 		WHERE user_id = $1 AND context_name = $2
 		ORDER BY created_at ASC, id ASC
@@ -212,14 +233,18 @@ func (s *PostgresStore) Load(userID, contextName string, limit int) ([]Message,
 	}
 	defer rows.Close()
 
-	var allMessages []Message
+	messages := []Message{}
 	for rows.Next() {
 		var msg Message
+		var parentID sql.NullInt64
 		var agent sql.NullString
 		var verbosity sql.NullInt64
-		if err := rows.Scan(&msg.Role, &msg.Content, &agent, &verbosity, &msg.Time); err != nil {
+		if err := rows.Scan(&msg.ID, &parentID, &msg.Role, &msg.Content, &agent, &verbosity, &msg.Time, &msg.Incomplete, &msg.PromptTokens, &msg.CompletionTokens, &msg.Model, &msg.Source, pq.Array(&msg.Keywords), &msg.LatencyMS, pq.Array(&msg.Files)); err != nil {
 			return nil, fmt.Errorf("scan message: %w", err)
 		}
+		if parentID.Valid {
+			msg.ParentID = ParentRef(parentID.Int64)
+		}
 		if agent.Valid {
 			agentValue := agent.String
 			msg.Agent = &agentValue
@@ -228,22 +253,17 @@ func (s *PostgresStore) Load(userID, contextName string, limit int) ([]Message,
 			v := int(verbosity.Int64)
 			msg.Verbosity = &v
 		}
-		allMessages = append(allMessages, msg)
+		messages = append(messages, msg)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate messages: %w", err)
 	}
-
-	// Return last N messages
-	if len(allMessages) > limit {
-		allMessages = allMessages[len(allMessages)-limit:]
-	}
-
-	return allMessages, nil
+	return messages, nil
 }
 
-// Append adds a message to a context for a specific user
+// Append adds a message to a context for a specific user. A nil ParentID
+// continues the active branch; see ParentRef to branch elsewhere.
 func (s *PostgresStore) Append(userID, contextName string, msg Message) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -256,18 +276,8 @@ func (s *PostgresStore) Append(userID, contextName string, msg Message) error {
 		return fmt.Errorf("get or create context: %w", err)
 	}
 
-	if msg.Role == "user" {
-		msg.Agent = nil
-		msg.Verbosity = nil
-	}
-
-	// Insert message with explicit timestamp
-	_, err = tx.Exec(`
-		INSERT INTO messages (user_id, context_name, role, content, agent, verbosity, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, userID, contextName, msg.Role, msg.Content, msg.Agent, msg.Verbosity, msg.Time)
-	if err != nil {
-		return fmt.Errorf("insert message: %w", err)
+	if _, err := insertMessageTx(tx, userID, contextName, msg); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -278,6 +288,8 @@ func (s *PostgresStore) Append(userID, contextName string, msg Message) error {
 }
 
 // AppendMessagesWithMeta appends messages and creates the context implicitly on first write for a specific user.
+// Each message follows the one before it; the first follows its ParentID or the active branch.
+// Assigned IDs are written back to messages.
 func (s *PostgresStore) AppendMessagesWithMeta(userID, contextName, agent string, verbosity int, messages []Message) error {
 	if len(messages) == 0 {
 		return nil
@@ -301,17 +313,16 @@ func (s *PostgresStore) AppendMessagesWithMeta(userID, contextName, agent string
 		return fmt.Errorf("create context: %w", err)
 	}
 
-	for _, msg := range messages {
-		if msg.Role == "user" {
-			msg.Agent = nil
-			msg.Verbosity = nil
+	for i := range messages {
+		msg := messages[i]
+		if i > 0 {
+			msg.ParentID = ParentRef(messages[i-1].ID)
 		}
-		if _, err := tx.Exec(`
-			INSERT INTO messages (user_id, context_name, role, content, agent, verbosity, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`, userID, contextName, msg.Role, msg.Content, msg.Agent, msg.Verbosity, msg.Time); err != nil {
-			return fmt.Errorf("insert message: %w", err)
+		id, err := insertMessageTx(tx, userID, contextName, msg)
+		if err != nil {
+			return err
 		}
+		messages[i].ID = id
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -321,6 +332,38 @@ func (s *PostgresStore) AppendMessagesWithMeta(userID, contextName, agent string
 	return nil
 }
 
+// insertMessageTx inserts msg, resolving a nil ParentID to the newest
+// message of the context, and returns its ID.
+func insertMessageTx(tx *sql.Tx, userID, contextName string, msg Message) (int64, error) {
+	if msg.Role == "user" {
+		msg.Agent = nil
+		msg.Verbosity = nil
+	}
+
+	var parentID sql.NullInt64
+	if msg.ParentID == nil {
+		if err := tx.QueryRow(`
+			SELECT MAX(id) FROM messages WHERE user_id = $1 AND context_name = $2
+		`, userID, contextName).Scan(&parentID); err != nil {
+			return 0, fmt.Errorf("find active branch: %w", err)
+		}
+	} else if *msg.ParentID != 0 {
+		parentID = sql.NullInt64{Int64: *msg.ParentID, Valid: true}
+	}
+
+	// Insert message with explicit timestamp
+	var id int64
+	err := tx.QueryRow(`
+		INSERT INTO messages (user_id, context_name, parent_id, role, content, agent, verbosity, created_at, incomplete, prompt_tokens, completion_tokens, model, source, keywords, latency_ms, files)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id
+	`, userID, contextName, parentID, msg.Role, msg.Content, msg.Agent, msg.Verbosity, msg.Time, msg.Incomplete, msg.PromptTokens, msg.CompletionTokens, msg.Model, msg.Source, pq.Array(msg.Keywords), msg.LatencyMS, pq.Array(msg.Files)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert message: %w", err)
+	}
+	return id, nil
+}
+
 // UpdateContext updates context metadata and/or renames the context for a specific user.
 // If name is changed, all messages are moved to the new context name.
 func (s *PostgresStore) UpdateContext(userID, name string, newName, agent *string, verbosity *int) (ContextInfo, error) {
@@ -523,8 +566,12 @@ func (a *CLIPostgresAdapter) LoadContext(contextName string) (ContextHistory, er
 	return a.store.LoadContext(CLI_DEFAULT_USER_ID, contextName)
 }
 
-func (a *CLIPostgresAdapter) SaveContext(contextName string, h ContextHistory) error {
-	return a.store.SaveContext(CLI_DEFAULT_USER_ID, contextName, h)
+func (a *CLIPostgresAdapter) SaveSystem(contextName, system string) error {
+	return a.store.SaveSystem(CLI_DEFAULT_USER_ID, contextName, system)
+}
+
+func (a *CLIPostgresAdapter) LoadMessageTree(contextName string) ([]Message, error) {
+	return a.store.LoadMessageTree(CLI_DEFAULT_USER_ID, contextName)
 }
 
 func (a *CLIPostgresAdapter) Load(contextName string, limit int) ([]Message, error) {
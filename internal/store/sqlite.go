@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -60,6 +61,23 @@ func initSchema(db *sql.DB) error {
 
 	CREATE INDEX IF NOT EXISTS idx_messages_context_id ON messages(context_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+
+	CREATE TABLE IF NOT EXISTS verbosity_escalation_keywords (
+		user_id TEXT NOT NULL,
+		keyword TEXT NOT NULL,
+		agent TEXT,
+		min_requested_verbosity INTEGER NOT NULL DEFAULT 0,
+		escalate_to INTEGER NOT NULL DEFAULT 2,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		match_type TEXT NOT NULL DEFAULT 'contains',
+		action TEXT NOT NULL DEFAULT 'escalate',
+		priority INTEGER NOT NULL DEFAULT 0,
+		min_length INTEGER NOT NULL DEFAULT 0,
+		max_length INTEGER NOT NULL DEFAULT 0,
+		code_block TEXT NOT NULL DEFAULT 'any',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, keyword)
+	);
 	`
 
 	_, err := db.Exec(schema)
@@ -67,20 +85,49 @@ func initSchema(db *sql.DB) error {
 		return err
 	}
 
-	if err := ensureContextColumn(db, "agent", "TEXT"); err != nil {
-		return err
+	columns := []struct{ table, name, definition string }{
+		{"contexts", "agent", "TEXT"},
+		{"contexts", "verbosity", "INTEGER DEFAULT 2"},
+		{"messages", "incomplete", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "model", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "source", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "keywords", "TEXT"}, // JSON array
+		{"messages", "latency_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "files", "TEXT"}, // JSON array
+	}
+	for _, c := range columns {
+		if _, err := ensureColumn(db, c.table, c.name, c.definition); err != nil {
+			return err
+		}
 	}
-	if err := ensureContextColumn(db, "verbosity", "INTEGER DEFAULT 2"); err != nil {
+
+	// Messages form a tree per context. Histories written before parent_id
+	// existed are chained once, in insert order.
+	added, err := ensureColumn(db, "messages", "parent_id", "INTEGER")
+	if err != nil {
 		return err
 	}
+	if added {
+		if _, err := db.Exec(`
+			UPDATE messages SET parent_id = (
+				SELECT MAX(p.id) FROM messages p
+				WHERE p.context_id = messages.context_id AND p.id < messages.id
+			)
+		`); err != nil {
+			return fmt.Errorf("backfill messages.parent_id: %w", err)
+		}
+	}
 
 	return nil
 }
 
-func ensureContextColumn(db *sql.DB, name, definition string) error {
-	rows, err := db.Query(`PRAGMA table_info(contexts)`)
+// ensureColumn adds a column unless it exists and reports whether it did.
+func ensureColumn(db *sql.DB, table, name, definition string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
 	if err != nil {
-		return fmt.Errorf("inspect contexts table: %w", err)
+		return false, fmt.Errorf("inspect %s table: %w", table, err)
 	}
 	defer rows.Close()
 
@@ -92,20 +139,20 @@ func ensureContextColumn(db *sql.DB, name, definition string) error {
 		var dfltValue sql.NullString
 		var pk int
 		if err := rows.Scan(&cid, &colName, &colType, &notNull, &dfltValue, &pk); err != nil {
-			return fmt.Errorf("scan contexts columns: %w", err)
+			return false, fmt.Errorf("scan %s columns: %w", table, err)
 		}
 		if colName == name {
-			return nil
+			return false, nil
 		}
 	}
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("iterate contexts columns: %w", err)
+		return false, fmt.Errorf("iterate %s columns: %w", table, err)
 	}
 
-	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE contexts ADD COLUMN %s %s`, name, definition)); err != nil {
-		return fmt.Errorf("add contexts.%s: %w", name, err)
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, name, definition)); err != nil {
+		return false, fmt.Errorf("add %s.%s: %w", table, name, err)
 	}
-	return nil
+	return true, nil
 }
 
 // Close closes the database connection
@@ -113,7 +160,8 @@ func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
 
-// LoadContext loads a context by name, creating it if it doesn't exist
+// LoadContext loads a context by name, creating it if it doesn't exist.
+// Messages are the context's active branch.
 func (s *SQLiteStore) LoadContext(contextName string) (ContextHistory, error) {
 	// Get or create context
 	contextID, err := s.getOrCreateContext(contextName)
@@ -130,56 +178,19 @@ func (s *SQLiteStore) LoadContext(contextName string) (ContextHistory, error) {
 		return ContextHistory{}, fmt.Errorf("load system prompt: %w", err)
 	}
 
-	// Load all messages
-	rows, err := s.db.Query(`
-		SELECT role, content, agent, verbosity, created_at
-		FROM messages
-		WHERE context_id = ?
-		ORDER BY created_at ASC, id ASC
-	`, contextID)
+	messages, err := s.loadMessages(contextID)
 	if err != nil {
-		return ContextHistory{}, fmt.Errorf("load messages: %w", err)
-	}
-	defer rows.Close()
-
-	messages := []Message{}
-	for rows.Next() {
-		var msg Message
-		var agent sql.NullString
-		var verbosity sql.NullInt64
-		var createdAt string
-		if err := rows.Scan(&msg.Role, &msg.Content, &agent, &verbosity, &createdAt); err != nil {
-			return ContextHistory{}, fmt.Errorf("scan message: %w", err)
-		}
-
-		msg.Time, err = parseTimestamp(createdAt)
-		if err != nil {
-			return ContextHistory{}, fmt.Errorf("parse timestamp: %w", err)
-		}
-		if agent.Valid {
-			agentValue := agent.String
-			msg.Agent = &agentValue
-		}
-		if verbosity.Valid {
-			v := int(verbosity.Int64)
-			msg.Verbosity = &v
-		}
-
-		messages = append(messages, msg)
-	}
-
-	if err := rows.Err(); err != nil {
-		return ContextHistory{}, fmt.Errorf("iterate messages: %w", err)
+		return ContextHistory{}, err
 	}
 
 	return ContextHistory{
 		System:   systemPrompt.String,
-		Messages: messages,
+		Messages: ActiveBranch(messages),
 	}, nil
 }
 
-// SaveContext updates the system prompt for a context
-func (s *SQLiteStore) SaveContext(contextName string, h ContextHistory) error {
+// SaveSystem updates the system prompt for a context
+func (s *SQLiteStore) SaveSystem(contextName, system string) error {
 	// Get or create context
 	contextID, err := s.getOrCreateContext(contextName)
 	if err != nil {
@@ -189,7 +200,7 @@ func (s *SQLiteStore) SaveContext(contextName string, h ContextHistory) error {
 	// Update system prompt
 	_, err = s.db.Exec(`
 		UPDATE contexts SET system_prompt = ? WHERE id = ?
-	`, h.System, contextID)
+	`, system, contextID)
 	if err != nil {
 		return fmt.Errorf("update system prompt: %w", err)
 	}
@@ -197,7 +208,7 @@ func (s *SQLiteStore) SaveContext(contextName string, h ContextHistory) error {
 	return nil
 }
 
-// Load loads the last N messages for a context
+// Load loads the last N messages of a context's active branch
 func (s *SQLiteStore) Load(contextName string, limit int) ([]Message, error) {
 	if limit <= 0 {
 		return []Message{}, nil
@@ -213,9 +224,37 @@ func (s *SQLiteStore) Load(contextName string, limit int) ([]Message, error) {
 		return nil, fmt.Errorf("get context id: %w", err)
 	}
 
-	// Load all messages
+	allMessages, err := s.loadMessages(contextID)
+	if err != nil {
+		return nil, err
+	}
+	allMessages = ActiveBranch(allMessages)
+
+	// Return last N messages
+	if len(allMessages) > limit {
+		allMessages = allMessages[len(allMessages)-limit:]
+	}
+
+	return allMessages, nil
+}
+
+// LoadMessageTree loads every message of a context, across all branches.
+func (s *SQLiteStore) LoadMessageTree(contextName string) ([]Message, error) {
+	var contextID int64
+	err := s.db.QueryRow(`SELECT id FROM contexts WHERE name = ?`, contextName).Scan(&contextID)
+	if err == sql.ErrNoRows {
+		return []Message{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get context id: %w", err)
+	}
+	return s.loadMessages(contextID)
+}
+
+// loadMessages loads every message of a context, across all branches.
+func (s *SQLiteStore) loadMessages(contextID int64) ([]Message, error) {
 	rows, err := s.db.Query(`
-		SELECT role, content, agent, verbosity, created_at
+		SELECT id, parent_id, role, content, agent, verbosity, created_at, incomplete, prompt_tokens, completion_tokens, model, source, keywords, latency_ms, files
 		FROM messages
 		WHERE context_id = ?
 		ORDER BY created_at ASC, id ASC
@@ -225,13 +264,15 @@ func (s *SQLiteStore) Load(contextName string, limit int) ([]Message, error) {
 	}
 	defer rows.Close()
 
-	var allMessages []Message
+	messages := []Message{}
 	for rows.Next() {
 		var msg Message
+		var parentID sql.NullInt64
 		var agent sql.NullString
 		var verbosity sql.NullInt64
 		var createdAt string
-		if err := rows.Scan(&msg.Role, &msg.Content, &agent, &verbosity, &createdAt); err != nil {
+		var keywords, files sql.NullString
+		if err := rows.Scan(&msg.ID, &parentID, &msg.Role, &msg.Content, &agent, &verbosity, &createdAt, &msg.Incomplete, &msg.PromptTokens, &msg.CompletionTokens, &msg.Model, &msg.Source, &keywords, &msg.LatencyMS, &files); err != nil {
 			return nil, fmt.Errorf("scan message: %w", err)
 		}
 
@@ -239,6 +280,9 @@ func (s *SQLiteStore) Load(contextName string, limit int) ([]Message, error) {
 		if err != nil {
 			return nil, fmt.Errorf("parse timestamp: %w", err)
 		}
+		if parentID.Valid {
+			msg.ParentID = ParentRef(parentID.Int64)
+		}
 		if agent.Valid {
 			agentValue := agent.String
 			msg.Agent = &agentValue
@@ -247,23 +291,24 @@ func (s *SQLiteStore) Load(contextName string, limit int) ([]Message, error) {
 			v := int(verbosity.Int64)
 			msg.Verbosity = &v
 		}
+		if keywords.Valid && keywords.String != "" {
+			_ = json.Unmarshal([]byte(keywords.String), &msg.Keywords)
+		}
+		if files.Valid && files.String != "" {
+			_ = json.Unmarshal([]byte(files.String), &msg.Files)
+		}
 
-		allMessages = append(allMessages, msg)
+		messages = append(messages, msg)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate messages: %w", err)
 	}
-
-	// Return last N messages
-	if len(allMessages) > limit {
-		allMessages = allMessages[len(allMessages)-limit:]
-	}
-
-	return allMessages, nil
+	return messages, nil
 }
 
-// Append adds a message to a context
+// Append adds a message to a context. A nil ParentID continues the active
+// branch; see ParentRef to branch elsewhere.
 func (s *SQLiteStore) Append(contextName string, msg Message) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -282,11 +327,30 @@ func (s *SQLiteStore) Append(contextName string, msg Message) error {
 		msg.Verbosity = nil
 	}
 
+	var parentID sql.NullInt64
+	if msg.ParentID == nil {
+		if err := tx.QueryRow(`SELECT MAX(id) FROM messages WHERE context_id = ?`, contextID).Scan(&parentID); err != nil {
+			return fmt.Errorf("find active branch: %w", err)
+		}
+	} else if *msg.ParentID != 0 {
+		parentID = sql.NullInt64{Int64: *msg.ParentID, Valid: true}
+	}
+
+	keywordsJSON, err := jsonList(msg.Keywords)
+	if err != nil {
+		return fmt.Errorf("encode keywords: %w", err)
+	}
+	filesJSON, err := jsonList(msg.Files)
+	if err != nil {
+		return fmt.Errorf("encode files: %w", err)
+	}
+
 	// Insert message with explicit timestamp
 	_, err = tx.Exec(`
-		INSERT INTO messages (context_id, role, content, agent, verbosity, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, contextID, msg.Role, msg.Content, msg.Agent, msg.Verbosity, msg.Time.Format(sqliteTimeFormat))
+		INSERT INTO messages (context_id, parent_id, role, content, agent, verbosity, created_at, incomplete, prompt_tokens, completion_tokens, model, source, keywords, latency_ms, files)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, contextID, parentID, msg.Role, msg.Content, msg.Agent, msg.Verbosity, msg.Time.Format(sqliteTimeFormat),
+		msg.Incomplete, msg.PromptTokens, msg.CompletionTokens, msg.Model, msg.Source, keywordsJSON, msg.LatencyMS, filesJSON)
 	if err != nil {
 		return fmt.Errorf("insert message: %w", err)
 	}
@@ -392,6 +456,18 @@ func (s *SQLiteStore) ListContexts() ([]ContextInfo, error) {
 	return contexts, nil
 }
 
+// jsonList encodes a string list column as a JSON array, or NULL when empty.
+func jsonList(values []string) (any, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
 // parseTimestamp handles both SQLite default format and custom formats
 func parseTimestamp(s string) (time.Time, error) {
 	t, err := time.Parse(sqliteTimeFormat, s)
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreResponseMetadata(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	appendMetadataReply(t, s)
+}
+
+func TestSQLiteStoreMigratesOldDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sidekick.db")
+
+	// The schema as it was before messages carried parent links, usage or
+	// response metadata.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE contexts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			system_prompt TEXT,
+			agent TEXT,
+			verbosity INTEGER DEFAULT 2,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			context_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			agent TEXT,
+			verbosity INTEGER,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (context_id) REFERENCES contexts(id)
+		);
+		INSERT INTO contexts (name) VALUES ('c');
+		INSERT INTO messages (context_id, role, content, created_at) VALUES
+			(1, 'user', 'q', CURRENT_TIMESTAMP),
+			(1, 'assistant', 'a', CURRENT_TIMESTAMP);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	h, err := s.LoadContext("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(h.Messages); got != "q a" {
+		t.Fatalf("old history = %q, want %q", got, "q a")
+	}
+	old := h.Messages[1]
+	if old.Model != "" || old.Source != "" || old.Keywords != nil || old.LatencyMS != 0 {
+		t.Fatalf("old reply has metadata: %+v", old)
+	}
+
+	appendMetadataReply(t, s)
+}
+
+// appendMetadataReply appends a question and an assistant reply carrying
+// response metadata to context "c" and checks LoadContext returns it.
+func appendMetadataReply(t *testing.T, s *SQLiteStore) {
+	t.Helper()
+	now := time.Now()
+	if err := s.Append("c", Message{Role: "user", Content: "explain this", Time: now}); err != nil {
+		t.Fatal(err)
+	}
+	want := Message{
+		Role:      "assistant",
+		Content:   "answer",
+		Time:      now,
+		Model:     "qwen2.5:7b",
+		Source:    "remote",
+		Keywords:  []string{"explain", "this"},
+		LatencyMS: 1234,
+	}
+	if err := s.Append("c", want); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.LoadContext("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := h.Messages[len(h.Messages)-1]
+	if got.Content != want.Content || got.Model != want.Model || got.Source != want.Source ||
+		got.LatencyMS != want.LatencyMS || !reflect.DeepEqual(got.Keywords, want.Keywords) {
+		t.Fatalf("reply = %+v, want model %q, source %q, keywords %v, latency %d",
+			got, want.Model, want.Source, want.Keywords, want.LatencyMS)
+	}
+}
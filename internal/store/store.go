@@ -11,11 +11,36 @@ import (
 )
 
 type Message struct {
+	// ID is assigned by the store; ParentID is the message this one
+	// follows (nil for a root). See ActiveBranch.
+	ID       int64  `json:"id,omitempty"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
 	Agent     *string   `json:"agent,omitempty"`
 	Verbosity *int      `json:"verbosity,omitempty"`
 	Time      time.Time `json:"time"`
+
+	// Incomplete marks an assistant reply that was cut short (client
+	// cancelled or generation failed mid-stream).
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// Token usage reported by Ollama for an assistant reply.
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+
+	// Response metadata for an assistant reply: the model that answered,
+	// where it ran (local, remote or fallback), the escalation keywords
+	// that shaped its verbosity and the wall time of the generation.
+	Model     string   `json:"model,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+	LatencyMS int64    `json:"latency_ms,omitempty"`
+
+	// Files names the inputs attached to a user message: paths of files
+	// and "stdin" for piped input.
+	Files []string `json:"files,omitempty"`
 }
 
 type ContextHistory struct {
@@ -35,7 +60,8 @@ type HistoryStore interface {
 	Load(context string, limit int) ([]Message, error)
 	Append(context string, msg Message) error
 	LoadContext(context string) (ContextHistory, error)
-	SaveContext(context string, h ContextHistory) error
+	LoadMessageTree(context string) ([]Message, error)
+	SaveSystem(context, system string) error
 	ListContexts() ([]ContextInfo, error)
 }
 
@@ -62,16 +88,52 @@ func (s *FileStore) Load(context string, limit int) ([]Message, error) {
 	return msgs, nil
 }
 
+// Append adds msg to the context. A nil ParentID continues the active
+// branch; see ParentRef to branch elsewhere.
 func (s *FileStore) Append(context string, msg Message) error {
-	h, err := s.LoadContext(context)
+	h, err := s.loadTree(context)
 	if err != nil {
 		return err
 	}
+	var leaf int64
+	for _, m := range h.Messages {
+		if m.ID > leaf {
+			leaf = m.ID
+		}
+	}
+	msg.ID = leaf + 1
+	if msg.ParentID == nil {
+		if leaf > 0 {
+			msg.ParentID = ParentRef(leaf)
+		}
+	} else if *msg.ParentID == 0 {
+		msg.ParentID = nil
+	}
 	h.Messages = append(h.Messages, msg)
-	return s.SaveContext(context, h)
+	return s.write(context, h)
 }
 
+// LoadContext loads the system prompt and the active branch of a context.
 func (s *FileStore) LoadContext(context string) (ContextHistory, error) {
+	h, err := s.loadTree(context)
+	if err != nil {
+		return ContextHistory{}, err
+	}
+	h.Messages = ActiveBranch(h.Messages)
+	return h, nil
+}
+
+// LoadMessageTree loads every message of a context, across all branches.
+func (s *FileStore) LoadMessageTree(context string) ([]Message, error) {
+	h, err := s.loadTree(context)
+	if err != nil {
+		return nil, err
+	}
+	return h.Messages, nil
+}
+
+// loadTree loads a context with every message of every branch.
+func (s *FileStore) loadTree(context string) (ContextHistory, error) {
 	path := s.contextPath(context)
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -85,16 +147,29 @@ func (s *FileStore) LoadContext(context string) (ContextHistory, error) {
 		if h.Messages == nil {
 			h.Messages = []Message{}
 		}
+		chainMessages(h.Messages)
 		return h, nil
 	}
 	var msgs []Message
 	if err := json.Unmarshal(b, &msgs); err != nil {
 		return ContextHistory{}, err
 	}
+	chainMessages(msgs)
 	return ContextHistory{Messages: msgs}, nil
 }
 
-func (s *FileStore) SaveContext(context string, h ContextHistory) error {
+// SaveSystem updates the system prompt for a context. Messages are only
+// added through Append.
+func (s *FileStore) SaveSystem(context, system string) error {
+	h, err := s.loadTree(context)
+	if err != nil {
+		return err
+	}
+	h.System = system
+	return s.write(context, h)
+}
+
+func (s *FileStore) write(context string, h ContextHistory) error {
 	path := s.contextPath(context)
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
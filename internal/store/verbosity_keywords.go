@@ -4,16 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// How a rule's keyword is matched against the user's message. All matching
+// is case-insensitive.
+const (
+	MatchContains = "contains" // keyword appears anywhere
+	MatchWord     = "word"     // keyword appears as a whole word or phrase
+	MatchRegex    = "regex"    // keyword is a regular expression
+)
+
+// What a matching rule does to the requested verbosity.
+const (
+	ActionEscalate   = "escalate"   // raise to EscalateTo
+	ActionDeescalate = "deescalate" // lower to EscalateTo
+	ActionSuppress   = "suppress"   // negative keyword: keep the requested level
+)
+
+// Conditions on fenced code blocks in the user's message.
+const (
+	CodeBlockAny       = "any"
+	CodeBlockRequired  = "required"
+	CodeBlockForbidden = "forbidden"
+)
+
+// VerbosityKeyword is a verbosity rule. Among the rules that match a
+// message only those with the highest Priority take effect; at equal
+// priority suppress wins over deescalate, which wins over escalate.
 type VerbosityKeyword struct {
 	Keyword      string    `json:"keyword"`
 	Agent        *string   `json:"agent,omitempty"` // NULL means global
 	MinRequested int       `json:"min_requested"`
 	EscalateTo   int       `json:"escalate_to"`
 	Enabled      bool      `json:"enabled"`
+	Match        string    `json:"match"`
+	Action       string    `json:"action"`
+	Priority     int       `json:"priority"`
+	MinLength    int       `json:"min_length"` // in characters, 0 means no limit
+	MaxLength    int       `json:"max_length"` // in characters, 0 means no limit
+	CodeBlock    string    `json:"code_block"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -21,6 +53,107 @@ type VerbosityKeywordUpdate struct {
 	MinRequested *int
 	EscalateTo   *int
 	Enabled      *bool
+	Match        *string
+	Action       *string
+	Priority     *int
+	MinLength    *int
+	MaxLength    *int
+	CodeBlock    *string
+}
+
+// Apply returns kw with the fields set in u replaced.
+func (u VerbosityKeywordUpdate) Apply(kw VerbosityKeyword) VerbosityKeyword {
+	if u.MinRequested != nil {
+		kw.MinRequested = *u.MinRequested
+	}
+	if u.EscalateTo != nil {
+		kw.EscalateTo = *u.EscalateTo
+	}
+	if u.Enabled != nil {
+		kw.Enabled = *u.Enabled
+	}
+	if u.Match != nil {
+		kw.Match = *u.Match
+	}
+	if u.Action != nil {
+		kw.Action = *u.Action
+	}
+	if u.Priority != nil {
+		kw.Priority = *u.Priority
+	}
+	if u.MinLength != nil {
+		kw.MinLength = *u.MinLength
+	}
+	if u.MaxLength != nil {
+		kw.MaxLength = *u.MaxLength
+	}
+	if u.CodeBlock != nil {
+		kw.CodeBlock = *u.CodeBlock
+	}
+	return kw
+}
+
+// NormalizeVerbosityKeyword fills in the defaults for unset fields and
+// checks that the rule is usable.
+func NormalizeVerbosityKeyword(kw VerbosityKeyword) (VerbosityKeyword, error) {
+	kw.Keyword = strings.TrimSpace(kw.Keyword)
+	if kw.Keyword == "" {
+		return kw, fmt.Errorf("keyword required")
+	}
+	if kw.Match == "" {
+		kw.Match = MatchContains
+	}
+	if kw.Action == "" {
+		kw.Action = ActionEscalate
+	}
+	if kw.CodeBlock == "" {
+		kw.CodeBlock = CodeBlockAny
+	}
+
+	switch kw.Action {
+	case ActionEscalate:
+		if kw.EscalateTo < kw.MinRequested {
+			return kw, fmt.Errorf("escalate_to must be >= min_requested")
+		}
+	case ActionDeescalate, ActionSuppress:
+	default:
+		return kw, fmt.Errorf("action must be %s, %s or %s", ActionEscalate, ActionDeescalate, ActionSuppress)
+	}
+	switch kw.CodeBlock {
+	case CodeBlockAny, CodeBlockRequired, CodeBlockForbidden:
+	default:
+		return kw, fmt.Errorf("code_block must be %s, %s or %s", CodeBlockAny, CodeBlockRequired, CodeBlockForbidden)
+	}
+	if kw.MinLength < 0 || kw.MaxLength < 0 {
+		return kw, fmt.Errorf("min_length and max_length must not be negative")
+	}
+	if kw.MaxLength > 0 && kw.MaxLength < kw.MinLength {
+		return kw, fmt.Errorf("max_length must be >= min_length")
+	}
+	if _, err := kw.Pattern(); err != nil {
+		return kw, err
+	}
+	return kw, nil
+}
+
+// Pattern compiles the rule's keyword according to its match type.
+func (kw VerbosityKeyword) Pattern() (*regexp.Regexp, error) {
+	switch kw.Match {
+	case MatchContains, "":
+		return regexp.Compile(`(?i)` + regexp.QuoteMeta(kw.Keyword))
+	case MatchWord:
+		// \b only knows ASCII word characters and never matches next to
+		// punctuation such as the end of "c++"
+		return regexp.Compile(`(?i)(?:^|[^\pL\pN_])` + regexp.QuoteMeta(kw.Keyword) + `(?:[^\pL\pN_]|$)`)
+	case MatchRegex:
+		re, err := regexp.Compile(`(?i)` + kw.Keyword)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		return re, nil
+	default:
+		return nil, fmt.Errorf("match must be %s, %s or %s", MatchContains, MatchWord, MatchRegex)
+	}
 }
 
 type VerbosityKeywordLister interface {
@@ -29,9 +162,23 @@ type VerbosityKeywordLister interface {
 
 type VerbosityKeywordStore interface {
 	VerbosityKeywordLister
-	CreateVerbosityKeyword(ctx context.Context, userID, keyword string, agent *string, minRequested, escalateTo int, enabled bool) (VerbosityKeyword, error)
+	CreateVerbosityKeyword(ctx context.Context, userID string, kw VerbosityKeyword) (VerbosityKeyword, error)
 	UpdateVerbosityKeyword(ctx context.Context, userID, keyword string, input VerbosityKeywordUpdate) (VerbosityKeyword, error)
 	DeleteVerbosityKeyword(ctx context.Context, userID, keyword string) error
+	// PutVerbosityKeywords stores keywords in one transaction, replacing
+	// rules with the same keyword. With replaceAll, the user's other rules
+	// are removed as well.
+	PutVerbosityKeywords(ctx context.Context, userID string, keywords []VerbosityKeyword, replaceAll bool) error
+}
+
+// LocalUserID is the pseudo-user CLI modes keep their verbosity rules under
+// in SQLite.
+const LocalUserID = "local"
+
+// PutVerbosityKeyword atomically stores kw, replacing any rule with the
+// same keyword.
+func PutVerbosityKeyword(ctx context.Context, s VerbosityKeywordStore, userID string, kw VerbosityKeyword) error {
+	return s.PutVerbosityKeywords(ctx, userID, []VerbosityKeyword{kw}, false)
 }
 
 type NoopVerbosityKeywordStore struct{}
@@ -40,12 +187,37 @@ func (NoopVerbosityKeywordStore) ListVerbosityKeywords(ctx context.Context, user
 	return []VerbosityKeyword{}, nil
 }
 
+const verbosityKeywordColumns = `keyword, agent, min_requested_verbosity, escalate_to, enabled, match_type, action, priority, min_length, max_length, code_block, created_at`
+
+type verbosityKeywordScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVerbosityKeyword(row verbosityKeywordScanner) (VerbosityKeyword, error) {
+	var kw VerbosityKeyword
+	err := row.Scan(
+		&kw.Keyword,
+		&kw.Agent,
+		&kw.MinRequested,
+		&kw.EscalateTo,
+		&kw.Enabled,
+		&kw.Match,
+		&kw.Action,
+		&kw.Priority,
+		&kw.MinLength,
+		&kw.MaxLength,
+		&kw.CodeBlock,
+		&kw.CreatedAt,
+	)
+	return kw, err
+}
+
 func (s *PostgresStore) ListVerbosityKeywords(ctx context.Context, userID string) ([]VerbosityKeyword, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT keyword, agent, min_requested_verbosity, escalate_to, enabled, created_at
+		SELECT `+verbosityKeywordColumns+`
 		FROM verbosity_escalation_keywords
 		WHERE user_id = $1
-		ORDER BY length(keyword) DESC, keyword ASC
+		ORDER BY priority DESC, length(keyword) DESC, keyword ASC
 	`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("list verbosity keywords: %w", err)
@@ -54,8 +226,8 @@ func (s *PostgresStore) ListVerbosityKeywords(ctx context.Context, userID string
 
 	var keywords []VerbosityKeyword
 	for rows.Next() {
-		var kw VerbosityKeyword
-		if err := rows.Scan(&kw.Keyword, &kw.Agent, &kw.MinRequested, &kw.EscalateTo, &kw.Enabled, &kw.CreatedAt); err != nil {
+		kw, err := scanVerbosityKeyword(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan verbosity keyword: %w", err)
 		}
 		keywords = append(keywords, kw)
@@ -66,68 +238,68 @@ func (s *PostgresStore) ListVerbosityKeywords(ctx context.Context, userID string
 	return keywords, nil
 }
 
-func (s *PostgresStore) CreateVerbosityKeyword(ctx context.Context, userID, keyword string, agent *string, minRequested, escalateTo int, enabled bool) (VerbosityKeyword, error) {
-	var kw VerbosityKeyword
-	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO verbosity_escalation_keywords (user_id, keyword, agent, min_requested_verbosity, escalate_to, enabled)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING keyword, agent, min_requested_verbosity, escalate_to, enabled, created_at
-	`, userID, keyword, agent, minRequested, escalateTo, enabled).Scan(
-		&kw.Keyword,
-		&kw.Agent,
-		&kw.MinRequested,
-		&kw.EscalateTo,
-		&kw.Enabled,
-		&kw.CreatedAt,
-	)
+func (s *PostgresStore) CreateVerbosityKeyword(ctx context.Context, userID string, kw VerbosityKeyword) (VerbosityKeyword, error) {
+	created, err := scanVerbosityKeyword(s.db.QueryRowContext(ctx, `
+		INSERT INTO verbosity_escalation_keywords (user_id, keyword, agent, min_requested_verbosity, escalate_to, enabled, match_type, action, priority, min_length, max_length, code_block)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+verbosityKeywordColumns,
+		userID, kw.Keyword, kw.Agent, kw.MinRequested, kw.EscalateTo, kw.Enabled, kw.Match, kw.Action, kw.Priority, kw.MinLength, kw.MaxLength, kw.CodeBlock))
 	if err != nil {
 		return VerbosityKeyword{}, fmt.Errorf("create verbosity keyword: %w", err)
 	}
-	return kw, nil
+	return created, nil
 }
 
 func (s *PostgresStore) UpdateVerbosityKeyword(ctx context.Context, userID, keyword string, input VerbosityKeywordUpdate) (VerbosityKeyword, error) {
-	sets := make([]string, 0, 3)
-	args := make([]any, 0, 5)
-	argID := 1
+	sets := make([]string, 0, 9)
+	args := make([]any, 0, 11)
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
 
 	if input.MinRequested != nil {
-		sets = append(sets, fmt.Sprintf("min_requested_verbosity = $%d", argID))
-		args = append(args, *input.MinRequested)
-		argID++
+		set("min_requested_verbosity", *input.MinRequested)
 	}
 	if input.EscalateTo != nil {
-		sets = append(sets, fmt.Sprintf("escalate_to = $%d", argID))
-		args = append(args, *input.EscalateTo)
-		argID++
+		set("escalate_to", *input.EscalateTo)
 	}
 	if input.Enabled != nil {
-		sets = append(sets, fmt.Sprintf("enabled = $%d", argID))
-		args = append(args, *input.Enabled)
-		argID++
+		set("enabled", *input.Enabled)
+	}
+	if input.Match != nil {
+		set("match_type", *input.Match)
+	}
+	if input.Action != nil {
+		set("action", *input.Action)
+	}
+	if input.Priority != nil {
+		set("priority", *input.Priority)
+	}
+	if input.MinLength != nil {
+		set("min_length", *input.MinLength)
+	}
+	if input.MaxLength != nil {
+		set("max_length", *input.MaxLength)
+	}
+	if input.CodeBlock != nil {
+		set("code_block", *input.CodeBlock)
 	}
 
 	if len(sets) == 0 {
 		return VerbosityKeyword{}, fmt.Errorf("no fields to update")
 	}
 
+	argID := len(args) + 1
 	args = append(args, userID, keyword)
 	query := fmt.Sprintf(`
 		UPDATE verbosity_escalation_keywords
 		SET %s
 		WHERE user_id = $%d AND keyword = $%d
-		RETURNING keyword, agent, min_requested_verbosity, escalate_to, enabled, created_at
-	`, strings.Join(sets, ", "), argID, argID+1)
+		RETURNING %s
+	`, strings.Join(sets, ", "), argID, argID+1, verbosityKeywordColumns)
 
-	var kw VerbosityKeyword
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(
-		&kw.Keyword,
-		&kw.Agent,
-		&kw.MinRequested,
-		&kw.EscalateTo,
-		&kw.Enabled,
-		&kw.CreatedAt,
-	)
+	kw, err := scanVerbosityKeyword(s.db.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return VerbosityKeyword{}, sql.ErrNoRows
@@ -137,6 +309,38 @@ func (s *PostgresStore) UpdateVerbosityKeyword(ctx context.Context, userID, keyw
 	return kw, nil
 }
 
+func (s *PostgresStore) PutVerbosityKeywords(ctx context.Context, userID string, keywords []VerbosityKeyword, replaceAll bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replaceAll {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("delete verbosity keywords: %w", err)
+		}
+	}
+	for _, kw := range keywords {
+		if !replaceAll {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = $1 AND keyword = $2`, userID, kw.Keyword); err != nil {
+				return fmt.Errorf("delete verbosity keyword %q: %w", kw.Keyword, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO verbosity_escalation_keywords (user_id, keyword, agent, min_requested_verbosity, escalate_to, enabled, match_type, action, priority, min_length, max_length, code_block)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, userID, kw.Keyword, kw.Agent, kw.MinRequested, kw.EscalateTo, kw.Enabled, kw.Match, kw.Action, kw.Priority, kw.MinLength, kw.MaxLength, kw.CodeBlock); err != nil {
+			return fmt.Errorf("create verbosity keyword %q: %w", kw.Keyword, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (s *PostgresStore) DeleteVerbosityKeyword(ctx context.Context, userID, keyword string) error {
 	res, err := s.db.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = $1 AND keyword = $2`, userID, keyword)
 	if err != nil {
@@ -148,4 +352,3 @@ func (s *PostgresStore) DeleteVerbosityKeyword(ctx context.Context, userID, keyw
 	}
 	return err
 }
-
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// The CLI keeps its own verbosity rules in SQLite, like its agents, so
+// escalation works offline. 'sidekick sync keywords push|pull' copies them
+// to and from a server account.
+
+func scanSQLiteVerbosityKeyword(row verbosityKeywordScanner) (VerbosityKeyword, error) {
+	var kw VerbosityKeyword
+	var agent sql.NullString
+	var createdAt string
+	err := row.Scan(
+		&kw.Keyword,
+		&agent,
+		&kw.MinRequested,
+		&kw.EscalateTo,
+		&kw.Enabled,
+		&kw.Match,
+		&kw.Action,
+		&kw.Priority,
+		&kw.MinLength,
+		&kw.MaxLength,
+		&kw.CodeBlock,
+		&createdAt,
+	)
+	if err != nil {
+		return VerbosityKeyword{}, err
+	}
+	if agent.Valid {
+		agentValue := agent.String
+		kw.Agent = &agentValue
+	}
+	if kw.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return VerbosityKeyword{}, err
+	}
+	return kw, nil
+}
+
+func (s *SQLiteStore) ListVerbosityKeywords(ctx context.Context, userID string) ([]VerbosityKeyword, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+verbosityKeywordColumns+`
+		FROM verbosity_escalation_keywords
+		WHERE user_id = ?
+		ORDER BY priority DESC, length(keyword) DESC, keyword ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list verbosity keywords: %w", err)
+	}
+	defer rows.Close()
+
+	var keywords []VerbosityKeyword
+	for rows.Next() {
+		kw, err := scanSQLiteVerbosityKeyword(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan verbosity keyword: %w", err)
+		}
+		keywords = append(keywords, kw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate verbosity keywords: %w", err)
+	}
+	return keywords, nil
+}
+
+func (s *SQLiteStore) CreateVerbosityKeyword(ctx context.Context, userID string, kw VerbosityKeyword) (VerbosityKeyword, error) {
+	created, err := scanSQLiteVerbosityKeyword(s.db.QueryRowContext(ctx, `
+		INSERT INTO verbosity_escalation_keywords (user_id, keyword, agent, min_requested_verbosity, escalate_to, enabled, match_type, action, priority, min_length, max_length, code_block)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+verbosityKeywordColumns,
+		userID, kw.Keyword, kw.Agent, kw.MinRequested, kw.EscalateTo, kw.Enabled, kw.Match, kw.Action, kw.Priority, kw.MinLength, kw.MaxLength, kw.CodeBlock))
+	if err != nil {
+		return VerbosityKeyword{}, fmt.Errorf("create verbosity keyword: %w", err)
+	}
+	return created, nil
+}
+
+func (s *SQLiteStore) UpdateVerbosityKeyword(ctx context.Context, userID, keyword string, input VerbosityKeywordUpdate) (VerbosityKeyword, error) {
+	sets := make([]string, 0, 9)
+	args := make([]any, 0, 11)
+	set := func(column string, value any) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+
+	if input.MinRequested != nil {
+		set("min_requested_verbosity", *input.MinRequested)
+	}
+	if input.EscalateTo != nil {
+		set("escalate_to", *input.EscalateTo)
+	}
+	if input.Enabled != nil {
+		set("enabled", *input.Enabled)
+	}
+	if input.Match != nil {
+		set("match_type", *input.Match)
+	}
+	if input.Action != nil {
+		set("action", *input.Action)
+	}
+	if input.Priority != nil {
+		set("priority", *input.Priority)
+	}
+	if input.MinLength != nil {
+		set("min_length", *input.MinLength)
+	}
+	if input.MaxLength != nil {
+		set("max_length", *input.MaxLength)
+	}
+	if input.CodeBlock != nil {
+		set("code_block", *input.CodeBlock)
+	}
+
+	if len(sets) == 0 {
+		return VerbosityKeyword{}, fmt.Errorf("no fields to update")
+	}
+
+	args = append(args, userID, keyword)
+	kw, err := scanSQLiteVerbosityKeyword(s.db.QueryRowContext(ctx, `
+		UPDATE verbosity_escalation_keywords
+		SET `+strings.Join(sets, ", ")+`
+		WHERE user_id = ? AND keyword = ?
+		RETURNING `+verbosityKeywordColumns, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return VerbosityKeyword{}, sql.ErrNoRows
+		}
+		return VerbosityKeyword{}, fmt.Errorf("update verbosity keyword: %w", err)
+	}
+	return kw, nil
+}
+
+func (s *SQLiteStore) PutVerbosityKeywords(ctx context.Context, userID string, keywords []VerbosityKeyword, replaceAll bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replaceAll {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("delete verbosity keywords: %w", err)
+		}
+	}
+	for _, kw := range keywords {
+		if !replaceAll {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = ? AND keyword = ?`, userID, kw.Keyword); err != nil {
+				return fmt.Errorf("delete verbosity keyword %q: %w", kw.Keyword, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO verbosity_escalation_keywords (user_id, keyword, agent, min_requested_verbosity, escalate_to, enabled, match_type, action, priority, min_length, max_length, code_block)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, kw.Keyword, kw.Agent, kw.MinRequested, kw.EscalateTo, kw.Enabled, kw.Match, kw.Action, kw.Priority, kw.MinLength, kw.MaxLength, kw.CodeBlock); err != nil {
+			return fmt.Errorf("create verbosity keyword %q: %w", kw.Keyword, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteVerbosityKeyword(ctx context.Context, userID, keyword string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM verbosity_escalation_keywords WHERE user_id = ? AND keyword = ?`, userID, keyword)
+	if err != nil {
+		return fmt.Errorf("delete verbosity keyword: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err == nil && affected == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteVerbosityKeywords(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	agentName := "golang-dev"
+	if _, err := s.CreateVerbosityKeyword(ctx, LocalUserID, VerbosityKeyword{Keyword: "explain", EscalateTo: 3, Enabled: true, Match: MatchContains, Action: ActionEscalate, CodeBlock: CodeBlockAny}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateVerbosityKeyword(ctx, LocalUserID, VerbosityKeyword{Keyword: "tl;dr", Agent: &agentName, Enabled: true, Match: MatchWord, Action: ActionDeescalate, Priority: 5, CodeBlock: CodeBlockAny}); err != nil {
+		t.Fatal(err)
+	}
+
+	keywords, err := s.ListVerbosityKeywords(ctx, LocalUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keywords) != 2 || keywords[0].Keyword != "tl;dr" || keywords[0].Agent == nil || *keywords[0].Agent != agentName {
+		t.Fatalf("list = %+v", keywords)
+	}
+	if keywords[1].Agent != nil || keywords[1].CreatedAt.IsZero() {
+		t.Fatalf("explain = %+v", keywords[1])
+	}
+
+	disabled := false
+	updated, err := s.UpdateVerbosityKeyword(ctx, LocalUserID, "explain", VerbosityKeywordUpdate{Enabled: &disabled})
+	if err != nil || updated.Enabled {
+		t.Fatalf("update = %+v, %v", updated, err)
+	}
+
+	// Put replaces the rule with the same keyword
+	if err := PutVerbosityKeyword(ctx, s, LocalUserID, VerbosityKeyword{Keyword: "explain", EscalateTo: 4, Enabled: true, Match: MatchContains, Action: ActionEscalate, CodeBlock: CodeBlockAny}); err != nil {
+		t.Fatal(err)
+	}
+	if keywords, _ = s.ListVerbosityKeywords(ctx, LocalUserID); len(keywords) != 2 || keywords[1].EscalateTo != 4 {
+		t.Fatalf("after put = %+v", keywords)
+	}
+
+	if other, _ := s.ListVerbosityKeywords(ctx, "someone-else"); len(other) != 0 {
+		t.Fatalf("rules leaked to another user: %+v", other)
+	}
+	if err := s.DeleteVerbosityKeyword(ctx, LocalUserID, "missing"); err != sql.ErrNoRows {
+		t.Fatalf("delete missing = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSQLitePutVerbosityKeywordsIsAtomic(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	rule := func(keyword string, escalateTo int) VerbosityKeyword {
+		return VerbosityKeyword{Keyword: keyword, EscalateTo: escalateTo, Enabled: true, Match: MatchContains, Action: ActionEscalate, CodeBlock: CodeBlockAny}
+	}
+	if err := s.PutVerbosityKeywords(ctx, LocalUserID, []VerbosityKeyword{rule("explain", 3), rule("detail", 4)}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutVerbosityKeywords(ctx, LocalUserID, []VerbosityKeyword{rule("explain", 5)}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The duplicate fails the batch after "detail" was deleted
+	err = s.PutVerbosityKeywords(ctx, LocalUserID, []VerbosityKeyword{rule("new", 2), rule("new", 2)}, true)
+	if err == nil {
+		t.Fatal("duplicate keyword in one batch was accepted")
+	}
+
+	keywords, err := s.ListVerbosityKeywords(ctx, LocalUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, kw := range keywords {
+		got[kw.Keyword] = kw.EscalateTo
+	}
+	if len(got) != 2 || got["explain"] != 5 || got["detail"] != 4 {
+		t.Fatalf("rules after failed replace = %v, want explain=5 and detail=4", got)
+	}
+}
@@ -1,8 +1,10 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/earlysvahn/sidekick/internal/agent"
@@ -35,27 +37,15 @@ func SyncContexts(source, target store.HistoryStore, sourceName, targetName stri
 			continue
 		}
 
-		// Load target context to see what messages already exist
-		targetCtx, err := target.LoadContext(ctxInfo.Name)
+		inserted, err := syncMessageTree(source, target, ctxInfo.Name)
+		result.MessagesInserted += inserted
 		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("failed to load target context %s: %v", ctxInfo.Name, err))
+			result.Errors = append(result.Errors, err.Error())
 			continue
 		}
 
-		// Find messages that don't exist in target
-		newMessages := findNewMessages(sourceCtx.Messages, targetCtx.Messages)
-
-		// Insert new messages
-		for _, msg := range newMessages {
-			if err := target.Append(ctxInfo.Name, msg); err != nil {
-				result.Errors = append(result.Errors, fmt.Sprintf("failed to append message to %s: %v", ctxInfo.Name, err))
-				continue
-			}
-			result.MessagesInserted++
-		}
-
 		// Update system prompt after messages are ensured (avoids empty contexts).
-		if err := target.SaveContext(ctxInfo.Name, sourceCtx); err != nil {
+		if err := target.SaveSystem(ctxInfo.Name, sourceCtx.System); err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("failed to save context %s: %v", ctxInfo.Name, err))
 			continue
 		}
@@ -70,26 +60,61 @@ func SyncContexts(source, target store.HistoryStore, sourceName, targetName stri
 	return result, nil
 }
 
-// findNewMessages returns messages from source that don't exist in target
-// Messages are matched by: role, content, and created_at timestamp
-func findNewMessages(sourceMessages, targetMessages []store.Message) []store.Message {
-	// Build a set of existing messages for fast lookup
-	existing := make(map[string]bool)
-	for _, msg := range targetMessages {
-		key := messageKey(msg)
-		existing[key] = true
+// syncMessageTree copies the messages of every branch of a context that
+// the target lacks. IDs are per store, so parents are remapped to the
+// target's IDs; a message matches an existing one with the same key under
+// the same (remapped) parent. It returns the number of messages inserted.
+func syncMessageTree(source, target store.HistoryStore, contextName string) (int, error) {
+	sourceTree, err := source.LoadMessageTree(contextName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load context %s: %v", contextName, err)
+	}
+	targetTree, err := target.LoadMessageTree(contextName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load target context %s: %v", contextName, err)
+	}
+
+	existing := make(map[string]int64, len(targetTree))
+	for _, msg := range targetTree {
+		existing[treeKey(msg, msg.Parent())] = msg.ID
 	}
 
-	// Find messages that don't exist in target
-	var newMessages []store.Message
-	for _, msg := range sourceMessages {
-		key := messageKey(msg)
-		if !existing[key] {
-			newMessages = append(newMessages, msg)
+	// Parents are always older than their children
+	sourceTree = append([]store.Message(nil), sourceTree...)
+	sort.Slice(sourceTree, func(i, j int) bool { return sourceTree[i].ID < sourceTree[j].ID })
+
+	inserted := 0
+	targetIDs := make(map[int64]int64, len(sourceTree)) // source ID -> target ID
+	for _, msg := range sourceTree {
+		parent := targetIDs[msg.Parent()]
+		key := treeKey(msg, parent)
+		if id, ok := existing[key]; ok {
+			targetIDs[msg.ID] = id
+			continue
 		}
+
+		sourceID := msg.ID
+		msg.ID, msg.ParentID = 0, store.ParentRef(parent)
+		if err := target.Append(contextName, msg); err != nil {
+			return inserted, fmt.Errorf("failed to append message to %s: %v", contextName, err)
+		}
+		inserted++
+
+		// The message just appended is the newest, so it ends the
+		// target's active branch
+		latest, err := target.Load(contextName, 1)
+		if err != nil || len(latest) == 0 {
+			return inserted, fmt.Errorf("failed to read back message in %s: %v", contextName, err)
+		}
+		targetIDs[sourceID] = latest[0].ID
+		existing[key] = latest[0].ID
 	}
+	return inserted, nil
+}
 
-	return newMessages
+// treeKey identifies a message by its key and the ID of its parent.
+func treeKey(msg store.Message, parent int64) string {
+	return fmt.Sprintf("%d|%s", parent, messageKey(msg))
 }
 
 // messageKey generates a unique key for a message based on role, content, and timestamp
@@ -131,3 +156,17 @@ func AutoSyncAgents(sqliteDB *sql.DB) error {
 
 	return agent.SyncToPostgres(sqliteDB, postgresDB)
 }
+
+// SyncKeywords copies verbosity rules from one store to another, replacing
+// rules with the same keyword in the target. Rules only present in the target
+// are kept. The copy is all or nothing. Returns the number of rules copied.
+func SyncKeywords(ctx context.Context, source, target store.VerbosityKeywordStore, sourceUserID, targetUserID string) (int, error) {
+	keywords, err := source.ListVerbosityKeywords(ctx, sourceUserID)
+	if err != nil {
+		return 0, err
+	}
+	if err := target.PutVerbosityKeywords(ctx, targetUserID, keywords, false); err != nil {
+		return 0, fmt.Errorf("sync rules: %w", err)
+	}
+	return len(keywords), nil
+}
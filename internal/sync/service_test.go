@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/store"
+)
+
+func TestSyncContextsCopiesBranches(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	source := store.NewFileStore()
+	target, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, msg := range []store.Message{
+		{Role: "user", Content: "question", Time: at},
+		{Role: "assistant", Content: "first answer", Time: at.Add(time.Second)},
+		// A retry: a second answer to message 1
+		{Role: "assistant", Content: "second answer", Time: at.Add(2 * time.Second), ParentID: store.ParentRef(1)},
+	} {
+		if err := source.Append("c", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := SyncContexts(source, target, "file", "sqlite")
+	if err != nil {
+		t.Fatalf("sync: %v (%v)", err, result.Errors)
+	}
+	if result.MessagesInserted != 3 {
+		t.Fatalf("inserted %d messages, want 3", result.MessagesInserted)
+	}
+	tree, err := target.LoadMessageTree("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 3 || tree[1].Parent() != tree[0].ID || tree[2].Parent() != tree[0].ID {
+		t.Fatalf("target tree = %+v, want both answers under the question", tree)
+	}
+
+	result, err = SyncContexts(source, target, "file", "sqlite")
+	if err != nil || result.MessagesInserted != 0 {
+		t.Fatalf("second sync inserted %d messages (%v), want 0", result.MessagesInserted, err)
+	}
+}
+
+// putCounter records how a sync writes to its target store.
+type putCounter struct {
+	store.VerbosityKeywordStore
+	puts int
+}
+
+func (p *putCounter) PutVerbosityKeywords(ctx context.Context, userID string, keywords []store.VerbosityKeyword, replaceAll bool) error {
+	p.puts++
+	return p.VerbosityKeywordStore.PutVerbosityKeywords(ctx, userID, keywords, replaceAll)
+}
+
+func TestSyncKeywordsWritesOneBatch(t *testing.T) {
+	s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	rule := func(keyword string) store.VerbosityKeyword {
+		return store.VerbosityKeyword{Keyword: keyword, EscalateTo: 4, Enabled: true, Match: store.MatchContains, Action: store.ActionEscalate, CodeBlock: store.CodeBlockAny}
+	}
+	for _, kw := range []string{"explain", "benchmark"} {
+		if _, err := s.CreateVerbosityKeyword(ctx, "source", rule(kw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.CreateVerbosityKeyword(ctx, "target", rule("keep")); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &putCounter{VerbosityKeywordStore: s}
+	n, err := SyncKeywords(ctx, s, target, "source", "target")
+	if err != nil || n != 2 {
+		t.Fatalf("sync = %d, %v; want 2", n, err)
+	}
+	if target.puts != 1 {
+		t.Fatalf("target written in %d batches, want 1", target.puts)
+	}
+	// Rules only on the target survive a sync
+	if got, _ := s.ListVerbosityKeywords(ctx, "target"); len(got) != 3 {
+		t.Fatalf("target rules = %+v, want 3", got)
+	}
+}
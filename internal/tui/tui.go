@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,8 +17,11 @@ import (
 )
 
 type ExecutionResult struct {
-	Reply  string
-	Source string
+	Reply   string
+	Source  string
+	Model   string
+	Usage   executor.Usage
+	Latency time.Duration
 }
 
 type Config struct {
@@ -51,12 +55,15 @@ type model struct {
 	currentProfile interface{}
 	lastSource     string
 	verbosity      int
+
+	// replyParent is set while /retry runs: the stored question the new
+	// reply answers. The question itself is not stored again.
+	replyParent *int64
 }
 
 type responseMsg struct {
-	content string
-	source  string
-	err     error
+	result ExecutionResult
+	err    error
 }
 
 func Run(cfg Config) error {
@@ -203,6 +210,55 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
+			// /retry answers the last question again and /edit N replaces an
+			// earlier one; both start a new branch and keep the old turns.
+			if userInput == "/retry" {
+				m.textarea.Reset()
+				stored, pos := m.storedMessages()
+				i, ok := chat.RetryPoint(stored)
+				if !ok {
+					return m.notice("Nothing to retry"), nil
+				}
+				m.messages = m.messages[:pos[i]+1]
+				m.replyParent = store.ParentRef(stored[i].ID)
+				m.waiting = true
+				m.viewport.SetContent(m.renderMessages())
+				m.viewport.GotoBottom()
+				return m, m.executeChat(stored[i])
+			}
+			if userInput == "/edit" || strings.HasPrefix(userInput, "/edit ") {
+				numStr, text, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(userInput, "/edit")), " ")
+				n, err := strconv.Atoi(numStr)
+				if err != nil {
+					m.textarea.Reset()
+					return m.notice("Usage: /edit N [new message]"), nil
+				}
+				stored, pos := m.storedMessages()
+				i, err := chat.EditPoint(stored, n)
+				if err != nil {
+					m.textarea.Reset()
+					return m.notice(err.Error()), nil
+				}
+				text = strings.TrimSpace(text)
+				if text == "" {
+					// Load the old message into the input for editing
+					m.textarea.SetValue(fmt.Sprintf("/edit %d %s", n, stored[i].Content))
+					return m, nil
+				}
+				m.textarea.Reset()
+				userMsg := store.Message{
+					Role:     "user",
+					Content:  text,
+					Time:     time.Now().UTC(),
+					ParentID: store.ParentRef(stored[i].Parent()),
+				}
+				m.messages = append(m.messages[:pos[i]], userMsg)
+				m.waiting = true
+				m.viewport.SetContent(m.renderMessages())
+				m.viewport.GotoBottom()
+				return m, m.executeChat(userMsg)
+			}
+
 			// Add user message
 			now := time.Now().UTC()
 			userMsg := store.Message{Role: "user", Content: userInput, Time: now}
@@ -238,23 +294,36 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			assistantAgent := m.currentAgent
 			assistantVerbosity := m.verbosity
 			assistantMsg = store.Message{
-				Role:      "assistant",
-				Content:   msg.content,
-				Agent:     &assistantAgent,
-				Verbosity: &assistantVerbosity,
-				Time:      now,
+				Role:             "assistant",
+				Content:          msg.result.Reply,
+				Agent:            &assistantAgent,
+				Verbosity:        &assistantVerbosity,
+				Time:             now,
+				Model:            msg.result.Model,
+				Source:           msg.result.Source,
+				PromptTokens:     msg.result.Usage.PromptTokens,
+				CompletionTokens: msg.result.Usage.CompletionTokens,
+				LatencyMS:        msg.result.Latency.Milliseconds(),
 			}
 			// Store execution source
-			m.lastSource = msg.source
+			m.lastSource = msg.result.Source
 		}
 
 		m.messages = append(m.messages, assistantMsg)
 
-		// Persist both messages
+		// Persist both messages (only the reply on /retry)
 		if msg.err == nil {
-			_ = m.config.HistoryStore.Append(m.config.ContextName, m.messages[len(m.messages)-2])
+			stored := 2
+			if m.replyParent != nil {
+				assistantMsg.ParentID = m.replyParent
+				stored = 1
+			} else {
+				_ = m.config.HistoryStore.Append(m.config.ContextName, m.messages[len(m.messages)-2])
+			}
 			_ = m.config.HistoryStore.Append(m.config.ContextName, assistantMsg)
+			m.loadIDs(stored)
 		}
+		m.replyParent = nil
 
 		// Update view
 		m.viewport.SetContent(m.renderMessages())
@@ -358,6 +427,41 @@ func (m model) renderMessages() string {
 	return sb.String()
 }
 
+// storedMessages returns the stored messages shown, which form the active
+// branch, and their positions in m.messages.
+func (m model) storedMessages() ([]store.Message, []int) {
+	var stored []store.Message
+	var pos []int
+	for i, msg := range m.messages {
+		if msg.ID != 0 {
+			stored = append(stored, msg)
+			pos = append(pos, i)
+		}
+	}
+	return stored, pos
+}
+
+// loadIDs copies the IDs of the last n messages, just stored, from the
+// store so later /retry and /edit can branch from them.
+func (m *model) loadIDs(n int) {
+	h, err := m.config.HistoryStore.LoadContext(m.config.ContextName)
+	if err != nil || len(h.Messages) < n || len(m.messages) < n {
+		return
+	}
+	for i := 1; i <= n; i++ {
+		m.messages[len(m.messages)-i].ID = h.Messages[len(h.Messages)-i].ID
+		m.messages[len(m.messages)-i].ParentID = h.Messages[len(h.Messages)-i].ParentID
+	}
+}
+
+// notice shows a system message that is not stored.
+func (m model) notice(text string) model {
+	m.messages = append(m.messages, store.Message{Role: "system", Content: text, Time: time.Now().UTC()})
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+	return m
+}
+
 func (m model) executeChat(userMsg store.Message) tea.Cmd {
 	return func() tea.Msg {
 		// Inject system constraint based on current verbosity
@@ -389,8 +493,8 @@ func (m model) executeChat(userMsg store.Message) tea.Cmd {
 		// Execute
 		result, err := m.config.ExecuteFn(messages, m.verbosity)
 		if err != nil {
-			return responseMsg{content: "", source: "", err: err}
+			return responseMsg{err: err}
 		}
-		return responseMsg{content: result.Reply, source: result.Source, err: nil}
+		return responseMsg{result: result}
 	}
 }
@@ -0,0 +1,294 @@
+// Package usage accounts generated tokens per user, agent, model and UTC day
+// and enforces optional daily token quotas.
+//
+// Counts are kept in a daily rollup table that is incremented after every
+// generation. Recording is best-effort: a failed write is logged and never
+// fails the request that triggered it.
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+// ErrQuotaExceeded is returned by Check when a user has used up their daily
+// token quota.
+var ErrQuotaExceeded = errors.New("daily token quota exceeded")
+
+// Entry is the usage of one generation.
+type Entry struct {
+	UserID           string
+	Agent            string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Row is one aggregated usage row. Dimensions that were not grouped by are
+// empty.
+type Row struct {
+	UserID           string `json:"user_id,omitempty"`
+	Day              string `json:"day,omitempty"` // YYYY-MM-DD (UTC)
+	Agent            string `json:"agent,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+}
+
+// Dimensions that Query can group by.
+var Dimensions = []string{"user", "day", "agent", "model"}
+
+var dimensionColumns = map[string]string{
+	"user":  "user_id",
+	"day":   "day",
+	"agent": "agent",
+	"model": "model",
+}
+
+// Filter selects usage rows. Zero-value fields are ignored.
+type Filter struct {
+	UserID  string
+	Since   time.Time // inclusive day
+	Until   time.Time // inclusive day
+	GroupBy []string  // subset of Dimensions; empty means totals only
+}
+
+// InitSchema creates the usage_daily rollup table.
+// Safe to call on every startup (idempotent).
+func InitSchema(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS usage_daily (
+			user_id           TEXT    NOT NULL,
+			day               DATE    NOT NULL,
+			agent             TEXT    NOT NULL DEFAULT '',
+			model             TEXT    NOT NULL DEFAULT '',
+			requests          INTEGER NOT NULL DEFAULT 0,
+			prompt_tokens     BIGINT  NOT NULL DEFAULT 0,
+			completion_tokens BIGINT  NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, day, agent, model)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_usage_daily_day ON usage_daily(day);
+	`)
+	return err
+}
+
+// Tracker records usage and checks quotas. A nil Tracker records nothing
+// and allows everything.
+type Tracker struct {
+	db  *sql.DB
+	cfg config.QuotaConfig
+	now func() time.Time
+}
+
+// NewTracker returns a Tracker writing to db and enforcing cfg.
+func NewTracker(db *sql.DB, cfg config.QuotaConfig) *Tracker {
+	users := make(map[string]int, len(cfg.Users))
+	for k, v := range cfg.Users {
+		users[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	cfg.Users = users
+	return &Tracker{db: db, cfg: cfg, now: time.Now}
+}
+
+// Record adds e to today's rollup row.
+func (t *Tracker) Record(e Entry) {
+	if t == nil || t.db == nil || e.UserID == "" {
+		return
+	}
+	_, err := t.db.Exec(`
+		INSERT INTO usage_daily (user_id, day, agent, model, requests, prompt_tokens, completion_tokens)
+		VALUES ($1, $2, $3, $4, 1, $5, $6)
+		ON CONFLICT (user_id, day, agent, model) DO UPDATE SET
+			requests          = usage_daily.requests + 1,
+			prompt_tokens     = usage_daily.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = usage_daily.completion_tokens + EXCLUDED.completion_tokens
+	`, e.UserID, day(t.now()), e.Agent, e.Model, e.PromptTokens, e.CompletionTokens)
+	if err != nil {
+		slog.Error("usage write failed", "user", e.UserID, "err", err)
+	}
+}
+
+// Limit returns userID's daily token quota, or 0 when unlimited. Per-user
+// overrides may be keyed by user ID or email.
+func (t *Tracker) Limit(userID string) (int, error) {
+	if t == nil {
+		return 0, nil
+	}
+	if n, ok := t.cfg.Users[strings.ToLower(userID)]; ok {
+		return n, nil
+	}
+	if len(t.cfg.Users) > 0 && t.db != nil {
+		var email string
+		err := t.db.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("look up user: %w", err)
+		}
+		if n, ok := t.cfg.Users[strings.ToLower(email)]; ok && email != "" {
+			return n, nil
+		}
+	}
+	return t.cfg.DailyTokens, nil
+}
+
+// UsedToday returns the tokens userID has used since UTC midnight.
+func (t *Tracker) UsedToday(userID string) (int, error) {
+	if t == nil || t.db == nil {
+		return 0, nil
+	}
+	var used int
+	err := t.db.QueryRow(`
+		SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+		FROM usage_daily WHERE user_id = $1 AND day = $2
+	`, userID, day(t.now())).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("query usage: %w", err)
+	}
+	return used, nil
+}
+
+// Check returns ErrQuotaExceeded (wrapped with the numbers) when userID has
+// no tokens left today. Quotas are checked before a generation, so the
+// generation that crosses the limit is allowed to finish.
+func (t *Tracker) Check(userID string) error {
+	limit, err := t.Limit(userID)
+	if err != nil || limit <= 0 {
+		return err
+	}
+	used, err := t.UsedToday(userID)
+	if err != nil {
+		return err
+	}
+	if used >= limit {
+		return fmt.Errorf("%w (%d of %d tokens used)", ErrQuotaExceeded, used, limit)
+	}
+	return nil
+}
+
+// UntilReset returns the time left until quotas reset at UTC midnight.
+func (t *Tracker) UntilReset() time.Duration {
+	now := time.Now
+	if t != nil {
+		now = t.now
+	}
+	n := now().UTC()
+	midnight := time.Date(n.Year(), n.Month(), n.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(n)
+}
+
+// Query aggregates usage rows matching f, grouped by f.GroupBy and ordered
+// by the grouped dimensions (day descending).
+func Query(db *sql.DB, f Filter) ([]Row, error) {
+	var cols []string
+	for _, dim := range f.GroupBy {
+		col, ok := dimensionColumns[dim]
+		if !ok {
+			return nil, fmt.Errorf("unknown group %q (want one of %s)", dim, strings.Join(Dimensions, ", "))
+		}
+		cols = append(cols, col)
+	}
+
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != "" {
+		add("user_id = $%d", f.UserID)
+	}
+	if !f.Since.IsZero() {
+		add("day >= $%d", day(f.Since))
+	}
+	if !f.Until.IsZero() {
+		add("day <= $%d", day(f.Until))
+	}
+
+	selectCols := make([]string, 0, len(cols)+4)
+	for _, col := range cols {
+		if col == "day" {
+			selectCols = append(selectCols, "to_char(day, 'YYYY-MM-DD')")
+		} else {
+			selectCols = append(selectCols, col)
+		}
+	}
+	selectCols = append(selectCols,
+		"COALESCE(SUM(requests), 0)",
+		"COALESCE(SUM(prompt_tokens), 0)",
+		"COALESCE(SUM(completion_tokens), 0)")
+
+	query := "SELECT " + strings.Join(selectCols, ", ") + " FROM usage_daily"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if len(cols) > 0 {
+		query += " GROUP BY " + strings.Join(cols, ", ")
+		order := make([]string, len(cols))
+		for i, col := range cols {
+			order[i] = col
+			if col == "day" {
+				order[i] = "day DESC"
+			}
+		}
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Row
+	for rows.Next() {
+		var r Row
+		dest := make([]any, 0, len(cols)+3)
+		for _, col := range cols {
+			switch col {
+			case "user_id":
+				dest = append(dest, &r.UserID)
+			case "day":
+				dest = append(dest, &r.Day)
+			case "agent":
+				dest = append(dest, &r.Agent)
+			case "model":
+				dest = append(dest, &r.Model)
+			}
+		}
+		dest = append(dest, &r.Requests, &r.PromptTokens, &r.CompletionTokens)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ParseGroupBy splits a comma-separated list of dimensions.
+func ParseGroupBy(s string) ([]string, error) {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if _, ok := dimensionColumns[part]; !ok {
+			return nil, fmt.Errorf("unknown group %q (want one of %s)", part, strings.Join(Dimensions, ", "))
+		}
+		out = append(out, part)
+	}
+	return out, nil
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/earlysvahn/sidekick/internal/config"
+)
+
+func TestLimitPrefersPerUserOverride(t *testing.T) {
+	tr := NewTracker(nil, config.QuotaConfig{
+		DailyTokens: 1000,
+		Users:       map[string]int{"AAAA-1": 50},
+	})
+	if got, _ := tr.Limit("aaaa-1"); got != 50 {
+		t.Fatalf("Limit(override) = %d, want 50", got)
+	}
+	if got, _ := tr.Limit("bbbb-2"); got != 1000 {
+		t.Fatalf("Limit(default) = %d, want 1000", got)
+	}
+}
+
+func TestNilTrackerAllowsEverything(t *testing.T) {
+	var tr *Tracker
+	if err := tr.Check("u1"); err != nil {
+		t.Fatalf("Check on nil tracker: %v", err)
+	}
+	tr.Record(Entry{UserID: "u1", PromptTokens: 10})
+	if errors.Is(NewTracker(nil, config.QuotaConfig{}).Check("u1"), ErrQuotaExceeded) {
+		t.Fatal("zero quota must be unlimited")
+	}
+}
+
+func TestUntilReset(t *testing.T) {
+	tr := NewTracker(nil, config.QuotaConfig{})
+	tr.now = func() time.Time { return time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC) }
+	if got := tr.UntilReset(); got != 30*time.Minute {
+		t.Fatalf("UntilReset = %v, want 30m", got)
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	got, err := ParseGroupBy("day, Model")
+	if err != nil || len(got) != 2 || got[0] != "day" || got[1] != "model" {
+		t.Fatalf("ParseGroupBy = %v, %v", got, err)
+	}
+	if _, err := ParseGroupBy("day,host"); err == nil {
+		t.Fatal("expected error for unknown dimension")
+	}
+}
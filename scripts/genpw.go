@@ -1,7 +1,8 @@
 //go:build ignore
 
 // genpw generates a bcrypt hash for a plaintext password, suitable for
-// inserting directly into the users.password_hash column.
+// inserting directly into the users.password_hash column. Prefer
+// `sidekick users create|passwd`, which also handles roles and sessions.
 //
 // Usage:
 //